@@ -23,8 +23,8 @@ type userAccountDatabase[AccountID comparable] interface {
 
 type UserAccountForm[AccountID comparable] struct {
 	ID                       AccountID                            `json:"id"`
-	TotalDepts               *float64                             `json:"total_depts,omitempty"`
-	TotalDeptsWithoutPenalty *float64                             `json:"total_depts_without_penalty,omitempty"`
+	TotalDepts               *Money                               `json:"total_depts,omitempty"`
+	TotalDeptsWithoutPenalty *Money                               `json:"total_depts_without_penalty,omitempty"`
 	AddressCount             *uint64                              `json:"address_count,omitempty"`
 	Bio                      *string                              `json:"bio,omitempty"`
 	DefaultAddress           *BuiltinUserAddress[AccountID]       `json:"default_address,omitempty"`
@@ -40,8 +40,8 @@ type UserAccountForm[AccountID comparable] struct {
 	ShoppingCartCount        *uint64                              `json:"shopping_cart_count,omitempty"`
 	Token                    *string                              `json:"token,omitempty"`
 	UserLevel                *int64                               `json:"user_level,omitempty"`
-	WalletCurrency           *float64                             `json:"wallet_currency,omitempty"`
-	Penalty                  *float64                             `json:"penalty,omitempty"`
+	WalletCurrency           *Money                               `json:"wallet_currency,omitempty"`
+	Penalty                  *Money                               `json:"penalty,omitempty"`
 	IsActiveState            *bool                                `json:"is_active_state,omitempty"`
 	IsBannedState            *string                              `json:"is_banned_state,omitempty"`
 	IsSuperUserState         *bool                                `json:"is_super_user_state,omitempty"`
@@ -50,10 +50,16 @@ type UserAccountForm[AccountID comparable] struct {
 
 type BuiltinUserAccount[AccountID comparable] struct {
 	UserAccountForm[AccountID]
-	DB                 userAccountDatabase[AccountID] `json:"-"`
-	FS                 FileStorage                    `json:"-"`
-	OrderStatusManager OrderStatusManager             `json:"-"`
-	MU                 sync.RWMutex                   `json:"-"`
+	DB                     userAccountDatabase[AccountID]    `json:"-"`
+	FS                     FileStorage                       `json:"-"`
+	OrderStatusManager     OrderStatusManager                `json:"-"`
+	TaxCalculator          TaxCalculator                     `json:"-"`
+	ShippingRateCalculator ShippingRateCalculator            `json:"-"`
+	PromotionCalculator    PromotionCalculator               `json:"-"`
+	PaymentGateways        PaymentGatewayRegistry[AccountID] `json:"-"`
+	InvoiceRenderer        InvoiceRenderer                   `json:"-"`
+	InvoiceSeller          InvoiceParty                      `json:"-"`
+	MU                     sync.RWMutex                      `json:"-"`
 }
 
 func (account *BuiltinUserAccount[AccountID]) AllowTrading(ctx context.Context, state bool) error {
@@ -100,7 +106,7 @@ func (account *BuiltinUserAccount[AccountID]) Ban(ctx context.Context, till time
 	return nil
 }
 
-func (account *BuiltinUserAccount[AccountID]) CalculateTotalDepts(ctx context.Context) (currency float64, err error) {
+func (account *BuiltinUserAccount[AccountID]) CalculateTotalDepts(ctx context.Context) (currency Money, err error) {
 	account.MU.RLock()
 	if account.TotalDepts != nil {
 		defer account.MU.RUnlock()
@@ -109,18 +115,18 @@ func (account *BuiltinUserAccount[AccountID]) CalculateTotalDepts(ctx context.Co
 	account.MU.RUnlock()
 	id, err := account.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := account.UserAccountForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	depts, err := account.DB.CalculateUserAccountTotalDepts(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := account.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	account.MU.Lock()
 	defer account.MU.Unlock()
@@ -128,7 +134,7 @@ func (account *BuiltinUserAccount[AccountID]) CalculateTotalDepts(ctx context.Co
 	return depts, nil
 }
 
-func (account *BuiltinUserAccount[AccountID]) CalculateTotalDeptsWithoutPenalty(ctx context.Context) (currency float64, err error) {
+func (account *BuiltinUserAccount[AccountID]) CalculateTotalDeptsWithoutPenalty(ctx context.Context) (currency Money, err error) {
 	account.MU.RLock()
 	if account.TotalDeptsWithoutPenalty != nil {
 		defer account.MU.RUnlock()
@@ -137,18 +143,18 @@ func (account *BuiltinUserAccount[AccountID]) CalculateTotalDeptsWithoutPenalty(
 	account.MU.RUnlock()
 	id, err := account.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := account.UserAccountForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	depts, err := account.DB.CalculateUserAccountTotalDeptsWithoutPenalty(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := account.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	account.MU.Lock()
 	defer account.MU.Unlock()
@@ -156,7 +162,7 @@ func (account *BuiltinUserAccount[AccountID]) CalculateTotalDeptsWithoutPenalty(
 	return depts, nil
 }
 
-func (account *BuiltinUserAccount[AccountID]) ChargeWallet(ctx context.Context, currency float64) error {
+func (account *BuiltinUserAccount[AccountID]) ChargeWallet(ctx context.Context, currency Money, entry *WalletEntry[AccountID], idempotencyKey string) error {
 	id, err := account.GetID(ctx)
 	if err != nil {
 		return err
@@ -165,7 +171,7 @@ func (account *BuiltinUserAccount[AccountID]) ChargeWallet(ctx context.Context,
 	if err != nil {
 		return err
 	}
-	if err := account.DB.ChargeUserAccountWallet(ctx, &form, id, currency); err != nil {
+	if err := account.DB.ChargeUserAccountWallet(ctx, &form, id, currency, entry, idempotencyKey); err != nil {
 		return err
 	}
 	if err := account.ApplyFormObject(ctx, &form); err != nil {
@@ -185,7 +191,7 @@ func (account *BuiltinUserAccount[AccountID]) Close(ctx context.Context) error {
 	return nil
 }
 
-func (account *BuiltinUserAccount[AccountID]) Fine(ctx context.Context, amount float64) error {
+func (account *BuiltinUserAccount[AccountID]) Fine(ctx context.Context, amount Money, entry *WalletEntry[AccountID]) error {
 	id, err := account.GetID(ctx)
 	if err != nil {
 		return err
@@ -194,7 +200,7 @@ func (account *BuiltinUserAccount[AccountID]) Fine(ctx context.Context, amount f
 	if err != nil {
 		return err
 	}
-	if err := account.DB.FineUserAccount(ctx, &form, id, amount); err != nil {
+	if err := account.DB.FineUserAccount(ctx, &form, id, amount, entry); err != nil {
 		return err
 	}
 	if err := account.ApplyFormObject(ctx, &form); err != nil {
@@ -542,6 +548,7 @@ func (account *BuiltinUserAccount[AccountID]) newOrder(ctx context.Context, oid
 		DB:                 db,
 		FS:                 account.FS,
 		OrderStatusManager: account.OrderStatusManager,
+		PaymentGateways:    account.PaymentGateways,
 	}
 	if err := order.Init(ctx); err != nil {
 		return nil, err
@@ -790,9 +797,13 @@ func (account *BuiltinUserAccount[AccountID]) newShoppingCart(ctx context.Contex
 		return nil, err
 	}
 	cart := &BuiltinUserShoppingCart[AccountID]{
-		DB:                 db,
-		FS:                 account.FS,
-		OrderStatusManager: account.OrderStatusManager,
+		DB:                     db,
+		FS:                     account.FS,
+		OrderStatusManager:     account.OrderStatusManager,
+		TaxCalculator:          account.TaxCalculator,
+		ShippingRateCalculator: account.ShippingRateCalculator,
+		PromotionCalculator:    account.PromotionCalculator,
+		PaymentGateways:        account.PaymentGateways,
 		UserShoppingCartForm: UserShoppingCartForm[AccountID]{
 			ID:            id,
 			UserAccountID: aid,
@@ -898,7 +909,7 @@ func (account *BuiltinUserAccount[AccountID]) GetUserLevel(ctx context.Context)
 	return level, nil
 }
 
-func (account *BuiltinUserAccount[AccountID]) GetWalletCurrency(ctx context.Context) (float64, error) {
+func (account *BuiltinUserAccount[AccountID]) GetWalletCurrency(ctx context.Context) (Money, error) {
 	account.MU.RLock()
 	if account.WalletCurrency != nil {
 		defer account.MU.RUnlock()
@@ -907,18 +918,18 @@ func (account *BuiltinUserAccount[AccountID]) GetWalletCurrency(ctx context.Cont
 	account.MU.RUnlock()
 	id, err := account.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := account.UserAccountForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	currency, err := account.DB.GetUserAccountWalletCurrency(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := account.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	account.MU.Lock()
 	defer account.MU.Unlock()
@@ -1469,7 +1480,7 @@ func (account *BuiltinUserAccount[AccountID]) SetPassword(ctx context.Context, p
 	return nil
 }
 
-func (account *BuiltinUserAccount[AccountID]) SetPenalty(ctx context.Context, penalty float64) error {
+func (account *BuiltinUserAccount[AccountID]) SetPenalty(ctx context.Context, penalty Money, entry *WalletEntry[AccountID]) error {
 	id, err := account.GetID(ctx)
 	if err != nil {
 		return err
@@ -1478,7 +1489,7 @@ func (account *BuiltinUserAccount[AccountID]) SetPenalty(ctx context.Context, pe
 	if err != nil {
 		return err
 	}
-	if err := account.DB.SetUserAccountPenalty(ctx, &form, id, penalty); err != nil {
+	if err := account.DB.SetUserAccountPenalty(ctx, &form, id, penalty, entry); err != nil {
 		return err
 	}
 	if err := account.ApplyFormObject(ctx, &form); err != nil {
@@ -1640,7 +1651,7 @@ func (account *BuiltinUserAccount[AccountID]) SetUserLevel(ctx context.Context,
 	return nil
 }
 
-func (account *BuiltinUserAccount[AccountID]) SetWalletCurrency(ctx context.Context, currency float64) error {
+func (account *BuiltinUserAccount[AccountID]) SetWalletCurrency(ctx context.Context, currency Money, entry *WalletEntry[AccountID]) error {
 	id, err := account.GetID(ctx)
 	if err != nil {
 		return err
@@ -1649,7 +1660,7 @@ func (account *BuiltinUserAccount[AccountID]) SetWalletCurrency(ctx context.Cont
 	if err != nil {
 		return err
 	}
-	if err := account.DB.SetUserAccountWalletCurrency(ctx, &form, id, currency); err != nil {
+	if err := account.DB.SetUserAccountWalletCurrency(ctx, &form, id, currency, entry); err != nil {
 		return err
 	}
 	if err := account.ApplyFormObject(ctx, &form); err != nil {
@@ -1662,7 +1673,7 @@ func (account *BuiltinUserAccount[AccountID]) SetWalletCurrency(ctx context.Cont
 	return nil
 }
 
-func (account *BuiltinUserAccount[AccountID]) TransferCurrency(ctx context.Context, to UserAccount[AccountID], amount float64) error {
+func (account *BuiltinUserAccount[AccountID]) TransferCurrency(ctx context.Context, to UserAccount[AccountID], amount Money, entry *WalletEntry[AccountID], idempotencyKey string) error {
 	aid, err := to.GetID(ctx)
 	if err != nil {
 		return err
@@ -1675,7 +1686,7 @@ func (account *BuiltinUserAccount[AccountID]) TransferCurrency(ctx context.Conte
 	if err != nil {
 		return err
 	}
-	if err := account.DB.TransferUserAccountCurrency(ctx, &form, id, aid, amount); err != nil {
+	if err := account.DB.TransferUserAccountCurrency(ctx, &form, id, aid, amount, entry, idempotencyKey); err != nil {
 		return err
 	}
 	if err := account.ApplyFormObject(ctx, &form); err != nil {
@@ -1688,6 +1699,47 @@ func (account *BuiltinUserAccount[AccountID]) TransferCurrency(ctx context.Conte
 	return nil
 }
 
+func (account *BuiltinUserAccount[AccountID]) GetWalletTransactions(ctx context.Context, transactions []WalletTransaction[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]WalletTransaction[AccountID], error) {
+	id, err := account.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := account.UserAccountForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if transactions == nil {
+		transactions = make([]WalletTransaction[AccountID], 0, GetSafeLimit(limit))
+	}
+	transactions, err = account.DB.GetUserAccountWalletTransactions(ctx, &form, id, transactions, skip, limit, queueOrder)
+	if err != nil {
+		return nil, err
+	}
+	if err := account.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+func (account *BuiltinUserAccount[AccountID]) GetWalletTransactionCount(ctx context.Context) (uint64, error) {
+	id, err := account.GetID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	form, err := account.UserAccountForm.Clone(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count, err := account.DB.GetUserAccountWalletTransactionCount(ctx, &form, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := account.ApplyFormObject(ctx, &form); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 func (account *BuiltinUserAccount[AccountID]) Unban(ctx context.Context) error {
 	id, err := account.GetID(ctx)
 	if err != nil {
@@ -1921,7 +1973,10 @@ func (account *BuiltinUserAccount[AccountID]) newUserFactor(ctx context.Context,
 			ID:            fid,
 			UserAccountID: aid,
 		},
-		DB: db,
+		DB:              db,
+		FS:              account.FS,
+		InvoiceRenderer: account.InvoiceRenderer,
+		InvoiceSeller:   account.InvoiceSeller,
 	}
 	if err := factor.Init(ctx); err != nil {
 		return nil, err
@@ -2005,7 +2060,7 @@ func (account *BuiltinUserAccount[AccountID]) GetUserFactorCount(ctx context.Con
 	return count, nil
 }
 
-func (account *BuiltinUserAccount[AccountID]) NewDiscount(ctx context.Context, value float64, validCount int64) (UserDiscount[AccountID], error) {
+func (account *BuiltinUserAccount[AccountID]) NewDiscount(ctx context.Context, value Money, validCount int64) (UserDiscount[AccountID], error) {
 	id, err := account.GetID(ctx)
 	if err != nil {
 		return nil, err
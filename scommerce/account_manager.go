@@ -16,11 +16,17 @@ type userAccountManagerDatabase[AccountID comparable] interface {
 }
 
 type BuiltinUserAccountManager[AccountID comparable] struct {
-	DB                 userAccountManagerDatabase[AccountID]
-	FS                 FileStorage
-	OTP                *otp.OTP
-	OTPTTL             time.Duration
-	OrderStatusManager OrderStatusManager
+	DB                     userAccountManagerDatabase[AccountID]
+	FS                     FileStorage
+	OTP                    *otp.OTP
+	OTPTTL                 time.Duration
+	OrderStatusManager     OrderStatusManager
+	TaxCalculator          TaxCalculator
+	ShippingRateCalculator ShippingRateCalculator
+	PromotionCalculator    PromotionCalculator
+	PaymentGateways        PaymentGatewayRegistry[AccountID]
+	InvoiceRenderer        InvoiceRenderer
+	InvoiceSeller          InvoiceParty
 }
 
 func NewBuiltinUserAccountManager[AccountID comparable](
@@ -30,6 +36,12 @@ func NewBuiltinUserAccountManager[AccountID comparable](
 	tokenLength int32,
 	otpTTL time.Duration,
 	osm OrderStatusManager,
+	taxCalculator TaxCalculator,
+	shippingRateCalculator ShippingRateCalculator,
+	promotionCalculator PromotionCalculator,
+	paymentGateways PaymentGatewayRegistry[AccountID],
+	invoiceRenderer InvoiceRenderer,
+	invoiceSeller InvoiceParty,
 ) (*BuiltinUserAccountManager[AccountID], error) {
 	otpDB, err := otp.NewInMemoryOTPDatabase()
 	if err != nil {
@@ -40,11 +52,17 @@ func NewBuiltinUserAccountManager[AccountID comparable](
 		return nil, err
 	}
 	return &BuiltinUserAccountManager[AccountID]{
-		DB:                 db,
-		OTP:                otpObj,
-		OTPTTL:             otpTTL,
-		FS:                 fs,
-		OrderStatusManager: osm,
+		DB:                     db,
+		OTP:                    otpObj,
+		OTPTTL:                 otpTTL,
+		FS:                     fs,
+		OrderStatusManager:     osm,
+		TaxCalculator:          taxCalculator,
+		ShippingRateCalculator: shippingRateCalculator,
+		PromotionCalculator:    promotionCalculator,
+		PaymentGateways:        paymentGateways,
+		InvoiceRenderer:        invoiceRenderer,
+		InvoiceSeller:          invoiceSeller,
 	}, nil
 }
 
@@ -53,9 +71,15 @@ func (accountManager *BuiltinUserAccountManager[AccountID]) newUserAccount(ctx c
 		UserAccountForm: UserAccountForm[AccountID]{
 			ID: id,
 		},
-		DB:                 db,
-		FS:                 accountManager.FS,
-		OrderStatusManager: accountManager.OrderStatusManager,
+		DB:                     db,
+		FS:                     accountManager.FS,
+		OrderStatusManager:     accountManager.OrderStatusManager,
+		TaxCalculator:          accountManager.TaxCalculator,
+		ShippingRateCalculator: accountManager.ShippingRateCalculator,
+		PromotionCalculator:    accountManager.PromotionCalculator,
+		PaymentGateways:        accountManager.PaymentGateways,
+		InvoiceRenderer:        accountManager.InvoiceRenderer,
+		InvoiceSeller:          accountManager.InvoiceSeller,
 	}
 	if err := account.Init(ctx); err != nil {
 		return nil, err
@@ -171,7 +195,14 @@ func (accountManager *BuiltinUserAccountManager[AccountID]) NewAccount(ctx conte
 }
 
 func (accountManager *BuiltinUserAccountManager[AccountID]) Pulse(ctx context.Context) error {
-	return accountManager.OTP.Collect()
+	return errors.Join(
+		accountManager.OTP.Collect(),
+		accountManager.DB.RemoveExpiredIdempotencyKeys(ctx, time.Now()),
+	)
+}
+
+func (accountManager *BuiltinUserAccountManager[AccountID]) ReconcileWallets(ctx context.Context) (*WalletReconciliation[AccountID], error) {
+	return accountManager.DB.ReconcileUserAccountWallets(ctx)
 }
 
 func (accountManager *BuiltinUserAccountManager[AccountID]) RemoveAccount(ctx context.Context, account UserAccount[AccountID]) error {
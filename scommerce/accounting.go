@@ -0,0 +1,446 @@
+package scommerce
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknownAccountingRecordKind = errors.New("unknown accounting record kind")
+var ErrUnknownAccountingField = errors.New("unknown accounting field")
+var ErrUnsupportedAccountingFormat = errors.New("unsupported accounting export format")
+
+var _ AccountingManager[any] = &BuiltinAccountingManager[any]{}
+
+// DefaultAccountingExportBatchSize is the number of records ExportAccounting reads at once when the options don't say.
+const DefaultAccountingExportBatchSize = 500
+
+type AccountingRecordKind string
+
+const (
+	AccountingRecordFactor AccountingRecordKind = "factor" // an issued factor
+	AccountingRecordRefund AccountingRecordKind = "refund" // a credit note
+	AccountingRecordWallet AccountingRecordKind = "wallet" // a wallet transaction
+)
+
+type AccountingExportFormat string
+
+const (
+	AccountingExportCSV   AccountingExportFormat = "csv"
+	AccountingExportJSONL AccountingExportFormat = "jsonl" // JSON Lines, one object per record
+)
+
+// AccountingPayment is the part of a record paid through a payment type, the name of the
+// payment type of the payment method or the gateway for payments without one, like "wallet".
+type AccountingPayment struct {
+	PaymentType string `json:"payment_type"`
+	Amount      Money  `json:"amount"`
+}
+
+// AccountingRecord is a factor, a refund or a wallet movement as finance sees it. Amounts are signed:
+// factors are positive, refunds negative and wallet transactions as they changed the wallet.
+type AccountingRecord[AccountID comparable] struct {
+	Kind          AccountingRecordKind `json:"kind"`
+	ID            uint64               `json:"id"`         // id of the factor, credit note or wallet transaction
+	CreatedAt     time.Time            `json:"created_at"` // issue time of factors
+	AccountID     AccountID            `json:"account_id"`
+	OrderID       uint64               `json:"order_id,omitempty"`
+	FactorID      uint64               `json:"factor_id,omitempty"`
+	InvoiceNumber string               `json:"invoice_number,omitempty"` // of the factor, or the factor a refund reverses
+	Type          string               `json:"type,omitempty"`           // WalletTransactionType of wallet records
+	Description   string               `json:"description,omitempty"`    // reason of refunds
+	Amount        Money                `json:"amount"`
+	Discount      Money                `json:"discount"`
+	Tax           Money                `json:"tax"`
+	TaxLines      []TaxLine            `json:"tax_lines,omitempty"` // refunds reverse the factor's in proportion to their amount
+	Payments      []AccountingPayment  `json:"payments,omitempty"`  // refunds follow the payments the order was paid back through
+	BalanceAfter  Money                `json:"balance_after"`       // of the wallet
+	Counterparty  string               `json:"counterparty,omitempty"`
+	ReferenceType string               `json:"reference_type,omitempty"`
+	ReferenceID   string               `json:"reference_id,omitempty"`
+}
+
+// Cursor returns the position right after the record.
+func (record *AccountingRecord[AccountID]) Cursor() AccountingCursor {
+	return AccountingCursor{At: record.CreatedAt, ID: record.ID}
+}
+
+// AccountingCursor is a position in the records of a kind, which are ordered by time and id.
+// AccountingCursor{At: from} is right before the first record at or after from.
+type AccountingCursor struct {
+	At time.Time `json:"at"`
+	ID uint64    `json:"id"`
+}
+
+// AccountingColumn maps a field of the records to a CSV column or a key of the JSON Lines objects.
+//
+// The fields are kind, id, created_at, account_id, order_id, factor_id, invoice_number, type, description,
+// currency, amount, discount, tax, net (amount without tax), balance_after, counterparty, reference_type and
+// reference_id. "tax:<rate>" is the tax at a rate in percent, like "tax:9", and "payment:<payment type>" the
+// amount paid through a payment type, like "payment:wallet". Amounts are in major units and times in RFC 3339.
+type AccountingColumn struct {
+	Header string `json:"header"`
+	Field  string `json:"field"`
+}
+
+type AccountingExportOptions struct {
+	Kind      AccountingRecordKind   `json:"kind"`
+	From      time.Time              `json:"from"`
+	To        time.Time              `json:"to"` // excluded
+	Format    AccountingExportFormat `json:"format"`
+	Columns   []AccountingColumn     `json:"columns"`    // nil uses DefaultAccountingColumns for CSV and every field of the records for JSON Lines
+	BatchSize int64                  `json:"batch_size"` // DefaultAccountingExportBatchSize when zero
+}
+
+// AccountingTotals sums the exported records, by tax in the order the taxes first appear and by payment type.
+type AccountingTotals struct {
+	Kind     AccountingRecordKind `json:"kind"`
+	From     time.Time            `json:"from"`
+	To       time.Time            `json:"to"`
+	Count    uint64               `json:"count"`
+	Amount   Money                `json:"amount"`
+	Tax      Money                `json:"tax"`
+	Taxes    []InvoiceTax         `json:"taxes"`
+	Payments []AccountingPayment  `json:"payments"`
+}
+
+// DefaultAccountingColumns returns the CSV columns of a kind of records.
+func DefaultAccountingColumns(kind AccountingRecordKind) []AccountingColumn {
+	switch kind {
+	case AccountingRecordFactor:
+		return []AccountingColumn{
+			{Header: "invoice_number", Field: "invoice_number"},
+			{Header: "issued_at", Field: "created_at"},
+			{Header: "account_id", Field: "account_id"},
+			{Header: "order_id", Field: "order_id"},
+			{Header: "currency", Field: "currency"},
+			{Header: "net", Field: "net"},
+			{Header: "discount", Field: "discount"},
+			{Header: "tax", Field: "tax"},
+			{Header: "amount", Field: "amount"},
+		}
+	case AccountingRecordRefund:
+		return []AccountingColumn{
+			{Header: "credit_note_id", Field: "id"},
+			{Header: "created_at", Field: "created_at"},
+			{Header: "invoice_number", Field: "invoice_number"},
+			{Header: "account_id", Field: "account_id"},
+			{Header: "order_id", Field: "order_id"},
+			{Header: "currency", Field: "currency"},
+			{Header: "net", Field: "net"},
+			{Header: "tax", Field: "tax"},
+			{Header: "amount", Field: "amount"},
+			{Header: "reason", Field: "description"},
+		}
+	case AccountingRecordWallet:
+		return []AccountingColumn{
+			{Header: "transaction_id", Field: "id"},
+			{Header: "created_at", Field: "created_at"},
+			{Header: "account_id", Field: "account_id"},
+			{Header: "type", Field: "type"},
+			{Header: "currency", Field: "currency"},
+			{Header: "amount", Field: "amount"},
+			{Header: "balance_after", Field: "balance_after"},
+			{Header: "counterparty", Field: "counterparty"},
+			{Header: "reference_type", Field: "reference_type"},
+			{Header: "reference_id", Field: "reference_id"},
+			{Header: "description", Field: "description"},
+		}
+	}
+	return nil
+}
+
+type accountingManagerDatabase[AccountID comparable] interface {
+	DBAccountingManager[AccountID]
+}
+
+type BuiltinAccountingManager[AccountID comparable] struct {
+	DB accountingManagerDatabase[AccountID]
+}
+
+func NewBuiltinAccountingManager[AccountID comparable](db accountingManagerDatabase[AccountID]) *BuiltinAccountingManager[AccountID] {
+	return &BuiltinAccountingManager[AccountID]{
+		DB: db,
+	}
+}
+
+func (accountingManager *BuiltinAccountingManager[AccountID]) Close(ctx context.Context) error {
+	return nil
+}
+
+// ExportAccounting streams the records of a kind from options.From until options.To to w, reading them in batches.
+func (accountingManager *BuiltinAccountingManager[AccountID]) ExportAccounting(ctx context.Context, options *AccountingExportOptions, w io.Writer) (*AccountingTotals, error) {
+	if DefaultAccountingColumns(options.Kind) == nil {
+		return nil, ErrUnknownAccountingRecordKind
+	}
+	columns := options.Columns
+	if columns == nil && options.Format == AccountingExportCSV {
+		columns = DefaultAccountingColumns(options.Kind)
+	}
+	for _, column := range columns {
+		if _, err := accountingField(&AccountingRecord[AccountID]{}, column.Field); err != nil {
+			return nil, err
+		}
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultAccountingExportBatchSize
+	}
+
+	var writeRecord func(record *AccountingRecord[AccountID]) error
+	var flush func() error
+	switch options.Format {
+	case AccountingExportCSV:
+		writer := csv.NewWriter(w)
+		header := make([]string, 0, len(columns))
+		for _, column := range columns {
+			header = append(header, column.Header)
+		}
+		if err := writer.Write(header); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(columns))
+		writeRecord = func(record *AccountingRecord[AccountID]) error {
+			for i, column := range columns {
+				row[i], _ = accountingField(record, column.Field)
+			}
+			return writer.Write(row)
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case AccountingExportJSONL:
+		writer := bufio.NewWriter(w)
+		writeRecord = func(record *AccountingRecord[AccountID]) error {
+			line, err := accountingJSONLine(record, columns)
+			if err != nil {
+				return err
+			}
+			_, err = writer.Write(append(line, '\n'))
+			return err
+		}
+		flush = writer.Flush
+	default:
+		return nil, ErrUnsupportedAccountingFormat
+	}
+
+	totals := newAccountingTotalsBuilder[AccountID](options)
+	cursor := AccountingCursor{At: options.From}
+	records := make([]AccountingRecord[AccountID], 0, batchSize)
+	for {
+		var err error
+		records, err = accountingManager.DB.GetAccountingRecords(ctx, options.Kind, cursor, options.To, records[:0], batchSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range records {
+			if err := totals.add(&records[i]); err != nil {
+				return nil, err
+			}
+			if err := writeRecord(&records[i]); err != nil {
+				return nil, err
+			}
+		}
+		if int64(len(records)) < batchSize {
+			break
+		}
+		cursor = records[len(records)-1].Cursor()
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return totals.build(), nil
+}
+
+// GetAccountingRecords returns up to limit records of a kind after the cursor and before to.
+// Pass the Cursor of the last record to get the next ones.
+func (accountingManager *BuiltinAccountingManager[AccountID]) GetAccountingRecords(ctx context.Context, kind AccountingRecordKind, cursor AccountingCursor, to time.Time, records []AccountingRecord[AccountID], limit int64) ([]AccountingRecord[AccountID], error) {
+	return accountingManager.DB.GetAccountingRecords(ctx, kind, cursor, to, records, GetSafeLimit(limit))
+}
+
+func (accountingManager *BuiltinAccountingManager[AccountID]) Init(ctx context.Context) error {
+	return accountingManager.DB.InitAccountingManager(ctx)
+}
+
+func (accountingManager *BuiltinAccountingManager[AccountID]) Pulse(ctx context.Context) error {
+	return nil
+}
+
+func (accountingManager *BuiltinAccountingManager[AccountID]) ToBuiltinObject(ctx context.Context) (*BuiltinAccountingManager[AccountID], error) {
+	return accountingManager, nil
+}
+
+func accountingField[AccountID comparable](record *AccountingRecord[AccountID], field string) (string, error) {
+	switch field {
+	case "kind":
+		return string(record.Kind), nil
+	case "id":
+		return strconv.FormatUint(record.ID, 10), nil
+	case "created_at":
+		return record.CreatedAt.Format(time.RFC3339), nil
+	case "account_id":
+		return accountingAccountID(record.AccountID), nil
+	case "order_id":
+		return accountingID(record.OrderID), nil
+	case "factor_id":
+		return accountingID(record.FactorID), nil
+	case "invoice_number":
+		return record.InvoiceNumber, nil
+	case "type":
+		return record.Type, nil
+	case "description":
+		return record.Description, nil
+	case "currency":
+		return record.Amount.Currency, nil
+	case "amount":
+		return record.Amount.Decimal(), nil
+	case "discount":
+		return record.Discount.Decimal(), nil
+	case "tax":
+		return record.Tax.Decimal(), nil
+	case "net":
+		net, err := record.Amount.Sub(record.Tax)
+		if err != nil {
+			return "", err
+		}
+		return net.Decimal(), nil
+	case "balance_after":
+		return record.BalanceAfter.Decimal(), nil
+	case "counterparty":
+		return record.Counterparty, nil
+	case "reference_type":
+		return record.ReferenceType, nil
+	case "reference_id":
+		return record.ReferenceID, nil
+	}
+
+	if rate, ok := strings.CutPrefix(field, "tax:"); ok {
+		sum := Money{Currency: record.Amount.Currency}
+		for _, line := range record.TaxLines {
+			if formatRatePercent(line.Rate) == rate {
+				sum.Amount += line.Amount.Amount
+			}
+		}
+		return sum.Decimal(), nil
+	}
+	if paymentType, ok := strings.CutPrefix(field, "payment:"); ok {
+		sum := Money{Currency: record.Amount.Currency}
+		for _, payment := range record.Payments {
+			if payment.PaymentType == paymentType {
+				sum.Amount += payment.Amount.Amount
+			}
+		}
+		return sum.Decimal(), nil
+	}
+	return "", errors.Join(ErrUnknownAccountingField, errors.New(field))
+}
+
+// accountingJSONLine marshals the whole record without columns, otherwise an object with a key per column in their order.
+func accountingJSONLine[AccountID comparable](record *AccountingRecord[AccountID], columns []AccountingColumn) ([]byte, error) {
+	if columns == nil {
+		return json.Marshal(record)
+	}
+	line := []byte{'{'}
+	for i, column := range columns {
+		value, err := accountingField(record, column.Field)
+		if err != nil {
+			return nil, err
+		}
+		key, err := json.Marshal(column.Header)
+		if err != nil {
+			return nil, err
+		}
+		text, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if i != 0 {
+			line = append(line, ',')
+		}
+		line = append(append(append(line, key...), ':'), text...)
+	}
+	return append(line, '}'), nil
+}
+
+func accountingID(id uint64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(id, 10)
+}
+
+// accountingAccountID formats an account id like its JSON without the quotes of strings.
+func accountingAccountID(id any) string {
+	raw, err := json.Marshal(id)
+	if err != nil {
+		return ""
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	return string(raw)
+}
+
+type accountingTotalsBuilder[AccountID comparable] struct {
+	totals   AccountingTotals
+	taxes    invoiceTaxTotals
+	payments map[string]int
+}
+
+func newAccountingTotalsBuilder[AccountID comparable](options *AccountingExportOptions) *accountingTotalsBuilder[AccountID] {
+	return &accountingTotalsBuilder[AccountID]{
+		totals: AccountingTotals{
+			Kind:     options.Kind,
+			From:     options.From,
+			To:       options.To,
+			Payments: make([]AccountingPayment, 0),
+		},
+		payments: make(map[string]int),
+	}
+}
+
+func (builder *accountingTotalsBuilder[AccountID]) add(record *AccountingRecord[AccountID]) error {
+	var err error
+	builder.totals.Count++
+	if builder.totals.Amount, err = builder.totals.Amount.Add(record.Amount); err != nil {
+		return err
+	}
+	if builder.totals.Tax, err = builder.totals.Tax.Add(record.Tax); err != nil {
+		return err
+	}
+	for _, line := range record.TaxLines {
+		if err := builder.taxes.add(line); err != nil {
+			return err
+		}
+	}
+	for _, payment := range record.Payments {
+		i, ok := builder.payments[payment.PaymentType]
+		if !ok {
+			i = len(builder.totals.Payments)
+			builder.payments[payment.PaymentType] = i
+			builder.totals.Payments = append(builder.totals.Payments, AccountingPayment{PaymentType: payment.PaymentType})
+		}
+		if builder.totals.Payments[i].Amount, err = builder.totals.Payments[i].Amount.Add(payment.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (builder *accountingTotalsBuilder[AccountID]) build() *AccountingTotals {
+	totals := builder.totals
+	totals.Taxes = builder.taxes.taxes
+	if totals.Taxes == nil {
+		totals.Taxes = make([]InvoiceTax, 0)
+	}
+	return &totals
+}
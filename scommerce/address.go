@@ -673,3 +673,26 @@ func (form *UserAddressForm[AccountID]) Clone(ctx context.Context) (UserAddressF
 	var cloned UserAddressForm[AccountID] = *form
 	return cloned, nil
 }
+
+// addressDestination returns the country and region an address ships to, a nil address has neither.
+func addressDestination[AccountID comparable](ctx context.Context, address UserAddress[AccountID]) (uint64, string, error) {
+	if address == nil {
+		return 0, "", nil
+	}
+	var cid uint64 = 0
+	country, err := address.GetCountry(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	if country != nil {
+		cid, err = country.GetID(ctx)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	region, err := address.GetRegion(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	return cid, region, nil
+}
@@ -24,6 +24,10 @@ type App[AccountID comparable] struct {
 	SubscriptionManager   ProductItemSubscriptionManager[AccountID]
 	DiscountManager       UserDiscountManager[AccountID]
 	FactorManager         UserFactorManager[AccountID]
+	ReturnRequestManager  ReturnRequestManager[AccountID]
+	ShipmentManager       ShipmentManager[AccountID]
+	GiftCardManager       GiftCardManager[AccountID]
+	AccountingManager     AccountingManager[AccountID]
 }
 
 type AppConfig[AccountID comparable] struct {
@@ -34,9 +38,30 @@ type AppConfig[AccountID comparable] struct {
 	OTPTTL                     time.Duration
 	SubscriptionRenewalHandler RenewalHandlerFunc[AccountID]
 	DiscountCodeLength         int32
+	TaxCalculator              TaxCalculator                     // nil disables taxes
+	ShippingRateCalculator     ShippingRateCalculator            // nil charges the flat price of the shipping method
+	PromotionCalculator        PromotionCalculator               // nil disables automatic promotions
+	PaymentGateways            PaymentGatewayRegistry[AccountID] // nil pays every order from the wallet or gift cards
+	AbandonedCartThreshold     time.Duration                     // DefaultAbandonedCartThreshold when zero
+	ShoppingCartRetention      time.Duration                     // DefaultShoppingCartRetention when zero, negative keeps carts forever
+	PendingPaymentTimeout      time.Duration                     // DefaultPendingPaymentTimeout when zero, negative keeps unpaid orders forever
+	InvoiceSeller              InvoiceParty                      // printed on every invoice
+	InvoiceRenderer            InvoiceRenderer                   // nil renders with NewBuiltinInvoiceRenderer
 }
 
 func NewBuiltinApplication[AccountID comparable](conf *AppConfig[AccountID]) (*App[AccountID], error) {
+	invoiceRenderer := conf.InvoiceRenderer
+	if invoiceRenderer == nil {
+		invoiceRenderer = NewBuiltinInvoiceRenderer()
+	}
+
+	paymentGateways := conf.PaymentGateways
+	if paymentGateways == nil {
+		registry := NewBuiltinPaymentGatewayRegistry(NewBuiltinWalletPaymentGateway(conf.DB))
+		registry.Register(NewBuiltinGiftCardPaymentGateway(conf.DB))
+		paymentGateways = registry
+	}
+
 	orderStatusManager := NewBuiltinOrderStatusManager(conf.DB)
 	shippingMethodManager := NewBuiltinShippingMethodManager(conf.DB)
 	paymentTypeManager := NewBuiltinPaymentTypeManager(conf.DB)
@@ -44,12 +69,16 @@ func NewBuiltinApplication[AccountID comparable](conf *AppConfig[AccountID]) (*A
 	userRoleManager := NewBuiltinUserRoleManager(conf.DB)
 	addressManager := NewBuiltinUserAddressManager(conf.DB)
 	paymentMethodManager := NewBuiltinPaymentMethodManager(conf.DB)
-	orderManager := NewBuiltinUserOrderManager(conf.DB, orderStatusManager, conf.FileStorage)
+	orderManager := NewBuiltinUserOrderManager(conf.DB, orderStatusManager, conf.FileStorage, paymentGateways, conf.PendingPaymentTimeout)
 	productManager := NewBuiltinProductManager(conf.DB, conf.FileStorage)
-	shoppingCartManager := NewBuiltinUserShoppingCartManager(conf.DB, conf.FileStorage, orderStatusManager)
+	shoppingCartManager := NewBuiltinUserShoppingCartManager(conf.DB, conf.FileStorage, orderStatusManager, conf.TaxCalculator, conf.ShippingRateCalculator, conf.PromotionCalculator, paymentGateways, conf.AbandonedCartThreshold, conf.ShoppingCartRetention)
 	userReviewManager := NewBuiltinUserReviewManager(conf.DB, conf.FileStorage)
 	subscriptionManager := NewBuiltinProductItemSubscriptionManager(conf.DB, conf.FileStorage, conf.SubscriptionRenewalHandler)
-	factorManager := NewBuiltinUserFactorManager(conf.DB)
+	factorManager := NewBuiltinUserFactorManager(conf.DB, conf.FileStorage, invoiceRenderer, conf.InvoiceSeller)
+	returnRequestManager := NewBuiltinReturnRequestManager(conf.DB, orderManager)
+	shipmentManager := NewBuiltinShipmentManager(conf.DB, orderManager)
+	giftCardManager := NewBuiltinGiftCardManager(conf.DB)
+	accountingManager := NewBuiltinAccountingManager(conf.DB)
 
 	discountCodeLength := conf.DiscountCodeLength
 	if discountCodeLength == 0 {
@@ -64,6 +93,12 @@ func NewBuiltinApplication[AccountID comparable](conf *AppConfig[AccountID]) (*A
 		conf.OTPTokenLength,
 		conf.OTPTTL,
 		orderStatusManager,
+		conf.TaxCalculator,
+		conf.ShippingRateCalculator,
+		conf.PromotionCalculator,
+		paymentGateways,
+		invoiceRenderer,
+		conf.InvoiceSeller,
 	)
 	if err != nil {
 		return nil, err
@@ -85,6 +120,10 @@ func NewBuiltinApplication[AccountID comparable](conf *AppConfig[AccountID]) (*A
 		SubscriptionManager:   subscriptionManager,
 		DiscountManager:       discountManager,
 		FactorManager:         factorManager,
+		ReturnRequestManager:  returnRequestManager,
+		ShipmentManager:       shipmentManager,
+		GiftCardManager:       giftCardManager,
+		AccountingManager:     accountingManager,
 	}, nil
 }
 
@@ -105,6 +144,10 @@ func (app *App[AccountID]) Close(ctx context.Context) error {
 	err = joinErr(err, app.SubscriptionManager.Close(ctx))
 	err = joinErr(err, app.DiscountManager.Close(ctx))
 	err = joinErr(err, app.FactorManager.Close(ctx))
+	err = joinErr(err, app.ReturnRequestManager.Close(ctx))
+	err = joinErr(err, app.ShipmentManager.Close(ctx))
+	err = joinErr(err, app.GiftCardManager.Close(ctx))
+	err = joinErr(err, app.AccountingManager.Close(ctx))
 
 	return err
 }
@@ -127,6 +170,10 @@ func (app *App[AccountID]) Init(ctx context.Context) error {
 	err = joinErr(err, app.SubscriptionManager.Init(ctx))
 	err = joinErr(err, app.DiscountManager.Init(ctx))
 	err = joinErr(err, app.FactorManager.Init(ctx))
+	err = joinErr(err, app.ReturnRequestManager.Init(ctx))
+	err = joinErr(err, app.ShipmentManager.Init(ctx))
+	err = joinErr(err, app.GiftCardManager.Init(ctx))
+	err = joinErr(err, app.AccountingManager.Init(ctx))
 
 	return err
 }
@@ -149,6 +196,10 @@ func (app *App[AccountID]) Pulse(ctx context.Context) error {
 	err = joinErr(err, app.SubscriptionManager.Pulse(ctx))
 	err = joinErr(err, app.DiscountManager.Pulse(ctx))
 	err = joinErr(err, app.FactorManager.Pulse(ctx))
+	err = joinErr(err, app.ReturnRequestManager.Pulse(ctx))
+	err = joinErr(err, app.ShipmentManager.Pulse(ctx))
+	err = joinErr(err, app.GiftCardManager.Pulse(ctx))
+	err = joinErr(err, app.AccountingManager.Pulse(ctx))
 
 	return err
 }
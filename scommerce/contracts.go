@@ -3,6 +3,7 @@ package scommerce
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"time"
 )
 
@@ -43,6 +44,8 @@ type UserAccountManager[AccountID comparable] interface {
 	ValidateTwoFactor(ctx context.Context, token string, code string) (bool, error)
 	CancelTwoFactor(ctx context.Context, token string) error
 
+	ReconcileWallets(ctx context.Context) (*WalletReconciliation[AccountID], error) // compares every wallet with its ledger
+
 	ToBuiltinObject(ctx context.Context) (*BuiltinUserAccountManager[AccountID], error)
 }
 
@@ -90,14 +93,17 @@ type UserAccount[AccountID comparable] interface {
 	IsTradingAllowed(ctx context.Context) (bool, error)
 
 	// Fine
-	Fine(ctx context.Context, amount float64) error
-	SetPenalty(ctx context.Context, penalty float64) error
+	Fine(ctx context.Context, amount Money, entry *WalletEntry[AccountID]) error
+	SetPenalty(ctx context.Context, penalty Money, entry *WalletEntry[AccountID]) error
 
 	// Wallet (Money, Currency)
-	GetWalletCurrency(ctx context.Context) (float64, error)
-	SetWalletCurrency(ctx context.Context, currency float64) error
-	ChargeWallet(ctx context.Context, currency float64) error
-	TransferCurrency(ctx context.Context, to UserAccount[AccountID], amount float64) error
+	GetWalletCurrency(ctx context.Context) (Money, error)
+	SetWalletCurrency(ctx context.Context, currency Money, entry *WalletEntry[AccountID]) error
+	// A retry with the non empty idempotencyKey of an earlier call doesn't move the wallet again
+	ChargeWallet(ctx context.Context, currency Money, entry *WalletEntry[AccountID], idempotencyKey string) error
+	TransferCurrency(ctx context.Context, to UserAccount[AccountID], amount Money, entry *WalletEntry[AccountID], idempotencyKey string) error
+	GetWalletTransactions(ctx context.Context, transactions []WalletTransaction[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]WalletTransaction[AccountID], error)
+	GetWalletTransactionCount(ctx context.Context) (uint64, error)
 
 	// Carts
 	NewShoppingCart(ctx context.Context, sessionText string) (UserShoppingCart[AccountID], error)
@@ -129,9 +135,9 @@ type UserAccount[AccountID comparable] interface {
 	GetOrderCount(ctx context.Context) (uint64, error)
 
 	// Dept
-	HasPenalty(ctx context.Context) (bool, error)                                        // if wallet currency is negative it has penalty
-	CalculateTotalDeptsWithoutPenalty(ctx context.Context) (currency float64, err error) // total shopping carts dept
-	CalculateTotalDepts(ctx context.Context) (currency float64, err error)               // depts without penalty + penalty depts
+	HasPenalty(ctx context.Context) (bool, error)                                      // if wallet currency is negative it has penalty
+	CalculateTotalDeptsWithoutPenalty(ctx context.Context) (currency Money, err error) // total shopping carts dept
+	CalculateTotalDepts(ctx context.Context) (currency Money, err error)               // depts without penalty + penalty depts
 
 	// Reviews
 	GetUserReviews(ctx context.Context, reviews []UserReview[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserReview[AccountID], error)
@@ -148,7 +154,7 @@ type UserAccount[AccountID comparable] interface {
 	GetUserFactorCount(ctx context.Context) (uint64, error)
 
 	// Discounts
-	NewDiscount(ctx context.Context, value float64, validCount int64) (UserDiscount[AccountID], error)
+	NewDiscount(ctx context.Context, value Money, validCount int64) (UserDiscount[AccountID], error)
 	RemoveDiscount(ctx context.Context, discount UserDiscount[AccountID]) error
 	RemoveAllDiscounts(ctx context.Context) error
 	GetDiscounts(ctx context.Context, discounts []UserDiscount[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserDiscount[AccountID], error)
@@ -169,6 +175,7 @@ type UserOrderManager[AccountID comparable] interface {
 	RemoveAllUserOrders(ctx context.Context) error
 	GetUserOrders(ctx context.Context, orders []UserOrder[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserOrder[AccountID], error)
 	GetUserOrderCount(ctx context.Context) (uint64, error)
+	CancelUnpaidOrders(ctx context.Context) error // called by Pulse
 
 	ToBuiltinObject(ctx context.Context) (*BuiltinUserOrderManager[AccountID], error)
 }
@@ -189,12 +196,24 @@ type UserOrder[AccountID comparable] interface {
 	GetShippingMethod(ctx context.Context) (ShippingMethod, error)
 	SetShippingMethod(ctx context.Context, shippingMethod ShippingMethod) error
 
-	GetOrderTotal(ctx context.Context) (float64, error)
-	SetOrderTotal(ctx context.Context, price float64) error
-	CalculateTotalPrice(ctx context.Context) (float64, error)
+	GetOrderTotal(ctx context.Context) (Money, error)
+	SetOrderTotal(ctx context.Context, price Money) error
+	CalculateTotalPrice(ctx context.Context) (Money, error)
+
+	Pay(ctx context.Context, paymentMethod UserPaymentMethod[AccountID], splits ...PaymentSplit[AccountID]) error
+	GetPayments(ctx context.Context, payments []OrderPayment[AccountID]) ([]OrderPayment[AccountID], error)
+	GetAmountDue(ctx context.Context) (Money, error)
+
+	Cancel(ctx context.Context, reason string) error
+	Refund(ctx context.Context, items []RefundItem, amount Money, reason string) (*CreditNote[AccountID], error) // the credit note comes with the error once money may have been paid back
+	GetCreditNotes(ctx context.Context, creditNotes []CreditNote[AccountID]) ([]CreditNote[AccountID], error)
+	IssueGiftCards(ctx context.Context) ([]GiftCard[AccountID], error)
+	GetGiftCards(ctx context.Context, giftCards []GiftCard[AccountID]) ([]GiftCard[AccountID], error) // gift cards issued for the gift card items of the order
 
 	GetStatus(ctx context.Context) (OrderStatus, error)
 	SetStatus(ctx context.Context, status OrderStatus) error
+	ChangeStatus(ctx context.Context, status OrderStatus, actor string, note string) error
+	GetStatusHistory(ctx context.Context, history []OrderStatusChange) ([]OrderStatusChange, error)
 	IsDeliveried(ctx context.Context) (bool, error)
 
 	GetUserComment(ctx context.Context) (string, error)
@@ -209,6 +228,7 @@ type UserOrder[AccountID comparable] interface {
 	GetProductItems(ctx context.Context, items []UserOrderProductItem[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserOrderProductItem[AccountID], error)
 	GetProductItemCount(ctx context.Context) (uint64, error)
 	SetProductItems(ctx context.Context, items []UserOrderProductItem[AccountID]) error
+	GetPromotions(ctx context.Context) ([]PromotionLine, error)
 
 	ToBuiltinObject(ctx context.Context) (*BuiltinUserOrder[AccountID], error)
 	ToFormObject(ctx context.Context) (*UserOrderForm[AccountID], error)
@@ -335,6 +355,14 @@ type UserShoppingCartManager[AccountID comparable] interface {
 	GetShoppingCarts(ctx context.Context, carts []UserShoppingCart[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserShoppingCart[AccountID], error) // for all users
 	GetShoppingCartCount(ctx context.Context) (uint64, error)
 	GetShoppingCartBySessionText(ctx context.Context, sessionText string) (UserShoppingCart[AccountID], error)
+	NewGuestShoppingCart(ctx context.Context, sessionText string) (UserShoppingCart[AccountID], error) // cart of an anonymous visitor
+
+	ReleaseExpiredStockReservations(ctx context.Context) error
+
+	// Abandoned carts belong to an account, have items and were inactive for longer than the abandoned cart threshold
+	GetAbandonedShoppingCarts(ctx context.Context, carts []UserShoppingCart[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserShoppingCart[AccountID], error)
+	GetAbandonedShoppingCartCount(ctx context.Context) (uint64, error)
+	RemoveInactiveShoppingCarts(ctx context.Context) error // called by Pulse
 
 	ToBuiltinObject(ctx context.Context) (*BuiltinUserShoppingCartManager[AccountID], error)
 }
@@ -353,9 +381,30 @@ type UserShoppingCart[AccountID comparable] interface {
 	GetShoppingCartItems(ctx context.Context, items []UserShoppingCartItem[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserShoppingCartItem[AccountID], error)
 	GetShoppingCartItemCount(ctx context.Context) (uint64, error)
 
-	CalculateDept(ctx context.Context, shippingMethod ShippingMethod) (float64, error)
+	// MergeInto moves the items of a guest cart into the latest cart of the account and deletes the guest cart,
+	// quantities of lines with the same product item and attributes are added up.
+	// An account without a cart takes the guest cart over. It returns the cart holding the items.
+	MergeInto(ctx context.Context, account UserAccount[AccountID]) (UserShoppingCart[AccountID], error)
+
+	CalculateDept(ctx context.Context, shippingMethod ShippingMethod, address UserAddress[AccountID]) (Money, error)         // address is optional, exclusive taxes are added when it's given, promotions are taken off up to the subtotal
+	CalculateShippingRate(ctx context.Context, shippingMethod ShippingMethod, address UserAddress[AccountID]) (Money, error) // address is optional, zone rules don't match without it
+	CalculateTax(ctx context.Context, shippingMethod ShippingMethod, address UserAddress[AccountID]) (*TaxResult, error)     // items are taxed less their share of the promotions
+	CalculatePromotions(ctx context.Context) (*PromotionResult, error)
+
+	GetLastActivityAt(ctx context.Context) (time.Time, error) // creation or the last change of its items
+
+	// Validate reports price changes, removed product items and lines exceeding the stock since the items were added.
+	// With fix the cart is changed to resolve them, the issues are reported as fixed.
+	Validate(ctx context.Context, fix bool) (*ShoppingCartValidation, error)
 
-	Order(ctx context.Context, paymentMethod UserPaymentMethod[AccountID], address UserAddress[AccountID], shippingMethod ShippingMethod, userComment string, discountCode string) (UserOrder[AccountID], error)
+	// Stock reservation (held until ttl passes, the cart is ordered or released)
+	ReserveStock(ctx context.Context, ttl time.Duration) (expiresAt time.Time, err error)
+	ReleaseStock(ctx context.Context) error
+	GetStockReservationExpiresAt(ctx context.Context) (time.Time, error) // zero time if nothing is reserved
+
+	// Order returns the order together with the error when its payment fails, the order stays pending payment.
+	// A retry with the non empty idempotencyKey of an earlier call returns the order of that call.
+	Order(ctx context.Context, paymentMethod UserPaymentMethod[AccountID], address UserAddress[AccountID], shippingMethod ShippingMethod, userComment string, discountCode string, idempotencyKey string, splits ...PaymentSplit[AccountID]) (UserOrder[AccountID], error)
 
 	ToBuiltinObject(ctx context.Context) (*BuiltinUserShoppingCart[AccountID], error)
 	ToFormObject(ctx context.Context) (*UserShoppingCartForm[AccountID], error)
@@ -378,7 +427,7 @@ type UserShoppingCartItem[AccountID comparable] interface {
 	GetAttributes(ctx context.Context) (json.RawMessage, error)
 	SetAttributes(ctx context.Context, attrs json.RawMessage) error
 
-	CalculateDept(ctx context.Context) (float64, error)
+	CalculateDept(ctx context.Context) (Money, error)
 
 	ToBuiltinObject(ctx context.Context) (*BuiltinUserShoppingCartItem[AccountID], error)
 	ToFormObject(ctx context.Context) (*UserShoppingCartItemForm[AccountID], error)
@@ -389,6 +438,7 @@ type UserFactorManager[AccountID comparable] interface {
 	GeneralAppObject
 
 	GetFactorWithID(ctx context.Context, aid uint64, fill bool) (UserFactor[AccountID], error)
+	GetFactorWithInvoiceNumber(ctx context.Context, number InvoiceNumber, fill bool) (UserFactor[AccountID], error)
 
 	GetUserFactors(ctx context.Context, account UserAccount[AccountID], factors []UserFactor[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserFactor[AccountID], error)
 	GetUserFactorCount(ctx context.Context, account UserAccount[AccountID]) (uint64, error)
@@ -403,17 +453,31 @@ type UserFactor[AccountID comparable] interface {
 	GetID(ctx context.Context) (uint64, error)
 	GetUserAccountID(ctx context.Context) (AccountID, error)
 
-	GetProducts(ctx context.Context) (json.RawMessage, error)
-	SetProducts(ctx context.Context, products json.RawMessage) error
+	GetOrderID(ctx context.Context) (uint64, error)
+	GetInvoiceNumber(ctx context.Context) (InvoiceNumber, error)
+	GetIssuedAt(ctx context.Context) (time.Time, error)
+
+	GetLines(ctx context.Context) ([]FactorLine, error)
+	SetLines(ctx context.Context, lines []FactorLine) error
 
-	GetDiscount(ctx context.Context) (float64, error)
-	SetDiscount(ctx context.Context, discount float64) error
+	GetDiscount(ctx context.Context) (Money, error)
+	SetDiscount(ctx context.Context, discount Money) error
 
-	GetTax(ctx context.Context) (float64, error)
-	SetTax(ctx context.Context, tax float64) error
+	GetTax(ctx context.Context) (Money, error)
+	SetTax(ctx context.Context, tax Money) error
+	GetTaxLines(ctx context.Context) ([]TaxLine, error)
+	SetTaxLines(ctx context.Context, lines []TaxLine) error
 
-	GetAmountPaid(ctx context.Context) (float64, error)
-	SetAmountPaid(ctx context.Context, amountPaid float64) error
+	GetAmountPaid(ctx context.Context) (Money, error)
+	SetAmountPaid(ctx context.Context, amountPaid Money) error
+	GetPayments(ctx context.Context) ([]OrderPayment[AccountID], error)
+	GetCreditNotes(ctx context.Context) ([]CreditNote[AccountID], error)
+
+	GetInvoice(ctx context.Context) (*Invoice, error)
+	GetInvoiceDocument(ctx context.Context, format InvoiceFormat) (FileReadCloser, error)
+	RenderInvoiceDocument(ctx context.Context, format InvoiceFormat) (FileReadCloser, error)
+	ExportUBLInvoice(ctx context.Context, w io.Writer) error
+	ExportUBLCreditNote(ctx context.Context, creditNote *CreditNote[AccountID], w io.Writer) error
 
 	ToBuiltinObject(ctx context.Context) (*BuiltinUserFactor[AccountID], error)
 	ToFormObject(ctx context.Context) (*UserFactorForm[AccountID], error)
@@ -471,8 +535,12 @@ type Product[AccountID comparable] interface {
 	SetImages(ctx context.Context, images []FileReader) error
 	GetProductCategory(ctx context.Context) (ProductCategory[AccountID], error)
 	SetProductCategory(ctx context.Context, category ProductCategory[AccountID]) error
+	GetOptions(ctx context.Context) ([]ProductOption, error)
+	SetOptions(ctx context.Context, options []ProductOption) error // fails when an item picks a value the new options don't allow
 
-	AddProductItem(ctx context.Context, sku string, name string, price float64, quantity uint64, images []FileReader, attrs json.RawMessage) (ProductItem[AccountID], error)
+	AddProductItem(ctx context.Context, sku string, name string, price Money, quantity uint64, images []FileReader, attrs json.RawMessage) (ProductItem[AccountID], error)
+	AddProductItemWithOptions(ctx context.Context, options map[string]string, sku string, name string, price Money, quantity uint64, images []FileReader, attrs json.RawMessage) (ProductItem[AccountID], error)
+	FindItemByOptions(ctx context.Context, options map[string]string) (ProductItem[AccountID], error)
 	RemoveProductItem(ctx context.Context, item ProductItem[AccountID]) error
 	RemoveAllProductItems(ctx context.Context) error
 	GetProductItems(ctx context.Context, items []ProductItem[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]ProductItem[AccountID], error)
@@ -491,12 +559,22 @@ type ProductItem[AccountID comparable] interface {
 	SetName(ctx context.Context, name string) error
 	GetSKU(ctx context.Context) (string, error) // slug
 	SetSKU(ctx context.Context, sku string) error
-	GetPrice(ctx context.Context) (float64, error)
-	SetPrice(ctx context.Context, price float64) error
+	GetPrice(ctx context.Context) (Money, error)
+	SetPrice(ctx context.Context, price Money) error
 
 	GetQuantityInStock(ctx context.Context) (uint64, error)
 	SetQuantityInStock(ctx context.Context, quantity uint64) error
 	AddQuantityInStock(ctx context.Context, delta int64) error
+	GetReservedQuantity(ctx context.Context) (uint64, error) // units held by unexpired cart reservations
+
+	GetWeight(ctx context.Context) (float64, error) // kilograms of one unit
+	SetWeight(ctx context.Context, weight float64) error
+	GetDimensions(ctx context.Context) (ProductItemDimensions, error)
+	SetDimensions(ctx context.Context, dimensions ProductItemDimensions) error
+	GetGiftCard(ctx context.Context) (ProductItemGiftCard, error)
+	SetGiftCard(ctx context.Context, giftCard ProductItemGiftCard) error
+	GetOptions(ctx context.Context) (map[string]string, error) // option axis name to picked value, nil when not a variant
+	SetOptions(ctx context.Context, options map[string]string) error
 
 	GetImages(ctx context.Context) ([]FileReadCloser, error)
 	SetImages(ctx context.Context, images []FileReader) error
@@ -516,7 +594,7 @@ type ProductItem[AccountID comparable] interface {
 	ApplyFormObject(ctx context.Context, form *ProductItemForm[AccountID]) error
 }
 
-type RenewalHandlerFunc[AccountID comparable] func(ctx context.Context, subscription ProductItemSubscription[AccountID], account UserAccount[AccountID], productItem ProductItem[AccountID]) (success bool, amountCharged float64, err error)
+type RenewalHandlerFunc[AccountID comparable] func(ctx context.Context, subscription ProductItemSubscription[AccountID], account UserAccount[AccountID], productItem ProductItem[AccountID]) (success bool, amountCharged Money, err error)
 
 type ProductItemSubscriptionManager[AccountID comparable] interface {
 	GeneralAppObject
@@ -635,7 +713,7 @@ type ShippingMethodManager interface {
 
 	GetShippingMethodWithID(ctx context.Context, aid uint64, fill bool) (ShippingMethod, error)
 
-	NewShippingMethod(ctx context.Context, name string, price float64) (ShippingMethod, error)
+	NewShippingMethod(ctx context.Context, name string, price Money) (ShippingMethod, error)
 	RemoveShippingMethod(ctx context.Context, shippingMethod ShippingMethod) error
 	RemoveAllShippingMethods(ctx context.Context) error
 	GetShippingMethods(ctx context.Context, shippingMethods []ShippingMethod, skip int64, limit int64, queueOrder QueueOrder) ([]ShippingMethod, error)
@@ -652,8 +730,8 @@ type ShippingMethod interface {
 	GetID(ctx context.Context) (uint64, error)
 	GetName(ctx context.Context) (string, error)
 	SetName(ctx context.Context, name string) error
-	GetPrice(ctx context.Context) (float64, error)
-	SetPrice(ctx context.Context, price float64) error
+	GetPrice(ctx context.Context) (Money, error)
+	SetPrice(ctx context.Context, price Money) error
 
 	ToBuiltinObject(ctx context.Context) (*BuiltinShippingMethod, error)
 	ToFormObject(ctx context.Context) (*ShippingMethodForm, error)
@@ -676,6 +754,12 @@ type OrderStatusManager interface {
 	GetDeliveriedOrderStatus(ctx context.Context) (OrderStatus, error)
 	GetIdleOrderStatus(ctx context.Context) (OrderStatus, error)
 
+	// Transitions (orders only move along allowed transitions)
+	AddOrderStatusTransition(ctx context.Context, from OrderStatus, to OrderStatus) error
+	RemoveOrderStatusTransition(ctx context.Context, from OrderStatus, to OrderStatus) error
+	GetOrderStatusTransitions(ctx context.Context, from OrderStatus, orderStatuses []OrderStatus) ([]OrderStatus, error)
+	CanTransitionOrderStatus(ctx context.Context, from OrderStatus, to OrderStatus) (bool, error)
+
 	ToBuiltinObject(ctx context.Context) (*BuiltinOrderStatusManager, error)
 }
 
@@ -733,13 +817,22 @@ type UserDiscountManager[AccountID comparable] interface {
 
 	GetUserDiscountWithID(ctx context.Context, aid uint64, fill bool) (UserDiscount[AccountID], error)
 
-	NewUserDiscount(ctx context.Context, ownerAccount UserAccount[AccountID], value float64, validCount int64) (UserDiscount[AccountID], error)
+	NewUserDiscount(ctx context.Context, ownerAccount UserAccount[AccountID], value Money, validCount int64) (UserDiscount[AccountID], error)
 	RemoveUserDiscount(ctx context.Context, discount UserDiscount[AccountID]) error
 	RemoveAllUserDiscounts(ctx context.Context) error
 	GetUserDiscounts(ctx context.Context, discounts []UserDiscount[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserDiscount[AccountID], error)
 	GetUserDiscountCount(ctx context.Context) (uint64, error)
 	GetUserDiscountByCode(ctx context.Context, code string) (UserDiscount[AccountID], error)
 	ExistsUserDiscountCode(ctx context.Context, code string) (bool, error)
+	PreviewDiscount(ctx context.Context, cart UserShoppingCart[AccountID], code string, shippingMethod ShippingMethod, address UserAddress[AccountID]) (*UserDiscountPreview, error)
+
+	NewUserDiscountCampaign(ctx context.Context, ownerAccount UserAccount[AccountID], name string, prefix string, count int64, rules UserDiscountRules) (*UserDiscountCampaign[AccountID], error)
+	GetUserDiscountCampaignWithID(ctx context.Context, cid uint64) (*UserDiscountCampaign[AccountID], error)
+	GetUserDiscountCampaigns(ctx context.Context, campaigns []UserDiscountCampaign[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserDiscountCampaign[AccountID], error)
+	GetUserDiscountCampaignDiscounts(ctx context.Context, cid uint64, discounts []UserDiscount[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserDiscount[AccountID], error)
+	ExportUserDiscountCampaignCSV(ctx context.Context, cid uint64, w io.Writer) error
+	GetUserDiscountCampaignReport(ctx context.Context, cid uint64) (*UserDiscountCampaignReport, error)
+	RemoveUserDiscountCampaign(ctx context.Context, cid uint64) error
 
 	ToBuiltinObject(ctx context.Context) (*BuiltinUserDiscountManager[AccountID], error)
 }
@@ -753,8 +846,28 @@ type UserDiscount[AccountID comparable] interface {
 	GetCode(ctx context.Context) (string, error)
 	SetCode(ctx context.Context, code string) error
 
-	GetValue(ctx context.Context) (float64, error)
-	SetValue(ctx context.Context, value float64) error
+	GetType(ctx context.Context) (UserDiscountType, error)
+	SetType(ctx context.Context, discountType UserDiscountType) error
+
+	GetValue(ctx context.Context) (Money, error)
+	SetValue(ctx context.Context, value Money) error
+
+	GetPercentage(ctx context.Context) (float64, error)
+	SetPercentage(ctx context.Context, percentage float64) error
+
+	GetMaxValue(ctx context.Context) (Money, error)
+	SetMaxValue(ctx context.Context, maxValue Money) error
+
+	GetMinOrderAmount(ctx context.Context) (Money, error)
+	SetMinOrderAmount(ctx context.Context, minOrderAmount Money) error
+
+	GetStartsAt(ctx context.Context) (time.Time, error)
+	SetStartsAt(ctx context.Context, startsAt time.Time) error
+	GetEndsAt(ctx context.Context) (time.Time, error)
+	SetEndsAt(ctx context.Context, endsAt time.Time) error
+
+	GetScope(ctx context.Context) (UserDiscountScope, error)
+	SetScope(ctx context.Context, scope UserDiscountScope) error
 
 	GetValidCount(ctx context.Context) (int64, error)
 	SetValidCount(ctx context.Context, validCount int64) error
@@ -768,3 +881,106 @@ type UserDiscount[AccountID comparable] interface {
 	ToFormObject(ctx context.Context) (*UserDiscountForm[AccountID], error)
 	ApplyFormObject(ctx context.Context, form *UserDiscountForm[AccountID]) error
 }
+
+type ReturnRequestManager[AccountID comparable] interface {
+	GeneralAppObject
+
+	GetReturnRequestWithID(ctx context.Context, rid uint64, fill bool) (ReturnRequest[AccountID], error)
+
+	NewReturnRequest(ctx context.Context, order UserOrder[AccountID], items []ReturnItem, comment string) (ReturnRequest[AccountID], error)
+	RemoveAllReturnRequests(ctx context.Context) error
+	GetReturnRequests(ctx context.Context, requests []ReturnRequest[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]ReturnRequest[AccountID], error)
+	GetReturnRequestsWithStatus(ctx context.Context, status string, requests []ReturnRequest[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]ReturnRequest[AccountID], error)
+	GetOrderReturnRequests(ctx context.Context, order UserOrder[AccountID], requests []ReturnRequest[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]ReturnRequest[AccountID], error)
+	GetReturnRequestCount(ctx context.Context) (uint64, error)
+
+	ToBuiltinObject(ctx context.Context) (*BuiltinReturnRequestManager[AccountID], error)
+}
+
+type ReturnRequest[AccountID comparable] interface {
+	GeneralAppObject
+
+	GetID(ctx context.Context) (uint64, error)
+	GetUserAccountID(ctx context.Context) (AccountID, error)
+	GetOrder(ctx context.Context) (UserOrder[AccountID], error)
+
+	GetItems(ctx context.Context) ([]ReturnItem, error)
+	GetReceivedItems(ctx context.Context) ([]ReturnItem, error)
+	GetComment(ctx context.Context) (string, error)
+	GetCreatedAt(ctx context.Context) (time.Time, error)
+
+	GetStatus(ctx context.Context) (string, error)
+	GetResolution(ctx context.Context) (string, error)
+	Approve(ctx context.Context, note string) error
+	Reject(ctx context.Context, reason string) error
+	Receive(ctx context.Context, items []ReturnItem, note string) error       // items are the accepted quantities, nil accepts everything
+	Refund(ctx context.Context, amount Money) (*CreditNote[AccountID], error) // a request left refunding with a credit note is only marked refunded
+	GetCreditNoteID(ctx context.Context) (uint64, error)
+
+	ToBuiltinObject(ctx context.Context) (*BuiltinReturnRequest[AccountID], error)
+	ToFormObject(ctx context.Context) (*ReturnRequestForm[AccountID], error)
+	ApplyFormObject(ctx context.Context, form *ReturnRequestForm[AccountID]) error
+}
+
+type GiftCardManager[AccountID comparable] interface {
+	GeneralAppObject
+
+	IssueGiftCard(ctx context.Context, owner UserAccount[AccountID], balance Money, expiresAt time.Time) (*GiftCard[AccountID], error)
+	GetGiftCardWithID(ctx context.Context, gcid uint64) (*GiftCard[AccountID], error)
+	GetGiftCardByCode(ctx context.Context, code string) (*GiftCard[AccountID], error)
+	GetGiftCards(ctx context.Context, giftCards []GiftCard[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]GiftCard[AccountID], error)
+	GetAccountGiftCards(ctx context.Context, account UserAccount[AccountID], giftCards []GiftCard[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]GiftCard[AccountID], error)
+	GetGiftCardTransactions(ctx context.Context, gcid uint64, transactions []GiftCardTransaction, skip int64, limit int64, queueOrder QueueOrder) ([]GiftCardTransaction, error)
+
+	ToBuiltinObject(ctx context.Context) (*BuiltinGiftCardManager[AccountID], error)
+}
+
+type AccountingManager[AccountID comparable] interface {
+	GeneralAppObject
+
+	GetAccountingRecords(ctx context.Context, kind AccountingRecordKind, cursor AccountingCursor, to time.Time, records []AccountingRecord[AccountID], limit int64) ([]AccountingRecord[AccountID], error)
+	ExportAccounting(ctx context.Context, options *AccountingExportOptions, w io.Writer) (*AccountingTotals, error)
+
+	ToBuiltinObject(ctx context.Context) (*BuiltinAccountingManager[AccountID], error)
+}
+
+type ShipmentManager[AccountID comparable] interface {
+	GeneralAppObject
+
+	GetShipmentWithID(ctx context.Context, shid uint64, fill bool) (Shipment[AccountID], error)
+
+	NewShipment(ctx context.Context, order UserOrder[AccountID], carrier string, trackingNumber string, items []ShipmentItem) (Shipment[AccountID], error)
+	RemoveShipment(ctx context.Context, shipment Shipment[AccountID]) error
+	RemoveAllShipments(ctx context.Context) error
+	GetShipments(ctx context.Context, shipments []Shipment[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]Shipment[AccountID], error)
+	GetShipmentCount(ctx context.Context) (uint64, error)
+	GetOrderShipments(ctx context.Context, order UserOrder[AccountID], shipments []Shipment[AccountID]) ([]Shipment[AccountID], error)
+
+	GetShipmentByTrackingNumber(ctx context.Context, trackingNumber string) (Shipment[AccountID], error)
+	GetOrderByTrackingNumber(ctx context.Context, trackingNumber string) (UserOrder[AccountID], error)
+
+	ToBuiltinObject(ctx context.Context) (*BuiltinShipmentManager[AccountID], error)
+}
+
+type Shipment[AccountID comparable] interface {
+	GeneralAppObject
+
+	GetID(ctx context.Context) (uint64, error)
+	GetOrder(ctx context.Context) (UserOrder[AccountID], error)
+	GetItems(ctx context.Context) ([]ShipmentItem, error)
+
+	GetCarrier(ctx context.Context) (string, error)
+	SetCarrier(ctx context.Context, carrier string) error
+	GetTrackingNumber(ctx context.Context) (string, error)
+	SetTrackingNumber(ctx context.Context, trackingNumber string) error
+
+	Ship(ctx context.Context, at time.Time) error
+	GetShippedAt(ctx context.Context) (time.Time, error) // zero time if not shipped
+	Deliver(ctx context.Context, at time.Time) error
+	GetDeliveredAt(ctx context.Context) (time.Time, error) // zero time if not delivered
+	IsDeliveried(ctx context.Context) (bool, error)
+
+	ToBuiltinObject(ctx context.Context) (*BuiltinShipment[AccountID], error)
+	ToFormObject(ctx context.Context) (*ShipmentForm, error)
+	ApplyFormObject(ctx context.Context, form *ShipmentForm) error
+}
@@ -0,0 +1,29 @@
+package scommerce
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrOrderCancelled = errors.New("order is cancelled")
+var ErrOrderDelivered = errors.New("order is delivered, refund it instead")
+var ErrRefundExceedsPaid = errors.New("refund exceeds the paid amount")
+var ErrRefundExceedsQuantity = errors.New("refund exceeds the ordered quantity")
+
+type RefundItem struct {
+	ProductItemID uint64 `json:"product_item_id"`
+	Quantity      uint64 `json:"quantity"`
+}
+
+// CreditNote reverses part or all of the factor of an order, its items were put back in stock
+// and its amount was paid back through the payments of the order.
+type CreditNote[AccountID comparable] struct {
+	ID        uint64       `json:"id"`
+	OrderID   uint64       `json:"order_id"`
+	FactorID  uint64       `json:"factor_id,omitempty"` // 0 for orders placed before factors were linked to orders
+	AccountID AccountID    `json:"account_id"`
+	Items     []RefundItem `json:"items"`
+	Amount    Money        `json:"amount"`
+	Reason    string       `json:"reason,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
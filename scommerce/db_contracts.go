@@ -32,6 +32,12 @@ type DBApplication[AccountID comparable] interface {
 	DBUserFactor[AccountID]
 	DBUserDiscountManager[AccountID]
 	DBUserDiscount[AccountID]
+	DBReturnRequestManager[AccountID]
+	DBReturnRequest[AccountID]
+	DBShipmentManager
+	DBShipment
+	DBGiftCardManager[AccountID]
+	DBAccountingManager[AccountID]
 	DBCountryManager
 	DBCountry
 	DBPaymentTypeManager
@@ -53,15 +59,17 @@ type DBUserAccountManager[AccountID comparable] interface {
 	AuthenticateUserAccount(ctx context.Context, token string, password string, accountForm *UserAccountForm[AccountID]) (AccountID, error)
 	InitUserAccountManager(ctx context.Context) error
 	FillUserAccountWithID(ctx context.Context, aid AccountID, accountForm *UserAccountForm[AccountID]) error
+	ReconcileUserAccountWallets(ctx context.Context) (*WalletReconciliation[AccountID], error)
+	RemoveExpiredIdempotencyKeys(ctx context.Context, now time.Time) error
 }
 
 type DBUserAccount[AccountID comparable] interface {
 	AllowUserAccountTrading(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, state bool) error
 	BanUserAccount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, till time.Duration, reason string) error
-	CalculateUserAccountTotalDepts(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (float64, error)
-	CalculateUserAccountTotalDeptsWithoutPenalty(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (float64, error)
-	ChargeUserAccountWallet(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, currency float64) error
-	FineUserAccount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, amount float64) error
+	CalculateUserAccountTotalDepts(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (Money, error)
+	CalculateUserAccountTotalDeptsWithoutPenalty(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (Money, error)
+	ChargeUserAccountWallet(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, currency Money, entry *WalletEntry[AccountID], idempotencyKey string) error
+	FineUserAccount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, amount Money, entry *WalletEntry[AccountID]) error
 	GetUserAccountAddressCount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (uint64, error)
 	GetUserAccountAddresses(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, addresses []uint64, addressForms []*UserAddressForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*UserAddressForm[AccountID], error)
 	GetUserAccountBio(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (string, error)
@@ -81,7 +89,9 @@ type DBUserAccount[AccountID comparable] interface {
 	GetUserAccountShoppingCarts(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, carts []uint64, cartForms []*UserShoppingCartForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*UserShoppingCartForm[AccountID], error)
 	GetUserAccountToken(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (string, error)
 	GetUserAccountLevel(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (int64, error)
-	GetUserAccountWalletCurrency(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (float64, error)
+	GetUserAccountWalletCurrency(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (Money, error)
+	GetUserAccountWalletTransactions(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, transactions []WalletTransaction[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]WalletTransaction[AccountID], error)
+	GetUserAccountWalletTransactionCount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (uint64, error)
 	GetUserAccountUserReviews(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, ids []uint64, reviewForms []*UserReviewForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*UserReviewForm[AccountID], error)
 	GetUserAccountUserReviewCount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (uint64, error)
 	GetUserAccountSubscriptions(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, ids []uint64, subscriptionForms []*ProductItemSubscriptionForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*ProductItemSubscriptionForm[AccountID], error)
@@ -90,7 +100,7 @@ type DBUserAccount[AccountID comparable] interface {
 	RemoveAllUserAccountSubscriptions(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) error
 	GetUserAccountUserFactors(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, ids []uint64, factorForms []*UserFactorForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*UserFactorForm[AccountID], error)
 	GetUserAccountUserFactorCount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) (uint64, error)
-	NewUserAccountDiscount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, value float64, validCount int64, discountForm *UserDiscountForm[AccountID]) (uint64, error)
+	NewUserAccountDiscount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, value Money, validCount int64, discountForm *UserDiscountForm[AccountID]) (uint64, error)
 	RemoveUserAccountDiscount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, discountID uint64) error
 	RemoveAllUserAccountDiscounts(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) error
 	GetUserAccountDiscounts(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, ids []uint64, discountForms []*UserDiscountForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*UserDiscountForm[AccountID], error)
@@ -117,16 +127,17 @@ type DBUserAccount[AccountID comparable] interface {
 	SetUserAccountLastName(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, name string) error
 	SetUserAccountLastUpdatedAt(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, lastUpdatedAt time.Time) error
 	SetUserAccountPassword(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, password string) error
-	SetUserAccountPenalty(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, penalty float64) error
+	SetUserAccountPenalty(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, penalty Money, entry *WalletEntry[AccountID]) error
 	SetUserAccountProfileImages(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, images []string) error
 	SetUserAccountRole(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, role uint64) error
 	SetUserAccountSuperUser(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, state bool) error
 	SetUserAccountToken(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, token string) error
 	SetUserAccountLevel(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, level int64) error
-	SetUserAccountWalletCurrency(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, currency float64) error
-	TransferUserAccountCurrency(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, to AccountID, currency float64) error
+	SetUserAccountWalletCurrency(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, currency Money, entry *WalletEntry[AccountID]) error
+	TransferUserAccountCurrency(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, to AccountID, currency Money, entry *WalletEntry[AccountID], idempotencyKey string) error
 	UnbanUserAccount(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID) error
 	ValidateUserAccountPassword(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, password string) (bool, error)
+	WithdrawUserAccountWallet(ctx context.Context, form *UserAccountForm[AccountID], aid AccountID, amount Money, entry *WalletEntry[AccountID], idempotencyKey string) error // fails with ErrInsufficientFunds
 }
 
 type DBUserUserShoppingCartResult[AccountID comparable] struct {
@@ -135,29 +146,68 @@ type DBUserUserShoppingCartResult[AccountID comparable] struct {
 }
 type DBUserShoppingCartManager[AccountID comparable] interface {
 	GetShoppingCartBySessionText(ctx context.Context, sessionText string, cartForm *UserShoppingCartForm[AccountID]) (uint64, error)
+	NewGuestShoppingCart(ctx context.Context, sessionText string, cartForm *UserShoppingCartForm[AccountID]) (uint64, error)
 	GetShoppingCartCount(ctx context.Context) (uint64, error)
 	GetShoppingCarts(ctx context.Context, ids []DBUserUserShoppingCartResult[AccountID], cartForms []*UserShoppingCartForm[AccountID], skip int64, limit int64, order QueueOrder) ([]DBUserUserShoppingCartResult[AccountID], []*UserShoppingCartForm[AccountID], error)
 	RemoveAllShoppingCarts(ctx context.Context) error
+	RemoveExpiredStockReservations(ctx context.Context, now time.Time) error
+	GetAbandonedShoppingCarts(ctx context.Context, inactiveSince time.Time, ids []DBUserUserShoppingCartResult[AccountID], cartForms []*UserShoppingCartForm[AccountID], skip int64, limit int64, order QueueOrder) ([]DBUserUserShoppingCartResult[AccountID], []*UserShoppingCartForm[AccountID], error)
+	GetAbandonedShoppingCartCount(ctx context.Context, inactiveSince time.Time) (uint64, error)
+	RemoveInactiveShoppingCarts(ctx context.Context, inactiveSince time.Time) error
 	InitUserShoppingCartManager(ctx context.Context) error
 	FillUserShoppingCartWithID(ctx context.Context, cid uint64, cartForm *UserShoppingCartForm[AccountID]) error
 	FillUserShoppingCartItemWithID(ctx context.Context, iid uint64, cartForm *UserShoppingCartItemForm[AccountID]) error
 }
 
+// DBShoppingCartValidationItem is a cart line with what it needs to be validated.
+type DBShoppingCartValidationItem struct {
+	ShoppingCartItemID uint64
+	ProductItemID      uint64 // 0 when the product item was removed
+	Quantity           int64
+	AddedPrice         *Money // nil when the price at adding isn't known
+	Price              Money
+	Available          int64 // stock not reserved by other carts, shared by the lines of the product item
+}
+
 type DBUserShoppingCart[AccountID comparable] interface {
-	CalculateUserShoppingCartDept(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64, shippingMethod uint64) (float64, error)
+	// CalculateUserShoppingCartDept charges shippingCost for shipping, a nil shippingCost charges the price of the shipping method.
+	CalculateUserShoppingCartDept(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64, shippingMethod uint64, shippingCost *Money) (Money, error)
+	GetUserShoppingCartTaxableItems(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64) ([]TaxableItem, error)
+	GetUserShoppingCartShippableItems(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64) ([]ShippableItem, error)
 	GetUserShoppingCartSessionText(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64) (string, error)
 	GetUserShoppingCartItemCount(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64) (uint64, error)
 	GetUserShoppingCartItems(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64, items []uint64, itemForms []*UserShoppingCartItemForm[AccountID], skip int64, limit int64, queueOrder QueueOrder, fs FileStorage, osm OrderStatusManager) ([]uint64, []*UserShoppingCartItemForm[AccountID], error)
 	NewUserShoppingCartShoppingCartItem(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64, productItem uint64, count int64, attrs json.RawMessage, itemForm *UserShoppingCartItemForm[AccountID], fs FileStorage, osm OrderStatusManager) (uint64, error)
-	OrderUserShoppingCart(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64, paymentMethod uint64, address uint64, shippingMethod uint64, userComment string, discountCode string, orderForm *UserOrderForm[AccountID]) (uint64, error)
+	// OrderUserShoppingCart must lock the product items of the cart, reject the order with
+	// *InsufficientStockError when any item quantity exceeds its stock and decrement the stock
+	// in the same transaction that creates the order.
+	// Units reserved by other carts are not available; the reservation of this cart is consumed.
+	// The lines of the pricing must be the locked lines of the cart and its discount the discount code takes off under the
+	// lock, otherwise the order is rejected with ErrShoppingCartChanged. The tax lines of the pricing are stored on the factor
+	// and their exclusive total is added to the order total. The promotion lines are spread over the discounts of the factor
+	// lines and stored on the order, and their total is taken off the order total. The totals are summed from the lines.
+	// shippingCost is charged for shipping like in CalculateUserShoppingCartDept.
+	// A non empty idempotencyKey which already created an order returns that order instead of ordering again.
+	OrderUserShoppingCart(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64, paymentMethod uint64, address uint64, shippingMethod uint64, shippingCost *Money, userComment string, discountCode string, pricing *OrderPricing, idempotencyKey string, orderForm *UserOrderForm[AccountID]) (uint64, error)
+	// MergeUserShoppingCartInto must reject carts which have an account with ErrShoppingCartNotGuest.
+	MergeUserShoppingCartInto(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64, aid AccountID, cartForm *UserShoppingCartForm[AccountID]) (uint64, error)
+	// GetUserShoppingCartValidationItems returns the lines of the cart in the order they were added.
+	GetUserShoppingCartValidationItems(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64) ([]DBShoppingCartValidationItem, error)
+	AcceptUserShoppingCartPrices(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64) error
 	RemoveUserShoppingCartAllShoppingCartItems(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64) error
 	RemoveUserShoppingCartShoppingCartItem(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64, itid uint64) error
 	SetUserShoppingCartSessionText(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64, text string) error
+	// ReserveUserShoppingCartStock replaces the reservation of the cart, failing with
+	// *InsufficientStockError when stock not reserved by other carts can't cover it.
+	ReserveUserShoppingCartStock(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64, expiresAt time.Time) error
+	ReleaseUserShoppingCartStock(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64) error
+	GetUserShoppingCartLastActivityAt(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64) (time.Time, error)
+	GetUserShoppingCartStockReservationExpiresAt(ctx context.Context, form *UserShoppingCartForm[AccountID], sid uint64) (time.Time, error)
 }
 
 type DBUserShoppingCartItem[AccountID comparable] interface {
 	AddUserShoppingCartItemQuantity(ctx context.Context, form *UserShoppingCartItemForm[AccountID], itid uint64, delta int64) error
-	CalculateUserShoppingCartItemDept(ctx context.Context, form *UserShoppingCartItemForm[AccountID], itid uint64) (float64, error)
+	CalculateUserShoppingCartItemDept(ctx context.Context, form *UserShoppingCartItemForm[AccountID], itid uint64) (Money, error)
 	GetUserShoppingCartItemProductItem(ctx context.Context, form *UserShoppingCartItemForm[AccountID], itid uint64, pItemForm *ProductItemForm[AccountID], db FileStorage) (uint64, error)
 	GetUserShoppingCartItemQuantity(ctx context.Context, form *UserShoppingCartItemForm[AccountID], itid uint64) (int64, error)
 	GetUserShoppingCartItemShoppingCart(ctx context.Context, form *UserShoppingCartItemForm[AccountID], itid uint64, cartForm *UserShoppingCartForm[AccountID], db FileStorage, osm OrderStatusManager) (uint64, error)
@@ -174,6 +224,9 @@ type DBUserOrderResult[AccountID comparable] struct {
 type DBUserOrderManager[AccountID comparable] interface {
 	GetUserOrderCount(ctx context.Context) (uint64, error)
 	GetUserOrders(ctx context.Context, orders []DBUserOrderResult[AccountID], orderForms []*UserOrderForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]DBUserOrderResult[AccountID], []*UserOrderForm[AccountID], error)
+	// GetUnpaidUserOrders lists the orders after afterID pending payment since before orderedBefore by id, orders whose
+	// payments are claimed are left out.
+	GetUnpaidUserOrders(ctx context.Context, orderedBefore time.Time, afterID uint64, orders []DBUserOrderResult[AccountID], limit int64) ([]DBUserOrderResult[AccountID], error)
 	RemoveAllUserOrders(ctx context.Context) error
 	InitUserOrderManager(ctx context.Context) error
 	FillUserOrderWithID(ctx context.Context, oid uint64, orderForm *UserOrderForm[AccountID]) error
@@ -185,29 +238,58 @@ type DBUserOrderProductItem struct {
 	Attributes    json.RawMessage `json:"attributes,omitempty"`
 }
 type DBUserOrder[AccountID comparable] interface {
-	CalculateUserOrderTotalPrice(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) (float64, error)
+	CalculateUserOrderTotalPrice(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) (Money, error)
+	// ClaimUserOrderPayments locks the order and claims its payments until expiresAt or ReleaseUserOrderPayments, it fails
+	// with ErrPaymentInProgress while another unexpired claim holds them. It returns the status the order has under the lock.
+	ClaimUserOrderPayments(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, expiresAt time.Time, statusForm *OrderStatusForm) (uint64, error)
+	// CompleteUserOrderRefund issues the pending credit note once refunded was paid back. When all of it was, the items
+	// go back in stock and the discount code of the order is given back if the order is cancelled or its credit notes
+	// reach its total. A partial refund issues the credit note for refunded without items and nothing refunded drops it,
+	// both restore the gift cards the credit note voided.
+	CompleteUserOrderRefund(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, creditNote *CreditNote[AccountID], refunded Money, cancel bool) error
+	// DeliverUserOrder moves the order to the delivered status sid like SetUserOrderStatus, comment is the note.
 	DeliverUserOrder(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, sid uint64, date time.Time, comment string) error
 	GetUserOrderDeliveryComment(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) (string, error)
 	GetUserOrderDeliveryDate(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) (time.Time, error)
+	GetUserOrderCreditNotes(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, creditNotes []CreditNote[AccountID]) ([]CreditNote[AccountID], error)
 	GetUserOrderDate(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) (time.Time, error)
-	GetUserOrderTotal(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) (float64, error)
+	GetUserOrderGiftCards(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, giftCards []GiftCard[AccountID]) ([]GiftCard[AccountID], error)
+	GetUserOrderTotal(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) (Money, error)
 	GetUserOrderPaymentMethod(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, paymentMethodForm *UserPaymentMethodForm[AccountID]) (uint64, error)
+	GetUserOrderPayments(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, payments []OrderPayment[AccountID]) ([]OrderPayment[AccountID], error)
 	GetUserOrderProductItemCount(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) (uint64, error)
 	GetUserOrderProductItems(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, items []DBUserOrderProductItem, skip int64, limit int64, queueOrder QueueOrder) ([]DBUserOrderProductItem, error)
+	GetUserOrderPromotions(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) ([]PromotionLine, error)
 	GetUserOrderShippingAddress(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, addressForm *UserAddressForm[AccountID]) (uint64, error)
 	GetUserOrderShippingMethod(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, shippingMethodForm *ShippingMethodForm) (uint64, error)
 	GetUserOrderStatus(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, statusForm *OrderStatusForm) (uint64, error)
+	GetUserOrderStatusHistory(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, history []OrderStatusChange) ([]OrderStatusChange, error)
 	GetUserOrderUserComment(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) (string, error)
+	// IssueUserOrderGiftCards issues a gift card for every unit of the gift card product items of the order,
+	// worth its share of the line total after discounts, once the captured payments cover the order total. Units
+	// which already have a gift card are skipped. It returns the gift cards it issued.
+	IssueUserOrderGiftCards(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) ([]GiftCard[AccountID], error)
+	NewUserOrderPayment(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, payment *OrderPayment[AccountID]) (uint64, error)
+	// RefundUserOrder stores the credit note pending under a lock of the order, it fails with ErrRefundExceedsQuantity
+	// when an item wasn't ordered that many times and with ErrRefundExceedsPaid when the amount is more than what was
+	// captured and isn't refunded or pending yet. cancel replaces the items with everything not refunded yet and the
+	// amount with everything refundable. Pending credit notes hold their items and amount but aren't listed. The gift
+	// cards issued for refunded gift card items are voided, it fails with ErrGiftCardSpent when they were spent.
+	RefundUserOrder(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, creditNote *CreditNote[AccountID], cancel bool) (uint64, error)
+	ReleaseUserOrderPayments(ctx context.Context, form *UserOrderForm[AccountID], oid uint64) error
 	SetUserOrderDeliveryComment(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, comment string) error
 	SetUserOrderDeliveryDate(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, date time.Time) error
 	SetUserOrderDate(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, date time.Time) error
-	SetUserOrderTotal(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, total float64) error
+	SetUserOrderTotal(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, total Money) error
 	SetUserOrderPaymentMethod(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, method uint64) error
 	SetUserOrderProductItems(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, items []DBUserOrderProductItem) error
 	SetUserOrderShippingAddress(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, address uint64) error
 	SetUserOrderShippingMethod(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, method uint64) error
-	SetUserOrderStatus(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, status uint64) error
+	// SetUserOrderStatus fails with ErrInvalidOrderStatusTransition unless the current status of the order can move
+	// to status, the change is recorded in the status history of the order.
+	SetUserOrderStatus(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, status uint64, actor string, note string) error
 	SetUserOrderUserComment(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, comment string) error
+	UpdateUserOrderPayment(ctx context.Context, form *UserOrderForm[AccountID], oid uint64, payment *OrderPayment[AccountID]) error
 }
 
 type DBUserPaymentMethodResult[AccountID comparable] struct {
@@ -315,11 +397,13 @@ type DBProductCategory[AccountID comparable] interface {
 }
 
 type DBProduct[AccountID comparable] interface {
-	AddProductProductItem(ctx context.Context, form *ProductForm[AccountID], pid uint64, sku string, name string, price float64, quantity uint64, images []string, attrs json.RawMessage, itemForm *ProductItemForm[AccountID], fs FileStorage) (uint64, error)
+	AddProductProductItem(ctx context.Context, form *ProductForm[AccountID], pid uint64, sku string, name string, price Money, quantity uint64, images []string, attrs json.RawMessage, options map[string]string, itemForm *ProductItemForm[AccountID], fs FileStorage) (uint64, error)
 	GetProductDescription(ctx context.Context, form *ProductForm[AccountID], pid uint64) (string, error)
 	GetProductName(ctx context.Context, form *ProductForm[AccountID], pid uint64) (string, error)
 	GetProductImages(ctx context.Context, form *ProductForm[AccountID], pid uint64) ([]string, error)
 	GetProductCategory(ctx context.Context, form *ProductForm[AccountID], pid uint64, catForm *ProductCategoryForm[AccountID], fs FileStorage) (uint64, error)
+	GetProductOptions(ctx context.Context, form *ProductForm[AccountID], pid uint64) ([]ProductOption, error)
+	GetProductProductItemByOptions(ctx context.Context, form *ProductForm[AccountID], pid uint64, options map[string]string, itemForm *ProductItemForm[AccountID], fs FileStorage) (uint64, error)
 	GetProductProductItemCount(ctx context.Context, form *ProductForm[AccountID], pid uint64) (uint64, error)
 	GetProductProductItems(ctx context.Context, form *ProductForm[AccountID], pid uint64, items []uint64, itemForms []*ProductItemForm[AccountID], skip int64, limit int64, queueOrder QueueOrder, fs FileStorage) ([]uint64, []*ProductItemForm[AccountID], error)
 	RemoveAllProductProductItems(ctx context.Context, form *ProductForm[AccountID], pid uint64) error
@@ -328,24 +412,34 @@ type DBProduct[AccountID comparable] interface {
 	SetProductName(ctx context.Context, form *ProductForm[AccountID], pid uint64, name string) error
 	SetProductImages(ctx context.Context, form *ProductForm[AccountID], pid uint64, images []string) error
 	SetProductCategory(ctx context.Context, form *ProductForm[AccountID], pid uint64, category *uint64, fs FileStorage) error
+	SetProductOptions(ctx context.Context, form *ProductForm[AccountID], pid uint64, options []ProductOption) error
 }
 
 type DBProductItem[AccountID comparable] interface {
 	AddProductItemQuantityInStock(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, delta int64) error
 	GetProductItemAttributes(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (json.RawMessage, error)
 	GetProductItemImages(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) ([]string, error)
-	GetProductItemPrice(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (float64, error)
+	GetProductItemPrice(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (Money, error)
 	GetProductItemProduct(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, productForm *ProductForm[AccountID], fs FileStorage) (uint64, error)
 	GetProductItemQuantityInStock(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (uint64, error)
+	GetProductItemReservedQuantity(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (uint64, error)
 	GetProductItemName(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (string, error)
 	GetProductItemSKU(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (string, error)
+	GetProductItemWeight(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (float64, error)
+	GetProductItemDimensions(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (ProductItemDimensions, error)
+	GetProductItemGiftCard(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (ProductItemGiftCard, error)
+	GetProductItemOptions(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (map[string]string, error)
 	SetProductItemAttributes(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, attrs json.RawMessage) error
 	SetProductItemImages(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, images []string) error
-	SetProductItemPrice(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, price float64) error
+	SetProductItemPrice(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, price Money) error
 	SetProductItemProduct(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, product *uint64, fs FileStorage) error
 	SetProductItemQuantityInStock(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, quantity uint64) error
 	SetProductItemName(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, name string) error
 	SetProductItemSKU(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, sku string) error
+	SetProductItemWeight(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, weight float64) error
+	SetProductItemDimensions(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, dimensions ProductItemDimensions) error
+	SetProductItemGiftCard(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, giftCard ProductItemGiftCard) error
+	SetProductItemOptions(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, options map[string]string) error
 	GetProductItemUserReviews(ctx context.Context, form *ProductItemForm[AccountID], pid uint64, ids []uint64, reviewForms []*UserReviewForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*UserReviewForm[AccountID], error)
 	GetProductItemUserReviewCount(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (uint64, error)
 	CalculateProductItemAverageRating(ctx context.Context, form *ProductItemForm[AccountID], pid uint64) (float64, error)
@@ -390,7 +484,7 @@ type DBShippingMethodManager interface {
 	GetShippingMethodByName(ctx context.Context, name string, methodForm *ShippingMethodForm) (uint64, error)
 	GetShippingMethodCount(ctx context.Context) (uint64, error)
 	GetShippingMethods(ctx context.Context, shippingMethods []uint64, methodForms []*ShippingMethodForm, skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*ShippingMethodForm, error)
-	NewShippingMethod(ctx context.Context, name string, price float64, methodForm *ShippingMethodForm) (uint64, error)
+	NewShippingMethod(ctx context.Context, name string, price Money, methodForm *ShippingMethodForm) (uint64, error)
 	RemoveAllShippingMethods(ctx context.Context) error
 	RemoveShippingMethod(ctx context.Context, shippingMethod uint64) error
 	InitShippingMethodManager(ctx context.Context) error
@@ -400,8 +494,8 @@ type DBShippingMethodManager interface {
 type DBShippingMethod interface {
 	GetShippingMethodName(ctx context.Context, form *ShippingMethodForm, id uint64) (string, error)
 	SetShippingMethodName(ctx context.Context, form *ShippingMethodForm, id uint64, name string) error
-	GetShippingMethodPrice(ctx context.Context, form *ShippingMethodForm, id uint64) (float64, error)
-	SetShippingMethodPrice(ctx context.Context, form *ShippingMethodForm, id uint64, price float64) error
+	GetShippingMethodPrice(ctx context.Context, form *ShippingMethodForm, id uint64) (Money, error)
+	SetShippingMethodPrice(ctx context.Context, form *ShippingMethodForm, id uint64, price Money) error
 }
 
 type DBOrderStatusManager interface {
@@ -416,6 +510,10 @@ type DBOrderStatusManager interface {
 	RemoveOrderStatus(ctx context.Context, status uint64) error
 	InitOrderStatusManager(ctx context.Context) error
 	FillOrderStatusWithID(ctx context.Context, sid uint64, statusForm *OrderStatusForm) error
+	AddOrderStatusTransition(ctx context.Context, from uint64, to uint64) error
+	RemoveOrderStatusTransition(ctx context.Context, from uint64, to uint64) error
+	GetOrderStatusTransitions(ctx context.Context, from uint64, status []uint64, statusForms []*OrderStatusForm) ([]uint64, []*OrderStatusForm, error)
+	ExistsOrderStatusTransition(ctx context.Context, from uint64, to uint64) (bool, error)
 }
 
 type DBOrderStatus interface {
@@ -490,17 +588,27 @@ type DBUserFactorManager[AccountID comparable] interface {
 	RemoveAllUserFactors(ctx context.Context) error
 	RemoveUserAccountFactors(ctx context.Context, aid AccountID) error
 	FillUserFactorWithID(ctx context.Context, fid uint64, factorForm *UserFactorForm[AccountID]) error
+	GetUserFactorIDWithInvoiceNumber(ctx context.Context, number InvoiceNumber) (uint64, error)
 }
 
 type DBUserFactor[AccountID comparable] interface {
-	GetUserFactorProducts(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (json.RawMessage, error)
-	SetUserFactorProducts(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, products json.RawMessage) error
-	GetUserFactorDiscount(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (float64, error)
-	SetUserFactorDiscount(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, discount float64) error
-	GetUserFactorTax(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (float64, error)
-	SetUserFactorTax(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, tax float64) error
-	GetUserFactorAmountPaid(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (float64, error)
-	SetUserFactorAmountPaid(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, amountPaid float64) error
+	GetUserFactorOrderID(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (uint64, error)
+	GetUserFactorInvoiceNumber(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (InvoiceNumber, error)
+	GetUserFactorIssuedAt(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (time.Time, error)
+	GetUserFactorLines(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) ([]FactorLine, error)
+	SetUserFactorLines(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, lines []FactorLine) error
+	GetUserFactorDiscount(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (Money, error)
+	SetUserFactorDiscount(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, discount Money) error
+	GetUserFactorTax(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (Money, error)
+	SetUserFactorTax(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, tax Money) error
+	GetUserFactorTaxLines(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) ([]TaxLine, error)
+	SetUserFactorTaxLines(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, lines []TaxLine) error
+	GetUserFactorAmountPaid(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (Money, error)
+	SetUserFactorAmountPaid(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, amountPaid Money) error
+	GetUserFactorPayments(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, payments []OrderPayment[AccountID]) ([]OrderPayment[AccountID], error)
+	GetUserFactorCreditNotes(ctx context.Context, form *UserFactorForm[AccountID], fid uint64, creditNotes []CreditNote[AccountID]) ([]CreditNote[AccountID], error)
+	// GetUserFactorBuyer returns the name of the account and the shipping address of the order of the factor.
+	GetUserFactorBuyer(ctx context.Context, form *UserFactorForm[AccountID], fid uint64) (InvoiceParty, error)
 }
 
 type DBUserDiscountResult[AccountID comparable] struct {
@@ -510,7 +618,7 @@ type DBUserDiscountResult[AccountID comparable] struct {
 
 type DBUserDiscountManager[AccountID comparable] interface {
 	InitUserDiscountManager(ctx context.Context) error
-	NewUserDiscount(ctx context.Context, ownerAccountID AccountID, value float64, validCount int64, discountForm *UserDiscountForm[AccountID]) (uint64, error)
+	NewUserDiscount(ctx context.Context, ownerAccountID AccountID, value Money, validCount int64, discountForm *UserDiscountForm[AccountID]) (uint64, error)
 	RemoveUserDiscount(ctx context.Context, discountID uint64) error
 	RemoveAllUserDiscounts(ctx context.Context) error
 	GetUserDiscountCount(ctx context.Context) (uint64, error)
@@ -519,13 +627,40 @@ type DBUserDiscountManager[AccountID comparable] interface {
 	ExistsUserDiscountCode(ctx context.Context, code string) (bool, error)
 	GetUserDiscountsForAccount(ctx context.Context, ownerAccountID AccountID, ids []uint64, discountForms []*UserDiscountForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*UserDiscountForm[AccountID], error)
 	FillUserDiscountWithID(ctx context.Context, did uint64, discountForm *UserDiscountForm[AccountID]) error
+	// PreviewUserDiscount must apply the same rules as OrderUserShoppingCart, a nil shippingCost
+	// stands for the price of the shipping method.
+	PreviewUserDiscount(ctx context.Context, code string, sid uint64, shippingMethod uint64, shippingCost *Money) (UserDiscountPreview, error)
+	// NewUserDiscountCampaign stores the campaign without codes, it sets the ID and CreatedAt of campaign.
+	NewUserDiscountCampaign(ctx context.Context, ownerAccountID AccountID, campaign *UserDiscountCampaign[AccountID]) (uint64, error)
+	// AddUserDiscountCampaignCodes creates discounts with the rules of the campaign, codes which already exist are skipped.
+	// It returns the number of discounts created.
+	AddUserDiscountCampaignCodes(ctx context.Context, cid uint64, codes []string) (int64, error)
+	GetUserDiscountCampaign(ctx context.Context, cid uint64, campaign *UserDiscountCampaign[AccountID]) error
+	GetUserDiscountCampaigns(ctx context.Context, campaigns []UserDiscountCampaign[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserDiscountCampaign[AccountID], error)
+	GetUserDiscountCampaignDiscounts(ctx context.Context, cid uint64, ids []uint64, discountForms []*UserDiscountForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*UserDiscountForm[AccountID], error)
+	GetUserDiscountCampaignReport(ctx context.Context, cid uint64) (UserDiscountCampaignReport, error)
+	RemoveUserDiscountCampaign(ctx context.Context, cid uint64) error
 }
 
 type DBUserDiscount[AccountID comparable] interface {
 	GetUserDiscountCode(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (string, error)
 	SetUserDiscountCode(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, code string) error
-	GetUserDiscountValue(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (float64, error)
-	SetUserDiscountValue(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, value float64) error
+	GetUserDiscountValue(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (Money, error)
+	SetUserDiscountValue(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, value Money) error
+	GetUserDiscountType(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (UserDiscountType, error)
+	SetUserDiscountType(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, discountType UserDiscountType) error
+	GetUserDiscountPercentage(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (float64, error)
+	SetUserDiscountPercentage(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, percentage float64) error
+	GetUserDiscountMaxValue(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (Money, error)
+	SetUserDiscountMaxValue(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, maxValue Money) error
+	GetUserDiscountMinOrderAmount(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (Money, error)
+	SetUserDiscountMinOrderAmount(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, minOrderAmount Money) error
+	GetUserDiscountStartsAt(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (time.Time, error)
+	SetUserDiscountStartsAt(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, startsAt time.Time) error
+	GetUserDiscountEndsAt(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (time.Time, error)
+	SetUserDiscountEndsAt(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, endsAt time.Time) error
+	GetUserDiscountScope(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (UserDiscountScope, error)
+	SetUserDiscountScope(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, scope UserDiscountScope) error
 	GetUserDiscountValidCount(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) (int64, error)
 	SetUserDiscountValidCount(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, validCount int64) error
 	DecrementUserDiscountValidCount(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64) error
@@ -533,3 +668,95 @@ type DBUserDiscount[AccountID comparable] interface {
 	AddUserDiscountUsedBy(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, accountID AccountID) error
 	HasUserUsedDiscount(ctx context.Context, form *UserDiscountForm[AccountID], discountID uint64, accountID AccountID) (bool, error)
 }
+
+type DBReturnRequestResult[AccountID comparable] struct {
+	ID  uint64
+	AID AccountID
+}
+
+type DBReturnRequestManager[AccountID comparable] interface {
+	InitReturnRequestManager(ctx context.Context) error
+	// NewReturnRequest fails with ErrReturnExceedsQuantity when an item exceeds what was ordered minus what was
+	// refunded and what other open returns of the order hold.
+	NewReturnRequest(ctx context.Context, aid AccountID, oid uint64, items []ReturnItem, comment string, form *ReturnRequestForm[AccountID]) (uint64, error)
+	RemoveAllReturnRequests(ctx context.Context) error
+	GetReturnRequestCount(ctx context.Context) (uint64, error)
+	GetReturnRequests(ctx context.Context, ids []DBReturnRequestResult[AccountID], forms []*ReturnRequestForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]DBReturnRequestResult[AccountID], []*ReturnRequestForm[AccountID], error)
+	GetReturnRequestsWithStatus(ctx context.Context, status string, ids []DBReturnRequestResult[AccountID], forms []*ReturnRequestForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]DBReturnRequestResult[AccountID], []*ReturnRequestForm[AccountID], error)
+	GetOrderReturnRequests(ctx context.Context, oid uint64, ids []DBReturnRequestResult[AccountID], forms []*ReturnRequestForm[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]DBReturnRequestResult[AccountID], []*ReturnRequestForm[AccountID], error)
+	FillReturnRequestWithID(ctx context.Context, rid uint64, form *ReturnRequestForm[AccountID]) error
+}
+
+type DBReturnRequest[AccountID comparable] interface {
+	GetReturnRequestOrderID(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64) (uint64, error)
+	GetReturnRequestItems(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64) ([]ReturnItem, error)
+	GetReturnRequestReceivedItems(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64) ([]ReturnItem, error)
+	GetReturnRequestComment(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64) (string, error)
+	GetReturnRequestCreatedAt(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64) (time.Time, error)
+	GetReturnRequestStatus(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64) (string, error)
+	GetReturnRequestResolution(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64) (string, error)
+	GetReturnRequestCreditNoteID(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64) (uint64, error)
+	// UpdateReturnRequestStatus fails with ErrReturnRequestStatus unless the request is in the from status.
+	UpdateReturnRequestStatus(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64, from string, to string, resolution string) error
+	// ReceiveReturnRequest moves an approved request to received, the items can't exceed the requested ones.
+	ReceiveReturnRequest(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64, items []ReturnItem, resolution string) error
+	// SetReturnRequestCreditNote links a refunding request to its credit note and keeps it refunding.
+	SetReturnRequestCreditNote(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64, creditNoteID uint64) error
+	// SetReturnRequestRefunded moves a refunding request to refunded.
+	SetReturnRequestRefunded(ctx context.Context, form *ReturnRequestForm[AccountID], rid uint64, creditNoteID uint64) error
+}
+
+type DBShipmentManager interface {
+	InitShipmentManager(ctx context.Context) error
+	// NewShipment fails with ErrOrderNotShippable unless the order is paid, shipped or idle (orders from before payments were
+	// tracked were paid at checkout), and with ErrShipmentExceedsQuantity
+	// when an item exceeds what was ordered minus what was refunded and what the other shipments of the order hold.
+	NewShipment(ctx context.Context, oid uint64, carrier string, trackingNumber string, items []ShipmentItem, form *ShipmentForm) (uint64, error)
+	RemoveShipment(ctx context.Context, shid uint64) error
+	RemoveAllShipments(ctx context.Context) error
+	GetShipmentCount(ctx context.Context) (uint64, error)
+	GetShipments(ctx context.Context, ids []uint64, forms []*ShipmentForm, skip int64, limit int64, queueOrder QueueOrder) ([]uint64, []*ShipmentForm, error)
+	GetOrderShipments(ctx context.Context, oid uint64, ids []uint64, forms []*ShipmentForm) ([]uint64, []*ShipmentForm, error)
+	GetShipmentByTrackingNumber(ctx context.Context, trackingNumber string, form *ShipmentForm) (uint64, error)
+	FillShipmentWithID(ctx context.Context, shid uint64, form *ShipmentForm) error
+}
+
+type DBShipment interface {
+	GetShipmentOrderID(ctx context.Context, form *ShipmentForm, shid uint64) (uint64, error)
+	GetShipmentItems(ctx context.Context, form *ShipmentForm, shid uint64) ([]ShipmentItem, error)
+	GetShipmentCarrier(ctx context.Context, form *ShipmentForm, shid uint64) (string, error)
+	SetShipmentCarrier(ctx context.Context, form *ShipmentForm, shid uint64, carrier string) error
+	GetShipmentTrackingNumber(ctx context.Context, form *ShipmentForm, shid uint64) (string, error)
+	SetShipmentTrackingNumber(ctx context.Context, form *ShipmentForm, shid uint64, trackingNumber string) error
+	GetShipmentShippedAt(ctx context.Context, form *ShipmentForm, shid uint64) (time.Time, error)
+	GetShipmentDeliveredAt(ctx context.Context, form *ShipmentForm, shid uint64) (time.Time, error)
+	ShipShipment(ctx context.Context, form *ShipmentForm, shid uint64, at time.Time) error
+	// DeliverShipment delivers the order like DeliverUserOrder with comment in the same transaction once every ordered
+	// item which wasn't refunded is in a delivered shipment.
+	DeliverShipment(ctx context.Context, form *ShipmentForm, shid uint64, at time.Time, comment string) error
+}
+
+type DBGiftCardManager[AccountID comparable] interface {
+	InitGiftCardManager(ctx context.Context) error
+	// NewGiftCard generates the code of the gift card and records its issue transaction.
+	NewGiftCard(ctx context.Context, ownerAccountID AccountID, balance Money, expiresAt time.Time, giftCard *GiftCard[AccountID]) (uint64, error)
+	GetGiftCard(ctx context.Context, gcid uint64, giftCard *GiftCard[AccountID]) error
+	// GetGiftCardByCode fails with ErrGiftCardNotFound when no gift card has the code.
+	GetGiftCardByCode(ctx context.Context, code string, giftCard *GiftCard[AccountID]) error
+	GetGiftCards(ctx context.Context, giftCards []GiftCard[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]GiftCard[AccountID], error)
+	GetGiftCardsForAccount(ctx context.Context, ownerAccountID AccountID, giftCards []GiftCard[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]GiftCard[AccountID], error)
+	GetGiftCardTransactions(ctx context.Context, gcid uint64, transactions []GiftCardTransaction, skip int64, limit int64, queueOrder QueueOrder) ([]GiftCardTransaction, error)
+	// RedeemGiftCard takes amount off the balance for the payment and returns the new balance. It fails with
+	// ErrInsufficientFunds or ErrGiftCardExpired, a payment which was already redeemed isn't taken twice.
+	RedeemGiftCard(ctx context.Context, gcid uint64, amount Money, oid uint64, paymentID uint64) (Money, error)
+	// RefundGiftCard puts amount back on the balance, even when the gift card is expired, and returns the new balance.
+	// refunded is what was refunded of the payment before, a refund of the payment with the same refunded isn't put back twice.
+	RefundGiftCard(ctx context.Context, gcid uint64, amount Money, oid uint64, paymentID uint64, refunded Money) (Money, error)
+}
+
+type DBAccountingManager[AccountID comparable] interface {
+	InitAccountingManager(ctx context.Context) error
+	// GetAccountingRecords returns up to limit records of the kind after the cursor, ordered by time and id,
+	// which were created before to. It fails with ErrUnknownAccountingRecordKind for other kinds.
+	GetAccountingRecords(ctx context.Context, kind AccountingRecordKind, cursor AccountingCursor, to time.Time, records []AccountingRecord[AccountID], limit int64) ([]AccountingRecord[AccountID], error)
+}
@@ -3,6 +3,8 @@ package dbsamples
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/MobinYengejehi/scommerce/scommerce"
@@ -41,8 +43,8 @@ func (db *PostgreDatabase) BanUserAccount(ctx context.Context, form *scommerce.U
 	return nil
 }
 
-func (db *PostgreDatabase) CalculateUserAccountTotalDepts(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID) (float64, error) {
-	var total float64
+func (db *PostgreDatabase) CalculateUserAccountTotalDepts(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID) (scommerce.Money, error) {
+	var total int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`
@@ -69,16 +71,16 @@ func (db *PostgreDatabase) CalculateUserAccountTotalDepts(ctx context.Context, f
 		aid,
 	).Scan(&total)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.TotalDepts = &total
+		form.TotalDepts = db.moneyPtr(total)
 	}
-	return total, nil
+	return db.money(total), nil
 }
 
-func (db *PostgreDatabase) CalculateUserAccountTotalDeptsWithoutPenalty(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID) (float64, error) {
-	var total float64
+func (db *PostgreDatabase) CalculateUserAccountTotalDeptsWithoutPenalty(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID) (scommerce.Money, error) {
+	var total int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`
@@ -97,44 +99,38 @@ func (db *PostgreDatabase) CalculateUserAccountTotalDeptsWithoutPenalty(ctx cont
 		aid,
 	).Scan(&total)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.TotalDeptsWithoutPenalty = &total
+		form.TotalDeptsWithoutPenalty = db.moneyPtr(total)
 	}
-	return total, nil
+	return db.money(total), nil
 }
 
-func (db *PostgreDatabase) ChargeUserAccountWallet(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, currency float64) error {
-	var newWallet float64
-	err := db.PgxPool.QueryRow(
-		ctx,
-		`update users set "wallet" = "wallet" + $1 where "id" = $2 returning "wallet"`,
-		currency,
-		aid,
-	).Scan(&newWallet)
+func (db *PostgreDatabase) ChargeUserAccountWallet(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, currency scommerce.Money, entry *scommerce.WalletEntry[UserAccountID], idempotencyKey string) error {
+	currencyUnits, err := db.minorUnits(currency)
 	if err != nil {
 		return err
 	}
-	if form != nil {
-		form.WalletCurrency = &newWallet
-	}
-	return nil
+	fingerprint := "account=" + strconv.FormatUint(aid, 10) + ";amount=" + strconv.FormatInt(currencyUnits, 10)
+	return db.moveWalletIdempotent(ctx, form, aid, idempotencyScopeWalletCharge, idempotencyKey, fingerprint, scommerce.WalletTransactionCharge, entry, func(wallet int64) (int64, error) {
+		return wallet + currencyUnits, nil
+	})
 }
 
-func (db *PostgreDatabase) FineUserAccount(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, amount float64) error {
-	var newPenalty float64
-	err := db.PgxPool.QueryRow(
-		ctx,
-		`update users set "wallet" = "wallet" - $1 where "id" = $2 returning "wallet"`,
-		amount,
-		aid,
-	).Scan(&newPenalty)
+func (db *PostgreDatabase) FineUserAccount(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, amount scommerce.Money, entry *scommerce.WalletEntry[UserAccountID]) error {
+	amountUnits, err := db.minorUnits(amount)
+	if err != nil {
+		return err
+	}
+	newPenalty, err := db.moveWallet(ctx, aid, scommerce.WalletTransactionFine, entry, func(wallet int64) int64 {
+		return wallet - amountUnits
+	})
 	if err != nil {
 		return err
 	}
 	if form != nil {
-		form.Penalty = &newPenalty
+		form.Penalty = db.moneyPtr(newPenalty)
 	}
 	return nil
 }
@@ -616,7 +612,7 @@ func (db *PostgreDatabase) GetUserAccountOrders(ctx context.Context, form *scomm
 		var id uint64
 		var userID UserAccountID
 		var orderDate time.Time
-		var orderTotal float64
+		var orderTotal int64
 		var userComment *string
 		var deliveryDate *time.Time
 		var deliveryComment *string
@@ -649,7 +645,7 @@ func (db *PostgreDatabase) GetUserAccountOrders(ctx context.Context, form *scomm
 			ID:               id,
 			UserAccountID:    userID,
 			Date:             &orderDate,
-			Total:            &orderTotal,
+			Total:            db.moneyPtr(orderTotal),
 			UserComment:      userComment,
 			DeliveryDate:     deliveryDate,
 			DeliveryComment:  deliveryComment,
@@ -940,7 +936,7 @@ func (db *PostgreDatabase) GetUserAccountShoppingCarts(ctx context.Context, form
 	for rows.Next() {
 		var id uint64
 		var sessionText string
-		var dept float64
+		var dept int64
 		if err := rows.Scan(&id, &sessionText, &dept); err != nil {
 			return nil, nil, err
 		}
@@ -949,7 +945,7 @@ func (db *PostgreDatabase) GetUserAccountShoppingCarts(ctx context.Context, form
 			ID:            id,
 			UserAccountID: aid,
 			SessionText:   &sessionText,
-			Dept:          &dept,
+			Dept:          db.moneyPtr(dept),
 		})
 	}
 
@@ -977,24 +973,24 @@ func (db *PostgreDatabase) GetUserAccountToken(ctx context.Context, form *scomme
 	return token, nil
 }
 
-func (db *PostgreDatabase) GetUserAccountWalletCurrency(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID) (float64, error) {
-	var wallet float64
+func (db *PostgreDatabase) GetUserAccountWalletCurrency(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID) (scommerce.Money, error) {
+	var wallet int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select "wallet" from users where "id" = $1`,
 		aid,
 	).Scan(&wallet)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.WalletCurrency = &wallet
+		form.WalletCurrency = db.moneyPtr(wallet)
 	}
-	return wallet, nil
+	return db.money(wallet), nil
 }
 
 func (db *PostgreDatabase) HasUserAccountPenalty(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID) (bool, error) {
-	var walletCurrency float64
+	var walletCurrency int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select coalesce("wallet", 0) from users where "id" = $1`,
@@ -1007,10 +1003,10 @@ func (db *PostgreDatabase) HasUserAccountPenalty(ctx context.Context, form *scom
 	if form != nil {
 		penalty := -walletCurrency
 		if hasPenalty {
-			form.Penalty = &penalty
+			form.Penalty = db.moneyPtr(penalty)
 		} else {
 			penalty = 0
-			form.Penalty = &penalty
+			form.Penalty = db.moneyPtr(penalty)
 		}
 	}
 	return hasPenalty, nil
@@ -1448,18 +1444,19 @@ func (db *PostgreDatabase) SetUserAccountPassword(ctx context.Context, form *sco
 	return nil
 }
 
-func (db *PostgreDatabase) SetUserAccountPenalty(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, penalty float64) error {
-	_, err := db.PgxPool.Exec(
-		ctx,
-		`update users set "wallet" = -$1 where "id" = $2`,
-		penalty,
-		aid,
-	)
+func (db *PostgreDatabase) SetUserAccountPenalty(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, penalty scommerce.Money, entry *scommerce.WalletEntry[UserAccountID]) error {
+	penaltyUnits, err := db.minorUnits(penalty)
+	if err != nil {
+		return err
+	}
+	_, err = db.moveWallet(ctx, aid, scommerce.WalletTransactionAdjustment, entry, func(wallet int64) int64 {
+		return -penaltyUnits
+	})
 	if err != nil {
 		return err
 	}
 	if form != nil {
-		form.Penalty = &penalty
+		form.Penalty = db.moneyPtr(penaltyUnits)
 	}
 	return nil
 }
@@ -1545,39 +1542,89 @@ func (db *PostgreDatabase) SetUserAccountToken(ctx context.Context, form *scomme
 	return nil
 }
 
-func (db *PostgreDatabase) SetUserAccountWalletCurrency(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, currency float64) error {
-	_, err := db.PgxPool.Exec(
-		ctx,
-		`update users set "wallet" = $1 where "id" = $2`,
-		currency,
-		aid,
-	)
+func (db *PostgreDatabase) SetUserAccountWalletCurrency(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, currency scommerce.Money, entry *scommerce.WalletEntry[UserAccountID]) error {
+	currencyUnits, err := db.minorUnits(currency)
+	if err != nil {
+		return err
+	}
+	_, err = db.moveWallet(ctx, aid, scommerce.WalletTransactionAdjustment, entry, func(wallet int64) int64 {
+		return currencyUnits
+	})
 	if err != nil {
 		return err
 	}
 	if form != nil {
-		form.WalletCurrency = &currency
+		form.WalletCurrency = db.moneyPtr(currencyUnits)
 	}
 	return nil
 }
 
-func (db *PostgreDatabase) TransferUserAccountCurrency(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, to UserAccountID, currency float64) error {
-	var sourceNewWallet float64
-	var destNewWallet float64
+func (db *PostgreDatabase) TransferUserAccountCurrency(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, to UserAccountID, currency scommerce.Money, entry *scommerce.WalletEntry[UserAccountID], idempotencyKey string) error {
+	currencyUnits, err := db.minorUnits(currency)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		SourceWallet      int64 `json:"source_wallet"`
+		DestinationWallet int64 `json:"destination_wallet"`
+	}
 
-	err := db.PgxPool.QueryRow(
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if idempotencyKey != "" {
+		fingerprint := "source=" + strconv.FormatUint(aid, 10) + ";destination=" + strconv.FormatUint(to, 10) + ";amount=" + strconv.FormatInt(currencyUnits, 10)
+		response, err := db.claimIdempotencyKey(ctx, tx, idempotencyScopeWalletTransfer, idempotencyKey, fingerprint)
+		if err != nil {
+			return err
+		}
+		if response != nil {
+			if err := json.Unmarshal(response, &result); err != nil {
+				return err
+			}
+			if form != nil {
+				form.WalletCurrency = db.moneyPtr(result.SourceWallet)
+			}
+			return nil
+		}
+	}
+
+	err = tx.QueryRow(
 		ctx,
 		`select * from transfer_user_currency($1, $2, $3)`,
 		aid,
 		to,
-		currency,
-	).Scan(&sourceNewWallet, &destNewWallet)
+		currencyUnits,
+	).Scan(&result.SourceWallet, &result.DestinationWallet)
 	if err != nil {
 		return err
 	}
 
+	err = db.postWalletJournal(
+		ctx,
+		tx,
+		scommerce.WalletTransactionTransfer,
+		entry,
+		walletPosting{ledger: scommerce.WalletLedgerWallet, userID: &aid, counterpartyID: &to, amount: -currencyUnits, balanceAfter: &result.SourceWallet},
+		walletPosting{ledger: scommerce.WalletLedgerWallet, userID: &to, counterpartyID: &aid, amount: currencyUnits, balanceAfter: &result.DestinationWallet},
+	)
+	if err != nil {
+		return err
+	}
+	if idempotencyKey != "" {
+		if err := db.completeIdempotencyKey(ctx, tx, idempotencyScopeWalletTransfer, idempotencyKey, result); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
 	if form != nil {
-		form.WalletCurrency = &sourceNewWallet
+		form.WalletCurrency = db.moneyPtr(result.SourceWallet)
 	}
 
 	return nil
@@ -1617,6 +1664,20 @@ func (db *PostgreDatabase) ValidateUserAccountPassword(ctx context.Context, form
 	return valid, nil
 }
 
+func (db *PostgreDatabase) WithdrawUserAccountWallet(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, amount scommerce.Money, entry *scommerce.WalletEntry[UserAccountID], idempotencyKey string) error {
+	amountUnits, err := db.minorUnits(amount)
+	if err != nil {
+		return err
+	}
+	fingerprint := "account=" + strconv.FormatUint(aid, 10) + ";amount=" + strconv.FormatInt(amountUnits, 10)
+	return db.moveWalletIdempotent(ctx, form, aid, idempotencyScopeWalletWithdraw, idempotencyKey, fingerprint, scommerce.WalletTransactionCheckout, entry, func(wallet int64) (int64, error) {
+		if wallet < amountUnits {
+			return 0, errors.Join(scommerce.ErrInsufficientFunds, errors.New("wallet balance is "+db.money(wallet).String()+", required amount is "+amount.String()))
+		}
+		return wallet - amountUnits, nil
+	})
+}
+
 func (db *PostgreDatabase) GetUserAccountUserReviews(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, ids []uint64, reviewForms []*scommerce.UserReviewForm[UserAccountID], skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]uint64, []*scommerce.UserReviewForm[UserAccountID], error) {
 	resultIDs := ids
 	if resultIDs == nil {
@@ -1737,7 +1798,7 @@ func (db *PostgreDatabase) GetUserAccountUserFactorCount(ctx context.Context, fo
 	return db.GetUserFactorCount(ctx, aid)
 }
 
-func (db *PostgreDatabase) NewUserAccountDiscount(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, value float64, validCount int64, discountForm *scommerce.UserDiscountForm[UserAccountID]) (uint64, error) {
+func (db *PostgreDatabase) NewUserAccountDiscount(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, value scommerce.Money, validCount int64, discountForm *scommerce.UserDiscountForm[UserAccountID]) (uint64, error) {
 	return db.NewUserDiscount(ctx, aid, value, validCount, discountForm)
 }
 
@@ -1798,7 +1859,7 @@ func (db *PostgreDatabase) GetUserAccountDiscounts(ctx context.Context, form *sc
 		var id uint64
 		var userID UserAccountID
 		var code string
-		var value float64
+		var value int64
 		var validCount int64
 
 		if err := rows.Scan(&id, &userID, &code, &value, &validCount); err != nil {
@@ -1810,7 +1871,7 @@ func (db *PostgreDatabase) GetUserAccountDiscounts(ctx context.Context, form *sc
 			ID:            id,
 			UserAccountID: userID,
 			Code:          &code,
-			Value:         &value,
+			Value:         db.moneyPtr(value),
 			ValidCount:    &validCount,
 		})
 	}
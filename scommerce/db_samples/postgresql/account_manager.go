@@ -25,7 +25,7 @@ func (db *PostgreDatabase) AuthenticateUserAccount(ctx context.Context, token st
 	var isActive bool
 	var profileImages json.RawMessage
 	var bio pgtype.Text
-	var wallet float64
+	var wallet int64
 	var banTill pgtype.Timestamptz
 	var banReason pgtype.Text
 	err := db.PgxPool.QueryRow(
@@ -136,7 +136,7 @@ func (db *PostgreDatabase) AuthenticateUserAccount(ctx context.Context, token st
 		if bio.Valid {
 			accountForm.Bio = &bio.String
 		}
-		accountForm.WalletCurrency = &wallet
+		accountForm.WalletCurrency = db.moneyPtr(wallet)
 		accountForm.IsBannedState = bReason
 	}
 
@@ -153,7 +153,7 @@ func (db *PostgreDatabase) GetUserAccount(ctx context.Context, token string, acc
 	var isActive bool
 	var profileImagesRaw json.RawMessage
 	var bio pgtype.Text
-	var wallet float64
+	var wallet int64
 	var banTill pgtype.Timestamptz
 	var banReason pgtype.Text
 
@@ -233,7 +233,7 @@ func (db *PostgreDatabase) GetUserAccount(ctx context.Context, token string, acc
 		if bio.Valid {
 			accountForm.Bio = &bio.String
 		}
-		accountForm.WalletCurrency = &wallet
+		accountForm.WalletCurrency = db.moneyPtr(wallet)
 		accountForm.IsBannedState = bReason
 	}
 
@@ -298,7 +298,7 @@ func (db *PostgreDatabase) GetUserAccounts(ctx context.Context, accounts []UserA
 		var isActive bool
 		var profileImages json.RawMessage
 		var bio pgtype.Text
-		var wallet float64
+		var wallet int64
 		var banTill pgtype.Timestamptz
 		var banReason pgtype.Text
 		if err := rows.Scan(
@@ -325,7 +325,7 @@ func (db *PostgreDatabase) GetUserAccounts(ctx context.Context, accounts []UserA
 			UserLevel:      &level,
 			IsActiveState:  &isActive,
 			Bio:            nil,
-			WalletCurrency: &wallet,
+			WalletCurrency: db.moneyPtr(wallet),
 		}
 
 		if firstName.Valid {
@@ -389,40 +389,47 @@ func (db *PostgreDatabase) InitUserAccountManager(ctx context.Context) error {
 				is_active      boolean not null default true,
 				profile_images jsonb,
 				bio            varchar(2000),
-				wallet         double precision default 0,
+				wallet         numeric(20, 0) default 0,
 				ban_till       timestamptz default null,
 				ban_reason     varchar(1000) default null
 			);
 
+			drop function if exists transfer_user_currency(bigint, bigint, double precision);
+
 			create or replace function transfer_user_currency(
 				source_user_id bigint,
 				destination_user_id bigint,
-				amount double precision
+				amount numeric
 			) returns table(
-				source_new_wallet double precision,
-				destination_new_wallet double precision
+				source_new_wallet numeric,
+				destination_new_wallet numeric
 			) as $$
 			declare
-				v_source_wallet double precision;
-				v_destination_wallet double precision;
+				v_source_wallet numeric;
+				v_destination_wallet numeric;
 			begin
 				if amount <= 0 then
 					raise exception 'Transfer amount must be positive';
 				end if;
 
-				select wallet into v_source_wallet
+				-- lock both wallets in id order, so opposite transfers between the same users can't deadlock
+				perform 1
 				from users
-				where id = source_user_id
+				where id in (source_user_id, destination_user_id)
+				order by id
 				for update;
 
+				select wallet into v_source_wallet
+				from users
+				where id = source_user_id;
+
 				if v_source_wallet is null then
 					raise exception 'Source user not found';
 				end if;
 
 				select wallet into v_destination_wallet
 				from users
-				where id = destination_user_id
-				for update;
+				where id = destination_user_id;
 
 				if v_destination_wallet is null then
 					raise exception 'Destination user not found';
@@ -449,7 +456,16 @@ func (db *PostgreDatabase) InitUserAccountManager(ctx context.Context) error {
 			$$ language plpgsql;
 		`,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := db.migrateMoneyColumns(ctx, "users", []string{"wallet"}); err != nil {
+		return err
+	}
+	if err := db.initWalletLedger(ctx); err != nil {
+		return err
+	}
+	return db.initIdempotencyKeys(ctx)
 }
 
 func (db *PostgreDatabase) NewUserAccount(ctx context.Context, token string, password string, accountForm *scommerce.UserAccountForm[UserAccountID]) (UserAccountID, error) {
@@ -458,7 +474,7 @@ func (db *PostgreDatabase) NewUserAccount(ctx context.Context, token string, pas
 	var roleID pgtype.Int8
 	var level int64
 	var isActive bool
-	var wallet float64
+	var wallet int64
 
 	hashedPassword, err := db.hashPassword(password)
 	if err != nil {
@@ -506,7 +522,7 @@ func (db *PostgreDatabase) NewUserAccount(ctx context.Context, token string, pas
 		}
 		accountForm.UserLevel = &level
 		accountForm.IsActiveState = &isActive
-		accountForm.WalletCurrency = &wallet
+		accountForm.WalletCurrency = db.moneyPtr(wallet)
 	}
 
 	return id, nil
@@ -552,7 +568,7 @@ func (db *PostgreDatabase) FillUserAccountWithID(ctx context.Context, aid UserAc
 	var isActive bool
 	var profileImagesRaw json.RawMessage
 	var bio pgtype.Text
-	var wallet float64
+	var wallet int64
 	var banTill pgtype.Timestamptz
 	var banReason pgtype.Text
 
@@ -632,7 +648,7 @@ func (db *PostgreDatabase) FillUserAccountWithID(ctx context.Context, aid UserAc
 	if bio.Valid {
 		accountForm.Bio = &bio.String
 	}
-	accountForm.WalletCurrency = &wallet
+	accountForm.WalletCurrency = db.moneyPtr(wallet)
 	accountForm.IsBannedState = bReason
 
 	return nil
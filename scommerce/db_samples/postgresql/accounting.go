@@ -0,0 +1,349 @@
+package dbsamples
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+)
+
+var _ scommerce.DBAccountingManager[UserAccountID] = &PostgreDatabase{}
+
+// accountingPaymentRow is a payment of an order as jsonb, the amount is in minor units.
+type accountingPaymentRow struct {
+	PaymentType string `json:"payment_type"`
+	Amount      int64  `json:"amount"`
+}
+
+// accountingOrderPayments aggregates the captured payments of an order in the order they were made.
+func accountingOrderPayments(orderID string) string {
+	return `
+		coalesce((
+			select jsonb_agg(jsonb_build_object('payment_type', coalesce(pt."name", p."gateway"), 'amount', p."captured_amount") order by p."id")
+			from order_payments p
+			left join payment_methods pm on pm."id" = p."payment_method_id"
+			left join payment_types pt on pt."id" = pm."payment_type_id"
+			where p."order_id" = ` + orderID + ` and p."captured_amount" > 0
+		), '[]'::jsonb)
+	`
+}
+
+func (db *PostgreDatabase) InitAccountingManager(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			create index if not exists idx_factors_issued_at on factors(issued_at, id);
+			create index if not exists credit_notes_created_idx on credit_notes(created_at, id);
+			create index if not exists wallet_transactions_created_idx on wallet_transactions(created_at, id) where ledger = 'wallet';
+		`,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) GetAccountingRecords(ctx context.Context, kind scommerce.AccountingRecordKind, cursor scommerce.AccountingCursor, to time.Time, records []scommerce.AccountingRecord[UserAccountID], limit int64) ([]scommerce.AccountingRecord[UserAccountID], error) {
+	if records == nil {
+		records = make([]scommerce.AccountingRecord[UserAccountID], 0, limit)
+	}
+	switch kind {
+	case scommerce.AccountingRecordFactor:
+		return db.getAccountingFactors(ctx, cursor, to, records, limit)
+	case scommerce.AccountingRecordRefund:
+		return db.getAccountingRefunds(ctx, cursor, to, records, limit)
+	case scommerce.AccountingRecordWallet:
+		return db.getAccountingWalletTransactions(ctx, cursor, to, records, limit)
+	}
+	return nil, scommerce.ErrUnknownAccountingRecordKind
+}
+
+func (db *PostgreDatabase) getAccountingFactors(ctx context.Context, cursor scommerce.AccountingCursor, to time.Time, records []scommerce.AccountingRecord[UserAccountID], limit int64) ([]scommerce.AccountingRecord[UserAccountID], error) {
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				f."id",
+				f."issued_at",
+				f."user_id",
+				coalesce(f."order_id", 0),
+				f."invoice_year",
+				f."invoice_sequence",
+				f."amount_paid",
+				f."discount",
+				f."tax",
+				f."tax_lines",
+				`+accountingOrderPayments(`f."order_id"`)+`
+			from factors f
+			where (f."issued_at", f."id") > ($1, $2) and f."issued_at" < $3
+			order by f."issued_at", f."id"
+			limit $4
+		`,
+		cursor.At,
+		cursor.ID,
+		to,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record := scommerce.AccountingRecord[UserAccountID]{Kind: scommerce.AccountingRecordFactor}
+		var invoiceNumber scommerce.InvoiceNumber
+		var amount, discount, tax int64
+		var rawTaxLines, rawPayments []byte
+		err := rows.Scan(
+			&record.ID,
+			&record.CreatedAt,
+			&record.AccountID,
+			&record.OrderID,
+			&invoiceNumber.Year,
+			&invoiceNumber.Sequence,
+			&amount,
+			&discount,
+			&tax,
+			&rawTaxLines,
+			&rawPayments,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if record.TaxLines, err = decodeTaxLines(rawTaxLines); err != nil {
+			return nil, err
+		}
+		payments, err := decodeAccountingPayments(rawPayments)
+		if err != nil {
+			return nil, err
+		}
+		record.FactorID = record.ID
+		record.InvoiceNumber = invoiceNumber.String()
+		record.Amount = db.money(amount)
+		record.Discount = db.money(discount)
+		record.Tax = db.money(tax)
+		record.BalanceAfter = db.money(0)
+		record.Payments = db.accountingPayments(payments, 0, amount, 1)
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// getAccountingRefunds reverses the tax lines of the factor in proportion to the credited amount and follows
+// refundPayments of the order, which pays back through the latest payments first, to find the payment types.
+func (db *PostgreDatabase) getAccountingRefunds(ctx context.Context, cursor scommerce.AccountingCursor, to time.Time, records []scommerce.AccountingRecord[UserAccountID], limit int64) ([]scommerce.AccountingRecord[UserAccountID], error) {
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				c."id",
+				c."created_at",
+				coalesce(c."user_id", 0),
+				coalesce(c."order_id", 0),
+				coalesce(c."factor_id", 0),
+				f."invoice_year",
+				f."invoice_sequence",
+				coalesce(f."amount_paid", 0),
+				coalesce(f."tax_lines", '[]'::jsonb),
+				c."amount",
+				coalesce(c."reason", ''),
+				coalesce((select sum(e."amount") from credit_notes e where e."order_id" = c."order_id" and e."status" = 'issued' and e."id" < c."id"), 0),
+				`+accountingOrderPayments(`c."order_id"`)+`
+			from credit_notes c
+			left join factors f on f."id" = c."factor_id"
+			where c."status" = 'issued' and (c."created_at", c."id") > ($1, $2) and c."created_at" < $3
+			order by c."created_at", c."id"
+			limit $4
+		`,
+		cursor.At,
+		cursor.ID,
+		to,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record := scommerce.AccountingRecord[UserAccountID]{Kind: scommerce.AccountingRecordRefund}
+		var invoiceYear *int
+		var invoiceSequence *uint64
+		var factorAmount, amount, refundedBefore int64
+		var rawTaxLines, rawPayments []byte
+		err := rows.Scan(
+			&record.ID,
+			&record.CreatedAt,
+			&record.AccountID,
+			&record.OrderID,
+			&record.FactorID,
+			&invoiceYear,
+			&invoiceSequence,
+			&factorAmount,
+			&rawTaxLines,
+			&amount,
+			&record.Description,
+			&refundedBefore,
+			&rawPayments,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if invoiceYear != nil && invoiceSequence != nil {
+			record.InvoiceNumber = scommerce.InvoiceNumber{Year: *invoiceYear, Sequence: *invoiceSequence}.String()
+		}
+
+		factorTaxLines, err := decodeTaxLines(rawTaxLines)
+		if err != nil {
+			return nil, err
+		}
+		// prorated in minor units like the credit note document, so the refund reverses exactly its tax
+		taxableAmounts := make([]int64, 0, len(factorTaxLines))
+		taxAmounts := make([]int64, 0, len(factorTaxLines))
+		for _, line := range factorTaxLines {
+			taxableAmounts = append(taxableAmounts, line.TaxableAmount.Amount)
+			taxAmounts = append(taxAmounts, line.Amount.Amount)
+		}
+		taxableAmounts = scommerce.ProrateAmounts(taxableAmounts, -amount, factorAmount)
+		taxAmounts = scommerce.ProrateAmounts(taxAmounts, -amount, factorAmount)
+		var tax int64
+		record.TaxLines = make([]scommerce.TaxLine, 0, len(factorTaxLines))
+		for i, line := range factorTaxLines {
+			line.TaxableAmount = scommerce.NewMoney(taxableAmounts[i], line.TaxableAmount.Currency)
+			line.Amount = scommerce.NewMoney(taxAmounts[i], line.Amount.Currency)
+			record.TaxLines = append(record.TaxLines, line)
+			tax += taxAmounts[i]
+		}
+
+		payments, err := decodeAccountingPayments(rawPayments)
+		if err != nil {
+			return nil, err
+		}
+		record.Amount = db.money(-amount)
+		record.Discount = db.money(0)
+		record.Tax = db.money(tax)
+		record.BalanceAfter = db.money(0)
+		record.Payments = db.accountingPayments(payments, refundedBefore, amount, -1)
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (db *PostgreDatabase) getAccountingWalletTransactions(ctx context.Context, cursor scommerce.AccountingCursor, to time.Time, records []scommerce.AccountingRecord[UserAccountID], limit int64) ([]scommerce.AccountingRecord[UserAccountID], error) {
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				t."id",
+				t."created_at",
+				coalesce(t."user_id", 0),
+				t."type",
+				t."amount",
+				coalesce(t."balance_after", 0),
+				coalesce((
+					select o."ledger" from wallet_transactions o
+					where o."journal_id" = t."journal_id" and o."id" <> t."id"
+					order by o."id" limit 1
+				), ''),
+				coalesce(t."reference_type", ''),
+				coalesce(t."reference_id", ''),
+				coalesce(t."description", '')
+			from wallet_transactions t
+			where t."ledger" = 'wallet' and (t."created_at", t."id") > ($1, $2) and t."created_at" < $3
+			order by t."created_at", t."id"
+			limit $4
+		`,
+		cursor.At,
+		cursor.ID,
+		to,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record := scommerce.AccountingRecord[UserAccountID]{Kind: scommerce.AccountingRecordWallet}
+		var amount, balanceAfter int64
+		err := rows.Scan(
+			&record.ID,
+			&record.CreatedAt,
+			&record.AccountID,
+			&record.Type,
+			&amount,
+			&balanceAfter,
+			&record.Counterparty,
+			&record.ReferenceType,
+			&record.ReferenceID,
+			&record.Description,
+		)
+		if err != nil {
+			return nil, err
+		}
+		switch record.ReferenceType {
+		case scommerce.WalletReferenceOrder:
+			record.OrderID, _ = strconv.ParseUint(record.ReferenceID, 10, 64)
+		case scommerce.WalletReferenceFactor:
+			record.FactorID, _ = strconv.ParseUint(record.ReferenceID, 10, 64)
+		}
+		record.Amount = db.money(amount)
+		record.Discount = db.money(0)
+		record.Tax = db.money(0)
+		record.BalanceAfter = db.money(balanceAfter)
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func decodeAccountingPayments(raw []byte) ([]accountingPaymentRow, error) {
+	payments := make([]accountingPaymentRow, 0)
+	if len(raw) == 0 {
+		return payments, nil
+	}
+	if err := json.Unmarshal(raw, &payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// accountingPayments takes amount from the payments of an order latest first, after skipping what earlier refunds took,
+// and sums it by payment type in the order the types were first paid with. Factors take everything in order with a
+// skip of 0, as sign 1 keeps the amounts while -1 negates them for refunds.
+func (db *PostgreDatabase) accountingPayments(payments []accountingPaymentRow, skip int64, amount int64, sign int64) []scommerce.AccountingPayment {
+	taken := make([]int64, len(payments))
+	for i := len(payments) - 1; i >= 0 && amount > 0; i-- {
+		available := payments[i].Amount
+		if skip > 0 {
+			skipped := min(skip, available)
+			skip -= skipped
+			available -= skipped
+		}
+		taken[i] = min(available, amount)
+		amount -= taken[i]
+	}
+
+	result := make([]scommerce.AccountingPayment, 0, len(payments))
+	index := make(map[string]int, len(payments))
+	for i, payment := range payments {
+		if taken[i] == 0 {
+			continue
+		}
+		j, ok := index[payment.PaymentType]
+		if !ok {
+			j = len(result)
+			index[payment.PaymentType] = j
+			result = append(result, scommerce.AccountingPayment{PaymentType: payment.PaymentType, Amount: db.money(0)})
+		}
+		result[j].Amount.Amount += sign * taken[i]
+	}
+	return result
+}
@@ -0,0 +1,378 @@
+package dbsamples
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// a credit note is pending from RefundUserOrder until CompleteUserOrderRefund, while its money is paid back, and it's
+// dated when it's issued so the accounting export, which walks credit notes by date, doesn't pass over it
+const (
+	creditNoteStatusPending = "pending"
+	creditNoteStatusIssued  = "issued"
+)
+
+func (db *PostgreDatabase) initCreditNotes(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			create table if not exists credit_notes(
+				id         bigint generated by default as identity primary key,
+				order_id   bigint references orders(id) on delete set null,
+				factor_id  bigint references factors(id) on delete set null,
+				user_id    bigint references users(id) on delete set null,
+				items      jsonb not null default '[]'::jsonb,
+				amount     numeric(20, 0) not null,
+				reason     text,
+				created_at timestamptz not null default now()
+			);
+
+			create index if not exists credit_notes_order_idx on credit_notes(order_id);
+			create index if not exists credit_notes_factor_idx on credit_notes(factor_id);
+
+			alter table credit_notes add column if not exists status varchar(16) not null default 'issued';
+		`,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) RefundUserOrder(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, creditNote *scommerce.CreditNote[UserAccountID], cancel bool) (uint64, error) {
+	var amount int64
+	if !cancel {
+		var err error
+		amount, err = db.minorUnits(creditNote.Amount)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var productItems json.RawMessage
+	err = tx.QueryRow(
+		ctx,
+		`select coalesce("product_items", '[]'::jsonb) from orders where "id" = $1 for update`,
+		oid,
+	).Scan(&productItems)
+	if err != nil {
+		return 0, err
+	}
+	var ordered []scommerce.RefundItem
+	if err := json.Unmarshal(productItems, &ordered); err != nil {
+		return 0, err
+	}
+
+	// what can still be refunded is what was ordered minus the earlier credit notes, pending ones included, and minus
+	// what open return requests hold unless the order is cancelled
+	remaining := make(map[uint64]uint64, len(ordered))
+	for _, item := range ordered {
+		remaining[item.ProductItemID] += item.Quantity
+	}
+	held := `select cn.items from credit_notes cn where cn.order_id = $1`
+	args := []any{oid}
+	if !cancel {
+		held += `
+			union all
+			select coalesce(rr.received_items, rr.items) from return_requests rr
+			where rr.order_id = $1 and rr.status = any($2)
+		`
+		args = append(args, returnRequestHeldStatuses)
+	}
+	if err := db.subtractItemQuantities(ctx, tx, remaining, held, args...); err != nil {
+		return 0, err
+	}
+
+	// the payments are only refunded after the credit note is stored, so pending credit notes are taken off too
+	var refundable int64
+	err = tx.QueryRow(
+		ctx,
+		`
+			select
+				coalesce((select sum("captured_amount" - "refunded_amount") from order_payments where "order_id" = $1), 0) -
+				coalesce((select sum("amount") from credit_notes where "order_id" = $1 and "status" = $2), 0)
+		`,
+		oid,
+		creditNoteStatusPending,
+	).Scan(&refundable)
+	if err != nil {
+		return 0, err
+	}
+	if cancel {
+		amount = max(refundable, 0)
+	} else if amount > refundable {
+		return 0, errors.Join(scommerce.ErrRefundExceedsPaid, errors.New("refundable amount is "+db.money(max(refundable, 0)).String()))
+	}
+
+	items := make([]scommerce.RefundItem, 0, len(remaining))
+	if cancel {
+		for _, item := range ordered {
+			if quantity := remaining[item.ProductItemID]; quantity > 0 {
+				items = append(items, scommerce.RefundItem{ProductItemID: item.ProductItemID, Quantity: quantity})
+				remaining[item.ProductItemID] = 0
+			}
+		}
+	} else {
+		for _, item := range creditNote.Items {
+			if item.Quantity == 0 {
+				continue
+			}
+			if item.Quantity > remaining[item.ProductItemID] {
+				return 0, errors.Join(scommerce.ErrRefundExceedsQuantity, errors.New("product item "+strconv.FormatUint(item.ProductItemID, 10)+" has "+strconv.FormatUint(remaining[item.ProductItemID], 10)+" refundable units"))
+			}
+			remaining[item.ProductItemID] -= item.Quantity
+			items = append(items, item)
+		}
+	}
+
+	itemsRaw, err := json.Marshal(items)
+	if err != nil {
+		return 0, err
+	}
+	var reason *string
+	if creditNote.Reason != "" {
+		reason = &creditNote.Reason
+	}
+	var factorID *uint64
+	err = tx.QueryRow(
+		ctx,
+		`
+			insert into credit_notes("order_id", "factor_id", "user_id", "items", "amount", "reason", "status")
+			select o."id", (select f."id" from factors f where f."order_id" = o."id" order by f."id" limit 1), o."user_id", $2, $3, $4, $5
+			from orders o
+			where o."id" = $1
+			returning "id", "factor_id", "created_at"
+		`,
+		oid,
+		itemsRaw,
+		amount,
+		reason,
+		creditNoteStatusPending,
+	).Scan(&creditNote.ID, &factorID, &creditNote.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	if err := db.voidOrderGiftCards(ctx, tx, oid, creditNote.ID, items); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	creditNote.OrderID = oid
+	creditNote.Items = items
+	creditNote.Amount = db.money(amount)
+	if factorID != nil {
+		creditNote.FactorID = *factorID
+	}
+	return creditNote.ID, nil
+}
+
+func (db *PostgreDatabase) CompleteUserOrderRefund(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, creditNote *scommerce.CreditNote[UserAccountID], refunded scommerce.Money, cancel bool) error {
+	refundedAmount, err := db.minorUnits(refunded)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var discountID *uint64
+	var orderTotal int64
+	err = tx.QueryRow(
+		ctx,
+		`select "discount_id", "order_total" from orders where "id" = $1 for update`,
+		oid,
+	).Scan(&discountID, &orderTotal)
+	if err != nil {
+		return err
+	}
+	var itemsRaw json.RawMessage
+	var amount int64
+	err = tx.QueryRow(
+		ctx,
+		`select "items", "amount" from credit_notes where "id" = $1 and "order_id" = $2 and "status" = $3`,
+		creditNote.ID,
+		oid,
+		creditNoteStatusPending,
+	).Scan(&itemsRaw, &amount)
+	if err != nil {
+		return err
+	}
+
+	if refundedAmount < amount {
+		if err := db.restoreOrderGiftCards(ctx, tx, creditNote.ID); err != nil {
+			return err
+		}
+		if refundedAmount <= 0 {
+			if _, err := tx.Exec(ctx, `delete from credit_notes where "id" = $1`, creditNote.ID); err != nil {
+				return err
+			}
+			creditNote.ID = 0
+		} else {
+			err := tx.QueryRow(
+				ctx,
+				`update credit_notes set "items" = '[]'::jsonb, "amount" = $1, "status" = $2, "created_at" = now() where "id" = $3 returning "created_at"`,
+				refundedAmount,
+				creditNoteStatusIssued,
+				creditNote.ID,
+			).Scan(&creditNote.CreatedAt)
+			if err != nil {
+				return err
+			}
+		}
+		creditNote.Items = nil
+		creditNote.Amount = refunded
+		return tx.Commit(ctx)
+	}
+
+	var items []scommerce.RefundItem
+	if err := json.Unmarshal(itemsRaw, &items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		_, err := tx.Exec(
+			ctx,
+			`update product_items set "quantity_in_stock" = "quantity_in_stock" + $1 where "id" = $2`,
+			item.Quantity,
+			item.ProductItemID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.QueryRow(
+		ctx,
+		`update credit_notes set "status" = $1, "created_at" = now() where "id" = $2 returning "created_at"`,
+		creditNoteStatusIssued,
+		creditNote.ID,
+	).Scan(&creditNote.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	// the discount code is given back once, when nothing of the order is kept
+	var credited int64
+	err = tx.QueryRow(
+		ctx,
+		`select coalesce(sum("amount"), 0) from credit_notes where "order_id" = $1 and "status" = $2`,
+		oid,
+		creditNoteStatusIssued,
+	).Scan(&credited)
+	if err != nil {
+		return err
+	}
+	if discountID != nil && (cancel || credited >= orderTotal) {
+		if err := db.restoreOrderDiscount(ctx, tx, oid, *discountID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// restoreOrderDiscount gives the discount code of the order back to its user.
+func (db *PostgreDatabase) restoreOrderDiscount(ctx context.Context, tx pgx.Tx, oid uint64, discountID uint64) error {
+	_, err := tx.Exec(
+		ctx,
+		`
+			update discounts d set
+				"valid_count" = d."valid_count" + 1,
+				"used_by" = coalesce((
+					select jsonb_agg(e)
+					from jsonb_array_elements(d."used_by") e
+					where e <> to_jsonb(o."user_id")
+				), '[]'::jsonb)
+			from orders o
+			where d."id" = $1 and o."id" = $2
+		`,
+		discountID,
+		oid,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `update orders set "discount_id" = null where "id" = $1`, oid)
+	return err
+}
+
+func (db *PostgreDatabase) GetUserOrderCreditNotes(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, creditNotes []scommerce.CreditNote[UserAccountID]) ([]scommerce.CreditNote[UserAccountID], error) {
+	return db.queryCreditNotes(ctx, creditNotes, `"order_id" = $1`, oid)
+}
+
+func (db *PostgreDatabase) GetUserFactorCreditNotes(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, creditNotes []scommerce.CreditNote[UserAccountID]) ([]scommerce.CreditNote[UserAccountID], error) {
+	return db.queryCreditNotes(ctx, creditNotes, `"factor_id" = $1`, fid)
+}
+
+// queryCreditNotes appends the credit notes matching condition in the order they were issued.
+func (db *PostgreDatabase) queryCreditNotes(ctx context.Context, creditNotes []scommerce.CreditNote[UserAccountID], condition string, args ...any) ([]scommerce.CreditNote[UserAccountID], error) {
+	result := creditNotes
+	if result == nil {
+		result = make([]scommerce.CreditNote[UserAccountID], 0, 1)
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				"id",
+				coalesce("order_id", 0),
+				coalesce("factor_id", 0),
+				coalesce("user_id", 0),
+				"items",
+				"amount",
+				coalesce("reason", ''),
+				"created_at"
+			from credit_notes
+			where "status" = 'issued' and `+condition+`
+			order by "id"
+		`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var creditNote scommerce.CreditNote[UserAccountID]
+		var itemsRaw json.RawMessage
+		var amount int64
+		err := rows.Scan(
+			&creditNote.ID,
+			&creditNote.OrderID,
+			&creditNote.FactorID,
+			&creditNote.AccountID,
+			&itemsRaw,
+			&amount,
+			&creditNote.Reason,
+			&creditNote.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(itemsRaw, &creditNote.Items); err != nil {
+			return nil, err
+		}
+		creditNote.Amount = db.money(amount)
+		result = append(result, creditNote)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
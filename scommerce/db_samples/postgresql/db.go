@@ -3,6 +3,7 @@ package dbsamples
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -14,6 +15,9 @@ type PostgreDatabase struct {
 	_         sync.Mutex
 	PgxPool   *pgxpool.Pool
 	TxOptions pgx.TxOptions
+	Currency  string // ISO 4217 code of every money column, DefaultCurrency when empty
+
+	IdempotencyKeyTTL time.Duration // scommerce.DefaultIdempotencyKeyTTL when zero
 }
 
 func NewPostgreDatabase(ctx context.Context, config *pgxpool.Config) (*PostgreDatabase, error) {
@@ -26,6 +30,7 @@ func NewPostgreDatabase(ctx context.Context, config *pgxpool.Config) (*PostgreDa
 		TxOptions: pgx.TxOptions{
 			IsoLevel: pgx.Serializable,
 		},
+		Currency: DefaultCurrency,
 	}, nil
 }
 
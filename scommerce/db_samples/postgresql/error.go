@@ -1,12 +1,20 @@
 package dbsamples
 
 import (
+	"encoding/json"
 	"errors"
 
+	"github.com/MobinYengejehi/scommerce/scommerce"
+
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
+const insufficientStockCode = "SC001"
+const productItemRemovedCode = "SC002"
+const discountNotApplicableCode = "SC003"
+const shoppingCartChangedCode = "SC004"
+
 func IsNotFound(err error) bool {
 	if errors.Is(err, pgx.ErrNoRows) {
 		return true
@@ -30,3 +38,23 @@ func AsPgError(err error) *pgconn.PgError {
 	}
 	return nil
 }
+
+func asInsufficientStockError(err error) *scommerce.InsufficientStockError {
+	pgErr := AsPgError(err)
+	if pgErr == nil || pgErr.Code != insufficientStockCode {
+		return nil
+	}
+	stockErr := &scommerce.InsufficientStockError{}
+	json.Unmarshal([]byte(pgErr.Detail), &stockErr.Items)
+	return stockErr
+}
+
+func asDiscountNotApplicableError(err error) *scommerce.DiscountNotApplicableError {
+	pgErr := AsPgError(err)
+	if pgErr == nil || pgErr.Code != discountNotApplicableCode {
+		return nil
+	}
+	return &scommerce.DiscountNotApplicableError{
+		Reason: scommerce.UserDiscountReason(pgErr.Detail),
+	}
+}
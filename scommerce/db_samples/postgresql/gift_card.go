@@ -0,0 +1,542 @@
+package dbsamples
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var _ scommerce.DBGiftCardManager[UserAccountID] = &PostgreDatabase{}
+
+const giftCardColumns = `
+	"id",
+	"code",
+	coalesce("user_id", 0),
+	coalesce("order_id", 0),
+	coalesce("product_item_id", 0),
+	"initial_balance",
+	"balance",
+	"expires_at",
+	"created_at"
+`
+
+func (db *PostgreDatabase) InitGiftCardManager(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			create table if not exists gift_cards(
+				id              bigint generated by default as identity primary key,
+				code            text unique not null,
+				user_id         bigint references users(id) on delete set null,
+				order_id        bigint references orders(id) on delete set null,
+				product_item_id bigint references product_items(id) on delete set null,
+				unit_index      bigint,
+				initial_balance numeric(20, 0) not null check (initial_balance >= 0),
+				balance         numeric(20, 0) not null check (balance >= 0),
+				expires_at      timestamptz,
+				created_at      timestamptz not null default now()
+			);
+
+			-- unit_index numbers the gift card units of an order, so an order issues each card once
+			create unique index if not exists gift_cards_order_unit_idx on gift_cards(order_id, unit_index);
+			create index if not exists gift_cards_user_idx on gift_cards(user_id);
+
+			-- credit_note_id is the credit note which voided the card when the order was refunded
+			alter table gift_cards add column if not exists credit_note_id bigint;
+
+			create table if not exists gift_card_transactions(
+				id            bigint generated by default as identity primary key,
+				gift_card_id  bigint not null references gift_cards(id) on delete cascade,
+				type          varchar(32) not null,
+				amount        numeric(20, 0) not null,
+				balance_after numeric(20, 0) not null,
+				order_id      bigint,
+				payment_id    bigint,
+				created_at    timestamptz not null default now()
+			);
+
+			create index if not exists gift_card_transactions_card_idx on gift_card_transactions(gift_card_id, id);
+			-- a retried capture must not redeem a payment twice
+			create unique index if not exists gift_card_transactions_redeem_idx on gift_card_transactions(payment_id) where type = 'redeem';
+
+			-- refunded_before is what was refunded of the payment before a refund, a retried refund must not credit the card twice
+			alter table gift_card_transactions add column if not exists refunded_before numeric(20, 0);
+			create unique index if not exists gift_card_transactions_refund_idx on gift_card_transactions(payment_id, refunded_before) where type = 'refund';
+
+			-- gift_card_code draws 64 bits from gen_random_uuid, which uses a cryptographic random source
+			create or replace function gift_card_code() returns text as $$
+				select upper(substr(md5(gen_random_uuid()::text), 1, 16))
+			$$ language sql volatile;
+		`,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) scanGiftCard(row pgx.Row, giftCard *scommerce.GiftCard[UserAccountID]) error {
+	var initialBalance, balance int64
+	var expiresAt pgtype.Timestamptz
+	err := row.Scan(
+		&giftCard.ID,
+		&giftCard.Code,
+		&giftCard.AccountID,
+		&giftCard.OrderID,
+		&giftCard.ProductItemID,
+		&initialBalance,
+		&balance,
+		&expiresAt,
+		&giftCard.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	giftCard.InitialBalance = db.money(initialBalance)
+	giftCard.Balance = db.money(balance)
+	giftCard.ExpiresAt = expiresAt.Time
+	return nil
+}
+
+// queryGiftCards appends the gift cards returned by the query.
+func (db *PostgreDatabase) queryGiftCards(ctx context.Context, giftCards []scommerce.GiftCard[UserAccountID], query string, args ...any) ([]scommerce.GiftCard[UserAccountID], error) {
+	result := giftCards
+	if result == nil {
+		result = make([]scommerce.GiftCard[UserAccountID], 0, 1)
+	}
+
+	rows, err := db.PgxPool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var giftCard scommerce.GiftCard[UserAccountID]
+		if err := db.scanGiftCard(rows, &giftCard); err != nil {
+			return nil, err
+		}
+		result = append(result, giftCard)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (db *PostgreDatabase) NewGiftCard(ctx context.Context, ownerAccountID UserAccountID, balance scommerce.Money, expiresAt time.Time, giftCard *scommerce.GiftCard[UserAccountID]) (uint64, error) {
+	balanceUnits, err := db.minorUnits(balance)
+	if err != nil {
+		return 0, err
+	}
+	row := db.PgxPool.QueryRow(
+		ctx,
+		`
+			with issued as (
+				insert into gift_cards("code", "user_id", "initial_balance", "balance", "expires_at")
+				values (gift_card_code(), $1, $2, $2, $3)
+				returning *
+			), journal as (
+				insert into gift_card_transactions("gift_card_id", "type", "amount", "balance_after")
+				select "id", $4, "initial_balance", "balance" from issued
+			)
+			select `+giftCardColumns+` from issued
+		`,
+		ownerAccountID,
+		balanceUnits,
+		pgtype.Timestamptz{Time: expiresAt, Valid: !expiresAt.IsZero()},
+		scommerce.GiftCardTransactionIssue,
+	)
+	if err := db.scanGiftCard(row, giftCard); err != nil {
+		return 0, err
+	}
+	return giftCard.ID, nil
+}
+
+func (db *PostgreDatabase) GetGiftCard(ctx context.Context, gcid uint64, giftCard *scommerce.GiftCard[UserAccountID]) error {
+	row := db.PgxPool.QueryRow(
+		ctx,
+		`select `+giftCardColumns+` from gift_cards where "id" = $1`,
+		gcid,
+	)
+	err := db.scanGiftCard(row, giftCard)
+	if IsNotFound(err) {
+		return scommerce.ErrGiftCardNotFound
+	}
+	return err
+}
+
+func (db *PostgreDatabase) GetGiftCardByCode(ctx context.Context, code string, giftCard *scommerce.GiftCard[UserAccountID]) error {
+	row := db.PgxPool.QueryRow(
+		ctx,
+		`select `+giftCardColumns+` from gift_cards where "code" = $1`,
+		code,
+	)
+	err := db.scanGiftCard(row, giftCard)
+	if IsNotFound(err) {
+		return scommerce.ErrGiftCardNotFound
+	}
+	return err
+}
+
+func (db *PostgreDatabase) GetGiftCards(ctx context.Context, giftCards []scommerce.GiftCard[UserAccountID], skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]scommerce.GiftCard[UserAccountID], error) {
+	return db.queryGiftCards(
+		ctx,
+		giftCards,
+		`
+			select `+giftCardColumns+`
+			from gift_cards
+			order by "id" `+queueOrder.String()+`
+			offset $1
+			limit $2
+		`,
+		skip,
+		limit,
+	)
+}
+
+func (db *PostgreDatabase) GetGiftCardsForAccount(ctx context.Context, ownerAccountID UserAccountID, giftCards []scommerce.GiftCard[UserAccountID], skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]scommerce.GiftCard[UserAccountID], error) {
+	return db.queryGiftCards(
+		ctx,
+		giftCards,
+		`
+			select `+giftCardColumns+`
+			from gift_cards
+			where "user_id" = $1
+			order by "id" `+queueOrder.String()+`
+			offset $2
+			limit $3
+		`,
+		ownerAccountID,
+		skip,
+		limit,
+	)
+}
+
+func (db *PostgreDatabase) GetGiftCardTransactions(ctx context.Context, gcid uint64, transactions []scommerce.GiftCardTransaction, skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]scommerce.GiftCardTransaction, error) {
+	result := transactions
+	if result == nil {
+		result = make([]scommerce.GiftCardTransaction, 0, 10)
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				"id",
+				"gift_card_id",
+				"type",
+				"amount",
+				"balance_after",
+				coalesce("order_id", 0),
+				coalesce("payment_id", 0),
+				"created_at"
+			from gift_card_transactions
+			where "gift_card_id" = $1
+			order by "id" `+queueOrder.String()+`
+			offset $2
+			limit $3
+		`,
+		gcid,
+		skip,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transaction scommerce.GiftCardTransaction
+		var transactionType string
+		var amount, balanceAfter int64
+		err := rows.Scan(
+			&transaction.ID,
+			&transaction.GiftCardID,
+			&transactionType,
+			&amount,
+			&balanceAfter,
+			&transaction.OrderID,
+			&transaction.PaymentID,
+			&transaction.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		transaction.Type = scommerce.GiftCardTransactionType(transactionType)
+		transaction.Amount = db.money(amount)
+		transaction.BalanceAfter = db.money(balanceAfter)
+		result = append(result, transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (db *PostgreDatabase) RedeemGiftCard(ctx context.Context, gcid uint64, amount scommerce.Money, oid uint64, paymentID uint64) (scommerce.Money, error) {
+	amountUnits, err := db.minorUnits(amount)
+	if err != nil {
+		return scommerce.Money{}, err
+	}
+	return db.moveGiftCard(ctx, gcid, oid, paymentID, nil, scommerce.GiftCardTransactionRedeem, func(balance int64, expiresAt pgtype.Timestamptz) (int64, error) {
+		if expiresAt.Valid && !time.Now().Before(expiresAt.Time) {
+			return 0, scommerce.ErrGiftCardExpired
+		}
+		if balance < amountUnits {
+			return 0, errors.Join(scommerce.ErrInsufficientFunds, errors.New("gift card balance is "+db.money(balance).String()+", required amount is "+amount.String()))
+		}
+		return balance - amountUnits, nil
+	})
+}
+
+func (db *PostgreDatabase) RefundGiftCard(ctx context.Context, gcid uint64, amount scommerce.Money, oid uint64, paymentID uint64, refunded scommerce.Money) (scommerce.Money, error) {
+	amountUnits, err := db.minorUnits(amount)
+	if err != nil {
+		return scommerce.Money{}, err
+	}
+	refundedUnits, err := db.minorUnits(refunded)
+	if err != nil {
+		return scommerce.Money{}, err
+	}
+	return db.moveGiftCard(ctx, gcid, oid, paymentID, &refundedUnits, scommerce.GiftCardTransactionRefund, func(balance int64, expiresAt pgtype.Timestamptz) (int64, error) {
+		return balance + amountUnits, nil
+	})
+}
+
+// moveGiftCard locks the gift card, replaces its balance with next(balance) and journals the difference.
+// A payment which was already redeemed, or refunded after refundedBefore, returns the current balance without journaling again.
+func (db *PostgreDatabase) moveGiftCard(ctx context.Context, gcid uint64, oid uint64, paymentID uint64, refundedBefore *int64, transactionType scommerce.GiftCardTransactionType, next func(balance int64, expiresAt pgtype.Timestamptz) (int64, error)) (scommerce.Money, error) {
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return scommerce.Money{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var balance int64
+	var expiresAt pgtype.Timestamptz
+	err = tx.QueryRow(
+		ctx,
+		`select "balance", "expires_at" from gift_cards where "id" = $1 for update`,
+		gcid,
+	).Scan(&balance, &expiresAt)
+	if IsNotFound(err) {
+		return scommerce.Money{}, scommerce.ErrGiftCardNotFound
+	}
+	if err != nil {
+		return scommerce.Money{}, err
+	}
+
+	if transactionType == scommerce.GiftCardTransactionRedeem || transactionType == scommerce.GiftCardTransactionRefund {
+		var moved bool
+		err := tx.QueryRow(
+			ctx,
+			`
+				select exists(
+					select 1 from gift_card_transactions
+					where "payment_id" = $1 and "type" = $2 and ($3::numeric is null or "refunded_before" = $3)
+				)
+			`,
+			paymentID,
+			transactionType,
+			refundedBefore,
+		).Scan(&moved)
+		if err != nil {
+			return scommerce.Money{}, err
+		}
+		if moved {
+			return db.money(balance), nil
+		}
+	}
+
+	newBalance, err := next(balance, expiresAt)
+	if err != nil {
+		return scommerce.Money{}, err
+	}
+	_, err = tx.Exec(
+		ctx,
+		`update gift_cards set "balance" = $1 where "id" = $2`,
+		newBalance,
+		gcid,
+	)
+	if err != nil {
+		return scommerce.Money{}, err
+	}
+
+	var orderID, paymentIDArg *uint64
+	if oid != 0 {
+		orderID = &oid
+	}
+	if paymentID != 0 {
+		paymentIDArg = &paymentID
+	}
+	_, err = tx.Exec(
+		ctx,
+		`
+			insert into gift_card_transactions("gift_card_id", "type", "amount", "balance_after", "order_id", "payment_id", "refunded_before")
+			values ($1, $2, $3, $4, $5, $6, $7)
+		`,
+		gcid,
+		transactionType,
+		newBalance-balance,
+		newBalance,
+		orderID,
+		paymentIDArg,
+		refundedBefore,
+	)
+	if err != nil {
+		return scommerce.Money{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return scommerce.Money{}, err
+	}
+	return db.money(newBalance), nil
+}
+
+func (db *PostgreDatabase) IssueUserOrderGiftCards(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64) ([]scommerce.GiftCard[UserAccountID], error) {
+	return db.queryGiftCards(
+		ctx,
+		nil,
+		`
+			with issued as (
+				insert into gift_cards(
+					"code",
+					"user_id",
+					"order_id",
+					"product_item_id",
+					"unit_index",
+					"initial_balance",
+					"balance",
+					"expires_at"
+				)
+				select
+					gift_card_code(),
+					o."user_id",
+					o."id",
+					u."product_item_id",
+					u."unit_index",
+					u."price",
+					u."price",
+					case when u."validity" > 0 then now() + make_interval(secs => u."validity") end
+				from orders o
+				-- the factor lines carry the share of the discounts, their total is spread over the units rounding down
+				-- the running total so the cards add up to it, orders without a factor fall back to the ordered price
+				cross join lateral (
+					select
+						pi."id" as "product_item_id",
+						floor(line.total * unit.n / line.quantity) - floor(line.total * (unit.n - 1) / line.quantity) as "price",
+						pi."gift_card_validity" as "validity",
+						row_number() over (order by line.ordinality, unit.n) as "unit_index"
+					from (
+						select
+							l.ordinality,
+							(l.item ->> 'product_item_id')::bigint as product_item_id,
+							(l.item ->> 'quantity')::bigint as quantity,
+							coalesce((l.item ->> 'total')::numeric, (l.item ->> 'price')::numeric * (l.item ->> 'quantity')::bigint) as total
+						from jsonb_array_elements(coalesce(
+							(select f."lines" from factors f where f."order_id" = o."id" order by f."id" limit 1),
+							o."product_items",
+							'[]'::jsonb
+						)) with ordinality as l(item, ordinality)
+					) line
+					join product_items pi on pi."id" = line.product_item_id and pi."gift_card"
+					cross join generate_series(1, line.quantity) as unit(n)
+				) u
+				where o."id" = $1
+				  and o."order_total" <= (
+					select coalesce(sum(op."captured_amount" - op."refunded_amount"), 0)
+					from order_payments op
+					where op."order_id" = o."id"
+				  )
+				on conflict ("order_id", "unit_index") do nothing
+				returning *
+			), journal as (
+				insert into gift_card_transactions("gift_card_id", "type", "amount", "balance_after", "order_id")
+				select "id", $2, "initial_balance", "balance", "order_id" from issued
+			)
+			select `+giftCardColumns+` from issued order by "id"
+		`,
+		oid,
+		scommerce.GiftCardTransactionIssue,
+	)
+}
+
+// voidOrderGiftCards zeroes the unspent gift cards the order issued for the refunded items and marks them with
+// the credit note, it fails with ErrGiftCardSpent when fewer unspent cards than refunded units are left. Items
+// without issued gift cards are skipped.
+func (db *PostgreDatabase) voidOrderGiftCards(ctx context.Context, tx pgx.Tx, oid uint64, creditNoteID uint64, items []scommerce.RefundItem) error {
+	for _, item := range items {
+		var issued, voided uint64
+		err := tx.QueryRow(
+			ctx,
+			`
+				with active as (
+					select "id", "balance", "initial_balance" from gift_cards
+					where "order_id" = $1 and "product_item_id" = $2 and "credit_note_id" is null
+					order by "id"
+					for update
+				), cards as (
+					select "id", "balance" from active
+					where "balance" = "initial_balance"
+					order by "id"
+					limit $3
+				), voided as (
+					update gift_cards g set "balance" = 0, "credit_note_id" = $4
+					from cards c
+					where g."id" = c."id"
+					returning g."id", c."balance"
+				), journal as (
+					insert into gift_card_transactions("gift_card_id", "type", "amount", "balance_after", "order_id")
+					select "id", $5, -"balance", 0, $1 from voided
+				)
+				select (select count(*) from active), (select count(*) from voided)
+			`,
+			oid,
+			item.ProductItemID,
+			item.Quantity,
+			creditNoteID,
+			scommerce.GiftCardTransactionVoid,
+		).Scan(&issued, &voided)
+		if err != nil {
+			return err
+		}
+		if issued > 0 && voided < item.Quantity {
+			return errors.Join(scommerce.ErrGiftCardSpent, errors.New("product item "+strconv.FormatUint(item.ProductItemID, 10)+" has "+strconv.FormatUint(voided, 10)+" unspent gift cards"))
+		}
+	}
+	return nil
+}
+
+// restoreOrderGiftCards gives the gift cards voided by the credit note their balance back.
+func (db *PostgreDatabase) restoreOrderGiftCards(ctx context.Context, tx pgx.Tx, creditNoteID uint64) error {
+	_, err := tx.Exec(
+		ctx,
+		`
+			with restored as (
+				update gift_cards set "balance" = "initial_balance", "credit_note_id" = null
+				where "credit_note_id" = $1
+				returning "id", "initial_balance", "order_id"
+			)
+			insert into gift_card_transactions("gift_card_id", "type", "amount", "balance_after", "order_id")
+			select "id", $2, "initial_balance", "initial_balance", "order_id" from restored
+		`,
+		creditNoteID,
+		scommerce.GiftCardTransactionRestore,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) GetUserOrderGiftCards(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, giftCards []scommerce.GiftCard[UserAccountID]) ([]scommerce.GiftCard[UserAccountID], error) {
+	return db.queryGiftCards(
+		ctx,
+		giftCards,
+		`select `+giftCardColumns+` from gift_cards where "order_id" = $1 order by "unit_index"`,
+		oid,
+	)
+}
@@ -0,0 +1,115 @@
+package dbsamples
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	idempotencyScopeOrder          = "order"
+	idempotencyScopeWalletCharge   = "wallet_charge"
+	idempotencyScopeWalletTransfer = "wallet_transfer"
+	idempotencyScopeWalletWithdraw = "wallet_withdraw"
+)
+
+func (db *PostgreDatabase) idempotencyKeyTTL() time.Duration {
+	if db.IdempotencyKeyTTL <= 0 {
+		return scommerce.DefaultIdempotencyKeyTTL
+	}
+	return db.IdempotencyKeyTTL
+}
+
+func (db *PostgreDatabase) initIdempotencyKeys(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			create table if not exists idempotency_keys(
+				scope       varchar(64) not null,
+				key         varchar(256) not null,
+				fingerprint text not null,
+				response    jsonb,
+				created_at  timestamptz not null default now(),
+				expires_at  timestamptz not null,
+				primary key (scope, key)
+			);
+
+			create index if not exists idempotency_keys_expires_at_idx on idempotency_keys(expires_at);
+		`,
+	)
+	return err
+}
+
+// claimIdempotencyKey claims the key in tx so the request can run. When the key already completed a request it
+// returns the stored response instead, or scommerce.ErrIdempotencyKeyReused when that request had another fingerprint.
+// A concurrent request with the same key waits until the first one commits or rolls back.
+func (db *PostgreDatabase) claimIdempotencyKey(ctx context.Context, tx pgx.Tx, scope string, key string, fingerprint string) (json.RawMessage, error) {
+	var claimed bool
+	err := tx.QueryRow(
+		ctx,
+		`
+			insert into idempotency_keys("scope", "key", "fingerprint", "expires_at")
+			values ($1, $2, $3, $4)
+			on conflict ("scope", "key") do update
+			set "fingerprint" = excluded."fingerprint",
+				"response" = null,
+				"created_at" = now(),
+				"expires_at" = excluded."expires_at"
+			where idempotency_keys."expires_at" <= now()
+			returning true
+		`,
+		scope,
+		key,
+		fingerprint,
+		time.Now().Add(db.idempotencyKeyTTL()),
+	).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if !IsNotFound(err) {
+		return nil, err
+	}
+
+	var storedFingerprint string
+	var response json.RawMessage
+	err = tx.QueryRow(
+		ctx,
+		`select "fingerprint", "response" from idempotency_keys where "scope" = $1 and "key" = $2`,
+		scope,
+		key,
+	).Scan(&storedFingerprint, &response)
+	if err != nil {
+		return nil, err
+	}
+	if storedFingerprint != fingerprint {
+		return nil, scommerce.ErrIdempotencyKeyReused
+	}
+	return response, nil
+}
+
+func (db *PostgreDatabase) completeIdempotencyKey(ctx context.Context, tx pgx.Tx, scope string, key string, response any) error {
+	responseRaw, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		ctx,
+		`update idempotency_keys set "response" = $1 where "scope" = $2 and "key" = $3`,
+		responseRaw,
+		scope,
+		key,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) RemoveExpiredIdempotencyKeys(ctx context.Context, now time.Time) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`delete from idempotency_keys where "expires_at" <= $1`,
+		now,
+	)
+	return err
+}
@@ -0,0 +1,139 @@
+package dbsamples
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+)
+
+// DefaultCurrency is the currency of the money columns unless PostgreDatabase.Currency is changed before Init.
+const DefaultCurrency = "USD"
+
+// moneyColumnType stores money as an exact count of minor units of PostgreDatabase.Currency.
+const moneyColumnType = "numeric(20, 0)"
+
+func (db *PostgreDatabase) currency() string {
+	if db.Currency == "" {
+		return DefaultCurrency
+	}
+	return db.Currency
+}
+
+func (db *PostgreDatabase) money(amount int64) scommerce.Money {
+	return scommerce.NewMoney(amount, db.currency())
+}
+
+func (db *PostgreDatabase) moneyPtr(amount int64) *scommerce.Money {
+	money := db.money(amount)
+	return &money
+}
+
+// minorUnits returns the amount to store for money, rejecting money of another currency.
+func (db *PostgreDatabase) minorUnits(money scommerce.Money) (int64, error) {
+	if !money.SameCurrency(db.money(0)) {
+		return 0, errors.Join(scommerce.ErrCurrencyMismatch, errors.New("database stores "+db.currency()+", got "+money.Currency))
+	}
+	return money.Amount, nil
+}
+
+// moneyScale is the factor between major units and the stored minor units.
+func (db *PostgreDatabase) moneyScale() string {
+	scale := int64(1)
+	for range scommerce.CurrencyExponent(db.currency()) {
+		scale *= 10
+	}
+	return strconv.FormatInt(scale, 10)
+}
+
+// migrateMoneyColumns converts legacy double precision major unit columns of the table into exact minor units.
+// Columns which are already migrated are left untouched, so it's safe to run on every Init.
+// jsonPrices lists jsonb columns holding arrays of objects with a major unit "price" key, they are
+// converted together with the first column.
+func (db *PostgreDatabase) migrateMoneyColumns(ctx context.Context, table string, columns []string, jsonPrices ...string) error {
+	for i, column := range columns {
+		if i > 0 {
+			jsonPrices = nil
+		}
+		if err := db.migrateMoneyColumn(ctx, table, column, jsonPrices); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) migrateMoneyColumn(ctx context.Context, table string, column string, jsonPrices []string) error {
+	var dataType string
+	var columnDefault *string
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`
+			select
+				"data_type",
+				"column_default"
+			from information_schema.columns
+			where "table_schema" = current_schema() and "table_name" = $1 and "column_name" = $2
+		`,
+		table,
+		column,
+	).Scan(&dataType, &columnDefault)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if dataType != "double precision" {
+		return nil
+	}
+
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, jsonColumn := range jsonPrices {
+		_, err := tx.Exec(
+			ctx,
+			`
+				update `+table+`
+				set "`+jsonColumn+`" = (
+					select jsonb_agg(
+						case
+							when jsonb_typeof(item -> 'price') = 'number' then
+								jsonb_set(item, '{price}', to_jsonb(round((item ->> 'price')::numeric * `+db.moneyScale()+`)))
+							else
+								item
+						end
+					)
+					from jsonb_array_elements("`+jsonColumn+`") item
+				)
+				where jsonb_typeof("`+jsonColumn+`") = 'array'
+			`,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if columnDefault != nil {
+		if _, err := tx.Exec(ctx, `alter table `+table+` alter column "`+column+`" drop default`); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(
+		ctx,
+		`alter table `+table+` alter column "`+column+`" type `+moneyColumnType+` using round("`+column+`"::numeric * `+db.moneyScale()+`)`,
+	)
+	if err != nil {
+		return err
+	}
+	if columnDefault != nil {
+		if _, err := tx.Exec(ctx, `alter table `+table+` alter column "`+column+`" set default 0`); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
@@ -8,14 +8,15 @@ import (
 
 	"github.com/MobinYengejehi/scommerce/scommerce"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 var _ scommerce.DBUserOrderManager[UserAccountID] = &PostgreDatabase{}
 var _ scommerce.DBUserOrder[UserAccountID] = &PostgreDatabase{}
 
-func (db *PostgreDatabase) CalculateUserOrderTotalPrice(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64) (float64, error) {
-	var total float64
+func (db *PostgreDatabase) CalculateUserOrderTotalPrice(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64) (scommerce.Money, error) {
+	var total int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`
@@ -32,33 +33,27 @@ func (db *PostgreDatabase) CalculateUserOrderTotalPrice(ctx context.Context, for
 		oid,
 	).Scan(&total)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.Total = &total
+		form.Total = db.moneyPtr(total)
 	}
-	return total, nil
+	return db.money(total), nil
 }
 
 func (db *PostgreDatabase) DeliverUserOrder(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, sid uint64, date time.Time, comment string) error {
-	_, err := db.PgxPool.Exec(
-		ctx,
-		`
-			update orders
-			set
-				order_status_id = $1,
-				delivery_date = $2,
-				delivery_comment = $3
-			where id = $4
-		`,
-		sid,
-		date,
-		comment,
-		oid,
-	)
+	tx, err := db.PgxPool.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
+
+	if err := db.deliverUserOrderTx(ctx, tx, oid, sid, date, comment); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
 	if form != nil {
 		form.Status = &scommerce.BuiltinOrderStatus{
 			DB: db,
@@ -72,6 +67,26 @@ func (db *PostgreDatabase) DeliverUserOrder(ctx context.Context, form *scommerce
 	return nil
 }
 
+func (db *PostgreDatabase) deliverUserOrderTx(ctx context.Context, tx pgx.Tx, oid uint64, sid uint64, date time.Time, comment string) error {
+	if err := db.changeOrderStatusTx(ctx, tx, oid, sid, "", comment); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		ctx,
+		`
+			update orders
+			set
+				delivery_date = $1,
+				delivery_comment = $2
+			where id = $3
+		`,
+		date,
+		comment,
+		oid,
+	)
+	return err
+}
+
 func (db *PostgreDatabase) GetUserOrderDate(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64) (time.Time, error) {
 	var date time.Time
 	err := db.PgxPool.QueryRow(
@@ -362,7 +377,7 @@ func (db *PostgreDatabase) GetUserOrderShippingAddress(ctx context.Context, form
 func (db *PostgreDatabase) GetUserOrderShippingMethod(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, shippingMethodForm *scommerce.ShippingMethodForm) (uint64, error) {
 	var id uint64
 	var name string
-	var price float64
+	var price int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`
@@ -382,7 +397,7 @@ func (db *PostgreDatabase) GetUserOrderShippingMethod(ctx context.Context, form
 	if shippingMethodForm != nil {
 		shippingMethodForm.ID = id
 		shippingMethodForm.Name = &name
-		shippingMethodForm.Price = &price
+		shippingMethodForm.Price = db.moneyPtr(price)
 	}
 	if form != nil {
 		form.ShippingMethod = &scommerce.BuiltinShippingMethod{
@@ -390,7 +405,7 @@ func (db *PostgreDatabase) GetUserOrderShippingMethod(ctx context.Context, form
 			ShippingMethodForm: scommerce.ShippingMethodForm{
 				ID:    id,
 				Name:  &name,
-				Price: &price,
+				Price: db.moneyPtr(price),
 			},
 		}
 	}
@@ -431,20 +446,40 @@ func (db *PostgreDatabase) GetUserOrderStatus(ctx context.Context, form *scommer
 	return id, nil
 }
 
-func (db *PostgreDatabase) GetUserOrderTotal(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64) (float64, error) {
-	var total float64
+func (db *PostgreDatabase) GetUserOrderTotal(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64) (scommerce.Money, error) {
+	var total int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select "order_total" from orders where "id" = $1`,
 		oid,
 	).Scan(&total)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.Total = &total
+		form.Total = db.moneyPtr(total)
 	}
-	return total, nil
+	return db.money(total), nil
+}
+
+func (db *PostgreDatabase) GetUserOrderPromotions(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64) ([]scommerce.PromotionLine, error) {
+	var rawPromotions []byte
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "promotions" from orders where "id" = $1`,
+		oid,
+	).Scan(&rawPromotions)
+	if err != nil {
+		return nil, err
+	}
+	promotions := make([]scommerce.PromotionLine, 0)
+	if err := json.Unmarshal(rawPromotions, &promotions); err != nil {
+		return nil, err
+	}
+	if form != nil {
+		form.Promotions = &promotions
+	}
+	return promotions, nil
 }
 
 func (db *PostgreDatabase) GetUserOrderUserComment(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64) (string, error) {
@@ -601,16 +636,19 @@ func (db *PostgreDatabase) SetUserOrderShippingMethod(ctx context.Context, form
 	return nil
 }
 
-func (db *PostgreDatabase) SetUserOrderStatus(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, status uint64) error {
-	_, err := db.PgxPool.Exec(
-		ctx,
-		`update orders set "order_status_id" = $1 where "id" = $2`,
-		status,
-		oid,
-	)
+func (db *PostgreDatabase) SetUserOrderStatus(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, status uint64, actor string, note string) error {
+	tx, err := db.PgxPool.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
+
+	if err := db.changeOrderStatusTx(ctx, tx, oid, status, actor, note); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
 	if form != nil {
 		form.Status = &scommerce.BuiltinOrderStatus{
 			DB: db,
@@ -622,18 +660,22 @@ func (db *PostgreDatabase) SetUserOrderStatus(ctx context.Context, form *scommer
 	return nil
 }
 
-func (db *PostgreDatabase) SetUserOrderTotal(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, total float64) error {
-	_, err := db.PgxPool.Exec(
+func (db *PostgreDatabase) SetUserOrderTotal(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, total scommerce.Money) error {
+	totalUnits, err := db.minorUnits(total)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
 		ctx,
 		`update orders set "order_total" = $1 where "id" = $2`,
-		total,
+		totalUnits,
 		oid,
 	)
 	if err != nil {
 		return err
 	}
 	if form != nil {
-		form.Total = &total
+		form.Total = db.moneyPtr(totalUnits)
 	}
 	return nil
 }
@@ -666,6 +708,49 @@ func (db *PostgreDatabase) GetUserOrderCount(ctx context.Context) (uint64, error
 	return count, nil
 }
 
+func (db *PostgreDatabase) GetUnpaidUserOrders(ctx context.Context, orderedBefore time.Time, afterID uint64, orders []scommerce.DBUserOrderResult[UserAccountID], limit int64) ([]scommerce.DBUserOrderResult[UserAccountID], error) {
+	ids := orders
+	if ids == nil {
+		ids = make([]scommerce.DBUserOrderResult[UserAccountID], 0, limit)
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select o."id", coalesce(o."user_id", 0)
+			from orders o
+			join order_statuses os on os."id" = o."order_status_id"
+			where os."status" = $1 and o."order_date" < $2 and o."id" > $3
+				and not exists(
+					select 1 from order_payment_claims c
+					where c."order_id" = o."id" and c."expires_at" >= now()
+				)
+			order by o."id"
+			limit $4
+		`,
+		scommerce.OrderStatusPendingPayment,
+		orderedBefore,
+		afterID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res scommerce.DBUserOrderResult[UserAccountID]
+		if err := rows.Scan(&res.ID, &res.AID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 func (db *PostgreDatabase) GetUserOrders(ctx context.Context, orders []scommerce.DBUserOrderResult[UserAccountID], orderForms []*scommerce.UserOrderForm[UserAccountID], skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]scommerce.DBUserOrderResult[UserAccountID], []*scommerce.UserOrderForm[UserAccountID], error) {
 	ids := orders
 	if ids == nil {
@@ -713,7 +798,7 @@ func (db *PostgreDatabase) GetUserOrders(ctx context.Context, orders []scommerce
 		var id uint64
 		var userID UserAccountID
 		var orderDate time.Time
-		var orderTotal float64
+		var orderTotal int64
 		var userComment *string
 		var deliveryDate *time.Time
 		var deliveryComment *string
@@ -749,7 +834,7 @@ func (db *PostgreDatabase) GetUserOrders(ctx context.Context, orders []scommerce
 			ID:               id,
 			UserAccountID:    userID,
 			Date:             &orderDate,
-			Total:            &orderTotal,
+			Total:            db.moneyPtr(orderTotal),
 			UserComment:      userComment,
 			DeliveryDate:     deliveryDate,
 			DeliveryComment:  deliveryComment,
@@ -814,16 +899,28 @@ func (db *PostgreDatabase) InitUserOrderManager(ctx context.Context) error {
 				payment_method_id   bigint references payment_methods(id),
 				shipping_address_id bigint references addresses(id),
 				shipping_method_id  bigint references shipping_methods(id),
-				order_total         double precision not null default 0,
+				order_total         numeric(20, 0) not null default 0,
 				order_status_id     bigint references order_statuses(id),
 				user_comment        text,
 				delivery_date       timestamptz,
 				delivery_comment    text,
 				product_items       jsonb
 			);
+
+			alter table orders add column if not exists discount_id bigint;
+			alter table orders add column if not exists promotions jsonb not null default '[]'::jsonb;
 		`,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := db.migrateMoneyColumns(ctx, "orders", []string{"order_total"}, "product_items"); err != nil {
+		return err
+	}
+	if err := db.initOrderPayments(ctx); err != nil {
+		return err
+	}
+	return db.initOrderStatusHistory(ctx)
 }
 
 func (db *PostgreDatabase) RemoveAllUserOrders(ctx context.Context) error {
@@ -841,7 +938,7 @@ func (db *PostgreDatabase) FillUserOrderWithID(ctx context.Context, oid uint64,
 
 	var userID UserAccountID
 	var orderDate time.Time
-	var orderTotal float64
+	var orderTotal int64
 	var userComment pgtype.Text
 	var deliveryDate pgtype.Timestamptz
 	var deliveryComment pgtype.Text
@@ -891,7 +988,7 @@ func (db *PostgreDatabase) FillUserOrderWithID(ctx context.Context, oid uint64,
 	orderForm.ID = oid
 	orderForm.UserAccountID = userID
 	orderForm.Date = &orderDate
-	orderForm.Total = &orderTotal
+	orderForm.Total = db.moneyPtr(orderTotal)
 
 	if userComment.Valid {
 		orderForm.UserComment = &userComment.String
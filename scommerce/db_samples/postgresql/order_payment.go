@@ -0,0 +1,267 @@
+package dbsamples
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func (db *PostgreDatabase) initOrderPayments(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			create table if not exists order_payments(
+				id                bigint generated by default as identity primary key,
+				order_id          bigint not null references orders(id) on delete cascade,
+				user_id           bigint references users(id) on delete set null,
+				payment_method_id bigint references payment_methods(id) on delete set null,
+				gateway           varchar(64) not null,
+				transaction_id    varchar(256),
+				amount            numeric(20, 0) not null,
+				captured_amount   numeric(20, 0) not null default 0,
+				refunded_amount   numeric(20, 0) not null default 0,
+				status            varchar(32) not null,
+				failure_reason    text,
+				created_at        timestamptz not null default now(),
+				updated_at        timestamptz not null default now()
+			);
+
+			create index if not exists order_payments_order_idx on order_payments(order_id, id);
+
+			alter table order_payments add column if not exists gift_card_id bigint;
+
+			create table if not exists order_payment_claims(
+				order_id   bigint primary key references orders(id) on delete cascade,
+				expires_at timestamptz not null
+			);
+		`,
+	)
+	return err
+}
+
+// ClaimUserOrderPayments holds the order row lock while it reads the status and takes the claim, so a claim
+// is only ever taken for the status it returns. An expired claim is taken over.
+func (db *PostgreDatabase) ClaimUserOrderPayments(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, expiresAt time.Time, statusForm *scommerce.OrderStatusForm) (uint64, error) {
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var sid pgtype.Int8
+	var name pgtype.Text
+	err = tx.QueryRow(
+		ctx,
+		`
+			select o."order_status_id", os."status"
+			from orders o
+			left join order_statuses os on os."id" = o."order_status_id"
+			where o."id" = $1
+			for update of o
+		`,
+		oid,
+	).Scan(&sid, &name)
+	if err != nil {
+		return 0, err
+	}
+
+	var claimed uint64
+	err = tx.QueryRow(
+		ctx,
+		`
+			insert into order_payment_claims("order_id", "expires_at") values($1, $2)
+			on conflict ("order_id") do update set "expires_at" = excluded."expires_at"
+			where order_payment_claims."expires_at" < now()
+			returning "order_id"
+		`,
+		oid,
+		expiresAt,
+	).Scan(&claimed)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, scommerce.ErrPaymentInProgress
+		}
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	if statusForm != nil {
+		statusForm.ID = uint64(sid.Int64)
+		if name.Valid {
+			statusForm.Name = &name.String
+		}
+	}
+	return uint64(sid.Int64), nil
+}
+
+func (db *PostgreDatabase) ReleaseUserOrderPayments(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64) error {
+	_, err := db.PgxPool.Exec(ctx, `delete from order_payment_claims where "order_id" = $1`, oid)
+	return err
+}
+
+func (db *PostgreDatabase) NewUserOrderPayment(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, payment *scommerce.OrderPayment[UserAccountID]) (uint64, error) {
+	amount, err := db.minorUnits(payment.Amount)
+	if err != nil {
+		return 0, err
+	}
+	var paymentMethodID *uint64
+	if payment.PaymentMethodID != 0 {
+		paymentMethodID = &payment.PaymentMethodID
+	}
+	err = db.PgxPool.QueryRow(
+		ctx,
+		`
+			insert into order_payments("order_id", "user_id", "payment_method_id", "gateway", "amount", "status")
+			select $1, o."user_id", $2, $3, $4, $5 from orders o where o."id" = $1
+			returning "id", coalesce("user_id", 0), "created_at", "updated_at"
+		`,
+		oid,
+		paymentMethodID,
+		payment.Gateway,
+		amount,
+		payment.Status,
+	).Scan(&payment.ID, &payment.AccountID, &payment.CreatedAt, &payment.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	payment.OrderID = oid
+	return payment.ID, nil
+}
+
+func (db *PostgreDatabase) UpdateUserOrderPayment(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, payment *scommerce.OrderPayment[UserAccountID]) error {
+	capturedAmount, err := db.minorUnits(payment.CapturedAmount)
+	if err != nil {
+		return err
+	}
+	refundedAmount, err := db.minorUnits(payment.RefundedAmount)
+	if err != nil {
+		return err
+	}
+	var transactionID *string
+	if payment.TransactionID != "" {
+		transactionID = &payment.TransactionID
+	}
+	var failureReason *string
+	if payment.FailureReason != "" {
+		failureReason = &payment.FailureReason
+	}
+	var giftCardID *uint64
+	if payment.GiftCardID != 0 {
+		giftCardID = &payment.GiftCardID
+	}
+	return db.PgxPool.QueryRow(
+		ctx,
+		`
+			update order_payments set
+				"transaction_id" = $1,
+				"captured_amount" = $2,
+				"refunded_amount" = $3,
+				"status" = $4,
+				"failure_reason" = $5,
+				"gift_card_id" = coalesce($8, "gift_card_id"),
+				"updated_at" = now()
+			where "id" = $6 and "order_id" = $7
+			returning "updated_at"
+		`,
+		transactionID,
+		capturedAmount,
+		refundedAmount,
+		payment.Status,
+		failureReason,
+		payment.ID,
+		oid,
+		giftCardID,
+	).Scan(&payment.UpdatedAt)
+}
+
+func (db *PostgreDatabase) GetUserOrderPayments(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, payments []scommerce.OrderPayment[UserAccountID]) ([]scommerce.OrderPayment[UserAccountID], error) {
+	return db.queryOrderPayments(ctx, payments, `"order_id" = $1`, oid)
+}
+
+func (db *PostgreDatabase) GetUserFactorPayments(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, payments []scommerce.OrderPayment[UserAccountID]) ([]scommerce.OrderPayment[UserAccountID], error) {
+	return db.queryOrderPayments(
+		ctx,
+		payments,
+		`"order_id" = (select f."order_id" from factors f where f."id" = $1) and "captured_amount" > 0`,
+		fid,
+	)
+}
+
+// queryOrderPayments appends the payments matching condition in the order they were made.
+func (db *PostgreDatabase) queryOrderPayments(ctx context.Context, payments []scommerce.OrderPayment[UserAccountID], condition string, args ...any) ([]scommerce.OrderPayment[UserAccountID], error) {
+	result := payments
+	if result == nil {
+		result = make([]scommerce.OrderPayment[UserAccountID], 0, 1)
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				"id",
+				"order_id",
+				coalesce("user_id", 0),
+				coalesce("payment_method_id", 0),
+				coalesce("gift_card_id", 0),
+				"gateway",
+				coalesce("transaction_id", ''),
+				"amount",
+				"captured_amount",
+				"refunded_amount",
+				"status",
+				coalesce("failure_reason", ''),
+				"created_at",
+				"updated_at"
+			from order_payments
+			where `+condition+`
+			order by "id"
+		`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var payment scommerce.OrderPayment[UserAccountID]
+		var amount, capturedAmount, refundedAmount int64
+		var status string
+		err := rows.Scan(
+			&payment.ID,
+			&payment.OrderID,
+			&payment.AccountID,
+			&payment.PaymentMethodID,
+			&payment.GiftCardID,
+			&payment.Gateway,
+			&payment.TransactionID,
+			&amount,
+			&capturedAmount,
+			&refundedAmount,
+			&status,
+			&payment.FailureReason,
+			&payment.CreatedAt,
+			&payment.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		payment.Amount = db.money(amount)
+		payment.CapturedAmount = db.money(capturedAmount)
+		payment.RefundedAmount = db.money(refundedAmount)
+		payment.Status = scommerce.PaymentStatus(status)
+		result = append(result, payment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -17,6 +17,36 @@ const (
 	deliveredOrderStatusName = "delivered"
 )
 
+// lifecycleOrderStatusNames are created after idle and delivered, paying, cancelling and refunding orders depend on them.
+var lifecycleOrderStatusNames = []string{
+	scommerce.OrderStatusPendingPayment,
+	scommerce.OrderStatusPaid,
+	scommerce.OrderStatusShipped,
+	scommerce.OrderStatusCancelled,
+	scommerce.OrderStatusRefunded,
+}
+
+// defaultOrderStatusTransitions are added on every Init when missing, so transitions added in later versions reach existing databases.
+// Orders from before the payment lifecycle are idle and were paid from the wallet at checkout, so they ship, deliver and refund like paid ones.
+var defaultOrderStatusTransitions = [][2]string{
+	{idleOrderStatusName, scommerce.OrderStatusPendingPayment},
+	{idleOrderStatusName, scommerce.OrderStatusPaid},
+	{idleOrderStatusName, scommerce.OrderStatusCancelled},
+	{idleOrderStatusName, scommerce.OrderStatusShipped},
+	{idleOrderStatusName, deliveredOrderStatusName},
+	{idleOrderStatusName, scommerce.OrderStatusRefunded},
+	{scommerce.OrderStatusPendingPayment, scommerce.OrderStatusPaid},
+	{scommerce.OrderStatusPendingPayment, scommerce.OrderStatusCancelled},
+	{scommerce.OrderStatusPaid, scommerce.OrderStatusShipped},
+	{scommerce.OrderStatusPaid, deliveredOrderStatusName},
+	{scommerce.OrderStatusPaid, scommerce.OrderStatusCancelled},
+	{scommerce.OrderStatusPaid, scommerce.OrderStatusRefunded},
+	{scommerce.OrderStatusShipped, deliveredOrderStatusName},
+	{scommerce.OrderStatusShipped, scommerce.OrderStatusCancelled},
+	{scommerce.OrderStatusShipped, scommerce.OrderStatusRefunded},
+	{deliveredOrderStatusName, scommerce.OrderStatusRefunded},
+}
+
 var _ scommerce.DBOrderStatusManager = &PostgreDatabase{}
 var _ scommerce.DBOrderStatus = &PostgreDatabase{}
 
@@ -181,9 +211,136 @@ func (db *PostgreDatabase) InitOrderStatusManager(ctx context.Context) error {
 			insert into order_statuses("status") values('`+idleOrderStatusName+`'), ('`+deliveredOrderStatusName+`') on conflict do nothing;
 		`,
 	)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
+		ctx,
+		`insert into order_statuses("status") select unnest($1::text[]) on conflict do nothing`,
+		lifecycleOrderStatusNames,
+	)
+	if err != nil {
+		return err
+	}
+	return db.initOrderStatusTransitions(ctx)
+}
+
+func (db *PostgreDatabase) initOrderStatusTransitions(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			create table if not exists order_status_transitions(
+				from_status_id bigint not null references order_statuses(id) on delete cascade,
+				to_status_id   bigint not null references order_statuses(id) on delete cascade,
+				primary key (from_status_id, to_status_id)
+			)
+		`,
+	)
+	if err != nil {
+		return err
+	}
+	from := make([]string, 0, len(defaultOrderStatusTransitions))
+	to := make([]string, 0, len(defaultOrderStatusTransitions))
+	for _, transition := range defaultOrderStatusTransitions {
+		from = append(from, transition[0])
+		to = append(to, transition[1])
+	}
+	_, err = db.PgxPool.Exec(
+		ctx,
+		`
+			insert into order_status_transitions("from_status_id", "to_status_id")
+			select f."id", t."id"
+			from unnest($1::text[], $2::text[]) as tr(from_name, to_name)
+			join order_statuses f on f."status" = tr.from_name
+			join order_statuses t on t."status" = tr.to_name
+			on conflict do nothing
+		`,
+		from,
+		to,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) AddOrderStatusTransition(ctx context.Context, from uint64, to uint64) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`insert into order_status_transitions("from_status_id", "to_status_id") values($1, $2) on conflict do nothing`,
+		from,
+		to,
+	)
 	return err
 }
 
+func (db *PostgreDatabase) RemoveOrderStatusTransition(ctx context.Context, from uint64, to uint64) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`delete from order_status_transitions where "from_status_id" = $1 and "to_status_id" = $2`,
+		from,
+		to,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) ExistsOrderStatusTransition(ctx context.Context, from uint64, to uint64) (bool, error) {
+	var exists bool
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select exists(select 1 from order_status_transitions where "from_status_id" = $1 and "to_status_id" = $2)`,
+		from,
+		to,
+	).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func (db *PostgreDatabase) GetOrderStatusTransitions(ctx context.Context, from uint64, status []uint64, statusForms []*scommerce.OrderStatusForm) ([]uint64, []*scommerce.OrderStatusForm, error) {
+	ids := status
+	if ids == nil {
+		ids = make([]uint64, 0, 4)
+	}
+	forms := statusForms
+	if forms == nil {
+		forms = make([]*scommerce.OrderStatusForm, 0, cap(ids))
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select os."id", os."status"
+			from order_status_transitions ost
+			join order_statuses os on os."id" = ost."to_status_id"
+			where ost."from_status_id" = $1
+			order by os."id"
+		`,
+		from,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		forms = append(forms, &scommerce.OrderStatusForm{
+			ID:   id,
+			Name: &name,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return ids, forms, nil
+}
+
 func (db *PostgreDatabase) NewOrderStatus(ctx context.Context, name string, statusForm *scommerce.OrderStatusForm) (uint64, error) {
 	var id uint64
 	var status string
@@ -205,7 +362,8 @@ func (db *PostgreDatabase) NewOrderStatus(ctx context.Context, name string, stat
 func (db *PostgreDatabase) RemoveAllOrderStatuses(ctx context.Context) error {
 	_, err := db.PgxPool.Exec(
 		ctx,
-		`delete from order_statuses where "id" > 2`,
+		`delete from order_statuses where "id" > 2 and not ("status" = any($1))`,
+		lifecycleOrderStatusNames,
 	)
 	return err
 }
@@ -213,8 +371,9 @@ func (db *PostgreDatabase) RemoveAllOrderStatuses(ctx context.Context) error {
 func (db *PostgreDatabase) RemoveOrderStatus(ctx context.Context, status uint64) error {
 	_, err := db.PgxPool.Exec(
 		ctx,
-		`delete from order_statuses where "id" > 2 and "id" = $1`,
+		`delete from order_statuses where "id" > 2 and "id" = $1 and not ("status" = any($2))`,
 		status,
+		lifecycleOrderStatusNames,
 	)
 	return err
 }
@@ -0,0 +1,160 @@
+package dbsamples
+
+import (
+	"context"
+	"errors"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func (db *PostgreDatabase) initOrderStatusHistory(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			create table if not exists order_status_history(
+				id             bigint generated by default as identity primary key,
+				order_id       bigint not null references orders(id) on delete cascade,
+				from_status_id bigint references order_statuses(id) on delete set null,
+				from_status    varchar(256),
+				to_status_id   bigint references order_statuses(id) on delete set null,
+				to_status      varchar(256) not null,
+				actor          text,
+				note           text,
+				created_at     timestamptz not null default now()
+			);
+
+			create index if not exists order_status_history_order_idx on order_status_history(order_id);
+		`,
+	)
+	return err
+}
+
+// changeOrderStatusTx moves the order to the status sid if the transition is allowed and records it in the history.
+// Orders without a status can move to any status.
+func (db *PostgreDatabase) changeOrderStatusTx(ctx context.Context, tx pgx.Tx, oid uint64, sid uint64, actor string, note string) error {
+	var fromID pgtype.Int8
+	var fromName pgtype.Text
+	err := tx.QueryRow(
+		ctx,
+		`
+			select o."order_status_id", os."status"
+			from orders o
+			left join order_statuses os on os."id" = o."order_status_id"
+			where o."id" = $1
+			for update of o
+		`,
+		oid,
+	).Scan(&fromID, &fromName)
+	if err != nil {
+		return err
+	}
+
+	var toName string
+	var allowed bool
+	err = tx.QueryRow(
+		ctx,
+		`
+			select
+				"status",
+				$2::bigint is null or exists(
+					select 1 from order_status_transitions
+					where "from_status_id" = $2 and "to_status_id" = $1
+				)
+			from order_statuses
+			where "id" = $1
+		`,
+		sid,
+		fromID,
+	).Scan(&toName, &allowed)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errors.Join(scommerce.ErrInvalidOrderStatusTransition, errors.New(fromName.String+" -> "+toName))
+	}
+
+	_, err = tx.Exec(ctx, `update orders set "order_status_id" = $1 where "id" = $2`, sid, oid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		ctx,
+		`
+			insert into order_status_history(
+				"order_id",
+				"from_status_id",
+				"from_status",
+				"to_status_id",
+				"to_status",
+				"actor",
+				"note"
+			) values($1, $2, $3, $4, $5, nullif($6, ''), nullif($7, ''))
+		`,
+		oid,
+		fromID,
+		fromName,
+		sid,
+		toName,
+		actor,
+		note,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) GetUserOrderStatusHistory(ctx context.Context, form *scommerce.UserOrderForm[UserAccountID], oid uint64, history []scommerce.OrderStatusChange) ([]scommerce.OrderStatusChange, error) {
+	result := history
+	if result == nil {
+		result = make([]scommerce.OrderStatusChange, 0, 4)
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				"id",
+				"order_id",
+				coalesce("from_status_id", 0),
+				coalesce("from_status", ''),
+				coalesce("to_status_id", 0),
+				"to_status",
+				coalesce("actor", ''),
+				coalesce("note", ''),
+				"created_at"
+			from order_status_history
+			where "order_id" = $1
+			order by "id"
+		`,
+		oid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var change scommerce.OrderStatusChange
+		err := rows.Scan(
+			&change.ID,
+			&change.OrderID,
+			&change.FromStatusID,
+			&change.FromStatus,
+			&change.ToStatusID,
+			&change.ToStatus,
+			&change.Actor,
+			&change.Note,
+			&change.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
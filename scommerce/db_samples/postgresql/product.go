@@ -6,15 +6,90 @@ import (
 
 	"github.com/MobinYengejehi/scommerce/scommerce"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 var _ scommerce.DBProduct[UserAccountID] = &PostgreDatabase{}
 
-func (db *PostgreDatabase) AddProductProductItem(ctx context.Context, form *scommerce.ProductForm[UserAccountID], pid uint64, sku string, name string, price float64, quantity uint64, images []string, attrs json.RawMessage, itemForm *scommerce.ProductItemForm[UserAccountID], fs scommerce.FileStorage) (uint64, error) {
+// productItemColumns are scanned by scanProductItem.
+const productItemColumns = `
+	"id",
+	"sku",
+	"name",
+	"price",
+	"quantity_in_stock",
+	"attributes",
+	"product_images",
+	"product_id",
+	"options"
+`
+
+func (db *PostgreDatabase) scanProductItem(row pgx.Row, fs scommerce.FileStorage) (*scommerce.ProductItemForm[UserAccountID], error) {
 	var id uint64
+	var sku string
+	var name string
+	var price int64
+	var quantityInStock int32
+	var attributes json.RawMessage
+	var productImages json.RawMessage
+	var productID pgtype.Int8
+	var rawOptions []byte
+	if err := row.Scan(
+		&id,
+		&sku,
+		&name,
+		&price,
+		&quantityInStock,
+		&attributes,
+		&productImages,
+		&productID,
+		&rawOptions,
+	); err != nil {
+		return nil, err
+	}
 
-	var err error = nil
+	var images []string
+	if err := json.Unmarshal(productImages, &images); err != nil {
+		return nil, err
+	}
+	options, err := decodeProductItemOptions(rawOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var quantity uint64 = uint64(quantityInStock)
+
+	var product *scommerce.BuiltinProduct[UserAccountID] = nil
+	if productID.Valid {
+		product = &scommerce.BuiltinProduct[UserAccountID]{
+			DB: db,
+			FS: fs,
+			ProductForm: scommerce.ProductForm[UserAccountID]{
+				ID: uint64(productID.Int64),
+			},
+		}
+	}
+
+	return &scommerce.ProductItemForm[UserAccountID]{
+		ID:              id,
+		Attributes:      &attributes,
+		Images:          db.getSafeImages(images),
+		Price:           db.moneyPtr(price),
+		Name:            &name,
+		QuantityInStock: &quantity,
+		SKU:             &sku,
+		Product:         product,
+		Options:         &options,
+	}, nil
+}
+
+func (db *PostgreDatabase) AddProductProductItem(ctx context.Context, form *scommerce.ProductForm[UserAccountID], pid uint64, sku string, name string, price scommerce.Money, quantity uint64, images []string, attrs json.RawMessage, options map[string]string, itemForm *scommerce.ProductItemForm[UserAccountID], fs scommerce.FileStorage) (uint64, error) {
+	priceUnits, err := db.minorUnits(price)
+	if err != nil {
+		return 0, err
+	}
+	var id uint64
 
 	var jImages json.RawMessage = nil
 	if images != nil {
@@ -23,8 +98,22 @@ func (db *PostgreDatabase) AddProductProductItem(ctx context.Context, form *scom
 			return 0, err
 		}
 	}
+	jOptions, err := encodeProductItemOptions(options)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := db.checkProductItemOptions(ctx, tx, &pid, options); err != nil {
+		return 0, err
+	}
 
-	err = db.PgxPool.QueryRow(
+	err = tx.QueryRow(
 		ctx,
 		`
 			insert into product_items(
@@ -34,7 +123,8 @@ func (db *PostgreDatabase) AddProductProductItem(ctx context.Context, form *scom
 				"quantity_in_stock",
 				"attributes",
 				"product_images",
-				"product_id"
+				"product_id",
+				"options"
 			) values(
 				$1,
 				$2,
@@ -42,29 +132,41 @@ func (db *PostgreDatabase) AddProductProductItem(ctx context.Context, form *scom
 				$4,
 				$5,
 				$6,
-				$7
+				$7,
+				$8
 			) returning "id"
 		`,
 		sku,
 		name,
-		price,
+		priceUnits,
 		quantity,
 		attrs,
 		jImages,
 		pid,
+		jOptions,
 	).Scan(&id)
 	if err != nil {
+		if isDuplicatedProductItemOptions(err) {
+			return 0, scommerce.ErrDuplicateProductItemOptions
+		}
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
 		return 0, err
 	}
 
 	if itemForm != nil {
+		if len(options) == 0 {
+			options = nil
+		}
 		itemForm.ID = id
 		itemForm.SKU = &sku
 		itemForm.Name = &name
-		itemForm.Price = &price
+		itemForm.Price = db.moneyPtr(priceUnits)
 		itemForm.QuantityInStock = &quantity
 		itemForm.Images = db.getSafeImages(images)
 		itemForm.Attributes = &attrs
+		itemForm.Options = &options
 		itemForm.Product = &scommerce.BuiltinProduct[UserAccountID]{
 			DB: db,
 			FS: fs,
@@ -186,15 +288,7 @@ func (db *PostgreDatabase) GetProductProductItems(ctx context.Context, form *sco
 	rows, err := db.PgxPool.Query(
 		ctx,
 		`
-			select
-				"id",
-				"sku",
-				"name",
-				"price",
-				"quantity_in_stock",
-				"attributes",
-				"product_images",
-				"product_id"
+			select `+productItemColumns+`
 			from product_items
 			where "product_id" = $1
 			order by "id" `+queueOrder.String()+`
@@ -211,56 +305,12 @@ func (db *PostgreDatabase) GetProductProductItems(ctx context.Context, form *sco
 	defer rows.Close()
 
 	for rows.Next() {
-		var id uint64
-		var sku string
-		var name string
-		var price float64
-		var quantityInStock int32
-		var attributes json.RawMessage
-		var productImages json.RawMessage
-		var productID pgtype.Int8
-		if err := rows.Scan(
-			&id,
-			&sku,
-			&name,
-			&price,
-			&quantityInStock,
-			&attributes,
-			&productImages,
-			&productID,
-		); err != nil {
-			return nil, nil, err
-		}
-
-		var images []string
-		if err := json.Unmarshal(productImages, &images); err != nil {
+		itemForm, err := db.scanProductItem(rows, fs)
+		if err != nil {
 			return nil, nil, err
 		}
-
-		var quantity uint64 = uint64(quantityInStock)
-
-		var product *scommerce.BuiltinProduct[UserAccountID] = nil
-		if productID.Valid {
-			product = &scommerce.BuiltinProduct[UserAccountID]{
-				DB: db,
-				FS: fs,
-				ProductForm: scommerce.ProductForm[UserAccountID]{
-					ID: uint64(productID.Int64),
-				},
-			}
-		}
-
-		ids = append(ids, id)
-		forms = append(forms, &scommerce.ProductItemForm[UserAccountID]{
-			ID:              id,
-			Attributes:      &attributes,
-			Images:          db.getSafeImages(images),
-			Price:           &price,
-			Name:            &name,
-			QuantityInStock: &quantity,
-			SKU:             &sku,
-			Product:         product,
-		})
+		ids = append(ids, itemForm.ID)
+		forms = append(forms, itemForm)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -270,6 +320,54 @@ func (db *PostgreDatabase) GetProductProductItems(ctx context.Context, form *sco
 	return ids, forms, nil
 }
 
+// GetProductProductItemByOptions relies on jsonb equality, which ignores the order of the keys.
+func (db *PostgreDatabase) GetProductProductItemByOptions(ctx context.Context, form *scommerce.ProductForm[UserAccountID], pid uint64, options map[string]string, itemForm *scommerce.ProductItemForm[UserAccountID], fs scommerce.FileStorage) (uint64, error) {
+	jOptions, err := encodeProductItemOptions(options)
+	if err != nil {
+		return 0, err
+	}
+	if jOptions == nil {
+		return 0, scommerce.ErrProductItemNotFound
+	}
+	row := db.PgxPool.QueryRow(
+		ctx,
+		`select `+productItemColumns+` from product_items where "product_id" = $1 and "options" = $2::jsonb limit 1`,
+		pid,
+		jOptions,
+	)
+	found, err := db.scanProductItem(row, fs)
+	if err != nil {
+		if IsNotFound(err) {
+			return 0, scommerce.ErrProductItemNotFound
+		}
+		return 0, err
+	}
+	if itemForm != nil {
+		*itemForm = *found
+	}
+	return found.ID, nil
+}
+
+func (db *PostgreDatabase) GetProductOptions(ctx context.Context, form *scommerce.ProductForm[UserAccountID], pid uint64) ([]scommerce.ProductOption, error) {
+	var raw []byte
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "options" from products where "id" = $1 limit 1`,
+		pid,
+	).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+	options, err := decodeProductOptions(raw)
+	if err != nil {
+		return nil, err
+	}
+	if form != nil {
+		form.Options = &options
+	}
+	return options, nil
+}
+
 func (db *PostgreDatabase) RemoveAllProductProductItems(ctx context.Context, form *scommerce.ProductForm[UserAccountID], pid uint64) error {
 	_, err := db.PgxPool.Exec(
 		ctx,
@@ -363,3 +461,66 @@ func (db *PostgreDatabase) SetProductName(ctx context.Context, form *scommerce.P
 	}
 	return nil
 }
+
+// SetProductOptions locks the product against concurrent item writes and rejects options which an item
+// of the product no longer matches.
+func (db *PostgreDatabase) SetProductOptions(ctx context.Context, form *scommerce.ProductForm[UserAccountID], pid uint64, options []scommerce.ProductOption) error {
+	jOptions, err := encodeProductOptions(options)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var id uint64
+	if err := tx.QueryRow(ctx, `select "id" from products where "id" = $1 for update`, pid).Scan(&id); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		`select "options" from product_items where "product_id" = $1 and "options" is not null`,
+		pid,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return err
+		}
+		itemOptions, err := decodeProductItemOptions(raw)
+		if err != nil {
+			return err
+		}
+		if !scommerce.MatchProductOptions(options, itemOptions) {
+			return scommerce.ErrProductItemOptionsMismatch
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`update products set "options" = $1 where "id" = $2`,
+		jOptions,
+		pid,
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	if form != nil {
+		form.Options = &options
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package dbsamples
 import (
 	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/MobinYengejehi/scommerce/scommerce"
 
@@ -75,20 +76,20 @@ func (db *PostgreDatabase) GetProductItemName(ctx context.Context, form *scommer
 	return name, nil
 }
 
-func (db *PostgreDatabase) GetProductItemPrice(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64) (float64, error) {
-	var price float64
+func (db *PostgreDatabase) GetProductItemPrice(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64) (scommerce.Money, error) {
+	var price int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select "price" from product_items where "id" = $1 limit 1`,
 		pid,
 	).Scan(&price)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.Price = &price
+		form.Price = db.moneyPtr(price)
 	}
-	return price, nil
+	return db.money(price), nil
 }
 
 func (db *PostgreDatabase) GetProductItemProduct(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64, productForm *scommerce.ProductForm[UserAccountID], fs scommerce.FileStorage) (uint64, error) {
@@ -164,6 +165,25 @@ func (db *PostgreDatabase) GetProductItemQuantityInStock(ctx context.Context, fo
 	return quantity, nil
 }
 
+func (db *PostgreDatabase) GetProductItemReservedQuantity(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64) (uint64, error) {
+	var reserved uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`
+			select
+				coalesce(sum("quantity"), 0)
+			from stock_reservations
+			where "product_item_id" = $1
+			  and "expires_at" > now()
+		`,
+		pid,
+	).Scan(&reserved)
+	if err != nil {
+		return 0, err
+	}
+	return reserved, nil
+}
+
 func (db *PostgreDatabase) GetProductItemSKU(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64) (string, error) {
 	var sku string
 	err := db.PgxPool.QueryRow(
@@ -180,6 +200,56 @@ func (db *PostgreDatabase) GetProductItemSKU(ctx context.Context, form *scommerc
 	return sku, nil
 }
 
+func (db *PostgreDatabase) GetProductItemWeight(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64) (float64, error) {
+	var weight float64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "weight" from product_items where "id" = $1 limit 1`,
+		pid,
+	).Scan(&weight)
+	if err != nil {
+		return 0, err
+	}
+	if form != nil {
+		form.Weight = &weight
+	}
+	return weight, nil
+}
+
+func (db *PostgreDatabase) GetProductItemDimensions(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64) (scommerce.ProductItemDimensions, error) {
+	var dimensions scommerce.ProductItemDimensions
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "length", "width", "height" from product_items where "id" = $1 limit 1`,
+		pid,
+	).Scan(&dimensions.Length, &dimensions.Width, &dimensions.Height)
+	if err != nil {
+		return scommerce.ProductItemDimensions{}, err
+	}
+	if form != nil {
+		form.Dimensions = &dimensions
+	}
+	return dimensions, nil
+}
+
+func (db *PostgreDatabase) GetProductItemGiftCard(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64) (scommerce.ProductItemGiftCard, error) {
+	var giftCard scommerce.ProductItemGiftCard
+	var validity int64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "gift_card", "gift_card_validity" from product_items where "id" = $1 limit 1`,
+		pid,
+	).Scan(&giftCard.Enabled, &validity)
+	if err != nil {
+		return scommerce.ProductItemGiftCard{}, err
+	}
+	giftCard.Validity = time.Duration(validity) * time.Second
+	if form != nil {
+		form.GiftCard = &giftCard
+	}
+	return giftCard, nil
+}
+
 func (db *PostgreDatabase) SetProductItemAttributes(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64, attrs json.RawMessage) error {
 	_, err := db.PgxPool.Exec(
 		ctx,
@@ -240,18 +310,22 @@ func (db *PostgreDatabase) SetProductItemName(ctx context.Context, form *scommer
 	return nil
 }
 
-func (db *PostgreDatabase) SetProductItemPrice(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64, price float64) error {
-	_, err := db.PgxPool.Exec(
+func (db *PostgreDatabase) SetProductItemPrice(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64, price scommerce.Money) error {
+	priceUnits, err := db.minorUnits(price)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
 		ctx,
 		`update product_items set "price" = $1 where "id" = $2`,
-		price,
+		priceUnits,
 		pid,
 	)
 	if err != nil {
 		return err
 	}
 	if form != nil {
-		form.Price = &price
+		form.Price = db.moneyPtr(priceUnits)
 	}
 	return nil
 }
@@ -259,7 +333,13 @@ func (db *PostgreDatabase) SetProductItemPrice(ctx context.Context, form *scomme
 func (db *PostgreDatabase) SetProductItemProduct(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64, product *uint64, fs scommerce.FileStorage) error {
 	_, err := db.PgxPool.Exec(
 		ctx,
-		`update product_items set "product_id" = $1 where "id" = $2`,
+		`
+			update product_items
+			set
+				"options" = case when "product_id" is not distinct from $1 then "options" end,
+				"product_id" = $1
+			where "id" = $2
+		`,
 		product,
 		pid,
 	)
@@ -414,3 +494,119 @@ func (db *PostgreDatabase) CalculateProductItemAverageRating(ctx context.Context
 	}
 	return avgRating, nil
 }
+
+func (db *PostgreDatabase) SetProductItemWeight(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64, weight float64) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`update product_items set "weight" = $1 where "id" = $2`,
+		weight,
+		pid,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.Weight = &weight
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) SetProductItemDimensions(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64, dimensions scommerce.ProductItemDimensions) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`update product_items set "length" = $1, "width" = $2, "height" = $3 where "id" = $4`,
+		dimensions.Length,
+		dimensions.Width,
+		dimensions.Height,
+		pid,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.Dimensions = &dimensions
+	}
+	return nil
+}
+
+// SetProductItemGiftCard stores the validity in whole seconds.
+func (db *PostgreDatabase) SetProductItemGiftCard(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64, giftCard scommerce.ProductItemGiftCard) error {
+	giftCard.Validity = giftCard.Validity.Truncate(time.Second)
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`update product_items set "gift_card" = $1, "gift_card_validity" = $2 where "id" = $3`,
+		giftCard.Enabled,
+		int64(giftCard.Validity/time.Second),
+		pid,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.GiftCard = &giftCard
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) GetProductItemOptions(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64) (map[string]string, error) {
+	var raw []byte
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "options" from product_items where "id" = $1 limit 1`,
+		pid,
+	).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+	options, err := decodeProductItemOptions(raw)
+	if err != nil {
+		return nil, err
+	}
+	if form != nil {
+		form.Options = &options
+	}
+	return options, nil
+}
+
+func (db *PostgreDatabase) SetProductItemOptions(ctx context.Context, form *scommerce.ProductItemForm[UserAccountID], pid uint64, options map[string]string) error {
+	jOptions, err := encodeProductItemOptions(options)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var productID *uint64
+	if err := tx.QueryRow(ctx, `select "product_id" from product_items where "id" = $1 for update`, pid).Scan(&productID); err != nil {
+		return err
+	}
+	if err := db.checkProductItemOptions(ctx, tx, productID, options); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		ctx,
+		`update product_items set "options" = $1 where "id" = $2`,
+		jOptions,
+		pid,
+	)
+	if err != nil {
+		if isDuplicatedProductItemOptions(err) {
+			return scommerce.ErrDuplicateProductItemOptions
+		}
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	if form != nil {
+		if len(options) == 0 {
+			options = nil
+		}
+		form.Options = &options
+	}
+	return nil
+}
@@ -110,14 +110,25 @@ func (db *PostgreDatabase) InitProductManager(ctx context.Context) error {
 				id                bigint generated by default as identity primary key,
 				sku               varchar(256) unique,
 				name              varchar(256) not null,
-				price             double precision default 0,
+				price             numeric(20, 0) default 0,
 				quantity_in_stock integer not null default 0,
 				attributes        jsonb,
 				product_images    jsonb,
 				product_id        bigint references products(id)
 			);
 
+			alter table product_items add column if not exists weight double precision not null default 0;
+			alter table product_items add column if not exists length double precision not null default 0;
+			alter table product_items add column if not exists width  double precision not null default 0;
+			alter table product_items add column if not exists height double precision not null default 0;
+			alter table product_items add column if not exists gift_card boolean not null default false;
+			alter table product_items add column if not exists gift_card_validity bigint not null default 0 check (gift_card_validity >= 0);
+
+			alter table products add column if not exists options jsonb;
+			alter table product_items add column if not exists options jsonb;
+
 			create index if not exists product_items_product_idx on product_items(product_id);
+			create unique index if not exists product_items_options_idx on product_items(product_id, options) where options is not null;
 
 			create or replace function search_product_categories(
 				search_term_arg varchar,
@@ -217,6 +228,9 @@ func (db *PostgreDatabase) InitProductManager(ctx context.Context) error {
 			end;
 			$$ language plpgsql;
 
+			-- the return type can't be replaced in place, it was double precision before prices became exact
+			drop function if exists search_product_items(varchar, bool, bigint, bigint, varchar, bigint, bigint);
+
 			create or replace function search_product_items(
 				search_term_arg varchar,
 				deepsearch_arg  bool,
@@ -229,7 +243,7 @@ func (db *PostgreDatabase) InitProductManager(ctx context.Context) error {
 				item_id             bigint,
 				sku                 varchar(256),
 				item_name           varchar(256),
-				price               double precision,
+				price               numeric,
 				quantity_in_stock   integer,
 				attributes          jsonb,
 				item_images         jsonb,
@@ -303,7 +317,10 @@ func (db *PostgreDatabase) InitProductManager(ctx context.Context) error {
 			$$ language plpgsql;
 		`,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return db.migrateMoneyColumns(ctx, "product_items", []string{"price"})
 }
 
 func (db *PostgreDatabase) NewProductCategory(ctx context.Context, name string, parentCategory *uint64, catForm *scommerce.ProductCategoryForm[UserAccountID], fs scommerce.FileStorage) (uint64, error) {
@@ -434,7 +451,7 @@ func (db *PostgreDatabase) SearchForProductItems(ctx context.Context, searchText
 		var id uint64
 		var sku string
 		var name string
-		var price float64
+		var price int64
 		var quantityInStock int32
 		var attributes json.RawMessage
 		var itemImages json.RawMessage
@@ -498,7 +515,7 @@ func (db *PostgreDatabase) SearchForProductItems(ctx context.Context, searchText
 			ID:              id,
 			Attributes:      &attributes,
 			Images:          db.getSafeImages(images),
-			Price:           &price,
+			Price:           db.moneyPtr(price),
 			Name:            &name,
 			QuantityInStock: &quantity,
 			SKU:             &sku,
@@ -693,7 +710,7 @@ func (db *PostgreDatabase) FillProductItemWithID(ctx context.Context, iid uint64
 
 	var sku string
 	var name string
-	var price float64
+	var price int64
 	var quantityInStock int32
 	var attributes json.RawMessage
 	var itemImages json.RawMessage
@@ -740,7 +757,7 @@ func (db *PostgreDatabase) FillProductItemWithID(ctx context.Context, iid uint64
 	itemForm.ID = iid
 	itemForm.SKU = &sku
 	itemForm.Name = &name
-	itemForm.Price = &price
+	itemForm.Price = db.moneyPtr(price)
 	itemForm.QuantityInStock = &quantity
 	itemForm.Attributes = &attributes
 	itemForm.Images = db.getSafeImages(images)
@@ -0,0 +1,82 @@
+package dbsamples
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// productItemOptionsIndex keeps the option combinations of the items of a product unique, items without options are null and skipped.
+const productItemOptionsIndex = "product_items_options_idx"
+
+func isDuplicatedProductItemOptions(err error) bool {
+	pgErr := AsPgError(err)
+	return pgErr != nil && pgErr.Code == "23505" && pgErr.ConstraintName == productItemOptionsIndex
+}
+
+func encodeProductOptions(options []scommerce.ProductOption) (json.RawMessage, error) {
+	if len(options) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(options)
+}
+
+func decodeProductOptions(raw []byte) ([]scommerce.ProductOption, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var options []scommerce.ProductOption
+	if err := json.Unmarshal(raw, &options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func encodeProductItemOptions(options map[string]string) (json.RawMessage, error) {
+	if len(options) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(options)
+}
+
+func decodeProductItemOptions(raw []byte) (map[string]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var options map[string]string
+	if err := json.Unmarshal(raw, &options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// checkProductItemOptions holds a share lock on the product until the transaction ends, so its options
+// can't change between the check and the write of the item.
+func (db *PostgreDatabase) checkProductItemOptions(ctx context.Context, tx pgx.Tx, productID *uint64, options map[string]string) error {
+	if len(options) == 0 {
+		return nil
+	}
+	if productID == nil {
+		return scommerce.ErrProductItemOptionsMismatch
+	}
+	var raw []byte
+	err := tx.QueryRow(
+		ctx,
+		`select "options" from products where "id" = $1 for share`,
+		*productID,
+	).Scan(&raw)
+	if err != nil {
+		return err
+	}
+	axes, err := decodeProductOptions(raw)
+	if err != nil {
+		return err
+	}
+	if !scommerce.MatchProductOptions(axes, options) {
+		return scommerce.ErrProductItemOptionsMismatch
+	}
+	return nil
+}
@@ -0,0 +1,525 @@
+package dbsamples
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var _ scommerce.DBReturnRequestManager[UserAccountID] = &PostgreDatabase{}
+var _ scommerce.DBReturnRequest[UserAccountID] = &PostgreDatabase{}
+
+// returnRequestHeldStatuses are the statuses in which a return request holds its items against refunds of the order,
+// a refunding request has handed them to the credit note of its refund.
+var returnRequestHeldStatuses = []string{scommerce.ReturnStatusRequested, scommerce.ReturnStatusApproved, scommerce.ReturnStatusReceived}
+
+const returnRequestColumns = `
+	"id",
+	coalesce("user_id", 0),
+	"order_id",
+	"items",
+	"received_items",
+	"status",
+	"comment",
+	"resolution",
+	"credit_note_id",
+	"created_at"
+`
+
+func (db *PostgreDatabase) InitReturnRequestManager(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			create table if not exists return_requests(
+				id             bigint generated by default as identity primary key,
+				order_id       bigint not null references orders(id) on delete cascade,
+				user_id        bigint references users(id) on delete set null,
+				items          jsonb not null,
+				received_items jsonb,
+				status         text not null default 'requested',
+				comment        text,
+				resolution     text,
+				credit_note_id bigint references credit_notes(id) on delete set null,
+				created_at     timestamptz not null default now(),
+				updated_at     timestamptz not null default now()
+			);
+
+			create index if not exists return_requests_order_idx on return_requests(order_id);
+			create index if not exists return_requests_status_idx on return_requests(status);
+		`,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) NewReturnRequest(ctx context.Context, aid UserAccountID, oid uint64, items []scommerce.ReturnItem, comment string, form *scommerce.ReturnRequestForm[UserAccountID]) (uint64, error) {
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var productItems json.RawMessage
+	var userID UserAccountID
+	err = tx.QueryRow(
+		ctx,
+		`select coalesce("product_items", '[]'::jsonb), coalesce("user_id", 0) from orders where "id" = $1 for update`,
+		oid,
+	).Scan(&productItems, &userID)
+	if err != nil {
+		return 0, err
+	}
+	var ordered []scommerce.RefundItem
+	if err := json.Unmarshal(productItems, &ordered); err != nil {
+		return 0, err
+	}
+
+	// returnable is what was ordered minus the credit notes and the returns still in progress
+	returnable := make(map[uint64]uint64, len(ordered))
+	for _, item := range ordered {
+		returnable[item.ProductItemID] += item.Quantity
+	}
+	rows, err := tx.Query(
+		ctx,
+		`
+			select (item->>'product_item_id')::bigint, sum((item->>'quantity')::bigint)
+			from (
+				select cn.items from credit_notes cn where cn.order_id = $1
+				union all
+				select coalesce(rr.received_items, rr.items) from return_requests rr
+				where rr.order_id = $1 and rr.status = any($2)
+			) held
+			cross join lateral jsonb_array_elements(held.items) as item
+			group by 1
+		`,
+		oid,
+		append([]string{scommerce.ReturnStatusRefunding}, returnRequestHeldStatuses...),
+	)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var productItemID uint64
+		var quantity uint64
+		if err := rows.Scan(&productItemID, &quantity); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		returnable[productItemID] -= min(quantity, returnable[productItemID])
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		if item.Quantity > returnable[item.ProductItemID] {
+			return 0, errors.Join(scommerce.ErrReturnExceedsQuantity, errors.New("product item "+strconv.FormatUint(item.ProductItemID, 10)+" has "+strconv.FormatUint(returnable[item.ProductItemID], 10)+" returnable units"))
+		}
+		returnable[item.ProductItemID] -= item.Quantity
+	}
+
+	itemsRaw, err := json.Marshal(items)
+	if err != nil {
+		return 0, err
+	}
+	var id uint64
+	var createdAt time.Time
+	err = tx.QueryRow(
+		ctx,
+		`
+			insert into return_requests("order_id", "user_id", "items", "comment")
+			values($1, nullif($2, 0), $3, $4)
+			returning "id", "created_at"
+		`,
+		oid,
+		userID,
+		itemsRaw,
+		comment,
+	).Scan(&id, &createdAt)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	if form != nil {
+		form.ID = id
+		form.UserAccountID = userID
+		form.CreatedAt = &createdAt
+	}
+	return id, nil
+}
+
+func (db *PostgreDatabase) RemoveAllReturnRequests(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`delete from return_requests`,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) GetReturnRequestCount(ctx context.Context) (uint64, error) {
+	var count uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select count(*) from return_requests`,
+	).Scan(&count)
+	return count, err
+}
+
+func (db *PostgreDatabase) GetReturnRequests(ctx context.Context, ids []scommerce.DBReturnRequestResult[UserAccountID], forms []*scommerce.ReturnRequestForm[UserAccountID], skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]scommerce.DBReturnRequestResult[UserAccountID], []*scommerce.ReturnRequestForm[UserAccountID], error) {
+	return db.queryReturnRequests(ctx, ids, forms, `true`, queueOrder, skip, limit)
+}
+
+func (db *PostgreDatabase) GetReturnRequestsWithStatus(ctx context.Context, status string, ids []scommerce.DBReturnRequestResult[UserAccountID], forms []*scommerce.ReturnRequestForm[UserAccountID], skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]scommerce.DBReturnRequestResult[UserAccountID], []*scommerce.ReturnRequestForm[UserAccountID], error) {
+	return db.queryReturnRequests(ctx, ids, forms, `"status" = $3`, queueOrder, skip, limit, status)
+}
+
+func (db *PostgreDatabase) GetOrderReturnRequests(ctx context.Context, oid uint64, ids []scommerce.DBReturnRequestResult[UserAccountID], forms []*scommerce.ReturnRequestForm[UserAccountID], skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]scommerce.DBReturnRequestResult[UserAccountID], []*scommerce.ReturnRequestForm[UserAccountID], error) {
+	return db.queryReturnRequests(ctx, ids, forms, `"order_id" = $3`, queueOrder, skip, limit, oid)
+}
+
+// queryReturnRequests pages through the return requests matching condition, whose arguments start at $3.
+func (db *PostgreDatabase) queryReturnRequests(ctx context.Context, ids []scommerce.DBReturnRequestResult[UserAccountID], forms []*scommerce.ReturnRequestForm[UserAccountID], condition string, queueOrder scommerce.QueueOrder, skip int64, limit int64, args ...any) ([]scommerce.DBReturnRequestResult[UserAccountID], []*scommerce.ReturnRequestForm[UserAccountID], error) {
+	results := ids
+	if results == nil {
+		results = make([]scommerce.DBReturnRequestResult[UserAccountID], 0, 10)
+	}
+	requestForms := forms
+	if requestForms == nil {
+		requestForms = make([]*scommerce.ReturnRequestForm[UserAccountID], 0, cap(results))
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select `+returnRequestColumns+`
+			from return_requests
+			where `+condition+`
+			order by "id" `+queueOrder.String()+`
+			offset $1
+			limit $2
+		`,
+		append([]any{skip, limit}, args...)...,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		form := &scommerce.ReturnRequestForm[UserAccountID]{}
+		if err := scanReturnRequest(rows, form); err != nil {
+			return nil, nil, err
+		}
+		results = append(results, scommerce.DBReturnRequestResult[UserAccountID]{
+			ID:  form.ID,
+			AID: form.UserAccountID,
+		})
+		requestForms = append(requestForms, form)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return results, requestForms, nil
+}
+
+func scanReturnRequest(row pgx.Row, form *scommerce.ReturnRequestForm[UserAccountID]) error {
+	var orderID uint64
+	var itemsRaw json.RawMessage
+	var receivedItemsRaw json.RawMessage
+	var status string
+	var comment pgtype.Text
+	var resolution pgtype.Text
+	var creditNoteID pgtype.Int8
+	var createdAt time.Time
+	err := row.Scan(
+		&form.ID,
+		&form.UserAccountID,
+		&orderID,
+		&itemsRaw,
+		&receivedItemsRaw,
+		&status,
+		&comment,
+		&resolution,
+		&creditNoteID,
+		&createdAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	var items []scommerce.ReturnItem
+	if err := json.Unmarshal(itemsRaw, &items); err != nil {
+		return err
+	}
+	form.Items = &items
+	if receivedItemsRaw != nil {
+		var receivedItems []scommerce.ReturnItem
+		if err := json.Unmarshal(receivedItemsRaw, &receivedItems); err != nil {
+			return err
+		}
+		form.ReceivedItems = &receivedItems
+	}
+	form.OrderID = &orderID
+	form.Status = &status
+	form.Comment = &comment.String
+	form.Resolution = &resolution.String
+	cnid := uint64(creditNoteID.Int64)
+	form.CreditNoteID = &cnid
+	form.CreatedAt = &createdAt
+	return nil
+}
+
+func (db *PostgreDatabase) FillReturnRequestWithID(ctx context.Context, rid uint64, form *scommerce.ReturnRequestForm[UserAccountID]) error {
+	if form == nil {
+		return errors.New("return request form is nil")
+	}
+	row := db.PgxPool.QueryRow(
+		ctx,
+		`select `+returnRequestColumns+` from return_requests where "id" = $1`,
+		rid,
+	)
+	return scanReturnRequest(row, form)
+}
+
+func (db *PostgreDatabase) GetReturnRequestOrderID(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64) (uint64, error) {
+	var orderID uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "order_id" from return_requests where "id" = $1`,
+		rid,
+	).Scan(&orderID)
+	return orderID, err
+}
+
+func (db *PostgreDatabase) GetReturnRequestItems(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64) ([]scommerce.ReturnItem, error) {
+	var itemsRaw json.RawMessage
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "items" from return_requests where "id" = $1`,
+		rid,
+	).Scan(&itemsRaw)
+	if err != nil {
+		return nil, err
+	}
+	var items []scommerce.ReturnItem
+	if err := json.Unmarshal(itemsRaw, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (db *PostgreDatabase) GetReturnRequestReceivedItems(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64) ([]scommerce.ReturnItem, error) {
+	var itemsRaw json.RawMessage
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "received_items" from return_requests where "id" = $1`,
+		rid,
+	).Scan(&itemsRaw)
+	if err != nil || itemsRaw == nil {
+		return nil, err
+	}
+	var items []scommerce.ReturnItem
+	if err := json.Unmarshal(itemsRaw, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (db *PostgreDatabase) GetReturnRequestComment(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64) (string, error) {
+	var comment string
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select coalesce("comment", '') from return_requests where "id" = $1`,
+		rid,
+	).Scan(&comment)
+	return comment, err
+}
+
+func (db *PostgreDatabase) GetReturnRequestCreatedAt(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64) (time.Time, error) {
+	var createdAt time.Time
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "created_at" from return_requests where "id" = $1`,
+		rid,
+	).Scan(&createdAt)
+	return createdAt, err
+}
+
+func (db *PostgreDatabase) GetReturnRequestStatus(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64) (string, error) {
+	var status string
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "status" from return_requests where "id" = $1`,
+		rid,
+	).Scan(&status)
+	return status, err
+}
+
+func (db *PostgreDatabase) GetReturnRequestResolution(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64) (string, error) {
+	var resolution string
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select coalesce("resolution", '') from return_requests where "id" = $1`,
+		rid,
+	).Scan(&resolution)
+	return resolution, err
+}
+
+func (db *PostgreDatabase) GetReturnRequestCreditNoteID(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64) (uint64, error) {
+	var creditNoteID uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select coalesce("credit_note_id", 0) from return_requests where "id" = $1`,
+		rid,
+	).Scan(&creditNoteID)
+	return creditNoteID, err
+}
+
+func (db *PostgreDatabase) UpdateReturnRequestStatus(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64, from string, to string, resolution string) error {
+	tag, err := db.PgxPool.Exec(
+		ctx,
+		`
+			update return_requests set
+				"status" = $3,
+				"resolution" = $4,
+				"updated_at" = now()
+			where "id" = $1 and "status" = $2
+		`,
+		rid,
+		from,
+		to,
+		resolution,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return db.returnRequestStatusError(ctx, rid, from)
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) ReceiveReturnRequest(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64, items []scommerce.ReturnItem, resolution string) error {
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	var requestedRaw json.RawMessage
+	err = tx.QueryRow(
+		ctx,
+		`select "status", "items" from return_requests where "id" = $1 for update`,
+		rid,
+	).Scan(&status, &requestedRaw)
+	if err != nil {
+		return err
+	}
+	if status != scommerce.ReturnStatusApproved {
+		return errors.Join(scommerce.ErrReturnRequestStatus, errors.New("return request is "+status+", not "+scommerce.ReturnStatusApproved))
+	}
+	var requested []scommerce.ReturnItem
+	if err := json.Unmarshal(requestedRaw, &requested); err != nil {
+		return err
+	}
+	remaining := make(map[uint64]uint64, len(requested))
+	for _, item := range requested {
+		remaining[item.ProductItemID] += item.Quantity
+	}
+	for _, item := range items {
+		if item.Quantity > remaining[item.ProductItemID] {
+			return errors.Join(scommerce.ErrReturnExceedsQuantity, errors.New("product item "+strconv.FormatUint(item.ProductItemID, 10)+" was requested "+strconv.FormatUint(remaining[item.ProductItemID], 10)+" times"))
+		}
+		remaining[item.ProductItemID] -= item.Quantity
+	}
+
+	itemsRaw, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		ctx,
+		`
+			update return_requests set
+				"status" = $2,
+				"received_items" = $3,
+				"resolution" = $4,
+				"updated_at" = now()
+			where "id" = $1
+		`,
+		rid,
+		scommerce.ReturnStatusReceived,
+		itemsRaw,
+		resolution,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *PostgreDatabase) SetReturnRequestCreditNote(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64, creditNoteID uint64) error {
+	tag, err := db.PgxPool.Exec(
+		ctx,
+		`
+			update return_requests set
+				"credit_note_id" = $3,
+				"updated_at" = now()
+			where "id" = $1 and "status" = $2
+		`,
+		rid,
+		scommerce.ReturnStatusRefunding,
+		creditNoteID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return db.returnRequestStatusError(ctx, rid, scommerce.ReturnStatusRefunding)
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) SetReturnRequestRefunded(ctx context.Context, form *scommerce.ReturnRequestForm[UserAccountID], rid uint64, creditNoteID uint64) error {
+	tag, err := db.PgxPool.Exec(
+		ctx,
+		`
+			update return_requests set
+				"status" = $3,
+				"credit_note_id" = $4,
+				"updated_at" = now()
+			where "id" = $1 and "status" = $2
+		`,
+		rid,
+		scommerce.ReturnStatusRefunding,
+		scommerce.ReturnStatusRefunded,
+		creditNoteID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return db.returnRequestStatusError(ctx, rid, scommerce.ReturnStatusRefunding)
+	}
+	return nil
+}
+
+// returnRequestStatusError explains why a status update matched no row.
+func (db *PostgreDatabase) returnRequestStatusError(ctx context.Context, rid uint64, expected string) error {
+	status, err := db.GetReturnRequestStatus(ctx, nil, rid)
+	if err != nil {
+		return err
+	}
+	return errors.Join(scommerce.ErrReturnRequestStatus, errors.New("return request is "+status+", not "+expected))
+}
@@ -0,0 +1,484 @@
+package dbsamples
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var _ scommerce.DBShipmentManager = &PostgreDatabase{}
+var _ scommerce.DBShipment = &PostgreDatabase{}
+
+const shipmentColumns = `
+	"id",
+	"order_id",
+	"carrier",
+	"tracking_number",
+	"items",
+	"shipped_at",
+	"delivered_at"
+`
+
+func (db *PostgreDatabase) InitShipmentManager(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			create table if not exists shipments(
+				id              bigint generated by default as identity primary key,
+				order_id        bigint not null references orders(id) on delete cascade,
+				carrier         varchar(256) not null,
+				tracking_number varchar(256) not null,
+				items           jsonb not null,
+				shipped_at      timestamptz,
+				delivered_at    timestamptz,
+				created_at      timestamptz not null default now()
+			);
+
+			create index if not exists shipments_order_idx on shipments(order_id);
+			create index if not exists shipments_tracking_number_idx on shipments(tracking_number);
+		`,
+	)
+	return err
+}
+
+// orderItemQuantities returns the ordered quantity of every product item of the order minus its credit notes, the
+// order row is locked until tx ends.
+func (db *PostgreDatabase) orderItemQuantities(ctx context.Context, tx pgx.Tx, oid uint64) (map[uint64]uint64, error) {
+	var productItems json.RawMessage
+	err := tx.QueryRow(
+		ctx,
+		`select coalesce("product_items", '[]'::jsonb) from orders where "id" = $1 for update`,
+		oid,
+	).Scan(&productItems)
+	if err != nil {
+		return nil, err
+	}
+	var ordered []scommerce.ShipmentItem
+	if err := json.Unmarshal(productItems, &ordered); err != nil {
+		return nil, err
+	}
+	quantities := make(map[uint64]uint64, len(ordered))
+	for _, item := range ordered {
+		quantities[item.ProductItemID] += item.Quantity
+	}
+	err = db.subtractItemQuantities(
+		ctx,
+		tx,
+		quantities,
+		`select cn.items from credit_notes cn where cn.order_id = $1`,
+		oid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return quantities, nil
+}
+
+// subtractItemQuantities subtracts the item quantities of the jsonb "items" column selected by query from quantities.
+func (db *PostgreDatabase) subtractItemQuantities(ctx context.Context, tx pgx.Tx, quantities map[uint64]uint64, query string, args ...any) error {
+	rows, err := tx.Query(
+		ctx,
+		`
+			select (item->>'product_item_id')::bigint, sum((item->>'quantity')::bigint)
+			from (`+query+`) held
+			cross join lateral jsonb_array_elements(held.items) as item
+			group by 1
+		`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var productItemID uint64
+		var quantity uint64
+		if err := rows.Scan(&productItemID, &quantity); err != nil {
+			return err
+		}
+		quantities[productItemID] -= min(quantity, quantities[productItemID])
+	}
+	return rows.Err()
+}
+
+func (db *PostgreDatabase) NewShipment(ctx context.Context, oid uint64, carrier string, trackingNumber string, items []scommerce.ShipmentItem, form *scommerce.ShipmentForm) (uint64, error) {
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	unshipped, err := db.orderItemQuantities(ctx, tx, oid)
+	if err != nil {
+		return 0, err
+	}
+	// the order row is locked, so it can't be cancelled or refunded until the shipment is stored
+	var statusName pgtype.Text
+	err = tx.QueryRow(
+		ctx,
+		`
+			select os."status"
+			from orders o
+			left join order_statuses os on os."id" = o."order_status_id"
+			where o."id" = $1
+		`,
+		oid,
+	).Scan(&statusName)
+	if err != nil {
+		return 0, err
+	}
+	// idle orders predate the payment lifecycle and were paid at checkout
+	if statusName.String != scommerce.OrderStatusPaid && statusName.String != scommerce.OrderStatusShipped && statusName.String != idleOrderStatusName {
+		return 0, errors.Join(scommerce.ErrOrderNotShippable, errors.New("order is "+statusName.String))
+	}
+	err = db.subtractItemQuantities(ctx, tx, unshipped, `select s.items from shipments s where s.order_id = $1`, oid)
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		if item.Quantity > unshipped[item.ProductItemID] {
+			return 0, errors.Join(scommerce.ErrShipmentExceedsQuantity, errors.New("product item "+strconv.FormatUint(item.ProductItemID, 10)+" has "+strconv.FormatUint(unshipped[item.ProductItemID], 10)+" unshipped units"))
+		}
+		unshipped[item.ProductItemID] -= item.Quantity
+	}
+
+	itemsRaw, err := json.Marshal(items)
+	if err != nil {
+		return 0, err
+	}
+	var id uint64
+	err = tx.QueryRow(
+		ctx,
+		`
+			insert into shipments("order_id", "carrier", "tracking_number", "items")
+			values($1, $2, $3, $4)
+			returning "id"
+		`,
+		oid,
+		carrier,
+		trackingNumber,
+		itemsRaw,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	if form != nil {
+		form.ID = id
+	}
+	return id, nil
+}
+
+func (db *PostgreDatabase) RemoveShipment(ctx context.Context, shid uint64) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`delete from shipments where "id" = $1`,
+		shid,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) RemoveAllShipments(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`delete from shipments`,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) GetShipmentCount(ctx context.Context) (uint64, error) {
+	var count uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select count(*) from shipments`,
+	).Scan(&count)
+	return count, err
+}
+
+func (db *PostgreDatabase) GetShipments(ctx context.Context, ids []uint64, forms []*scommerce.ShipmentForm, skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]uint64, []*scommerce.ShipmentForm, error) {
+	return db.queryShipments(
+		ctx,
+		ids,
+		forms,
+		`select `+shipmentColumns+` from shipments order by "id" `+queueOrder.String()+` offset $1 limit $2`,
+		skip,
+		limit,
+	)
+}
+
+func (db *PostgreDatabase) GetOrderShipments(ctx context.Context, oid uint64, ids []uint64, forms []*scommerce.ShipmentForm) ([]uint64, []*scommerce.ShipmentForm, error) {
+	return db.queryShipments(
+		ctx,
+		ids,
+		forms,
+		`select `+shipmentColumns+` from shipments where "order_id" = $1 order by "id"`,
+		oid,
+	)
+}
+
+func (db *PostgreDatabase) queryShipments(ctx context.Context, ids []uint64, forms []*scommerce.ShipmentForm, query string, args ...any) ([]uint64, []*scommerce.ShipmentForm, error) {
+	shipmentIDs := ids
+	if shipmentIDs == nil {
+		shipmentIDs = make([]uint64, 0, 10)
+	}
+	shipmentForms := forms
+	if shipmentForms == nil {
+		shipmentForms = make([]*scommerce.ShipmentForm, 0, cap(shipmentIDs))
+	}
+
+	rows, err := db.PgxPool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		form := &scommerce.ShipmentForm{}
+		if err := scanShipment(rows, form); err != nil {
+			return nil, nil, err
+		}
+		shipmentIDs = append(shipmentIDs, form.ID)
+		shipmentForms = append(shipmentForms, form)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return shipmentIDs, shipmentForms, nil
+}
+
+func scanShipment(row pgx.Row, form *scommerce.ShipmentForm) error {
+	var orderID uint64
+	var carrier string
+	var trackingNumber string
+	var itemsRaw json.RawMessage
+	var shippedAt pgtype.Timestamptz
+	var deliveredAt pgtype.Timestamptz
+	err := row.Scan(
+		&form.ID,
+		&orderID,
+		&carrier,
+		&trackingNumber,
+		&itemsRaw,
+		&shippedAt,
+		&deliveredAt,
+	)
+	if err != nil {
+		return err
+	}
+	var items []scommerce.ShipmentItem
+	if err := json.Unmarshal(itemsRaw, &items); err != nil {
+		return err
+	}
+	form.OrderID = &orderID
+	form.Carrier = &carrier
+	form.TrackingNumber = &trackingNumber
+	form.Items = &items
+	form.ShippedAt = &shippedAt.Time
+	form.DeliveredAt = &deliveredAt.Time
+	return nil
+}
+
+func (db *PostgreDatabase) GetShipmentByTrackingNumber(ctx context.Context, trackingNumber string, form *scommerce.ShipmentForm) (uint64, error) {
+	if form == nil {
+		form = &scommerce.ShipmentForm{}
+	}
+	row := db.PgxPool.QueryRow(
+		ctx,
+		`select `+shipmentColumns+` from shipments where "tracking_number" = $1 order by "id" desc limit 1`,
+		trackingNumber,
+	)
+	if err := scanShipment(row, form); err != nil {
+		return 0, err
+	}
+	return form.ID, nil
+}
+
+func (db *PostgreDatabase) FillShipmentWithID(ctx context.Context, shid uint64, form *scommerce.ShipmentForm) error {
+	if form == nil {
+		return errors.New("shipment form is nil")
+	}
+	row := db.PgxPool.QueryRow(
+		ctx,
+		`select `+shipmentColumns+` from shipments where "id" = $1`,
+		shid,
+	)
+	return scanShipment(row, form)
+}
+
+func (db *PostgreDatabase) GetShipmentOrderID(ctx context.Context, form *scommerce.ShipmentForm, shid uint64) (uint64, error) {
+	var orderID uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "order_id" from shipments where "id" = $1`,
+		shid,
+	).Scan(&orderID)
+	return orderID, err
+}
+
+func (db *PostgreDatabase) GetShipmentItems(ctx context.Context, form *scommerce.ShipmentForm, shid uint64) ([]scommerce.ShipmentItem, error) {
+	var itemsRaw json.RawMessage
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "items" from shipments where "id" = $1`,
+		shid,
+	).Scan(&itemsRaw)
+	if err != nil {
+		return nil, err
+	}
+	var items []scommerce.ShipmentItem
+	if err := json.Unmarshal(itemsRaw, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (db *PostgreDatabase) GetShipmentCarrier(ctx context.Context, form *scommerce.ShipmentForm, shid uint64) (string, error) {
+	var carrier string
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "carrier" from shipments where "id" = $1`,
+		shid,
+	).Scan(&carrier)
+	return carrier, err
+}
+
+func (db *PostgreDatabase) SetShipmentCarrier(ctx context.Context, form *scommerce.ShipmentForm, shid uint64, carrier string) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`update shipments set "carrier" = $1 where "id" = $2`,
+		carrier,
+		shid,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) GetShipmentTrackingNumber(ctx context.Context, form *scommerce.ShipmentForm, shid uint64) (string, error) {
+	var trackingNumber string
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "tracking_number" from shipments where "id" = $1`,
+		shid,
+	).Scan(&trackingNumber)
+	return trackingNumber, err
+}
+
+func (db *PostgreDatabase) SetShipmentTrackingNumber(ctx context.Context, form *scommerce.ShipmentForm, shid uint64, trackingNumber string) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`update shipments set "tracking_number" = $1 where "id" = $2`,
+		trackingNumber,
+		shid,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) GetShipmentShippedAt(ctx context.Context, form *scommerce.ShipmentForm, shid uint64) (time.Time, error) {
+	var shippedAt pgtype.Timestamptz
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "shipped_at" from shipments where "id" = $1`,
+		shid,
+	).Scan(&shippedAt)
+	return shippedAt.Time, err
+}
+
+func (db *PostgreDatabase) GetShipmentDeliveredAt(ctx context.Context, form *scommerce.ShipmentForm, shid uint64) (time.Time, error) {
+	var deliveredAt pgtype.Timestamptz
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "delivered_at" from shipments where "id" = $1`,
+		shid,
+	).Scan(&deliveredAt)
+	return deliveredAt.Time, err
+}
+
+func (db *PostgreDatabase) ShipShipment(ctx context.Context, form *scommerce.ShipmentForm, shid uint64, at time.Time) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`update shipments set "shipped_at" = $1 where "id" = $2`,
+		at,
+		shid,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) DeliverShipment(ctx context.Context, form *scommerce.ShipmentForm, shid uint64, at time.Time, comment string) error {
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// a box can't arrive without leaving
+	var oid uint64
+	err = tx.QueryRow(
+		ctx,
+		`
+			update shipments set
+				"shipped_at" = coalesce("shipped_at", $1),
+				"delivered_at" = $1
+			where "id" = $2
+			returning "order_id"
+		`,
+		at,
+		shid,
+	).Scan(&oid)
+	if err != nil {
+		return err
+	}
+
+	undelivered, err := db.orderItemQuantities(ctx, tx, oid)
+	if err != nil {
+		return err
+	}
+	err = db.subtractItemQuantities(
+		ctx,
+		tx,
+		undelivered,
+		`select s.items from shipments s where s.order_id = $1 and s.delivered_at is not null`,
+		oid,
+	)
+	if err != nil {
+		return err
+	}
+	var orderDeliveried bool
+	err = tx.QueryRow(
+		ctx,
+		`select coalesce("order_status_id" = $2, false) from orders where "id" = $1`,
+		oid,
+		deliveredOrderStatusID,
+	).Scan(&orderDeliveried)
+	if err != nil {
+		return err
+	}
+	allDelivered := true
+	for _, quantity := range undelivered {
+		if quantity > 0 {
+			allDelivered = false
+			break
+		}
+	}
+	if allDelivered && !orderDeliveried {
+		if err := db.deliverUserOrderTx(ctx, tx, oid, deliveredOrderStatusID, at, comment); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	if form != nil {
+		form.OrderID = &oid
+	}
+	return nil
+}
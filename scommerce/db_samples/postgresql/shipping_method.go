@@ -26,20 +26,20 @@ func (db *PostgreDatabase) GetShippingMethodName(ctx context.Context, form *scom
 	return name, nil
 }
 
-func (db *PostgreDatabase) GetShippingMethodPrice(ctx context.Context, form *scommerce.ShippingMethodForm, id uint64) (float64, error) {
-	var price float64
+func (db *PostgreDatabase) GetShippingMethodPrice(ctx context.Context, form *scommerce.ShippingMethodForm, id uint64) (scommerce.Money, error) {
+	var price int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select "price" from shipping_methods where "id"=$1 limit 1`,
 		id,
 	).Scan(&price)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.Price = &price
+		form.Price = db.moneyPtr(price)
 	}
-	return price, nil
+	return db.money(price), nil
 }
 
 func (db *PostgreDatabase) SetShippingMethodName(ctx context.Context, form *scommerce.ShippingMethodForm, id uint64, name string) error {
@@ -52,11 +52,15 @@ func (db *PostgreDatabase) SetShippingMethodName(ctx context.Context, form *scom
 	return err
 }
 
-func (db *PostgreDatabase) SetShippingMethodPrice(ctx context.Context, form *scommerce.ShippingMethodForm, id uint64, price float64) error {
-	_, err := db.PgxPool.Exec(
+func (db *PostgreDatabase) SetShippingMethodPrice(ctx context.Context, form *scommerce.ShippingMethodForm, id uint64, price scommerce.Money) error {
+	priceUnits, err := db.minorUnits(price)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
 		ctx,
 		`update shipping_methods set "price"=$1 where "id"=$2`,
-		price,
+		priceUnits,
 		id,
 	)
 	return err
@@ -78,7 +82,7 @@ func (db *PostgreDatabase) ExistsShippingMethod(ctx context.Context, name string
 func (db *PostgreDatabase) GetShippingMethodByName(ctx context.Context, name string, methodForm *scommerce.ShippingMethodForm) (uint64, error) {
 	var id uint64
 	var rName string
-	var rPrice float64
+	var rPrice int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select "id", "name", "price" from shipping_methods where "name"=$1 limit 1`,
@@ -90,7 +94,7 @@ func (db *PostgreDatabase) GetShippingMethodByName(ctx context.Context, name str
 	if methodForm != nil {
 		methodForm.ID = id
 		methodForm.Name = &rName
-		methodForm.Price = &rPrice
+		methodForm.Price = db.moneyPtr(rPrice)
 	}
 	return id, nil
 }
@@ -131,7 +135,7 @@ func (db *PostgreDatabase) GetShippingMethods(ctx context.Context, shippingMetho
 	for rows.Next() {
 		var id uint64
 		var name string
-		var price float64
+		var price int64
 		if err := rows.Scan(&id, &name, &price); err != nil {
 			return nil, nil, err
 		}
@@ -139,7 +143,7 @@ func (db *PostgreDatabase) GetShippingMethods(ctx context.Context, shippingMetho
 		forms = append(forms, &scommerce.ShippingMethodForm{
 			ID:    id,
 			Name:  &name,
-			Price: &price,
+			Price: db.moneyPtr(price),
 		})
 	}
 
@@ -157,22 +161,29 @@ func (db *PostgreDatabase) InitShippingMethodManager(ctx context.Context) error
 			create table if not exists shipping_methods(
 				id    bigint generated by default as identity primary key,
 				name  varchar(256) not null unique,
-				price double precision default 0
+				price numeric(20, 0) default 0
 			);
 		`,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return db.migrateMoneyColumns(ctx, "shipping_methods", []string{"price"})
 }
 
-func (db *PostgreDatabase) NewShippingMethod(ctx context.Context, name string, price float64, methodForm *scommerce.ShippingMethodForm) (uint64, error) {
+func (db *PostgreDatabase) NewShippingMethod(ctx context.Context, name string, price scommerce.Money, methodForm *scommerce.ShippingMethodForm) (uint64, error) {
+	priceUnits, err := db.minorUnits(price)
+	if err != nil {
+		return 0, err
+	}
 	var id uint64
 	var rName string
-	var rPrice float64
-	err := db.PgxPool.QueryRow(
+	var rPrice int64
+	err = db.PgxPool.QueryRow(
 		ctx,
 		`insert into shipping_methods("name", "price") values($1, $2) returning "id", "name", "price"`,
 		name,
-		price,
+		priceUnits,
 	).Scan(&id, &rName, &rPrice)
 	if err != nil {
 		return 0, err
@@ -180,7 +191,7 @@ func (db *PostgreDatabase) NewShippingMethod(ctx context.Context, name string, p
 	if methodForm != nil {
 		methodForm.ID = id
 		methodForm.Name = &name
-		methodForm.Price = &price
+		methodForm.Price = db.moneyPtr(priceUnits)
 	}
 	return id, nil
 }
@@ -208,7 +219,7 @@ func (db *PostgreDatabase) FillShippingMethodWithID(ctx context.Context, sid uin
 	}
 
 	var name string
-	var price float64
+	var price int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select "name", "price" from shipping_methods where "id" = $1 limit 1`,
@@ -220,6 +231,6 @@ func (db *PostgreDatabase) FillShippingMethodWithID(ctx context.Context, sid uin
 
 	methodForm.ID = sid
 	methodForm.Name = &name
-	methodForm.Price = &price
+	methodForm.Price = db.moneyPtr(price)
 	return nil
 }
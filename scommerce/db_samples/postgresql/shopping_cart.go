@@ -4,18 +4,28 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strconv"
 	"time"
 
 	"github.com/MobinYengejehi/scommerce/scommerce"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 var _ scommerce.DBUserShoppingCartManager[UserAccountID] = &PostgreDatabase{}
 var _ scommerce.DBUserShoppingCart[UserAccountID] = &PostgreDatabase{}
 
-func (db *PostgreDatabase) CalculateUserShoppingCartDept(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64, shippingMethod uint64) (float64, error) {
-	var dept float64
+func (db *PostgreDatabase) CalculateUserShoppingCartDept(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64, shippingMethod uint64, shippingCost *scommerce.Money) (scommerce.Money, error) {
+	var cost *int64 = nil
+	if shippingCost != nil {
+		units, err := db.minorUnits(*shippingCost)
+		if err != nil {
+			return scommerce.Money{}, err
+		}
+		cost = &units
+	}
+	var dept int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`
@@ -27,7 +37,7 @@ func (db *PostgreDatabase) CalculateUserShoppingCartDept(ctx context.Context, fo
 					join product_items pi on sci."product_item_id" = pi."id"
 					where sci."cart_id" = sc."id"
 				), 0)
-				+ coalesce(sm.price, 0) as "dept"
+				+ coalesce($3::numeric, sm.price, 0) as "dept"
 			from shopping_carts sc
 			left join shipping_methods sm on sm.id = $1
 			where sc."id" = $2
@@ -35,14 +45,115 @@ func (db *PostgreDatabase) CalculateUserShoppingCartDept(ctx context.Context, fo
 		`,
 		shippingMethod,
 		sid,
+		cost,
 	).Scan(&dept)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.Dept = &dept
+		form.Dept = db.moneyPtr(dept)
+	}
+	return db.money(dept), nil
+}
+
+func (db *PostgreDatabase) GetUserShoppingCartTaxableItems(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64) ([]scommerce.TaxableItem, error) {
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				sci."product_item_id",
+				coalesce(pi."price", 0),
+				sci."quantity",
+				coalesce((
+					with recursive chain("id", "parent_category_id", "depth") as (
+						select pc."id", pc."parent_category_id", 0
+						from product_categories pc
+						where pc."id" = p."category_id"
+						union all
+						select pc."id", pc."parent_category_id", chain."depth" + 1
+						from product_categories pc
+						join chain on pc."id" = chain."parent_category_id"
+					)
+					select jsonb_agg(chain."id" order by chain."depth") from chain
+				), '[]'::jsonb) as "category_ids"
+			from shopping_cart_items sci
+			join product_items pi on sci."product_item_id" = pi."id"
+			left join products p on pi."product_id" = p."id"
+			where sci."cart_id" = $1
+			order by sci."id"
+		`,
+		sid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]scommerce.TaxableItem, 0)
+	for rows.Next() {
+		var item scommerce.TaxableItem
+		var categoryIDs []byte
+		if err := rows.Scan(&item.ProductItemID, &item.UnitPrice, &item.Quantity, &categoryIDs); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(categoryIDs, &item.CategoryIDs); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
 	}
-	return dept, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (db *PostgreDatabase) GetUserShoppingCartShippableItems(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64) ([]scommerce.ShippableItem, error) {
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				sci."product_item_id",
+				coalesce(pi."price", 0),
+				sci."quantity",
+				pi."weight",
+				pi."length",
+				pi."width",
+				pi."height"
+			from shopping_cart_items sci
+			join product_items pi on sci."product_item_id" = pi."id"
+			where sci."cart_id" = $1
+			order by sci."id"
+		`,
+		sid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]scommerce.ShippableItem, 0, 8)
+	for rows.Next() {
+		var item scommerce.ShippableItem
+		var price int64
+		err := rows.Scan(
+			&item.ProductItemID,
+			&price,
+			&item.Quantity,
+			&item.Weight,
+			&item.Dimensions.Length,
+			&item.Dimensions.Width,
+			&item.Dimensions.Height,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.UnitPrice = db.money(price)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 func (db *PostgreDatabase) GetUserShoppingCartItemCount(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64) (uint64, error) {
@@ -76,14 +187,14 @@ func (db *PostgreDatabase) GetUserShoppingCartItems(ctx context.Context, form *s
 		`
 			select
 				"id",
-				(
+				coalesce((
 					select
 						sc."user_id"
 					from shopping_carts sc
 					where sc."id" = sci."cart_id"
 					limit 1
-				) as "user_id",
-				"product_item_id",
+				), 0) as "user_id",
+				coalesce("product_item_id", 0),
 				"quantity",
 				coalesce((
 					select
@@ -113,7 +224,7 @@ func (db *PostgreDatabase) GetUserShoppingCartItems(ctx context.Context, form *s
 		var userID UserAccountID
 		var productItemID uint64
 		var quantity int64
-		var dept float64
+		var dept int64
 		var attrs json.RawMessage
 		if err := rows.Scan(&id, &userID, &productItemID, &quantity, &dept, &attrs); err != nil {
 			return nil, nil, err
@@ -136,7 +247,7 @@ func (db *PostgreDatabase) GetUserShoppingCartItems(ctx context.Context, form *s
 			UserAccountID: userID,
 			ProductItem:   item,
 			Quantity:      &quantity,
-			Dept:          &dept,
+			Dept:          db.moneyPtr(dept),
 			Attributes:    &attrs,
 			ShoppingCart: &scommerce.BuiltinUserShoppingCart[UserAccountID]{
 				DB:                 db,
@@ -185,8 +296,10 @@ func (db *PostgreDatabase) NewUserShoppingCartShoppingCartItem(ctx context.Conte
 		ctx,
 		`
 			insert into
-				shopping_cart_items("cart_id", "product_item_id", "quantity", "attributes")
-				values($1, $2, $3, $4)
+				shopping_cart_items("cart_id", "product_item_id", "quantity", "attributes", "unit_price")
+				select $1, pi."id", $3, $4, pi."price"
+				from product_items pi
+				where pi."id" = $2
 				returning "id";
 		`,
 		sid,
@@ -220,11 +333,18 @@ func (db *PostgreDatabase) NewUserShoppingCartShoppingCartItem(ctx context.Conte
 	return id, nil
 }
 
-func (db *PostgreDatabase) OrderUserShoppingCart(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64, paymentMethod uint64, address uint64, shippingMethod uint64, userComment string, discountCode string, orderForm *scommerce.UserOrderForm[UserAccountID]) (uint64, error) {
+// pricedCartLine is a cart line as OrderPricing priced it, in the shape order_shopping_cart compares with its locked lines.
+type pricedCartLine struct {
+	ProductItemID uint64 `json:"product_item_id"`
+	UnitPrice     int64  `json:"unit_price"`
+	Quantity      int64  `json:"quantity"`
+}
+
+func (db *PostgreDatabase) OrderUserShoppingCart(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64, paymentMethod uint64, address uint64, shippingMethod uint64, shippingCost *scommerce.Money, userComment string, discountCode string, pricing *scommerce.OrderPricing, idempotencyKey string, orderForm *scommerce.UserOrderForm[UserAccountID]) (uint64, error) {
 	var orderID uint64
 	var userID UserAccountID
 	var orderDate time.Time
-	var orderTotal float64
+	var orderTotal int64
 	var productItemCount uint64
 
 	var discountCodePtr *string
@@ -232,18 +352,134 @@ func (db *PostgreDatabase) OrderUserShoppingCart(ctx context.Context, form *scom
 		discountCodePtr = &discountCode
 	}
 
-	err := db.PgxPool.QueryRow(
+	var cost *int64 = nil
+	if shippingCost != nil {
+		units, err := db.minorUnits(*shippingCost)
+		if err != nil {
+			return 0, err
+		}
+		cost = &units
+	}
+
+	if pricing == nil {
+		pricing = &scommerce.OrderPricing{}
+	}
+	var taxLines []byte
+	if pricing.Tax != nil {
+		lines, err := json.Marshal(pricing.Tax.Lines)
+		if err != nil {
+			return 0, err
+		}
+		taxLines = lines
+	}
+	var promotionLines []byte
+	if pricing.Promotions != nil {
+		lines, err := json.Marshal(pricing.Promotions.Lines)
+		if err != nil {
+			return 0, err
+		}
+		promotionLines = lines
+	}
+	// the checkout compares the lines the pricing was computed from with the locked cart lines
+	pricedItems := make([]pricedCartLine, 0, len(pricing.Items))
+	for _, item := range pricing.Items {
+		unitPrice, err := db.minorUnits(item.UnitPrice)
+		if err != nil {
+			return 0, err
+		}
+		pricedItems = append(pricedItems, pricedCartLine{
+			ProductItemID: item.ProductItemID,
+			UnitPrice:     unitPrice,
+			Quantity:      item.Quantity,
+		})
+	}
+	pricedItemsRaw, err := json.Marshal(pricedItems)
+	if err != nil {
+		return 0, err
+	}
+	pricedDiscount, err := db.minorUnits(pricing.Discount)
+	if err != nil {
+		return 0, err
+	}
+
+	// orders wait for their payment, the payment gateway moves them to paid
+	statusForm := scommerce.OrderStatusForm{}
+	statusID, err := db.GetOrderStatusByName(ctx, scommerce.OrderStatusPendingPayment, &statusForm)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var result struct {
+		OrderID uint64 `json:"order_id"`
+	}
+	if idempotencyKey != "" {
+		fingerprint := "cart=" + strconv.FormatUint(sid, 10) +
+			";payment_method=" + strconv.FormatUint(paymentMethod, 10) +
+			";address=" + strconv.FormatUint(address, 10) +
+			";shipping_method=" + strconv.FormatUint(shippingMethod, 10) +
+			";discount_code=" + discountCode
+		response, err := db.claimIdempotencyKey(ctx, tx, idempotencyScopeOrder, idempotencyKey, fingerprint)
+		if err != nil {
+			return 0, err
+		}
+		if response != nil {
+			if err := json.Unmarshal(response, &result); err != nil {
+				return 0, err
+			}
+			if orderForm != nil {
+				if err := db.FillUserOrderWithID(ctx, result.OrderID, orderForm); err != nil {
+					return 0, err
+				}
+			}
+			return result.OrderID, nil
+		}
+	}
+
+	err = tx.QueryRow(
 		ctx,
-		`select * from order_shopping_cart($1, $2, $3, $4, $5, $6, $7)`,
+		`select * from order_shopping_cart($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
 		sid,
 		paymentMethod,
 		address,
 		shippingMethod,
-		idleOrderStatusID,
+		statusID,
 		userComment,
 		discountCodePtr,
+		taxLines,
+		cost,
+		promotionLines,
+		pricedItemsRaw,
+		pricedDiscount,
 	).Scan(&orderID, &userID, &orderDate, &orderTotal, &productItemCount)
 	if err != nil {
+		if stockErr := asInsufficientStockError(err); stockErr != nil {
+			return 0, stockErr
+		}
+		if IsCode(err, productItemRemovedCode) {
+			return 0, errors.Join(scommerce.ErrProductItemRemoved, err)
+		}
+		if IsCode(err, shoppingCartChangedCode) {
+			return 0, errors.Join(scommerce.ErrShoppingCartChanged, err)
+		}
+		if discountErr := asDiscountNotApplicableError(err); discountErr != nil {
+			return 0, discountErr
+		}
+		return 0, err
+	}
+
+	if idempotencyKey != "" {
+		result.OrderID = orderID
+		if err := db.completeIdempotencyKey(ctx, tx, idempotencyScopeOrder, idempotencyKey, result); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
 		return 0, err
 	}
 
@@ -251,7 +487,7 @@ func (db *PostgreDatabase) OrderUserShoppingCart(ctx context.Context, form *scom
 		orderForm.ID = orderID
 		orderForm.UserAccountID = userID
 		orderForm.Date = &orderDate
-		orderForm.Total = &orderTotal
+		orderForm.Total = db.moneyPtr(orderTotal)
 		orderForm.ProductItemCount = &productItemCount
 		orderForm.PaymentMethod = &scommerce.BuiltinUserPaymentMethod[UserAccountID]{
 			DB: db,
@@ -272,16 +508,168 @@ func (db *PostgreDatabase) OrderUserShoppingCart(ctx context.Context, form *scom
 			},
 		}
 		orderForm.Status = &scommerce.BuiltinOrderStatus{
-			DB: db,
-			OrderStatusForm: scommerce.OrderStatusForm{
-				ID: idleOrderStatusID,
-			},
+			DB:              db,
+			OrderStatusForm: statusForm,
 		}
 	}
 
 	return orderID, nil
 }
 
+func (db *PostgreDatabase) MergeUserShoppingCartInto(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64, aid UserAccountID, cartForm *scommerce.UserShoppingCartForm[UserAccountID]) (uint64, error) {
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var owner pgtype.Int8
+	var sessionText pgtype.Text
+	err = tx.QueryRow(
+		ctx,
+		`select "user_id", "session_text" from shopping_carts where "id" = $1 for update`,
+		sid,
+	).Scan(&owner, &sessionText)
+	if err != nil {
+		return 0, err
+	}
+	if owner.Valid {
+		return 0, scommerce.ErrShoppingCartNotGuest
+	}
+
+	var target uint64
+	err = tx.QueryRow(
+		ctx,
+		`select "id" from shopping_carts where "user_id" = $1 order by "id" desc limit 1 for update`,
+		aid,
+	).Scan(&target)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// the guest cart becomes the cart of the account
+		_, err = tx.Exec(ctx, `update shopping_carts set "user_id" = $1 where "id" = $2`, aid, sid)
+		if err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return 0, err
+		}
+		if cartForm != nil {
+			cartForm.ID = sid
+			cartForm.UserAccountID = aid
+			if sessionText.Valid {
+				cartForm.SessionText = &sessionText.String
+			}
+		}
+		return sid, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`
+			insert into shopping_cart_items("cart_id", "product_item_id", "quantity", "attributes", "unit_price")
+			select $1, sci."product_item_id", sci."quantity", sci."attributes", sci."unit_price"
+			from shopping_cart_items sci
+			where sci."cart_id" = $2
+			  and sci."product_item_id" is not null
+			order by sci."id"
+			on conflict ("cart_id", "product_item_id", (coalesce("attributes", 'null'::jsonb)))
+			do update set "quantity" = shopping_cart_items."quantity" + excluded."quantity"
+		`,
+		target,
+		sid,
+	)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx, `delete from shopping_carts where "id" = $1`, sid)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	if cartForm != nil {
+		if err := db.FillUserShoppingCartWithID(ctx, target, cartForm); err != nil {
+			return 0, err
+		}
+	}
+	return target, nil
+}
+
+func (db *PostgreDatabase) GetUserShoppingCartValidationItems(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64) ([]scommerce.DBShoppingCartValidationItem, error) {
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				sci."id",
+				coalesce(sci."product_item_id", 0),
+				sci."quantity",
+				sci."unit_price"::bigint,
+				coalesce(pi."price", 0),
+				coalesce(pi."quantity_in_stock" - coalesce((
+					select sum(sr."quantity")
+					from stock_reservations sr
+					where sr."product_item_id" = pi."id"
+					  and sr."cart_id" <> sci."cart_id"
+					  and sr."expires_at" > now()
+				), 0), 0)
+			from shopping_cart_items sci
+			left join product_items pi on sci."product_item_id" = pi."id"
+			where sci."cart_id" = $1
+			order by sci."id"
+		`,
+		sid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]scommerce.DBShoppingCartValidationItem, 0, 8)
+	for rows.Next() {
+		var item scommerce.DBShoppingCartValidationItem
+		var addedPrice pgtype.Int8
+		var price int64
+		err := rows.Scan(
+			&item.ShoppingCartItemID,
+			&item.ProductItemID,
+			&item.Quantity,
+			&addedPrice,
+			&price,
+			&item.Available,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if addedPrice.Valid {
+			item.AddedPrice = db.moneyPtr(addedPrice.Int64)
+		}
+		item.Price = db.money(price)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (db *PostgreDatabase) AcceptUserShoppingCartPrices(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			update shopping_cart_items sci
+			set "unit_price" = pi."price"
+			from product_items pi
+			where sci."cart_id" = $1
+			  and sci."product_item_id" = pi."id"
+		`,
+		sid,
+	)
+	return err
+}
+
 func (db *PostgreDatabase) RemoveUserShoppingCartAllShoppingCartItems(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64) error {
 	_, err := db.PgxPool.Exec(
 		ctx,
@@ -323,16 +711,185 @@ func (db *PostgreDatabase) SetUserShoppingCartSessionText(ctx context.Context, f
 	return nil
 }
 
+func (db *PostgreDatabase) ReserveUserShoppingCartStock(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64, expiresAt time.Time) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`select reserve_shopping_cart_stock($1, $2)`,
+		sid,
+		expiresAt,
+	)
+	if err != nil {
+		if stockErr := asInsufficientStockError(err); stockErr != nil {
+			return stockErr
+		}
+		return err
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) ReleaseUserShoppingCartStock(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`delete from stock_reservations where "cart_id" = $1`,
+		sid,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) GetUserShoppingCartLastActivityAt(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64) (time.Time, error) {
+	var lastActivityAt time.Time
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select "last_activity_at" from shopping_carts where "id" = $1`,
+		sid,
+	).Scan(&lastActivityAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lastActivityAt, nil
+}
+
+func (db *PostgreDatabase) GetUserShoppingCartStockReservationExpiresAt(ctx context.Context, form *scommerce.UserShoppingCartForm[UserAccountID], sid uint64) (time.Time, error) {
+	var expiresAt pgtype.Timestamptz
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select min("expires_at") from stock_reservations where "cart_id" = $1 and "expires_at" > now()`,
+		sid,
+	).Scan(&expiresAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !expiresAt.Valid {
+		return time.Time{}, nil
+	}
+	return expiresAt.Time, nil
+}
+
+func (db *PostgreDatabase) RemoveExpiredStockReservations(ctx context.Context, now time.Time) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`delete from stock_reservations where "expires_at" <= $1`,
+		now,
+	)
+	return err
+}
+
+func (db *PostgreDatabase) GetAbandonedShoppingCarts(ctx context.Context, inactiveSince time.Time, carts []scommerce.DBUserUserShoppingCartResult[UserAccountID], cartForms []*scommerce.UserShoppingCartForm[UserAccountID], skip int64, limit int64, order scommerce.QueueOrder) ([]scommerce.DBUserUserShoppingCartResult[UserAccountID], []*scommerce.UserShoppingCartForm[UserAccountID], error) {
+	ids := carts
+	if ids == nil {
+		ids = make([]scommerce.DBUserUserShoppingCartResult[UserAccountID], 0, 10)
+	}
+	forms := cartForms
+	if forms == nil {
+		forms = make([]*scommerce.UserShoppingCartForm[UserAccountID], 0, cap(ids))
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				sc."id",
+				sc."user_id",
+				sc."session_text",
+				(
+					select
+						coalesce(sum(sci.quantity * pi.price), 0)
+					from shopping_cart_items sci
+					join product_items pi on sci."product_item_id" = pi."id"
+					where sci."cart_id" = sc."id"
+				) as "dept",
+				(
+					select count(*)
+					from shopping_cart_items sci
+					where sci."cart_id" = sc."id"
+				) as "item_count"
+			from shopping_carts sc
+			where sc."user_id" is not null
+			  and sc."last_activity_at" < $1
+			  and exists (select 1 from shopping_cart_items sci where sci."cart_id" = sc."id")
+			order by sc."last_activity_at" `+order.String()+`
+			offset $2
+			limit $3
+		`,
+		inactiveSince,
+		skip,
+		limit,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		var userID UserAccountID
+		var sessionText pgtype.Text
+		var dept int64
+		var itemCount uint64
+		if err := rows.Scan(&id, &userID, &sessionText, &dept, &itemCount); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, scommerce.DBUserUserShoppingCartResult[UserAccountID]{
+			ID:  id,
+			AID: userID,
+		})
+		form := &scommerce.UserShoppingCartForm[UserAccountID]{
+			ID:                    id,
+			UserAccountID:         userID,
+			ShoppingCartItemCount: &itemCount,
+			Dept:                  db.moneyPtr(dept),
+		}
+		if sessionText.Valid {
+			form.SessionText = &sessionText.String
+		}
+		forms = append(forms, form)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return ids, forms, nil
+}
+
+func (db *PostgreDatabase) GetAbandonedShoppingCartCount(ctx context.Context, inactiveSince time.Time) (uint64, error) {
+	var count uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`
+			select count(*)
+			from shopping_carts sc
+			where sc."user_id" is not null
+			  and sc."last_activity_at" < $1
+			  and exists (select 1 from shopping_cart_items sci where sci."cart_id" = sc."id")
+		`,
+		inactiveSince,
+	).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (db *PostgreDatabase) RemoveInactiveShoppingCarts(ctx context.Context, inactiveSince time.Time) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`delete from shopping_carts where "last_activity_at" < $1`,
+		inactiveSince,
+	)
+	return err
+}
+
 func (db *PostgreDatabase) GetShoppingCartBySessionText(ctx context.Context, sessionText string, cartForm *scommerce.UserShoppingCartForm[UserAccountID]) (uint64, error) {
 	var id uint64
 	var userID UserAccountID
-	var dept float64
+	var dept int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`
 			select
 				sc."id",
-				sc."user_id",
+				coalesce(sc."user_id", 0),
 				coalesce((
 					select
 						sum(sci.quantity * pi.price)
@@ -353,7 +910,29 @@ func (db *PostgreDatabase) GetShoppingCartBySessionText(ctx context.Context, ses
 		cartForm.ID = id
 		cartForm.UserAccountID = userID
 		cartForm.SessionText = &sessionText
-		cartForm.Dept = &dept
+		cartForm.Dept = db.moneyPtr(dept)
+	}
+	return id, nil
+}
+
+func (db *PostgreDatabase) NewGuestShoppingCart(ctx context.Context, sessionText string, cartForm *scommerce.UserShoppingCartForm[UserAccountID]) (uint64, error) {
+	var id uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`
+			insert into
+				shopping_carts("session_text")
+				values($1)
+				returning "id"
+		`,
+		sessionText,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if cartForm != nil {
+		cartForm.ID = id
+		cartForm.SessionText = &sessionText
 	}
 	return id, nil
 }
@@ -385,7 +964,7 @@ func (db *PostgreDatabase) GetShoppingCarts(ctx context.Context, carts []scommer
 		`
 			select
 				sc."id",
-				sc."user_id",
+				coalesce(sc."user_id", 0),
 				sc."session_text",
 				coalesce((
 					select
@@ -411,7 +990,7 @@ func (db *PostgreDatabase) GetShoppingCarts(ctx context.Context, carts []scommer
 		var id uint64
 		var userID UserAccountID
 		var sessionText pgtype.Text
-		var dept float64
+		var dept int64
 		if err := rows.Scan(&id, &userID, &sessionText, &dept); err != nil {
 			return nil, nil, err
 		}
@@ -423,7 +1002,7 @@ func (db *PostgreDatabase) GetShoppingCarts(ctx context.Context, carts []scommer
 			ID:            id,
 			UserAccountID: userID,
 			SessionText:   nil,
-			Dept:          &dept,
+			Dept:          db.moneyPtr(dept),
 		}
 		if sessionText.Valid {
 			form.SessionText = &sessionText.String
@@ -453,49 +1032,306 @@ func (db *PostgreDatabase) InitUserShoppingCartManager(ctx context.Context) erro
 				cart_id         bigint not null references shopping_carts(id) on delete cascade,
 				product_item_id bigint not null references product_items(id),
 				quantity        bigint not null,
-				attributes      jsonb,
+				attributes      jsonb
+			);
+
+			-- lines of removed product items stay in the cart until it's validated
+			alter table shopping_cart_items alter column product_item_id drop not null;
+			alter table shopping_cart_items drop constraint if exists shopping_cart_items_product_item_id_fkey;
+			alter table shopping_cart_items add constraint shopping_cart_items_product_item_id_fkey
+				foreign key (product_item_id) references product_items(id) on delete set null;
+
+			-- price of the product item when it was added, to tell the user about price changes
+			alter table shopping_cart_items add column if not exists unit_price numeric(20, 0);
+
+			alter table shopping_carts add column if not exists last_activity_at timestamptz not null default now();
+
+			create index if not exists shopping_carts_last_activity_idx on shopping_carts(last_activity_at);
+
+			-- changing the items of a cart is activity on the cart
+			create or replace function touch_shopping_cart() returns trigger as $$
+			begin
+				update shopping_carts
+				set last_activity_at = now()
+				where id = case when tg_op = 'DELETE' then old.cart_id else new.cart_id end;
+				return null;
+			end;
+			$$ language plpgsql;
+
+			drop trigger if exists shopping_cart_items_touch on shopping_cart_items;
+			create trigger shopping_cart_items_touch
+				after insert or update or delete on shopping_cart_items
+				for each row execute function touch_shopping_cart();
+
+			-- a product item can be in a cart several times with different attributes
+			alter table shopping_cart_items drop constraint if exists shopping_cart_items_cart_id_product_item_id_key;
+			create unique index if not exists shopping_cart_items_line_idx on shopping_cart_items(cart_id, product_item_id, coalesce(attributes, 'null'::jsonb));
+
+			create table if not exists stock_reservations(
+				id              bigint generated by default as identity primary key,
+				cart_id         bigint not null references shopping_carts(id) on delete cascade,
+				product_item_id bigint not null references product_items(id) on delete cascade,
+				quantity        bigint not null,
+				expires_at      timestamptz not null,
 				unique (cart_id, product_item_id)
 			);
 
+			create index if not exists stock_reservations_product_item_idx on stock_reservations(product_item_id, expires_at);
+
+			create or replace function reserve_shopping_cart_stock(
+				cart_id_arg    bigint,
+				expires_at_arg timestamptz
+			) returns void as $$
+			declare
+				v_insufficient_stock jsonb;
+			begin
+				if not exists (select 1 from shopping_carts sc where sc.id = cart_id_arg) then
+					raise exception 'Shopping cart not found';
+				end if;
+
+				perform 1
+				from product_items pi
+				where pi.id in (
+					select sci.product_item_id
+					from shopping_cart_items sci
+					where sci.cart_id = cart_id_arg
+				)
+				order by pi.id
+				for update;
+
+				-- Stock held by other carts is not available to this one
+				select jsonb_agg(
+					jsonb_build_object(
+						'product_item_id', pi.id,
+						'requested', sci.quantity,
+						'available', pi.quantity_in_stock - coalesce(r.reserved, 0)
+					)
+					order by pi.id
+				)
+				into v_insufficient_stock
+				from (
+					select product_item_id, sum(quantity) as quantity
+					from shopping_cart_items
+					where cart_id = cart_id_arg
+					group by product_item_id
+				) sci
+				join product_items pi on sci.product_item_id = pi.id
+				left join lateral (
+					select sum(sr.quantity) as reserved
+					from stock_reservations sr
+					where sr.product_item_id = pi.id
+					  and sr.cart_id <> cart_id_arg
+					  and sr.expires_at > now()
+				) r on true
+				where sci.quantity > pi.quantity_in_stock - coalesce(r.reserved, 0);
+
+				if v_insufficient_stock is not null then
+					raise exception 'Insufficient stock'
+						using errcode = 'SC001', detail = v_insufficient_stock::text;
+				end if;
+
+				delete from stock_reservations where cart_id = cart_id_arg;
+
+				insert into stock_reservations (
+					cart_id,
+					product_item_id,
+					quantity,
+					expires_at
+				)
+				select
+					sci.cart_id,
+					sci.product_item_id,
+					sum(sci.quantity),
+					expires_at_arg
+				from shopping_cart_items sci
+				where sci.cart_id = cart_id_arg
+				group by sci.cart_id, sci.product_item_id;
+			end;
+			$$ language plpgsql;
+
+			drop function if exists order_shopping_cart(bigint, bigint, bigint, bigint, bigint, text, text);
+			drop function if exists order_shopping_cart(bigint, bigint, bigint, bigint, bigint, text, text, double precision, double precision, jsonb);
+			drop function if exists order_shopping_cart(bigint, bigint, bigint, bigint, bigint, text, text, numeric, numeric, jsonb);
+			drop function if exists order_shopping_cart(bigint, bigint, bigint, bigint, bigint, text, text, numeric, numeric, jsonb, numeric);
+			drop function if exists order_shopping_cart(bigint, bigint, bigint, bigint, bigint, text, text, numeric, numeric, jsonb, numeric, numeric, jsonb);
+			drop function if exists order_shopping_cart(bigint, bigint, bigint, bigint, bigint, text, text, jsonb, numeric, jsonb, jsonb, numeric);
+
 			create or replace function order_shopping_cart(
 				cart_id_arg bigint,
 				payment_method_arg bigint,
 				address_arg bigint,
 				shipping_method_arg bigint,
-				idle_status_id_arg bigint,
+				status_id_arg bigint,
 				user_comment_arg text default null,
-				discount_code_arg text default null
+				discount_code_arg text default null,
+				tax_lines_arg jsonb default null,
+				shipping_cost_arg numeric default null,
+				promotion_lines_arg jsonb default null,
+				priced_items_arg jsonb default null,
+				priced_discount_arg numeric default 0
 			) returns table(
 				order_id bigint,
 				user_id_result bigint,
 				order_date_result date,
-				order_total_result double precision,
+				order_total_result numeric,
 				product_item_count bigint
 			) as $$
 			declare
 				v_user_id bigint;
 				v_order_id bigint;
 				v_factor_id bigint;
-				v_subtotal double precision;
-				v_discount_value double precision;
-				v_effective_discount double precision;
-				v_discounted_subtotal double precision;
-				v_shipping_cost double precision;
-				v_total double precision;
+				v_subtotal numeric;
+				v_effective_discount numeric;
+				v_shipping_discount numeric;
+				v_promotion numeric;
+				v_tax numeric;
+				v_tax_exclusive numeric;
+				v_pricing_valid boolean;
+				v_discount_reason text;
+				v_discounted_subtotal numeric;
+				v_shipping_cost numeric;
+				v_total numeric;
 				v_product_items jsonb;
+				v_lines jsonb;
+				v_invoice_year int;
+				v_invoice_sequence bigint;
 				v_count bigint;
-				v_wallet_balance double precision;
 				v_discount_id bigint;
+				v_insufficient_stock jsonb;
 			begin
-				-- Retrieve user ID from shopping cart
+				-- Retrieve user ID from shopping cart, the lock keeps items from being added until the order is stored
 				select sc.user_id into v_user_id
 				from shopping_carts sc
-				where sc.id = cart_id_arg;
+				where sc.id = cart_id_arg
+				for update;
 
 				if v_user_id is null then
 					raise exception 'Shopping cart not found';
 				end if;
 
+				if exists (
+					select 1
+					from shopping_cart_items sci
+					where sci.cart_id = cart_id_arg
+					  and sci.product_item_id is null
+				) then
+					raise exception 'Shopping cart has removed product items'
+						using errcode = 'SC002';
+				end if;
+
+				-- Lock product items of the cart so concurrent checkouts wait for each other
+				perform 1
+				from product_items pi
+				where pi.id in (
+					select sci.product_item_id
+					from shopping_cart_items sci
+					where sci.cart_id = cart_id_arg
+				)
+				order by pi.id
+				for update;
+
+				perform 1
+				from shopping_cart_items sci
+				where sci.cart_id = cart_id_arg
+				for update;
+
+				-- The caller priced the taxes and the promotions from the cart lines, they must still be the locked
+				-- lines and the lines of the taxes and the promotions must be non negative amounts of cart items
+				if coalesce(priced_items_arg, '[]'::jsonb) is distinct from (
+					select coalesce(jsonb_agg(
+						jsonb_build_object(
+							'product_item_id', sci.product_item_id,
+							'unit_price', pi.price,
+							'quantity', sci.quantity
+						)
+						order by sci.id
+					), '[]'::jsonb)
+					from shopping_cart_items sci
+					join product_items pi on sci.product_item_id = pi.id
+					where sci.cart_id = cart_id_arg
+				) then
+					raise exception 'Shopping cart changed'
+						using errcode = 'SC004', detail = 'cart lines';
+				end if;
+
+				select
+					coalesce(sum((tl->'amount'->>'amount')::numeric), 0),
+					coalesce(sum((tl->'amount'->>'amount')::numeric) filter (where not coalesce((tl->>'inclusive')::boolean, false)), 0),
+					coalesce(bool_and(
+						(tl->'amount'->>'amount')::numeric >= 0
+						and exists (
+							select 1 from shopping_cart_items sci
+							where sci.cart_id = cart_id_arg and sci.product_item_id = (tl->>'product_item_id')::bigint
+						)
+					), true)
+				into v_tax, v_tax_exclusive, v_pricing_valid
+				from jsonb_array_elements(coalesce(tax_lines_arg, '[]'::jsonb)) tl;
+
+				if not v_pricing_valid then
+					raise exception 'Shopping cart changed'
+						using errcode = 'SC004', detail = 'tax lines';
+				end if;
+
+				select
+					coalesce(sum((pl->'amount'->>'amount')::numeric), 0),
+					coalesce(bool_and(
+						(pl->'amount'->>'amount')::numeric >= 0
+						-- a promotion takes off at most what the units of its product items are worth
+						and (pl->'amount'->>'amount')::numeric <= (
+							select coalesce(sum(sci.quantity * pi.price), 0)
+							from shopping_cart_items sci
+							join product_items pi on sci.product_item_id = pi.id
+							where sci.cart_id = cart_id_arg and sci.product_item_id in (
+								select piid::bigint from jsonb_array_elements_text(coalesce(pl->'product_item_ids', '[]'::jsonb)) piid
+							)
+						)
+						and not exists (
+							select 1 from jsonb_array_elements_text(coalesce(pl->'product_item_ids', '[]'::jsonb)) piid
+							where not exists (
+								select 1 from shopping_cart_items sci
+								where sci.cart_id = cart_id_arg and sci.product_item_id = piid::bigint
+							)
+						)
+					), true)
+				into v_promotion, v_pricing_valid
+				from jsonb_array_elements(coalesce(promotion_lines_arg, '[]'::jsonb)) pl;
+
+				if not v_pricing_valid then
+					raise exception 'Shopping cart changed'
+						using errcode = 'SC004', detail = 'promotion lines';
+				end if;
+
+				-- Reject the order if any item requests more than is in stock and not reserved by other carts
+				select jsonb_agg(
+					jsonb_build_object(
+						'product_item_id', pi.id,
+						'requested', sci.quantity,
+						'available', pi.quantity_in_stock - coalesce(r.reserved, 0)
+					)
+					order by pi.id
+				)
+				into v_insufficient_stock
+				from (
+					select product_item_id, sum(quantity) as quantity
+					from shopping_cart_items
+					where cart_id = cart_id_arg
+					group by product_item_id
+				) sci
+				join product_items pi on sci.product_item_id = pi.id
+				left join lateral (
+					select sum(sr.quantity) as reserved
+					from stock_reservations sr
+					where sr.product_item_id = pi.id
+					  and sr.cart_id <> cart_id_arg
+					  and sr.expires_at > now()
+				) r on true
+				where sci.quantity > pi.quantity_in_stock - coalesce(r.reserved, 0);
+
+				if v_insufficient_stock is not null then
+					raise exception 'Insufficient stock'
+						using errcode = 'SC001', detail = v_insufficient_stock::text;
+				end if;
+
 				-- Aggregate product items with full details
 				select jsonb_agg(
 					jsonb_build_object(
@@ -518,35 +1354,32 @@ func (db *PostgreDatabase) InitUserShoppingCartManager(ctx context.Context) erro
 				join product_items pi on sci.product_item_id = pi.id
 				where sci.cart_id = cart_id_arg;
 
-				-- Get shipping cost
-				select coalesce(sm.price, 0)
+				-- Get shipping cost, a calculated rate replaces the price of the shipping method
+				select coalesce(shipping_cost_arg, sm.price, 0)
 				into v_shipping_cost
 				from shipping_methods sm
 				where sm.id = shipping_method_arg;
+				v_shipping_cost := coalesce(v_shipping_cost, shipping_cost_arg, 0);
 
 				-- Initialize discount values
-				v_discount_value := 0;
 				v_effective_discount := 0;
+				v_shipping_discount := 0;
 				v_discount_id := null;
 
 				-- Process discount if provided
 				if discount_code_arg is not null and discount_code_arg != '' then
-					-- Validate discount code exists and get discount value
-					select d.id, d.value
-					into v_discount_id, v_discount_value
-					from discounts d
-					where d.code = discount_code_arg
-					  and d.valid_count > 0
-					  and not (v_user_id = any(d.used_by))
-					limit 1;
-
-					if v_discount_id is null then
-						raise exception 'Invalid discount code or discount already used';
+					-- Lock the discount so concurrent checkouts can't redeem its last use twice
+					perform 1 from discounts d where d.code = discount_code_arg for update;
+
+					select a.discount_id_result, a.reason_result, a.discount_result, a.shipping_discount_result
+					into v_discount_id, v_discount_reason, v_effective_discount, v_shipping_discount
+					from discount_applicability(discount_code_arg, cart_id_arg, shipping_method_arg, shipping_cost_arg) a;
+
+					if v_discount_reason is not null then
+						raise exception 'Discount code does not apply'
+							using errcode = 'SC003', detail = v_discount_reason;
 					end if;
 
-					-- Calculate effective discount (CRITICAL: use LEAST to prevent negative subtotals)
-					v_effective_discount := least(v_discount_value, v_subtotal);
-					
 					-- Mark discount as used
 					update discounts
 					set valid_count = valid_count - 1,
@@ -554,41 +1387,125 @@ func (db *PostgreDatabase) InitUserShoppingCartManager(ctx context.Context) erro
 					where id = v_discount_id;
 				end if;
 
-				-- Apply discount to subtotal (guaranteed to be >= 0)
-				v_discounted_subtotal := v_subtotal - v_effective_discount;
+				-- Promotions come first, the discount code can't take off more than they leave
+				v_promotion := least(v_promotion, v_subtotal);
+				v_effective_discount := least(v_effective_discount, v_subtotal - v_promotion);
 
-				-- Calculate final total
-				v_total := v_discounted_subtotal + v_shipping_cost;
+				-- The taxes were computed on the prices less the promotions and this discount
+				if v_effective_discount <> coalesce(priced_discount_arg, 0) then
+					raise exception 'Shopping cart changed'
+						using errcode = 'SC004', detail = 'discount';
+				end if;
 
-				-- Validate wallet balance
-				select wallet into v_wallet_balance
-				from users
-				where id = v_user_id;
+				-- Apply discounts to subtotal (guaranteed to be >= 0)
+				v_discounted_subtotal := v_subtotal - v_promotion - v_effective_discount;
 
-				if v_wallet_balance < v_total then
-					raise exception 'Insufficient funds: wallet balance is %, required amount is %', v_wallet_balance, v_total;
-				end if;
+				-- Calculate final total, inclusive taxes are already part of the prices
+				v_total := v_discounted_subtotal + v_shipping_cost - v_shipping_discount + v_tax_exclusive;
+
+				-- Invoice lines, the promotions and the discount code are spread over the lines in proportion
+				-- to their subtotals and the taxes of a product item over its lines in proportion to their
+				-- quantities, rounding down the running total so the shares add up exactly
+				with cart_lines as (
+					select
+						sci.id,
+						sci.product_item_id,
+						coalesce(pi.sku, '') as sku,
+						pi.name,
+						pi.price,
+						sci.quantity,
+						coalesce(sci.attributes, 'null'::jsonb) as attributes,
+						sci.quantity * pi.price as subtotal,
+						sum(sci.quantity * pi.price) over (order by sci.id) as running_subtotal,
+						sum(sci.quantity) over (partition by sci.product_item_id order by sci.id) as running_quantity,
+						sum(sci.quantity) over (partition by sci.product_item_id) as item_quantity
+					from shopping_cart_items sci
+					join product_items pi on sci.product_item_id = pi.id
+					where sci.cart_id = cart_id_arg
+				), item_taxes as (
+					select
+						(tl->>'product_item_id')::bigint as product_item_id,
+						sum((tl->'amount'->>'amount')::numeric) as tax,
+						coalesce(sum((tl->'amount'->>'amount')::numeric) filter (where not (tl->>'inclusive')::boolean), 0) as exclusive_tax
+					from jsonb_array_elements(coalesce(tax_lines_arg, '[]'::jsonb)) tl
+					group by 1
+				), shares as (
+					select
+						l.*,
+						case when v_subtotal > 0 then
+							floor((v_promotion + v_effective_discount) * l.running_subtotal / v_subtotal)
+							- floor((v_promotion + v_effective_discount) * (l.running_subtotal - l.subtotal) / v_subtotal)
+						else 0 end as line_discount,
+						floor(coalesce(t.tax, 0) * l.running_quantity / l.item_quantity)
+							- floor(coalesce(t.tax, 0) * (l.running_quantity - l.quantity) / l.item_quantity) as line_tax,
+						floor(coalesce(t.exclusive_tax, 0) * l.running_quantity / l.item_quantity)
+							- floor(coalesce(t.exclusive_tax, 0) * (l.running_quantity - l.quantity) / l.item_quantity) as line_exclusive_tax
+					from cart_lines l
+					left join item_taxes t on t.product_item_id = l.product_item_id
+				)
+				select coalesce(jsonb_agg(
+					jsonb_build_object(
+						'product_item_id', s.product_item_id,
+						'sku', s.sku,
+						'name', s.name,
+						'unit_price', s.price,
+						'quantity', s.quantity,
+						'attributes', s.attributes,
+						'discount', s.line_discount,
+						'tax', s.line_tax,
+						'total', s.subtotal - s.line_discount + s.line_exclusive_tax
+					)
+					order by s.id
+				), '[]'::jsonb)
+				into v_lines
+				from shares s;
+
+				-- Take the next invoice number of the year, the row lock makes concurrent checkouts wait
+				-- and a rolled back checkout gives its number back
+				insert into factor_invoice_numbers as n (year, last_number)
+				values (extract(year from now())::int, 1)
+				on conflict (year) do update set last_number = n.last_number + 1
+				returning n.year, n.last_number into v_invoice_year, v_invoice_sequence;
 
 				-- Create factor record with effective discount
 				insert into factors (
 					user_id,
 					products,
+					lines,
 					discount,
 					tax,
-					amount_paid
+					tax_lines,
+					amount_paid,
+					issued_at,
+					invoice_year,
+					invoice_sequence
 				) values (
 					v_user_id,
-					v_product_items,
-					v_effective_discount,
-					0,
-					v_total
+					v_product_items || coalesce(promotion_lines_arg, '[]'::jsonb),
+					v_lines,
+					v_promotion + v_effective_discount + v_shipping_discount,
+					v_tax,
+					coalesce(tax_lines_arg, '[]'::jsonb),
+					v_total,
+					now(),
+					v_invoice_year,
+					v_invoice_sequence
 				)
 				returning id into v_factor_id;
 
-				-- Deduct amount from user wallet
-				update users
-				set wallet = wallet - v_total
-				where id = v_user_id;
+				-- Decrement stock of ordered product items
+				update product_items pi
+				set quantity_in_stock = pi.quantity_in_stock - sci.quantity
+				from (
+					select product_item_id, sum(quantity) as quantity
+					from shopping_cart_items
+					where cart_id = cart_id_arg
+					group by product_item_id
+				) sci
+				where sci.product_item_id = pi.id;
+
+				-- The reservation of this cart is now a real decrement
+				delete from stock_reservations where cart_id = cart_id_arg;
 
 				-- Create order record
 				insert into orders (
@@ -600,7 +1517,9 @@ func (db *PostgreDatabase) InitUserShoppingCartManager(ctx context.Context) erro
 					order_total,
 					order_status_id,
 					product_items,
-					user_comment
+					user_comment,
+					discount_id,
+					promotions
 				) values (
 					v_user_id,
 					current_date,
@@ -608,12 +1527,22 @@ func (db *PostgreDatabase) InitUserShoppingCartManager(ctx context.Context) erro
 					address_arg,
 					shipping_method_arg,
 					v_total,
-					idle_status_id_arg,
+					status_id_arg,
 					v_product_items,
-					user_comment_arg
+					user_comment_arg,
+					v_discount_id,
+					coalesce(promotion_lines_arg, '[]'::jsonb)
 				)
 				returning id into v_order_id;
 
+				insert into order_status_history (order_id, to_status_id, to_status)
+				select v_order_id, os.id, os.status
+				from order_statuses os
+				where os.id = status_id_arg;
+
+				-- The payments of the order are the payments of its factor
+				update factors set order_id = v_order_id where id = v_factor_id;
+
 				-- Delete shopping cart
 				delete from shopping_carts where "id" = cart_id_arg;
 
@@ -652,7 +1581,7 @@ func (db *PostgreDatabase) FillUserShoppingCartWithID(ctx context.Context, cid u
 		ctx,
 		`
 			select
-				"user_id",
+				coalesce("user_id", 0),
 				"session_text"
 			from shopping_carts
 			where "id" = $1
@@ -694,7 +1623,7 @@ func (db *PostgreDatabase) FillUserShoppingCartItemWithID(ctx context.Context, i
 		`
 			select
 				"cart_id",
-				"product_item_id",
+				coalesce("product_item_id", 0),
 				"quantity",
 				coalesce("attributes", 'null'::jsonb)
 			from shopping_cart_items
@@ -716,7 +1645,7 @@ func (db *PostgreDatabase) FillUserShoppingCartItemWithID(ctx context.Context, i
 	var userID UserAccountID
 	err = db.PgxPool.QueryRow(
 		ctx,
-		`select "user_id" from shopping_carts where "id" = $1 limit 1`,
+		`select coalesce("user_id", 0) from shopping_carts where "id" = $1 limit 1`,
 		cartID,
 	).Scan(&userID)
 	if err != nil {
@@ -26,8 +26,8 @@ func (db *PostgreDatabase) AddUserShoppingCartItemQuantity(ctx context.Context,
 	return nil
 }
 
-func (db *PostgreDatabase) CalculateUserShoppingCartItemDept(ctx context.Context, form *scommerce.UserShoppingCartItemForm[UserAccountID], itid uint64) (float64, error) {
-	var dept float64
+func (db *PostgreDatabase) CalculateUserShoppingCartItemDept(ctx context.Context, form *scommerce.UserShoppingCartItemForm[UserAccountID], itid uint64) (scommerce.Money, error) {
+	var dept int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`
@@ -46,19 +46,19 @@ func (db *PostgreDatabase) CalculateUserShoppingCartItemDept(ctx context.Context
 		itid,
 	).Scan(&dept)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.Dept = &dept
+		form.Dept = db.moneyPtr(dept)
 	}
-	return dept, nil
+	return db.money(dept), nil
 }
 
 func (db *PostgreDatabase) GetUserShoppingCartItemProductItem(ctx context.Context, form *scommerce.UserShoppingCartItemForm[UserAccountID], itid uint64, pItemForm *scommerce.ProductItemForm[UserAccountID], fs scommerce.FileStorage) (uint64, error) {
 	var id uint64
 	err := db.PgxPool.QueryRow(
 		ctx,
-		`select "product_item_id" from shopping_cart_items where "id" = $1 limit 1`,
+		`select coalesce("product_item_id", 0) from shopping_cart_items where "id" = $1 limit 1`,
 		itid,
 	).Scan(&id)
 	if err != nil {
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/MobinYengejehi/scommerce/scommerce"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 var _ scommerce.DBUserDiscountManager[UserAccountID] = &PostgreDatabase{}
@@ -19,7 +22,7 @@ func (db *PostgreDatabase) InitUserDiscountManager(ctx context.Context) error {
 				id bigint generated by default as identity primary key,
 				user_id bigint not null references users(id),
 				code text unique not null,
-				value double precision not null check (value >= 0),
+				value numeric(20, 0) not null check (value >= 0),
 				valid_count bigint not null check (valid_count >= 0),
 				used_by jsonb default '[]'::jsonb
 			);
@@ -27,28 +30,188 @@ func (db *PostgreDatabase) InitUserDiscountManager(ctx context.Context) error {
 			create index if not exists idx_discounts_user_id on discounts(user_id);
 			create index if not exists idx_discounts_code on discounts(code);
 			create index if not exists idx_discounts_valid_count on discounts(valid_count);
+
+			alter table discounts add column if not exists discount_type text not null default 'fixed'
+				check (discount_type in ('fixed', 'percentage', 'free_shipping'));
+			alter table discounts add column if not exists percentage numeric(7, 4) not null default 0
+				check (percentage >= 0 and percentage <= 100);
+			alter table discounts add column if not exists max_value numeric(20, 0) not null default 0 check (max_value >= 0);
+			alter table discounts add column if not exists min_order_amount numeric(20, 0) not null default 0 check (min_order_amount >= 0);
+			alter table discounts add column if not exists starts_at timestamptz;
+			alter table discounts add column if not exists ends_at timestamptz;
+			alter table discounts add column if not exists product_ids jsonb not null default '[]'::jsonb;
+			alter table discounts add column if not exists category_ids jsonb not null default '[]'::jsonb;
+			alter table discounts add column if not exists shipping_method_ids jsonb not null default '[]'::jsonb;
+
+			-- A campaign keeps the rules its codes were generated with
+			create table if not exists discount_campaigns(
+				id bigint generated by default as identity primary key,
+				user_id bigint not null references users(id),
+				name text unique not null,
+				code_prefix text not null default '',
+				value numeric(20, 0) not null default 0 check (value >= 0),
+				valid_count bigint not null check (valid_count >= 0),
+				discount_type text not null default 'fixed'
+					check (discount_type in ('fixed', 'percentage', 'free_shipping')),
+				percentage numeric(7, 4) not null default 0 check (percentage >= 0 and percentage <= 100),
+				max_value numeric(20, 0) not null default 0 check (max_value >= 0),
+				min_order_amount numeric(20, 0) not null default 0 check (min_order_amount >= 0),
+				starts_at timestamptz,
+				ends_at timestamptz,
+				product_ids jsonb not null default '[]'::jsonb,
+				category_ids jsonb not null default '[]'::jsonb,
+				shipping_method_ids jsonb not null default '[]'::jsonb,
+				created_at timestamptz not null default now()
+			);
+
+			alter table discounts add column if not exists campaign_id bigint references discount_campaigns(id) on delete cascade;
+			create index if not exists idx_discounts_campaign_id on discounts(campaign_id);
+
+			-- discount_applicability checks a discount code against a shopping cart, reason_result is null when it applies.
+			-- order_shopping_cart redeems codes with it and PreviewUserDiscount shows it, so both agree.
+			create or replace function discount_applicability(
+				code_arg text,
+				cart_id_arg bigint,
+				shipping_method_arg bigint,
+				shipping_cost_arg numeric default null
+			) returns table(
+				discount_id_result bigint,
+				discount_type_result text,
+				reason_result text,
+				subtotal_result numeric,
+				eligible_subtotal_result numeric,
+				min_order_amount_result numeric,
+				discount_result numeric,
+				shipping_discount_result numeric
+			) as $$
+			declare
+				d discounts%rowtype;
+				v_user_id bigint;
+				v_subtotal numeric;
+				v_eligible_subtotal numeric;
+				v_eligible_count bigint;
+				v_shipping_cost numeric;
+				v_reason text;
+				v_discount numeric := 0;
+				v_shipping_discount numeric := 0;
+			begin
+				select * into d from discounts where discounts.code = code_arg;
+				if not found then
+					return query select null::bigint, null::text, 'not_found'::text, 0::numeric, 0::numeric, 0::numeric, 0::numeric, 0::numeric;
+					return;
+				end if;
+
+				select sc.user_id into v_user_id
+				from shopping_carts sc
+				where sc.id = cart_id_arg;
+
+				-- A line is eligible when its product and one of its categories or their parents are in the scope
+				select
+					coalesce(sum(lines.amount), 0),
+					coalesce(sum(lines.amount) filter (where lines.eligible), 0),
+					count(*) filter (where lines.eligible)
+				into v_subtotal, v_eligible_subtotal, v_eligible_count
+				from (
+					select
+						sci.quantity * pi.price as amount,
+						(d.product_ids = '[]'::jsonb or d.product_ids @> to_jsonb(p.id))
+						and (d.category_ids = '[]'::jsonb or exists(
+							with recursive chain(id, parent_category_id) as (
+								select pc.id, pc.parent_category_id
+								from product_categories pc
+								where pc.id = p.category_id
+								union all
+								select pc.id, pc.parent_category_id
+								from product_categories pc
+								join chain on pc.id = chain.parent_category_id
+							)
+							select 1 from chain where d.category_ids @> to_jsonb(chain.id)
+						)) as eligible
+					from shopping_cart_items sci
+					join product_items pi on pi.id = sci.product_item_id
+					left join products p on p.id = pi.product_id
+					where sci.cart_id = cart_id_arg
+				) lines;
+
+				if d.valid_count <= 0 then
+					v_reason := 'exhausted';
+				elsif v_user_id is not null and d.used_by @> jsonb_build_array(v_user_id) then
+					v_reason := 'already_used';
+				elsif d.starts_at is not null and d.starts_at > now() then
+					v_reason := 'not_started';
+				elsif d.ends_at is not null and d.ends_at <= now() then
+					v_reason := 'expired';
+				elsif v_subtotal < d.min_order_amount then
+					v_reason := 'below_min_order_amount';
+				elsif (d.product_ids <> '[]'::jsonb or d.category_ids <> '[]'::jsonb) and v_eligible_count = 0 then
+					v_reason := 'no_eligible_items';
+				elsif d.shipping_method_ids <> '[]'::jsonb
+				  and not coalesce(d.shipping_method_ids @> to_jsonb(shipping_method_arg), false) then
+					v_reason := 'shipping_method_not_eligible';
+				end if;
+
+				if v_reason is null then
+					if d.discount_type = 'percentage' then
+						v_discount := round(v_eligible_subtotal * d.percentage / 100);
+					elsif d.discount_type = 'free_shipping' then
+						select coalesce(shipping_cost_arg, sm.price, 0)
+						into v_shipping_cost
+						from shipping_methods sm
+						where sm.id = shipping_method_arg;
+						v_shipping_discount := coalesce(v_shipping_cost, shipping_cost_arg, 0);
+					else
+						v_discount := d.value;
+					end if;
+
+					-- Never take off more than the eligible items cost
+					v_discount := least(v_discount, v_eligible_subtotal);
+					if d.max_value > 0 then
+						v_discount := least(v_discount, d.max_value);
+						v_shipping_discount := least(v_shipping_discount, d.max_value);
+					end if;
+				end if;
+
+				return query select
+					d.id,
+					d.discount_type,
+					v_reason,
+					v_subtotal,
+					v_eligible_subtotal,
+					d.min_order_amount,
+					v_discount,
+					v_shipping_discount;
+			end;
+			$$ language plpgsql;
 		`,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return db.migrateMoneyColumns(ctx, "discounts", []string{"value"})
 }
 
-func (db *PostgreDatabase) NewUserDiscount(ctx context.Context, ownerAccountID UserAccountID, value float64, validCount int64, discountForm *scommerce.UserDiscountForm[UserAccountID]) (uint64, error) {
+func (db *PostgreDatabase) NewUserDiscount(ctx context.Context, ownerAccountID UserAccountID, value scommerce.Money, validCount int64, discountForm *scommerce.UserDiscountForm[UserAccountID]) (uint64, error) {
+	valueUnits, err := db.minorUnits(value)
+	if err != nil {
+		return 0, err
+	}
 	var id uint64
 	var code string
 	var usedByJSON []byte
+	var rules userDiscountRules
 
-	err := db.PgxPool.QueryRow(
+	err = db.PgxPool.QueryRow(
 		ctx,
 		`
 			insert into discounts(user_id, code, value, valid_count, used_by)
 			values($1, $2, $3, $4, '[]'::jsonb)
-			returning id, code, used_by
+			returning id, code, used_by, `+userDiscountRuleColumns+`
 		`,
 		ownerAccountID,
 		*discountForm.Code,
-		value,
+		valueUnits,
 		validCount,
-	).Scan(&id, &code, &usedByJSON)
+	).Scan(append([]any{&id, &code, &usedByJSON}, rules.scanDest()...)...)
 
 	if err != nil {
 		return 0, err
@@ -58,12 +221,13 @@ func (db *PostgreDatabase) NewUserDiscount(ctx context.Context, ownerAccountID U
 		discountForm.ID = id
 		discountForm.UserAccountID = ownerAccountID
 		discountForm.Code = &code
-		discountForm.Value = &value
+		discountForm.Value = db.moneyPtr(valueUnits)
 		discountForm.ValidCount = &validCount
 		var usedBy []UserAccountID
 		if err := json.Unmarshal(usedByJSON, &usedBy); err == nil {
 			discountForm.UsedBy = &usedBy
 		}
+		db.applyUserDiscountRules(&rules, discountForm)
 	}
 
 	return id, nil
@@ -117,7 +281,8 @@ func (db *PostgreDatabase) GetUserDiscounts(ctx context.Context, ids []scommerce
 				code,
 				value,
 				valid_count,
-				used_by
+				used_by,
+				`+userDiscountRuleColumns+`
 			from discounts
 			order by id `+queueOrder.String()+`
 			offset $1
@@ -135,11 +300,12 @@ func (db *PostgreDatabase) GetUserDiscounts(ctx context.Context, ids []scommerce
 		var id uint64
 		var userID UserAccountID
 		var code string
-		var value float64
+		var value int64
 		var validCount int64
 		var usedByJSON []byte
+		var rules userDiscountRules
 
-		if err := rows.Scan(&id, &userID, &code, &value, &validCount, &usedByJSON); err != nil {
+		if err := rows.Scan(append([]any{&id, &userID, &code, &value, &validCount, &usedByJSON}, rules.scanDest()...)...); err != nil {
 			return nil, nil, err
 		}
 
@@ -152,14 +318,16 @@ func (db *PostgreDatabase) GetUserDiscounts(ctx context.Context, ids []scommerce
 			ID:  id,
 			AID: userID,
 		})
-		forms = append(forms, &scommerce.UserDiscountForm[UserAccountID]{
+		discountForm := &scommerce.UserDiscountForm[UserAccountID]{
 			ID:            id,
 			UserAccountID: userID,
 			Code:          &code,
-			Value:         &value,
+			Value:         db.moneyPtr(value),
 			ValidCount:    &validCount,
 			UsedBy:        &usedBy,
-		})
+		}
+		db.applyUserDiscountRules(&rules, discountForm)
+		forms = append(forms, discountForm)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -173,9 +341,10 @@ func (db *PostgreDatabase) GetUserDiscountByCode(ctx context.Context, code strin
 	var id uint64
 	var userID UserAccountID
 	var codeStr string
-	var value float64
+	var value int64
 	var validCount int64
 	var usedByJSON []byte
+	var rules userDiscountRules
 
 	err := db.PgxPool.QueryRow(
 		ctx,
@@ -186,13 +355,14 @@ func (db *PostgreDatabase) GetUserDiscountByCode(ctx context.Context, code strin
 				code,
 				value,
 				valid_count,
-				used_by
+				used_by,
+				`+userDiscountRuleColumns+`
 			from discounts
 			where code = $1
 			limit 1
 		`,
 		code,
-	).Scan(&id, &userID, &codeStr, &value, &validCount, &usedByJSON)
+	).Scan(append([]any{&id, &userID, &codeStr, &value, &validCount, &usedByJSON}, rules.scanDest()...)...)
 
 	if err != nil {
 		return scommerce.DBUserDiscountResult[UserAccountID]{}, err
@@ -206,8 +376,9 @@ func (db *PostgreDatabase) GetUserDiscountByCode(ctx context.Context, code strin
 		discountForm.ID = id
 		discountForm.UserAccountID = userID
 		discountForm.Code = &codeStr
-		discountForm.Value = &value
+		discountForm.Value = db.moneyPtr(value)
 		discountForm.ValidCount = &validCount
+		db.applyUserDiscountRules(&rules, discountForm)
 	}
 
 	return scommerce.DBUserDiscountResult[UserAccountID]{
@@ -248,7 +419,8 @@ func (db *PostgreDatabase) GetUserDiscountsForAccount(ctx context.Context, owner
 				code,
 				value,
 				valid_count,
-				used_by
+				used_by,
+				`+userDiscountRuleColumns+`
 			from discounts
 			where user_id = $1
 			order by id `+queueOrder.String()+`
@@ -268,11 +440,12 @@ func (db *PostgreDatabase) GetUserDiscountsForAccount(ctx context.Context, owner
 		var id uint64
 		var userID UserAccountID
 		var code string
-		var value float64
+		var value int64
 		var validCount int64
 		var usedByJSON []byte
+		var rules userDiscountRules
 
-		if err := rows.Scan(&id, &userID, &code, &value, &validCount, &usedByJSON); err != nil {
+		if err := rows.Scan(append([]any{&id, &userID, &code, &value, &validCount, &usedByJSON}, rules.scanDest()...)...); err != nil {
 			return nil, nil, err
 		}
 
@@ -282,14 +455,16 @@ func (db *PostgreDatabase) GetUserDiscountsForAccount(ctx context.Context, owner
 		}
 
 		dids = append(dids, id)
-		forms = append(forms, &scommerce.UserDiscountForm[UserAccountID]{
+		discountForm := &scommerce.UserDiscountForm[UserAccountID]{
 			ID:            id,
 			UserAccountID: userID,
 			Code:          &code,
-			Value:         &value,
+			Value:         db.moneyPtr(value),
 			ValidCount:    &validCount,
 			UsedBy:        &usedBy,
-		})
+		}
+		db.applyUserDiscountRules(&rules, discountForm)
+		forms = append(forms, discountForm)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -331,34 +506,38 @@ func (db *PostgreDatabase) SetUserDiscountCode(ctx context.Context, form *scomme
 	return nil
 }
 
-func (db *PostgreDatabase) GetUserDiscountValue(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64) (float64, error) {
-	var value float64
+func (db *PostgreDatabase) GetUserDiscountValue(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64) (scommerce.Money, error) {
+	var value int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select value from discounts where id = $1`,
 		discountID,
 	).Scan(&value)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.Value = &value
+		form.Value = db.moneyPtr(value)
 	}
-	return value, nil
+	return db.money(value), nil
 }
 
-func (db *PostgreDatabase) SetUserDiscountValue(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64, value float64) error {
-	_, err := db.PgxPool.Exec(
+func (db *PostgreDatabase) SetUserDiscountValue(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64, value scommerce.Money) error {
+	valueUnits, err := db.minorUnits(value)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
 		ctx,
 		`update discounts set value = $1 where id = $2`,
-		value,
+		valueUnits,
 		discountID,
 	)
 	if err != nil {
 		return err
 	}
 	if form != nil {
-		form.Value = &value
+		form.Value = db.moneyPtr(valueUnits)
 	}
 	return nil
 }
@@ -491,9 +670,10 @@ func (db *PostgreDatabase) FillUserDiscountWithID(ctx context.Context, did uint6
 
 	var userID UserAccountID
 	var code string
-	var value float64
+	var value int64
 	var validCount int64
 	var usedByJSON []byte
+	var rules userDiscountRules
 
 	err := db.PgxPool.QueryRow(
 		ctx,
@@ -503,19 +683,14 @@ func (db *PostgreDatabase) FillUserDiscountWithID(ctx context.Context, did uint6
 				"code",
 				"value",
 				"valid_count",
-				"used_by"
+				"used_by",
+				`+userDiscountRuleColumns+`
 			from discounts
 			where "id" = $1
 			limit 1
 		`,
 		did,
-	).Scan(
-		&userID,
-		&code,
-		&value,
-		&validCount,
-		&usedByJSON,
-	)
+	).Scan(append([]any{&userID, &code, &value, &validCount, &usedByJSON}, rules.scanDest()...)...)
 	if err != nil {
 		return err
 	}
@@ -528,9 +703,379 @@ func (db *PostgreDatabase) FillUserDiscountWithID(ctx context.Context, did uint6
 	discountForm.ID = did
 	discountForm.UserAccountID = userID
 	discountForm.Code = &code
-	discountForm.Value = &value
+	discountForm.Value = db.moneyPtr(value)
 	discountForm.ValidCount = &validCount
 	discountForm.UsedBy = &usedBy
+	db.applyUserDiscountRules(&rules, discountForm)
 
 	return nil
 }
+
+const userDiscountRuleColumns = `
+	"discount_type",
+	"percentage",
+	"max_value",
+	"min_order_amount",
+	"starts_at",
+	"ends_at",
+	"product_ids",
+	"category_ids",
+	"shipping_method_ids"
+`
+
+type userDiscountRules struct {
+	discountType      string
+	percentage        float64
+	maxValue          int64
+	minOrderAmount    int64
+	startsAt          pgtype.Timestamptz
+	endsAt            pgtype.Timestamptz
+	productIDs        []uint64
+	categoryIDs       []uint64
+	shippingMethodIDs []uint64
+}
+
+func (rules *userDiscountRules) scanDest() []any {
+	return []any{
+		&rules.discountType,
+		&rules.percentage,
+		&rules.maxValue,
+		&rules.minOrderAmount,
+		&rules.startsAt,
+		&rules.endsAt,
+		&rules.productIDs,
+		&rules.categoryIDs,
+		&rules.shippingMethodIDs,
+	}
+}
+
+func (db *PostgreDatabase) applyUserDiscountRules(rules *userDiscountRules, form *scommerce.UserDiscountForm[UserAccountID]) {
+	discountType := scommerce.UserDiscountType(rules.discountType)
+	percentage := rules.percentage
+	startsAt := rules.startsAt.Time
+	endsAt := rules.endsAt.Time
+	form.Type = &discountType
+	form.Percentage = &percentage
+	form.MaxValue = db.moneyPtr(rules.maxValue)
+	form.MinOrderAmount = db.moneyPtr(rules.minOrderAmount)
+	form.StartsAt = &startsAt
+	form.EndsAt = &endsAt
+	form.Scope = &scommerce.UserDiscountScope{
+		ProductIDs:        rules.productIDs,
+		CategoryIDs:       rules.categoryIDs,
+		ShippingMethodIDs: rules.shippingMethodIDs,
+	}
+}
+
+// discountIDs encodes a scope list, an empty list is stored as [] rather than null.
+func discountIDs(ids []uint64) ([]byte, error) {
+	if ids == nil {
+		ids = []uint64{}
+	}
+	return json.Marshal(ids)
+}
+
+func (db *PostgreDatabase) GetUserDiscountType(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64) (scommerce.UserDiscountType, error) {
+	var discountType string
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select discount_type from discounts where id = $1`,
+		discountID,
+	).Scan(&discountType)
+	if err != nil {
+		return "", err
+	}
+	value := scommerce.UserDiscountType(discountType)
+	if form != nil {
+		form.Type = &value
+	}
+	return value, nil
+}
+
+func (db *PostgreDatabase) SetUserDiscountType(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64, discountType scommerce.UserDiscountType) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`update discounts set discount_type = $1 where id = $2`,
+		string(discountType),
+		discountID,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.Type = &discountType
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) GetUserDiscountPercentage(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64) (float64, error) {
+	var percentage float64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select percentage from discounts where id = $1`,
+		discountID,
+	).Scan(&percentage)
+	if err != nil {
+		return 0, err
+	}
+	if form != nil {
+		form.Percentage = &percentage
+	}
+	return percentage, nil
+}
+
+func (db *PostgreDatabase) SetUserDiscountPercentage(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64, percentage float64) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`update discounts set percentage = $1 where id = $2`,
+		percentage,
+		discountID,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.Percentage = &percentage
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) GetUserDiscountMaxValue(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64) (scommerce.Money, error) {
+	var maxValue int64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select max_value from discounts where id = $1`,
+		discountID,
+	).Scan(&maxValue)
+	if err != nil {
+		return scommerce.Money{}, err
+	}
+	if form != nil {
+		form.MaxValue = db.moneyPtr(maxValue)
+	}
+	return db.money(maxValue), nil
+}
+
+func (db *PostgreDatabase) SetUserDiscountMaxValue(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64, maxValue scommerce.Money) error {
+	units, err := db.minorUnits(maxValue)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
+		ctx,
+		`update discounts set max_value = $1 where id = $2`,
+		units,
+		discountID,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.MaxValue = db.moneyPtr(units)
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) GetUserDiscountMinOrderAmount(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64) (scommerce.Money, error) {
+	var minOrderAmount int64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select min_order_amount from discounts where id = $1`,
+		discountID,
+	).Scan(&minOrderAmount)
+	if err != nil {
+		return scommerce.Money{}, err
+	}
+	if form != nil {
+		form.MinOrderAmount = db.moneyPtr(minOrderAmount)
+	}
+	return db.money(minOrderAmount), nil
+}
+
+func (db *PostgreDatabase) SetUserDiscountMinOrderAmount(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64, minOrderAmount scommerce.Money) error {
+	units, err := db.minorUnits(minOrderAmount)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
+		ctx,
+		`update discounts set min_order_amount = $1 where id = $2`,
+		units,
+		discountID,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.MinOrderAmount = db.moneyPtr(units)
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) GetUserDiscountStartsAt(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64) (time.Time, error) {
+	var startsAt pgtype.Timestamptz
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select starts_at from discounts where id = $1`,
+		discountID,
+	).Scan(&startsAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if form != nil {
+		form.StartsAt = &startsAt.Time
+	}
+	return startsAt.Time, nil
+}
+
+func (db *PostgreDatabase) SetUserDiscountStartsAt(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64, startsAt time.Time) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`update discounts set starts_at = $1 where id = $2`,
+		pgtype.Timestamptz{Time: startsAt, Valid: !startsAt.IsZero()},
+		discountID,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.StartsAt = &startsAt
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) GetUserDiscountEndsAt(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64) (time.Time, error) {
+	var endsAt pgtype.Timestamptz
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select ends_at from discounts where id = $1`,
+		discountID,
+	).Scan(&endsAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if form != nil {
+		form.EndsAt = &endsAt.Time
+	}
+	return endsAt.Time, nil
+}
+
+func (db *PostgreDatabase) SetUserDiscountEndsAt(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64, endsAt time.Time) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`update discounts set ends_at = $1 where id = $2`,
+		pgtype.Timestamptz{Time: endsAt, Valid: !endsAt.IsZero()},
+		discountID,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.EndsAt = &endsAt
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) GetUserDiscountScope(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64) (scommerce.UserDiscountScope, error) {
+	var scope scommerce.UserDiscountScope
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select product_ids, category_ids, shipping_method_ids from discounts where id = $1`,
+		discountID,
+	).Scan(&scope.ProductIDs, &scope.CategoryIDs, &scope.ShippingMethodIDs)
+	if err != nil {
+		return scommerce.UserDiscountScope{}, err
+	}
+	if form != nil {
+		form.Scope = &scope
+	}
+	return scope, nil
+}
+
+func (db *PostgreDatabase) SetUserDiscountScope(ctx context.Context, form *scommerce.UserDiscountForm[UserAccountID], discountID uint64, scope scommerce.UserDiscountScope) error {
+	productIDs, err := discountIDs(scope.ProductIDs)
+	if err != nil {
+		return err
+	}
+	categoryIDs, err := discountIDs(scope.CategoryIDs)
+	if err != nil {
+		return err
+	}
+	shippingMethodIDs, err := discountIDs(scope.ShippingMethodIDs)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
+		ctx,
+		`
+			update discounts
+			set
+				product_ids = $1::jsonb,
+				category_ids = $2::jsonb,
+				shipping_method_ids = $3::jsonb
+			where id = $4
+		`,
+		productIDs,
+		categoryIDs,
+		shippingMethodIDs,
+		discountID,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.Scope = &scope
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) PreviewUserDiscount(ctx context.Context, code string, sid uint64, shippingMethod uint64, shippingCost *scommerce.Money) (scommerce.UserDiscountPreview, error) {
+	var cost *int64 = nil
+	if shippingCost != nil {
+		units, err := db.minorUnits(*shippingCost)
+		if err != nil {
+			return scommerce.UserDiscountPreview{}, err
+		}
+		cost = &units
+	}
+
+	var discountID pgtype.Int8
+	var discountType pgtype.Text
+	var reason pgtype.Text
+	var subtotal, eligibleSubtotal, minOrderAmount, discount, shippingDiscount int64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`
+			select
+				discount_id_result,
+				discount_type_result,
+				reason_result,
+				subtotal_result::bigint,
+				eligible_subtotal_result::bigint,
+				min_order_amount_result::bigint,
+				discount_result::bigint,
+				shipping_discount_result::bigint
+			from discount_applicability($1, $2, nullif($3::bigint, 0), $4)
+		`,
+		code,
+		sid,
+		shippingMethod,
+		cost,
+	).Scan(&discountID, &discountType, &reason, &subtotal, &eligibleSubtotal, &minOrderAmount, &discount, &shippingDiscount)
+	if err != nil {
+		return scommerce.UserDiscountPreview{}, err
+	}
+
+	return scommerce.UserDiscountPreview{
+		DiscountID:       uint64(discountID.Int64),
+		Code:             code,
+		Type:             scommerce.UserDiscountType(discountType.String),
+		Applicable:       !reason.Valid,
+		Reason:           scommerce.UserDiscountReason(reason.String),
+		Subtotal:         db.money(subtotal),
+		EligibleSubtotal: db.money(eligibleSubtotal),
+		MinOrderAmount:   db.money(minOrderAmount),
+		Discount:         db.money(discount),
+		ShippingDiscount: db.money(shippingDiscount),
+	}, nil
+}
@@ -0,0 +1,334 @@
+package dbsamples
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const userDiscountCampaignColumns = `
+	c.id,
+	c.user_id,
+	c.name,
+	c.code_prefix,
+	c.created_at,
+	(select count(*) from discounts d where d.campaign_id = c.id),
+	c.value,
+	c.valid_count,
+	` + userDiscountRuleColumns
+
+func (db *PostgreDatabase) NewUserDiscountCampaign(ctx context.Context, ownerAccountID UserAccountID, campaign *scommerce.UserDiscountCampaign[UserAccountID]) (uint64, error) {
+	rules := &campaign.Rules
+	valueUnits, err := db.minorUnits(rules.Value)
+	if err != nil {
+		return 0, err
+	}
+	maxValueUnits, err := db.minorUnits(rules.MaxValue)
+	if err != nil {
+		return 0, err
+	}
+	minOrderAmountUnits, err := db.minorUnits(rules.MinOrderAmount)
+	if err != nil {
+		return 0, err
+	}
+	productIDs, err := discountIDs(rules.Scope.ProductIDs)
+	if err != nil {
+		return 0, err
+	}
+	categoryIDs, err := discountIDs(rules.Scope.CategoryIDs)
+	if err != nil {
+		return 0, err
+	}
+	shippingMethodIDs, err := discountIDs(rules.Scope.ShippingMethodIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	var id uint64
+	var createdAt time.Time
+	err = db.PgxPool.QueryRow(
+		ctx,
+		`
+			insert into discount_campaigns(
+				user_id,
+				name,
+				code_prefix,
+				value,
+				valid_count,
+				discount_type,
+				percentage,
+				max_value,
+				min_order_amount,
+				starts_at,
+				ends_at,
+				product_ids,
+				category_ids,
+				shipping_method_ids
+			)
+			values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12::jsonb, $13::jsonb, $14::jsonb)
+			returning id, created_at
+		`,
+		ownerAccountID,
+		campaign.Name,
+		campaign.CodePrefix,
+		valueUnits,
+		rules.ValidCount,
+		string(rules.Type),
+		rules.Percentage,
+		maxValueUnits,
+		minOrderAmountUnits,
+		pgtype.Timestamptz{Time: rules.StartsAt, Valid: !rules.StartsAt.IsZero()},
+		pgtype.Timestamptz{Time: rules.EndsAt, Valid: !rules.EndsAt.IsZero()},
+		productIDs,
+		categoryIDs,
+		shippingMethodIDs,
+	).Scan(&id, &createdAt)
+	if err != nil {
+		return 0, err
+	}
+
+	campaign.ID = id
+	campaign.AccountID = ownerAccountID
+	campaign.CreatedAt = createdAt
+	return id, nil
+}
+
+func (db *PostgreDatabase) AddUserDiscountCampaignCodes(ctx context.Context, cid uint64, codes []string) (int64, error) {
+	tag, err := db.PgxPool.Exec(
+		ctx,
+		`
+			insert into discounts(
+				user_id,
+				code,
+				value,
+				valid_count,
+				used_by,
+				discount_type,
+				percentage,
+				max_value,
+				min_order_amount,
+				starts_at,
+				ends_at,
+				product_ids,
+				category_ids,
+				shipping_method_ids,
+				campaign_id
+			)
+			select
+				c.user_id,
+				codes.code,
+				c.value,
+				c.valid_count,
+				'[]'::jsonb,
+				c.discount_type,
+				c.percentage,
+				c.max_value,
+				c.min_order_amount,
+				c.starts_at,
+				c.ends_at,
+				c.product_ids,
+				c.category_ids,
+				c.shipping_method_ids,
+				c.id
+			from discount_campaigns c
+			cross join unnest($2::text[]) as codes(code)
+			where c.id = $1
+			on conflict (code) do nothing
+		`,
+		cid,
+		codes,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (db *PostgreDatabase) scanUserDiscountCampaign(row pgx.Row, campaign *scommerce.UserDiscountCampaign[UserAccountID]) error {
+	var value int64
+	var rules userDiscountRules
+	err := row.Scan(append([]any{
+		&campaign.ID,
+		&campaign.AccountID,
+		&campaign.Name,
+		&campaign.CodePrefix,
+		&campaign.CreatedAt,
+		&campaign.CodeCount,
+		&value,
+		&campaign.Rules.ValidCount,
+	}, rules.scanDest()...)...)
+	if err != nil {
+		return err
+	}
+
+	campaign.Rules.Type = scommerce.UserDiscountType(rules.discountType)
+	campaign.Rules.Value = db.money(value)
+	campaign.Rules.Percentage = rules.percentage
+	campaign.Rules.MaxValue = db.money(rules.maxValue)
+	campaign.Rules.MinOrderAmount = db.money(rules.minOrderAmount)
+	campaign.Rules.StartsAt = rules.startsAt.Time
+	campaign.Rules.EndsAt = rules.endsAt.Time
+	campaign.Rules.Scope = scommerce.UserDiscountScope{
+		ProductIDs:        rules.productIDs,
+		CategoryIDs:       rules.categoryIDs,
+		ShippingMethodIDs: rules.shippingMethodIDs,
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) GetUserDiscountCampaign(ctx context.Context, cid uint64, campaign *scommerce.UserDiscountCampaign[UserAccountID]) error {
+	row := db.PgxPool.QueryRow(
+		ctx,
+		`select `+userDiscountCampaignColumns+` from discount_campaigns c where c.id = $1`,
+		cid,
+	)
+	return db.scanUserDiscountCampaign(row, campaign)
+}
+
+func (db *PostgreDatabase) GetUserDiscountCampaigns(ctx context.Context, campaigns []scommerce.UserDiscountCampaign[UserAccountID], skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]scommerce.UserDiscountCampaign[UserAccountID], error) {
+	result := campaigns
+	if result == nil {
+		result = make([]scommerce.UserDiscountCampaign[UserAccountID], 0, 10)
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select `+userDiscountCampaignColumns+`
+			from discount_campaigns c
+			order by c.id `+queueOrder.String()+`
+			offset $1
+			limit $2
+		`,
+		skip,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var campaign scommerce.UserDiscountCampaign[UserAccountID]
+		if err := db.scanUserDiscountCampaign(rows, &campaign); err != nil {
+			return nil, err
+		}
+		result = append(result, campaign)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (db *PostgreDatabase) GetUserDiscountCampaignDiscounts(ctx context.Context, cid uint64, ids []uint64, discountForms []*scommerce.UserDiscountForm[UserAccountID], skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]uint64, []*scommerce.UserDiscountForm[UserAccountID], error) {
+	dids := ids
+	if dids == nil {
+		dids = make([]uint64, 0, 10)
+	}
+	forms := discountForms
+	if forms == nil {
+		forms = make([]*scommerce.UserDiscountForm[UserAccountID], 0, cap(dids))
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				id,
+				user_id,
+				code,
+				value,
+				valid_count,
+				used_by,
+				`+userDiscountRuleColumns+`
+			from discounts
+			where campaign_id = $1
+			order by id `+queueOrder.String()+`
+			offset $2
+			limit $3
+		`,
+		cid,
+		skip,
+		limit,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		var userID UserAccountID
+		var code string
+		var value int64
+		var validCount int64
+		var usedByJSON []byte
+		var rules userDiscountRules
+
+		if err := rows.Scan(append([]any{&id, &userID, &code, &value, &validCount, &usedByJSON}, rules.scanDest()...)...); err != nil {
+			return nil, nil, err
+		}
+
+		var usedBy []UserAccountID
+		if err := json.Unmarshal(usedByJSON, &usedBy); err != nil {
+			return nil, nil, err
+		}
+
+		dids = append(dids, id)
+		discountForm := &scommerce.UserDiscountForm[UserAccountID]{
+			ID:            id,
+			UserAccountID: userID,
+			Code:          &code,
+			Value:         db.moneyPtr(value),
+			ValidCount:    &validCount,
+			UsedBy:        &usedBy,
+		}
+		db.applyUserDiscountRules(&rules, discountForm)
+		forms = append(forms, discountForm)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return dids, forms, nil
+}
+
+func (db *PostgreDatabase) GetUserDiscountCampaignReport(ctx context.Context, cid uint64) (scommerce.UserDiscountCampaignReport, error) {
+	report := scommerce.UserDiscountCampaignReport{
+		CampaignID: cid,
+	}
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`
+			select
+				(select count(*) from discounts d where d.campaign_id = c.id),
+				(select count(distinct o.discount_id) from orders o join discounts d on d.id = o.discount_id where d.campaign_id = c.id),
+				(select count(*) from orders o join discounts d on d.id = o.discount_id where d.campaign_id = c.id)
+			from discount_campaigns c
+			where c.id = $1
+		`,
+		cid,
+	).Scan(&report.CodeCount, &report.RedeemedCodeCount, &report.RedemptionCount)
+	if err != nil {
+		return scommerce.UserDiscountCampaignReport{}, err
+	}
+	return report, nil
+}
+
+func (db *PostgreDatabase) RemoveUserDiscountCampaign(ctx context.Context, cid uint64) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`delete from discount_campaigns where id = $1`,
+		cid,
+	)
+	return err
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/MobinYengejehi/scommerce/scommerce"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 var _ scommerce.DBUserFactorManager[UserAccountID] = &PostgreDatabase{}
@@ -19,18 +23,181 @@ func (db *PostgreDatabase) InitUserFactorManager(ctx context.Context) error {
 				id bigint generated by default as identity primary key,
 				user_id bigint not null references users(id),
 				products jsonb not null,
-				discount double precision not null default 0,
-				tax double precision not null default 0,
-				amount_paid double precision not null
+				discount numeric(20, 0) not null default 0,
+				tax numeric(20, 0) not null default 0,
+				amount_paid numeric(20, 0) not null
+			);
+
+			alter table factors add column if not exists tax_lines jsonb not null default '[]'::jsonb;
+			alter table factors add column if not exists order_id bigint references orders(id) on delete set null;
+			alter table factors add column if not exists lines jsonb;
+			alter table factors add column if not exists issued_at timestamptz;
+			alter table factors add column if not exists invoice_year int;
+			alter table factors add column if not exists invoice_sequence bigint;
+
+			-- last invoice number handed out in each year, order_shopping_cart takes the next one
+			-- in the checkout transaction so a failed checkout doesn't leave a gap
+			create table if not exists factor_invoice_numbers(
+				year        int primary key,
+				last_number bigint not null
 			);
 
 			create index if not exists idx_factors_user_id on factors(user_id);
+			create index if not exists idx_factors_order_id on factors(order_id);
 			create index if not exists idx_factors_amount_paid on factors(amount_paid);
 		`,
 	)
+	if err != nil {
+		return err
+	}
+	if err := db.migrateMoneyColumns(ctx, "factors", []string{"amount_paid", "discount", "tax"}, "products"); err != nil {
+		return err
+	}
+	if err := db.migrateFactorInvoices(ctx); err != nil {
+		return err
+	}
+	return db.initCreditNotes(ctx)
+}
+
+// migrateFactorInvoices numbers the factors issued before invoice numbers and builds their lines
+// from the legacy products column, factors which already have them are left untouched.
+func (db *PostgreDatabase) migrateFactorInvoices(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			update factors f
+			set issued_at = coalesce((select o.order_date::timestamptz from orders o where o.id = f.order_id), now())
+			where f.issued_at is null;
+
+			alter table factors alter column issued_at set default now();
+			alter table factors alter column issued_at set not null;
+
+			with numbered as (
+				select
+					f.id,
+					extract(year from f.issued_at)::int as year,
+					row_number() over (partition by extract(year from f.issued_at) order by f.issued_at, f.id) as n
+				from factors f
+				where f.invoice_sequence is null
+			)
+			update factors f
+			set invoice_year = numbered.year,
+				invoice_sequence = numbered.n + coalesce((select s.last_number from factor_invoice_numbers s where s.year = numbered.year), 0)
+			from numbered
+			where f.id = numbered.id;
+
+			insert into factor_invoice_numbers(year, last_number)
+			select invoice_year, max(invoice_sequence)
+			from factors
+			where invoice_year is not null
+			group by invoice_year
+			on conflict (year) do update set last_number = greatest(factor_invoice_numbers.last_number, excluded.last_number);
+
+			alter table factors alter column invoice_year set not null;
+			alter table factors alter column invoice_sequence set not null;
+			create unique index if not exists idx_factors_invoice_number on factors(invoice_year, invoice_sequence);
+
+			-- legacy products hold the cart items followed by the promotion lines, which have no price
+			update factors f
+			set lines = coalesce((
+				select jsonb_agg(
+					jsonb_build_object(
+						'product_item_id', (p.item->>'product_item_id')::bigint,
+						'sku', coalesce(pi.sku, ''),
+						'name', coalesce(p.item->>'name', ''),
+						'unit_price', (p.item->>'price')::numeric,
+						'quantity', (p.item->>'quantity')::bigint,
+						'attributes', coalesce(p.item->'attributes', 'null'::jsonb),
+						'discount', 0,
+						'tax', 0,
+						'total', (p.item->>'price')::numeric * (p.item->>'quantity')::bigint
+					)
+					order by p.ordinality
+				)
+				from jsonb_array_elements(f.products) with ordinality as p(item, ordinality)
+				left join product_items pi on pi.id = (p.item->>'product_item_id')::bigint
+				where p.item ? 'price' and p.item ? 'quantity'
+			), '[]'::jsonb)
+			where f.lines is null;
+
+			alter table factors alter column lines set default '[]'::jsonb;
+			alter table factors alter column lines set not null;
+		`,
+	)
 	return err
 }
 
+// factorLineRow is a FactorLine as stored in factors.lines, amounts are minor units of the database currency.
+type factorLineRow struct {
+	ProductItemID uint64          `json:"product_item_id"`
+	SKU           string          `json:"sku"`
+	Name          string          `json:"name"`
+	UnitPrice     int64           `json:"unit_price"`
+	Quantity      int64           `json:"quantity"`
+	Attributes    json.RawMessage `json:"attributes,omitempty"`
+	Discount      int64           `json:"discount"`
+	Tax           int64           `json:"tax"`
+	Total         int64           `json:"total"`
+}
+
+func (db *PostgreDatabase) decodeFactorLines(raw []byte) ([]scommerce.FactorLine, error) {
+	rows := make([]factorLineRow, 0)
+	if len(raw) != 0 {
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			return nil, err
+		}
+	}
+	lines := make([]scommerce.FactorLine, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, scommerce.FactorLine{
+			ProductItemID: row.ProductItemID,
+			SKU:           row.SKU,
+			Name:          row.Name,
+			UnitPrice:     db.money(row.UnitPrice),
+			Quantity:      row.Quantity,
+			Attributes:    row.Attributes,
+			Discount:      db.money(row.Discount),
+			Tax:           db.money(row.Tax),
+			Total:         db.money(row.Total),
+		})
+	}
+	return lines, nil
+}
+
+func (db *PostgreDatabase) encodeFactorLines(lines []scommerce.FactorLine) ([]byte, error) {
+	rows := make([]factorLineRow, 0, len(lines))
+	for _, line := range lines {
+		unitPrice, err := db.minorUnits(line.UnitPrice)
+		if err != nil {
+			return nil, err
+		}
+		discount, err := db.minorUnits(line.Discount)
+		if err != nil {
+			return nil, err
+		}
+		tax, err := db.minorUnits(line.Tax)
+		if err != nil {
+			return nil, err
+		}
+		total, err := db.minorUnits(line.Total)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, factorLineRow{
+			ProductItemID: line.ProductItemID,
+			SKU:           line.SKU,
+			Name:          line.Name,
+			UnitPrice:     unitPrice,
+			Quantity:      line.Quantity,
+			Attributes:    line.Attributes,
+			Discount:      discount,
+			Tax:           tax,
+			Total:         total,
+		})
+	}
+	return json.Marshal(rows)
+}
+
 func (db *PostgreDatabase) GetUserFactorCount(ctx context.Context, aid UserAccountID) (uint64, error) {
 	var count uint64
 	err := db.PgxPool.QueryRow(
@@ -60,9 +227,14 @@ func (db *PostgreDatabase) GetUserFactors(ctx context.Context, aid UserAccountID
 			select
 				id,
 				user_id,
-				products,
+				coalesce(order_id, 0),
+				invoice_year,
+				invoice_sequence,
+				issued_at,
+				lines,
 				discount,
 				tax,
+				tax_lines,
 				amount_paid
 			from factors
 			where user_id = $1
@@ -82,12 +254,25 @@ func (db *PostgreDatabase) GetUserFactors(ctx context.Context, aid UserAccountID
 	for rows.Next() {
 		var id uint64
 		var userID UserAccountID
-		var products json.RawMessage
-		var discount float64
-		var tax float64
-		var amountPaid float64
+		var orderID uint64
+		var invoiceNumber scommerce.InvoiceNumber
+		var issuedAt time.Time
+		var rawLines []byte
+		var discount int64
+		var tax int64
+		var rawTaxLines []byte
+		var amountPaid int64
 
-		if err := rows.Scan(&id, &userID, &products, &discount, &tax, &amountPaid); err != nil {
+		if err := rows.Scan(&id, &userID, &orderID, &invoiceNumber.Year, &invoiceNumber.Sequence, &issuedAt, &rawLines, &discount, &tax, &rawTaxLines, &amountPaid); err != nil {
+			return nil, nil, err
+		}
+
+		lines, err := db.decodeFactorLines(rawLines)
+		if err != nil {
+			return nil, nil, err
+		}
+		taxLines, err := decodeTaxLines(rawTaxLines)
+		if err != nil {
 			return nil, nil, err
 		}
 
@@ -95,10 +280,14 @@ func (db *PostgreDatabase) GetUserFactors(ctx context.Context, aid UserAccountID
 		forms = append(forms, &scommerce.UserFactorForm[UserAccountID]{
 			ID:            id,
 			UserAccountID: userID,
-			Products:      &products,
-			Discount:      &discount,
-			Tax:           &tax,
-			AmountPaid:    &amountPaid,
+			OrderID:       &orderID,
+			InvoiceNumber: &invoiceNumber,
+			IssuedAt:      &issuedAt,
+			Lines:         &lines,
+			Discount:      db.moneyPtr(discount),
+			Tax:           db.moneyPtr(tax),
+			TaxLines:      &taxLines,
+			AmountPaid:    db.moneyPtr(amountPaid),
 		})
 	}
 
@@ -126,130 +315,306 @@ func (db *PostgreDatabase) RemoveUserAccountFactors(ctx context.Context, aid Use
 	return err
 }
 
-func (db *PostgreDatabase) GetUserFactorProducts(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (json.RawMessage, error) {
-	var products json.RawMessage
+func (db *PostgreDatabase) GetUserFactorIDWithInvoiceNumber(ctx context.Context, number scommerce.InvoiceNumber) (uint64, error) {
+	var fid uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select id from factors where invoice_year = $1 and invoice_sequence = $2`,
+		number.Year,
+		number.Sequence,
+	).Scan(&fid)
+	if err != nil {
+		return 0, err
+	}
+	return fid, nil
+}
+
+func (db *PostgreDatabase) GetUserFactorBuyer(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (scommerce.InvoiceParty, error) {
+	var name string
+	var unitNumber, streetNumber, addressLine1, addressLine2 pgtype.Text
+	var city, region, postalCode, country pgtype.Text
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`
+			select
+				trim(concat_ws(' ', u.first_name, u.last_name)),
+				a.unit_number,
+				a.street_number,
+				a.address_line1,
+				a.address_line2,
+				a.city,
+				a.region,
+				a.postal_code,
+				c.name
+			from factors f
+			join users u on u.id = f.user_id
+			left join orders o on o.id = f.order_id
+			left join addresses a on a.id = o.shipping_address_id
+			left join countries c on c.id = a.country_id
+			where f.id = $1
+		`,
+		fid,
+	).Scan(&name, &unitNumber, &streetNumber, &addressLine1, &addressLine2, &city, &region, &postalCode, &country)
+	if err != nil {
+		return scommerce.InvoiceParty{}, err
+	}
+
+	addressLines := make([]string, 0, 2)
+	if line := strings.TrimSpace(strings.Join([]string{unitNumber.String, streetNumber.String, addressLine1.String}, " ")); line != "" {
+		addressLines = append(addressLines, strings.Join(strings.Fields(line), " "))
+	}
+	if addressLine2.String != "" {
+		addressLines = append(addressLines, addressLine2.String)
+	}
+
+	return scommerce.InvoiceParty{
+		Name:         name,
+		AddressLines: addressLines,
+		City:         city.String,
+		Region:       region.String,
+		PostalCode:   postalCode.String,
+		Country:      country.String,
+	}, nil
+}
+
+func (db *PostgreDatabase) GetUserFactorOrderID(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (uint64, error) {
+	var orderID uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select coalesce(order_id, 0) from factors where id = $1`,
+		fid,
+	).Scan(&orderID)
+	if err != nil {
+		return 0, err
+	}
+	if form != nil {
+		form.OrderID = &orderID
+	}
+	return orderID, nil
+}
+
+func (db *PostgreDatabase) GetUserFactorInvoiceNumber(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (scommerce.InvoiceNumber, error) {
+	var number scommerce.InvoiceNumber
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select invoice_year, invoice_sequence from factors where id = $1`,
+		fid,
+	).Scan(&number.Year, &number.Sequence)
+	if err != nil {
+		return scommerce.InvoiceNumber{}, err
+	}
+	if form != nil {
+		form.InvoiceNumber = &number
+	}
+	return number, nil
+}
+
+func (db *PostgreDatabase) GetUserFactorIssuedAt(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (time.Time, error) {
+	var issuedAt time.Time
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select issued_at from factors where id = $1`,
+		fid,
+	).Scan(&issuedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if form != nil {
+		form.IssuedAt = &issuedAt
+	}
+	return issuedAt, nil
+}
+
+func (db *PostgreDatabase) GetUserFactorLines(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) ([]scommerce.FactorLine, error) {
+	var rawLines []byte
 	err := db.PgxPool.QueryRow(
 		ctx,
-		`select products from factors where id = $1`,
+		`select lines from factors where id = $1`,
 		fid,
-	).Scan(&products)
+	).Scan(&rawLines)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := db.decodeFactorLines(rawLines)
 	if err != nil {
 		return nil, err
 	}
 	if form != nil {
-		form.Products = &products
+		form.Lines = &lines
 	}
-	return products, nil
+	return lines, nil
 }
 
-func (db *PostgreDatabase) SetUserFactorProducts(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, products json.RawMessage) error {
-	_, err := db.PgxPool.Exec(
+func (db *PostgreDatabase) SetUserFactorLines(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, lines []scommerce.FactorLine) error {
+	if lines == nil {
+		lines = []scommerce.FactorLine{}
+	}
+	rawLines, err := db.encodeFactorLines(lines)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
 		ctx,
-		`update factors set products = $1 where id = $2`,
-		products,
+		`update factors set lines = $1 where id = $2`,
+		rawLines,
 		fid,
 	)
 	if err != nil {
 		return err
 	}
 	if form != nil {
-		form.Products = &products
+		form.Lines = &lines
 	}
 	return nil
 }
 
-func (db *PostgreDatabase) GetUserFactorDiscount(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (float64, error) {
-	var discount float64
+func (db *PostgreDatabase) GetUserFactorDiscount(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (scommerce.Money, error) {
+	var discount int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select discount from factors where id = $1`,
 		fid,
 	).Scan(&discount)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.Discount = &discount
+		form.Discount = db.moneyPtr(discount)
 	}
-	return discount, nil
+	return db.money(discount), nil
 }
 
-func (db *PostgreDatabase) SetUserFactorDiscount(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, discount float64) error {
-	_, err := db.PgxPool.Exec(
+func (db *PostgreDatabase) SetUserFactorDiscount(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, discount scommerce.Money) error {
+	discountUnits, err := db.minorUnits(discount)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
 		ctx,
 		`update factors set discount = $1 where id = $2`,
-		discount,
+		discountUnits,
 		fid,
 	)
 	if err != nil {
 		return err
 	}
 	if form != nil {
-		form.Discount = &discount
+		form.Discount = db.moneyPtr(discountUnits)
 	}
 	return nil
 }
 
-func (db *PostgreDatabase) GetUserFactorTax(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (float64, error) {
-	var tax float64
+func (db *PostgreDatabase) GetUserFactorTax(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (scommerce.Money, error) {
+	var tax int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select tax from factors where id = $1`,
 		fid,
 	).Scan(&tax)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.Tax = &tax
+		form.Tax = db.moneyPtr(tax)
 	}
-	return tax, nil
+	return db.money(tax), nil
 }
 
-func (db *PostgreDatabase) SetUserFactorTax(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, tax float64) error {
-	_, err := db.PgxPool.Exec(
+func (db *PostgreDatabase) SetUserFactorTax(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, tax scommerce.Money) error {
+	taxUnits, err := db.minorUnits(tax)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
 		ctx,
 		`update factors set tax = $1 where id = $2`,
-		tax,
+		taxUnits,
 		fid,
 	)
 	if err != nil {
 		return err
 	}
 	if form != nil {
-		form.Tax = &tax
+		form.Tax = db.moneyPtr(taxUnits)
 	}
 	return nil
 }
 
-func (db *PostgreDatabase) GetUserFactorAmountPaid(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (float64, error) {
-	var amountPaid float64
+func (db *PostgreDatabase) GetUserFactorTaxLines(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) ([]scommerce.TaxLine, error) {
+	var rawTaxLines []byte
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select tax_lines from factors where id = $1`,
+		fid,
+	).Scan(&rawTaxLines)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := decodeTaxLines(rawTaxLines)
+	if err != nil {
+		return nil, err
+	}
+	if form != nil {
+		form.TaxLines = &lines
+	}
+	return lines, nil
+}
+
+func (db *PostgreDatabase) SetUserFactorTaxLines(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, lines []scommerce.TaxLine) error {
+	if lines == nil {
+		lines = []scommerce.TaxLine{}
+	}
+	rawTaxLines, err := json.Marshal(lines)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
+		ctx,
+		`update factors set tax_lines = $1 where id = $2`,
+		rawTaxLines,
+		fid,
+	)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		form.TaxLines = &lines
+	}
+	return nil
+}
+
+func (db *PostgreDatabase) GetUserFactorAmountPaid(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64) (scommerce.Money, error) {
+	var amountPaid int64
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`select amount_paid from factors where id = $1`,
 		fid,
 	).Scan(&amountPaid)
 	if err != nil {
-		return 0, err
+		return scommerce.Money{}, err
 	}
 	if form != nil {
-		form.AmountPaid = &amountPaid
+		form.AmountPaid = db.moneyPtr(amountPaid)
 	}
-	return amountPaid, nil
+	return db.money(amountPaid), nil
 }
 
-func (db *PostgreDatabase) SetUserFactorAmountPaid(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, amountPaid float64) error {
-	_, err := db.PgxPool.Exec(
+func (db *PostgreDatabase) SetUserFactorAmountPaid(ctx context.Context, form *scommerce.UserFactorForm[UserAccountID], fid uint64, amountPaid scommerce.Money) error {
+	amountPaidUnits, err := db.minorUnits(amountPaid)
+	if err != nil {
+		return err
+	}
+	_, err = db.PgxPool.Exec(
 		ctx,
 		`update factors set amount_paid = $1 where id = $2`,
-		amountPaid,
+		amountPaidUnits,
 		fid,
 	)
 	if err != nil {
 		return err
 	}
 	if form != nil {
-		form.AmountPaid = &amountPaid
+		form.AmountPaid = db.moneyPtr(amountPaidUnits)
 	}
 	return nil
 }
@@ -260,19 +625,28 @@ func (db *PostgreDatabase) FillUserFactorWithID(ctx context.Context, fid uint64,
 	}
 
 	var userID UserAccountID
-	var products json.RawMessage
-	var discount float64
-	var tax float64
-	var amountPaid float64
+	var orderID uint64
+	var invoiceNumber scommerce.InvoiceNumber
+	var issuedAt time.Time
+	var rawLines []byte
+	var discount int64
+	var tax int64
+	var rawTaxLines []byte
+	var amountPaid int64
 
 	err := db.PgxPool.QueryRow(
 		ctx,
 		`
 			select
 				"user_id",
-				"products",
+				coalesce("order_id", 0),
+				"invoice_year",
+				"invoice_sequence",
+				"issued_at",
+				"lines",
 				"discount",
 				"tax",
+				"tax_lines",
 				"amount_paid"
 			from factors
 			where "id" = $1
@@ -281,21 +655,50 @@ func (db *PostgreDatabase) FillUserFactorWithID(ctx context.Context, fid uint64,
 		fid,
 	).Scan(
 		&userID,
-		&products,
+		&orderID,
+		&invoiceNumber.Year,
+		&invoiceNumber.Sequence,
+		&issuedAt,
+		&rawLines,
 		&discount,
 		&tax,
+		&rawTaxLines,
 		&amountPaid,
 	)
 	if err != nil {
 		return err
 	}
 
+	lines, err := db.decodeFactorLines(rawLines)
+	if err != nil {
+		return err
+	}
+	taxLines, err := decodeTaxLines(rawTaxLines)
+	if err != nil {
+		return err
+	}
+
 	factorForm.ID = fid
 	factorForm.UserAccountID = userID
-	factorForm.Products = &products
-	factorForm.Discount = &discount
-	factorForm.Tax = &tax
-	factorForm.AmountPaid = &amountPaid
+	factorForm.OrderID = &orderID
+	factorForm.InvoiceNumber = &invoiceNumber
+	factorForm.IssuedAt = &issuedAt
+	factorForm.Lines = &lines
+	factorForm.Discount = db.moneyPtr(discount)
+	factorForm.Tax = db.moneyPtr(tax)
+	factorForm.TaxLines = &taxLines
+	factorForm.AmountPaid = db.moneyPtr(amountPaid)
 
 	return nil
 }
+
+func decodeTaxLines(raw []byte) ([]scommerce.TaxLine, error) {
+	lines := make([]scommerce.TaxLine, 0)
+	if len(raw) == 0 {
+		return lines, nil
+	}
+	if err := json.Unmarshal(raw, &lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
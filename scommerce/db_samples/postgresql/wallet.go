@@ -0,0 +1,442 @@
+package dbsamples
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/MobinYengejehi/scommerce/scommerce"
+	"github.com/jackc/pgx/v5"
+)
+
+// walletPosting is one side of a wallet journal, userID is nil for the non wallet ledgers.
+type walletPosting struct {
+	ledger         string
+	userID         *UserAccountID
+	counterpartyID *UserAccountID
+	amount         int64
+	balanceAfter   *int64
+}
+
+func (db *PostgreDatabase) initWalletLedger(ctx context.Context) error {
+	_, err := db.PgxPool.Exec(
+		ctx,
+		`
+			create sequence if not exists wallet_journal_seq;
+
+			create table if not exists wallet_transactions(
+				id              bigint generated by default as identity primary key,
+				journal_id      bigint not null,
+				ledger          varchar(64) not null,
+				user_id         bigint references users(id) on delete set null,
+				counterparty_id bigint references users(id) on delete set null,
+				type            varchar(64) not null,
+				amount          numeric(20, 0) not null,
+				balance_after   numeric(20, 0),
+				reference_type  varchar(64),
+				reference_id    varchar(256),
+				actor_id        bigint references users(id) on delete set null,
+				description     varchar(1000),
+				created_at      timestamptz not null default now()
+			);
+
+			create index if not exists wallet_transactions_user_idx on wallet_transactions(user_id, id) where ledger = 'wallet';
+			create index if not exists wallet_transactions_journal_idx on wallet_transactions(journal_id);
+
+			create or replace function reject_wallet_transaction_change() returns trigger as $$
+			begin
+				if tg_op = 'UPDATE' and (
+					new.id, new.journal_id, new.ledger, new.type, new.amount, new.balance_after,
+					new.reference_type, new.reference_id, new.description, new.created_at
+				) is not distinct from (
+					old.id, old.journal_id, old.ledger, old.type, old.amount, old.balance_after,
+					old.reference_type, old.reference_id, old.description, old.created_at
+				) then
+					-- removing a user only detaches its transactions
+					return new;
+				end if;
+				raise exception 'wallet transactions are append-only';
+			end;
+			$$ language plpgsql;
+
+			drop trigger if exists wallet_transactions_append_only on wallet_transactions;
+			create trigger wallet_transactions_append_only
+				before update or delete on wallet_transactions
+				for each row execute function reject_wallet_transaction_change();
+		`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// wallets which existed before the ledger get an opening balance so they reconcile
+	_, err = db.PgxPool.Exec(
+		ctx,
+		`
+			with opening as (
+				select
+					u."id",
+					u."wallet",
+					nextval('wallet_journal_seq') as journal_id
+				from users u
+				where coalesce(u."wallet", 0) <> 0 and not exists (
+					select 1 from wallet_transactions t where t."ledger" = 'wallet' and t."user_id" = u."id"
+				)
+			)
+			insert into wallet_transactions("journal_id", "ledger", "user_id", "counterparty_id", "type", "amount", "balance_after")
+			select "journal_id", 'wallet', "id", null, $1, "wallet", "wallet" from opening
+			union all
+			select "journal_id", $2, null, "id", $1, -"wallet", null from opening
+		`,
+		scommerce.WalletTransactionOpeningBalance,
+		scommerce.WalletTransactionOpeningBalance.Counterparty(),
+	)
+	return err
+}
+
+// postWalletJournal appends the postings as one journal, they must sum to zero.
+func (db *PostgreDatabase) postWalletJournal(ctx context.Context, tx pgx.Tx, transactionType scommerce.WalletTransactionType, entry *scommerce.WalletEntry[UserAccountID], postings ...walletPosting) error {
+	var referenceType *string
+	var referenceID *string
+	var actorID *UserAccountID
+	var description *string
+	if entry != nil {
+		if entry.Type != "" {
+			transactionType = entry.Type
+		}
+		if entry.ReferenceType != "" {
+			referenceType = &entry.ReferenceType
+		}
+		if entry.ReferenceID != "" {
+			referenceID = &entry.ReferenceID
+		}
+		if entry.Description != "" {
+			description = &entry.Description
+		}
+		actorID = entry.ActorID
+	}
+
+	var journalID uint64
+	if err := tx.QueryRow(ctx, `select nextval('wallet_journal_seq')`).Scan(&journalID); err != nil {
+		return err
+	}
+	for _, posting := range postings {
+		ledger := posting.ledger
+		if ledger == "" {
+			ledger = transactionType.Counterparty()
+		}
+		_, err := tx.Exec(
+			ctx,
+			`
+				insert into wallet_transactions(
+					"journal_id",
+					"ledger",
+					"user_id",
+					"counterparty_id",
+					"type",
+					"amount",
+					"balance_after",
+					"reference_type",
+					"reference_id",
+					"actor_id",
+					"description"
+				) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			`,
+			journalID,
+			ledger,
+			posting.userID,
+			posting.counterpartyID,
+			transactionType,
+			posting.amount,
+			posting.balanceAfter,
+			referenceType,
+			referenceID,
+			actorID,
+			description,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveWallet runs moveWalletTx in its own transaction.
+func (db *PostgreDatabase) moveWallet(ctx context.Context, aid UserAccountID, transactionType scommerce.WalletTransactionType, entry *scommerce.WalletEntry[UserAccountID], next func(wallet int64) int64) (int64, error) {
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	newWallet, err := db.moveWalletTx(ctx, tx, aid, transactionType, entry, func(wallet int64) (int64, error) {
+		return next(wallet), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return newWallet, nil
+}
+
+// moveWalletIdempotent runs moveWalletTx in its own transaction under the idempotency key, a completed key
+// replays the wallet it produced. It stores the new wallet in form.
+func (db *PostgreDatabase) moveWalletIdempotent(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, scope string, idempotencyKey string, fingerprint string, transactionType scommerce.WalletTransactionType, entry *scommerce.WalletEntry[UserAccountID], next func(wallet int64) (int64, error)) error {
+	tx, err := db.PgxPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var result struct {
+		Wallet int64 `json:"wallet"`
+	}
+	if idempotencyKey != "" {
+		response, err := db.claimIdempotencyKey(ctx, tx, scope, idempotencyKey, fingerprint)
+		if err != nil {
+			return err
+		}
+		if response != nil {
+			if err := json.Unmarshal(response, &result); err != nil {
+				return err
+			}
+			if form != nil {
+				form.WalletCurrency = db.moneyPtr(result.Wallet)
+			}
+			return nil
+		}
+	}
+
+	result.Wallet, err = db.moveWalletTx(ctx, tx, aid, transactionType, entry, next)
+	if err != nil {
+		return err
+	}
+	if idempotencyKey != "" {
+		if err := db.completeIdempotencyKey(ctx, tx, scope, idempotencyKey, result); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	if form != nil {
+		form.WalletCurrency = db.moneyPtr(result.Wallet)
+	}
+	return nil
+}
+
+// moveWalletTx locks the wallet of the user, replaces it with next(wallet) and journals the difference
+// against the counterparty ledger of the transaction type. It returns the new wallet.
+func (db *PostgreDatabase) moveWalletTx(ctx context.Context, tx pgx.Tx, aid UserAccountID, transactionType scommerce.WalletTransactionType, entry *scommerce.WalletEntry[UserAccountID], next func(wallet int64) (int64, error)) (int64, error) {
+	var wallet int64
+	err := tx.QueryRow(
+		ctx,
+		`select coalesce("wallet", 0) from users where "id" = $1 for update`,
+		aid,
+	).Scan(&wallet)
+	if err != nil {
+		return 0, err
+	}
+
+	newWallet, err := next(wallet)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(
+		ctx,
+		`update users set "wallet" = $1 where "id" = $2`,
+		newWallet,
+		aid,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if delta := newWallet - wallet; delta != 0 {
+		err := db.postWalletJournal(
+			ctx,
+			tx,
+			transactionType,
+			entry,
+			walletPosting{ledger: scommerce.WalletLedgerWallet, userID: &aid, amount: delta, balanceAfter: &newWallet},
+			walletPosting{counterpartyID: &aid, amount: -delta},
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return newWallet, nil
+}
+
+func (db *PostgreDatabase) GetUserAccountWalletTransactions(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID, transactions []scommerce.WalletTransaction[UserAccountID], skip int64, limit int64, queueOrder scommerce.QueueOrder) ([]scommerce.WalletTransaction[UserAccountID], error) {
+	result := transactions
+	if result == nil {
+		result = make([]scommerce.WalletTransaction[UserAccountID], 0, 10)
+	}
+
+	rows, err := db.PgxPool.Query(
+		ctx,
+		`
+			select
+				t."id",
+				t."journal_id",
+				t."type",
+				t."amount",
+				coalesce(t."balance_after", 0),
+				coalesce((
+					select o."ledger" from wallet_transactions o
+					where o."journal_id" = t."journal_id" and o."id" <> t."id"
+					order by o."id" limit 1
+				), ''),
+				t."counterparty_id",
+				coalesce(t."reference_type", ''),
+				coalesce(t."reference_id", ''),
+				t."actor_id",
+				coalesce(t."description", ''),
+				t."created_at"
+			from wallet_transactions t
+			where t."ledger" = 'wallet' and t."user_id" = $1
+			order by t."id" `+queueOrder.String()+`
+			offset $2
+			limit $3
+		`,
+		aid,
+		skip,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transaction scommerce.WalletTransaction[UserAccountID]
+		var transactionType string
+		var amount int64
+		var balanceAfter int64
+		err := rows.Scan(
+			&transaction.ID,
+			&transaction.JournalID,
+			&transactionType,
+			&amount,
+			&balanceAfter,
+			&transaction.Counterparty,
+			&transaction.CounterpartyID,
+			&transaction.ReferenceType,
+			&transaction.ReferenceID,
+			&transaction.ActorID,
+			&transaction.Description,
+			&transaction.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		transaction.AccountID = aid
+		transaction.Type = scommerce.WalletTransactionType(transactionType)
+		transaction.Amount = db.money(amount)
+		transaction.BalanceAfter = db.money(balanceAfter)
+		result = append(result, transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (db *PostgreDatabase) GetUserAccountWalletTransactionCount(ctx context.Context, form *scommerce.UserAccountForm[UserAccountID], aid UserAccountID) (uint64, error) {
+	var count uint64
+	err := db.PgxPool.QueryRow(
+		ctx,
+		`select count(*) from wallet_transactions where "ledger" = 'wallet' and "user_id" = $1`,
+		aid,
+	).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (db *PostgreDatabase) ReconcileUserAccountWallets(ctx context.Context) (*scommerce.WalletReconciliation[UserAccountID], error) {
+	reconciliation := &scommerce.WalletReconciliation[UserAccountID]{
+		CheckedAt:          time.Now(),
+		Discrepancies:      make([]scommerce.WalletDiscrepancy[UserAccountID], 0),
+		UnbalancedJournals: make([]uint64, 0),
+	}
+
+	tx, err := db.PgxPool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(
+		ctx,
+		`
+			select
+				u."id",
+				coalesce(u."wallet", 0),
+				coalesce(l."total", 0)
+			from users u
+			left join (
+				select "user_id", sum("amount") as total
+				from wallet_transactions
+				where "ledger" = 'wallet'
+				group by "user_id"
+			) l on l."user_id" = u."id"
+			where coalesce(u."wallet", 0) <> coalesce(l."total", 0)
+			order by u."id"
+		`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var aid UserAccountID
+		var wallet int64
+		var total int64
+		if err := rows.Scan(&aid, &wallet, &total); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		reconciliation.Discrepancies = append(reconciliation.Discrepancies, scommerce.WalletDiscrepancy[UserAccountID]{
+			AccountID:     aid,
+			Balance:       db.money(wallet),
+			LedgerBalance: db.money(total),
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(
+		ctx,
+		`
+			select "journal_id"
+			from wallet_transactions
+			group by "journal_id"
+			having sum("amount") <> 0
+			order by "journal_id"
+		`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var journalID uint64
+		if err := rows.Scan(&journalID); err != nil {
+			return nil, err
+		}
+		reconciliation.UnbalancedJournals = append(reconciliation.UnbalancedJournals, journalID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reconciliation, nil
+}
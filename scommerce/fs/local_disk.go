@@ -41,7 +41,7 @@ func (fs *LocalDiskFileStorage) Create(ctx context.Context, token string) (scomm
 }
 
 func (fs *LocalDiskFileStorage) Exists(ctx context.Context, token string) (bool, error) {
-	file, err := os.Open(token)
+	file, err := os.Open(filepath.Join(fs.Directory, token))
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return false, nil
@@ -70,3 +70,7 @@ func (fs *LocalDiskFileStorage) Delete(ctx context.Context, token string) error
 func (fs *LocalDiskFileStorage) DeleteAll(ctx context.Context, path string) error {
 	return os.RemoveAll(path)
 }
+
+func (fs *LocalDiskFileStorage) Rename(ctx context.Context, from string, to string) error {
+	return os.Rename(filepath.Join(fs.Directory, from), filepath.Join(fs.Directory, to))
+}
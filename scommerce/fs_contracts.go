@@ -54,6 +54,7 @@ type FileStorage interface {
 	Exists(ctx context.Context, token string) (bool, error)
 	Delete(ctx context.Context, token string) error
 	DeleteAll(ctx context.Context, path string) error
+	Rename(ctx context.Context, from string, to string) error // replaces the file of to, if any
 }
 
 type OSFileIO struct {
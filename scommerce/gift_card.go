@@ -0,0 +1,199 @@
+package scommerce
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var ErrGiftCardNotFound = errors.New("gift card not found")
+var ErrGiftCardExpired = errors.New("gift card is expired")
+var ErrGiftCardSpent = errors.New("gift card bought by the order is already spent")
+
+var _ GiftCardManager[any] = &BuiltinGiftCardManager[any]{}
+var _ PaymentGateway[any] = &BuiltinGiftCardPaymentGateway[any]{}
+
+type GiftCardTransactionType string
+
+const (
+	GiftCardTransactionIssue   GiftCardTransactionType = "issue"
+	GiftCardTransactionRedeem  GiftCardTransactionType = "redeem"  // paid an order
+	GiftCardTransactionRefund  GiftCardTransactionType = "refund"  // money of an order paid back to the card
+	GiftCardTransactionVoid    GiftCardTransactionType = "void"    // the order which bought the card was refunded
+	GiftCardTransactionRestore GiftCardTransactionType = "restore" // a void taken back because the refund failed
+)
+
+// GiftCard is a balance which pays orders through the gift card payment gateway, anyone knowing its code can spend it.
+type GiftCard[AccountID comparable] struct {
+	ID             uint64    `json:"id"`
+	Code           string    `json:"code"`
+	AccountID      AccountID `json:"account_id"`                // buyer of the card
+	OrderID        uint64    `json:"order_id,omitempty"`        // order which bought the card, 0 when issued by IssueGiftCard
+	ProductItemID  uint64    `json:"product_item_id,omitempty"` // gift card product item which was bought
+	InitialBalance Money     `json:"initial_balance"`
+	Balance        Money     `json:"balance"`
+	ExpiresAt      time.Time `json:"expires_at"` // zero when the card never expires
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (giftCard *GiftCard[AccountID]) IsExpired(now time.Time) bool {
+	return !giftCard.ExpiresAt.IsZero() && !now.Before(giftCard.ExpiresAt)
+}
+
+// GiftCardTransaction is an append-only change of the balance of a gift card, Amount is signed.
+type GiftCardTransaction struct {
+	ID           uint64                  `json:"id"`
+	GiftCardID   uint64                  `json:"gift_card_id"`
+	Type         GiftCardTransactionType `json:"type"`
+	Amount       Money                   `json:"amount"`
+	BalanceAfter Money                   `json:"balance_after"`
+	OrderID      uint64                  `json:"order_id,omitempty"`
+	PaymentID    uint64                  `json:"payment_id,omitempty"`
+	CreatedAt    time.Time               `json:"created_at"`
+}
+
+type giftCardManagerDatabase[AccountID comparable] interface {
+	DBGiftCardManager[AccountID]
+}
+
+type BuiltinGiftCardManager[AccountID comparable] struct {
+	DB giftCardManagerDatabase[AccountID]
+}
+
+func NewBuiltinGiftCardManager[AccountID comparable](db giftCardManagerDatabase[AccountID]) *BuiltinGiftCardManager[AccountID] {
+	return &BuiltinGiftCardManager[AccountID]{
+		DB: db,
+	}
+}
+
+func (giftCardManager *BuiltinGiftCardManager[AccountID]) Close(ctx context.Context) error {
+	return nil
+}
+
+func (giftCardManager *BuiltinGiftCardManager[AccountID]) GetAccountGiftCards(ctx context.Context, account UserAccount[AccountID], giftCards []GiftCard[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]GiftCard[AccountID], error) {
+	aid, err := account.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return giftCardManager.DB.GetGiftCardsForAccount(ctx, aid, giftCards, skip, limit, queueOrder)
+}
+
+// GetGiftCardByCode fails with ErrGiftCardNotFound when no gift card has the code.
+func (giftCardManager *BuiltinGiftCardManager[AccountID]) GetGiftCardByCode(ctx context.Context, code string) (*GiftCard[AccountID], error) {
+	giftCard := &GiftCard[AccountID]{}
+	if err := giftCardManager.DB.GetGiftCardByCode(ctx, code, giftCard); err != nil {
+		return nil, err
+	}
+	return giftCard, nil
+}
+
+func (giftCardManager *BuiltinGiftCardManager[AccountID]) GetGiftCardTransactions(ctx context.Context, gcid uint64, transactions []GiftCardTransaction, skip int64, limit int64, queueOrder QueueOrder) ([]GiftCardTransaction, error) {
+	return giftCardManager.DB.GetGiftCardTransactions(ctx, gcid, transactions, skip, limit, queueOrder)
+}
+
+func (giftCardManager *BuiltinGiftCardManager[AccountID]) GetGiftCardWithID(ctx context.Context, gcid uint64) (*GiftCard[AccountID], error) {
+	giftCard := &GiftCard[AccountID]{}
+	if err := giftCardManager.DB.GetGiftCard(ctx, gcid, giftCard); err != nil {
+		return nil, err
+	}
+	return giftCard, nil
+}
+
+func (giftCardManager *BuiltinGiftCardManager[AccountID]) GetGiftCards(ctx context.Context, giftCards []GiftCard[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]GiftCard[AccountID], error) {
+	return giftCardManager.DB.GetGiftCards(ctx, giftCards, skip, limit, queueOrder)
+}
+
+func (giftCardManager *BuiltinGiftCardManager[AccountID]) Init(ctx context.Context) error {
+	return giftCardManager.DB.InitGiftCardManager(ctx)
+}
+
+// IssueGiftCard issues a gift card without an order, for store credit and promotions.
+// A zero expiresAt never expires.
+func (giftCardManager *BuiltinGiftCardManager[AccountID]) IssueGiftCard(ctx context.Context, owner UserAccount[AccountID], balance Money, expiresAt time.Time) (*GiftCard[AccountID], error) {
+	if !balance.IsPositive() {
+		return nil, errors.New("gift card balance must be positive")
+	}
+	aid, err := owner.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	giftCard := &GiftCard[AccountID]{}
+	if _, err := giftCardManager.DB.NewGiftCard(ctx, aid, balance, expiresAt, giftCard); err != nil {
+		return nil, err
+	}
+	return giftCard, nil
+}
+
+func (giftCardManager *BuiltinGiftCardManager[AccountID]) Pulse(ctx context.Context) error {
+	return nil
+}
+
+func (giftCardManager *BuiltinGiftCardManager[AccountID]) ToBuiltinObject(ctx context.Context) (*BuiltinGiftCardManager[AccountID], error) {
+	return giftCardManager, nil
+}
+
+const GiftCardPaymentGatewayName = "gift_card"
+
+// BuiltinGiftCardPaymentGateway pays the splits carrying a gift card code. Authorize checks the card,
+// Capture takes the amount off its balance atomically and Refund puts it back.
+type BuiltinGiftCardPaymentGateway[AccountID comparable] struct {
+	DB DBGiftCardManager[AccountID]
+}
+
+func NewBuiltinGiftCardPaymentGateway[AccountID comparable](db DBGiftCardManager[AccountID]) *BuiltinGiftCardPaymentGateway[AccountID] {
+	return &BuiltinGiftCardPaymentGateway[AccountID]{
+		DB: db,
+	}
+}
+
+func (gateway *BuiltinGiftCardPaymentGateway[AccountID]) Name() string {
+	return GiftCardPaymentGatewayName
+}
+
+// Authorize resolves the gift card code of the payment into its GiftCardID.
+func (gateway *BuiltinGiftCardPaymentGateway[AccountID]) Authorize(ctx context.Context, payment *OrderPayment[AccountID]) (string, error) {
+	giftCard := GiftCard[AccountID]{}
+	var err error = nil
+	if payment.GiftCardID != 0 {
+		err = gateway.DB.GetGiftCard(ctx, payment.GiftCardID, &giftCard)
+	} else {
+		err = gateway.DB.GetGiftCardByCode(ctx, payment.GiftCardCode, &giftCard)
+	}
+	if errors.Is(err, ErrGiftCardNotFound) {
+		return "", errors.Join(ErrPaymentDeclined, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	if giftCard.IsExpired(time.Now()) {
+		return "", errors.Join(ErrPaymentDeclined, ErrGiftCardExpired)
+	}
+	cmp, err := giftCard.Balance.Cmp(payment.Amount)
+	if err != nil {
+		return "", err
+	}
+	if cmp < 0 {
+		return "", errors.Join(ErrPaymentDeclined, ErrInsufficientFunds)
+	}
+	payment.GiftCardID = giftCard.ID
+	return "gift_card_" + strconv.FormatUint(payment.ID, 10), nil
+}
+
+func (gateway *BuiltinGiftCardPaymentGateway[AccountID]) Capture(ctx context.Context, payment *OrderPayment[AccountID], amount Money) error {
+	_, err := gateway.DB.RedeemGiftCard(ctx, payment.GiftCardID, amount, payment.OrderID, payment.ID)
+	if errors.Is(err, ErrInsufficientFunds) || errors.Is(err, ErrGiftCardExpired) {
+		return errors.Join(ErrPaymentDeclined, err)
+	}
+	return err
+}
+
+func (gateway *BuiltinGiftCardPaymentGateway[AccountID]) Void(ctx context.Context, payment *OrderPayment[AccountID]) error {
+	return nil
+}
+
+func (gateway *BuiltinGiftCardPaymentGateway[AccountID]) Refund(ctx context.Context, payment *OrderPayment[AccountID], amount Money) error {
+	// the refunded amount so far tells the refunds of a payment apart, a retried refund must not credit the card twice
+	_, err := gateway.DB.RefundGiftCard(ctx, payment.GiftCardID, amount, payment.OrderID, payment.ID, payment.RefundedAmount)
+	return err
+}
@@ -0,0 +1,13 @@
+package scommerce
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrIdempotencyKeyReused is returned when the idempotency key of UserShoppingCart.Order, UserAccount.ChargeWallet or
+// UserAccount.TransferCurrency is repeated with other arguments, a repeat with the same arguments returns the original result.
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+
+// DefaultIdempotencyKeyTTL is how long a completed request is remembered when the database doesn't configure it.
+const DefaultIdempotencyKeyTTL = 24 * time.Hour
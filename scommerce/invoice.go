@@ -0,0 +1,114 @@
+package scommerce
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrUnsupportedInvoiceFormat = errors.New("unsupported invoice format")
+
+type InvoiceFormat string
+
+const (
+	InvoiceFormatHTML InvoiceFormat = "html"
+	InvoiceFormatPDF  InvoiceFormat = "pdf"
+)
+
+// InvoiceParty is the seller or the buyer printed on an invoice.
+type InvoiceParty struct {
+	Name         string   `json:"name"`
+	TaxID        string   `json:"tax_id,omitempty"`
+	Email        string   `json:"email,omitempty"`
+	Phone        string   `json:"phone,omitempty"`
+	AddressLines []string `json:"address_lines,omitempty"`
+	City         string   `json:"city,omitempty"`
+	Region       string   `json:"region,omitempty"`
+	PostalCode   string   `json:"postal_code,omitempty"`
+	Country      string   `json:"country,omitempty"`
+	CountryCode  string   `json:"country_code,omitempty"` // ISO 3166-1 alpha-2
+}
+
+// InvoiceTax sums the tax lines of an invoice sharing a name, rate and inclusiveness.
+type InvoiceTax struct {
+	Name          string  `json:"name"`
+	Rate          float64 `json:"rate"`
+	Inclusive     bool    `json:"inclusive"`
+	TaxableAmount Money   `json:"taxable_amount"`
+	Amount        Money   `json:"amount"`
+}
+
+// Invoice is everything printed on the invoice of a factor.
+type Invoice struct {
+	FactorID uint64        `json:"factor_id"`
+	Number   InvoiceNumber `json:"number"`
+	IssuedAt time.Time     `json:"issued_at"`
+	OrderID  uint64        `json:"order_id,omitempty"`
+	Seller   InvoiceParty  `json:"seller"`
+	Buyer    InvoiceParty  `json:"buyer"`
+	Lines    []FactorLine  `json:"lines"`
+	Taxes    []InvoiceTax  `json:"taxes"`
+	TaxLines []TaxLine     `json:"tax_lines"` // the taxes of each product item, Taxes groups them
+	Subtotal Money         `json:"subtotal"`  // unit prices times quantities
+	Discount Money         `json:"discount"`  // discounts of the lines and the shipping
+	Shipping Money         `json:"shipping"`  // shipping cost before its discount
+	Tax      Money         `json:"tax"`
+	Total    Money         `json:"total"`
+}
+
+type InvoiceRenderer interface {
+	RenderInvoice(ctx context.Context, invoice *Invoice, format InvoiceFormat, w io.Writer) error
+}
+
+// newInvoiceTaxes groups tax lines in the order their groups first appear.
+func newInvoiceTaxes(lines []TaxLine) ([]InvoiceTax, error) {
+	totals := invoiceTaxTotals{}
+	for _, line := range lines {
+		if err := totals.add(line); err != nil {
+			return nil, err
+		}
+	}
+	return totals.taxes, nil
+}
+
+type invoiceTaxKey struct {
+	name      string
+	rate      float64
+	inclusive bool
+}
+
+// invoiceTaxTotals sums tax lines sharing a name, rate and inclusiveness.
+type invoiceTaxTotals struct {
+	taxes []InvoiceTax
+	index map[invoiceTaxKey]int
+}
+
+func (totals *invoiceTaxTotals) add(line TaxLine) error {
+	if totals.index == nil {
+		totals.taxes = make([]InvoiceTax, 0)
+		totals.index = make(map[invoiceTaxKey]int)
+	}
+	key := invoiceTaxKey{name: line.Name, rate: line.Rate, inclusive: line.Inclusive}
+	i, ok := totals.index[key]
+	if !ok {
+		i = len(totals.taxes)
+		totals.index[key] = i
+		totals.taxes = append(totals.taxes, InvoiceTax{Name: line.Name, Rate: line.Rate, Inclusive: line.Inclusive})
+	}
+	taxableAmount, err := totals.taxes[i].TaxableAmount.Add(line.TaxableAmount)
+	if err != nil {
+		return err
+	}
+	amount, err := totals.taxes[i].Amount.Add(line.Amount)
+	if err != nil {
+		return err
+	}
+	totals.taxes[i].TaxableAmount = taxableAmount
+	totals.taxes[i].Amount = amount
+	return nil
+}
+
+func invoiceDocumentToken(number InvoiceNumber, format InvoiceFormat) string {
+	return "invoice-" + number.String() + "." + string(format)
+}
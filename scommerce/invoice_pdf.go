@@ -0,0 +1,110 @@
+package scommerce
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Layout of the invoice PDF, an A4 page in points.
+const (
+	invoicePDFPageWidth  = 595
+	invoicePDFPageHeight = 842
+	invoicePDFMargin     = 50
+	invoicePDFFontSize   = 10
+	invoicePDFLeading    = 12
+	invoicePDFLineWidth  = 82 // characters of Courier which fit between the margins
+)
+
+// writeTextPDF lays the lines out on as many pages as they need in Courier. Courier is one of the
+// standard fonts every PDF viewer has, so nothing is embedded and columns line up. Longer lines are
+// wrapped and characters outside of WinAnsiEncoding are printed as '?'.
+func writeTextPDF(w io.Writer, lines []string) error {
+	wrapped := make([]string, 0, len(lines))
+	for _, line := range lines {
+		runes := []rune(strings.TrimRight(line, " \r"))
+		for len(runes) > invoicePDFLineWidth {
+			wrapped = append(wrapped, string(runes[:invoicePDFLineWidth]))
+			runes = runes[invoicePDFLineWidth:]
+		}
+		wrapped = append(wrapped, string(runes))
+	}
+
+	linesPerPage := (invoicePDFPageHeight - 2*invoicePDFMargin) / invoicePDFLeading
+	pages := make([][]string, 0, len(wrapped)/linesPerPage+1)
+	for len(wrapped) > linesPerPage {
+		pages = append(pages, wrapped[:linesPerPage])
+		wrapped = wrapped[linesPerPage:]
+	}
+	pages = append(pages, wrapped)
+
+	// objects 1 to 3 are the catalog, the page tree and the font, page i is object 4+2i and its content 5+2i
+	buf := bytes.Buffer{}
+	offsets := make([]int, 0, 3+2*len(pages))
+	writeObject := func(body []byte) {
+		offsets = append(offsets, buf.Len())
+		buf.WriteString(strconv.Itoa(len(offsets)) + " 0 obj\n")
+		buf.Write(body)
+		buf.WriteString("\nendobj\n")
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	writeObject([]byte("<< /Type /Catalog /Pages 2 0 R >>"))
+	kids := make([]string, 0, len(pages))
+	for i := range pages {
+		kids = append(kids, strconv.Itoa(4+2*i)+" 0 R")
+	}
+	writeObject([]byte("<< /Type /Pages /Kids [" + strings.Join(kids, " ") + "] /Count " + strconv.Itoa(len(pages)) + " >>"))
+	writeObject([]byte("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>"))
+
+	for i, page := range pages {
+		writeObject([]byte(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 " + strconv.Itoa(invoicePDFPageWidth) + " " + strconv.Itoa(invoicePDFPageHeight) + "]" +
+				" /Resources << /Font << /F1 3 0 R >> >> /Contents " + strconv.Itoa(5+2*i) + " 0 R >>",
+		))
+
+		content := bytes.Buffer{}
+		content.WriteString("BT\n/F1 " + strconv.Itoa(invoicePDFFontSize) + " Tf\n" + strconv.Itoa(invoicePDFLeading) + " TL\n")
+		content.WriteString(strconv.Itoa(invoicePDFMargin) + " " + strconv.Itoa(invoicePDFPageHeight-invoicePDFMargin-invoicePDFFontSize) + " Td\n")
+		for _, line := range page {
+			content.WriteByte('(')
+			content.Write(pdfString(line))
+			content.WriteString(") Tj T*\n")
+		}
+		content.WriteString("ET")
+
+		stream := append([]byte("<< /Length "+strconv.Itoa(content.Len())+" >>\nstream\n"), content.Bytes()...)
+		writeObject(append(stream, "\nendstream"...))
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n0 " + strconv.Itoa(len(offsets)+1) + "\n0000000000 65535 f \n")
+	for _, offset := range offsets {
+		digits := strconv.Itoa(offset)
+		buf.WriteString(strings.Repeat("0", 10-len(digits)) + digits + " 00000 n \n")
+	}
+	buf.WriteString("trailer\n<< /Size " + strconv.Itoa(len(offsets)+1) + " /Root 1 0 R >>\nstartxref\n" + strconv.Itoa(xref) + "\n%%EOF\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pdfString encodes text in WinAnsiEncoding, which matches Latin-1 for the characters it keeps, escaping the string delimiters.
+func pdfString(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			encoded = append(encoded, '\\', byte(r))
+		case r == '\t':
+			encoded = append(encoded, ' ')
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		case r < 0x20:
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
@@ -0,0 +1,212 @@
+package scommerce
+
+import (
+	"bytes"
+	"context"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+)
+
+var _ InvoiceRenderer = &BuiltinInvoiceRenderer{}
+
+// DefaultInvoiceHTMLTemplate is executed with an *Invoice. It defines a "party" template for the seller and the buyer.
+const DefaultInvoiceHTMLTemplate = `{{define "party"}}<strong>{{.Name}}</strong>{{range .AddressLines}}<br>{{.}}{{end}}{{with cityLine .}}<br>{{.}}{{end}}{{with .Country}}<br>{{.}}{{end}}{{with .TaxID}}<br>Tax ID: {{.}}{{end}}{{with .Email}}<br>{{.}}{{end}}{{with .Phone}}<br>{{.}}{{end}}{{end}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; color: #222; margin: 40px; }
+table { border-collapse: collapse; width: 100%; margin-top: 16px; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.amount { text-align: right; white-space: nowrap; }
+.parties { display: flex; justify-content: space-between; margin: 24px 0; }
+.totals { width: auto; margin-left: auto; }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Number}}</h1>
+<p>Date: {{date .IssuedAt}}{{if .OrderID}}<br>Order: #{{.OrderID}}{{end}}</p>
+<div class="parties">
+<div>{{template "party" .Seller}}</div>
+<div>Bill to<br>{{template "party" .Buyer}}</div>
+</div>
+<table>
+<thead>
+<tr><th>SKU</th><th>Item</th><th class="amount">Unit price</th><th class="amount">Quantity</th><th class="amount">Discount</th><th class="amount">Tax</th><th class="amount">Total</th></tr>
+</thead>
+<tbody>
+{{range .Lines}}<tr><td>{{.SKU}}</td><td>{{.Name}}</td><td class="amount">{{money .UnitPrice}}</td><td class="amount">{{.Quantity}}</td><td class="amount">{{money .Discount}}</td><td class="amount">{{money .Tax}}</td><td class="amount">{{money .Total}}</td></tr>
+{{end}}</tbody>
+</table>
+{{if .Taxes}}<table>
+<thead>
+<tr><th>Tax</th><th class="amount">Rate</th><th class="amount">Taxable amount</th><th class="amount">Amount</th></tr>
+</thead>
+<tbody>
+{{range .Taxes}}<tr><td>{{.Name}}{{if .Inclusive}} (included){{end}}</td><td class="amount">{{percent .Rate}}</td><td class="amount">{{money .TaxableAmount}}</td><td class="amount">{{money .Amount}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}<table class="totals">
+<tr><td>Subtotal</td><td class="amount">{{money .Subtotal}}</td></tr>
+<tr><td>Discount</td><td class="amount">{{money .Discount}}</td></tr>
+<tr><td>Shipping</td><td class="amount">{{money .Shipping}}</td></tr>
+<tr><td>Tax</td><td class="amount">{{money .Tax}}</td></tr>
+<tr><th>Total</th><th class="amount">{{money .Total}}</th></tr>
+</table>
+</body>
+</html>
+`
+
+// DefaultInvoiceTextTemplate is executed with an *Invoice, its lines are laid out in a monospaced font for the PDF.
+const DefaultInvoiceTextTemplate = `{{define "party"}}{{.Name}}
+{{range .AddressLines}}{{.}}
+{{end}}{{with cityLine .}}{{.}}
+{{end}}{{with .Country}}{{.}}
+{{end}}{{with .TaxID}}Tax ID: {{.}}
+{{end}}{{with .Email}}{{.}}
+{{end}}{{with .Phone}}{{.}}
+{{end}}{{end}}INVOICE {{.Number}}
+Date: {{date .IssuedAt}}{{if .OrderID}}    Order: #{{.OrderID}}{{end}}
+
+{{template "party" .Seller}}
+Bill to:
+{{template "party" .Buyer}}
+Amounts in {{.Total.Currency}}
+
+{{pad "Item" 28}} {{padLeft "Qty" 4}} {{padLeft "Unit price" 11}} {{padLeft "Discount" 11}} {{padLeft "Tax" 10}} {{padLeft "Total" 12}}
+{{rule 81}}
+{{range .Lines}}{{pad .Name 28}} {{padLeft (print .Quantity) 4}} {{padLeft (amount .UnitPrice) 11}} {{padLeft (amount .Discount) 11}} {{padLeft (amount .Tax) 10}} {{padLeft (amount .Total) 12}}
+{{with .SKU}}  SKU {{.}}
+{{end}}{{end}}{{rule 81}}
+{{if .Taxes}}
+{{pad "Tax" 28}} {{padLeft "Rate" 8}}       {{padLeft "Taxable amount" 16}} {{padLeft "Amount" 16}}
+{{range .Taxes}}{{pad .Name 28}} {{padLeft (percent .Rate) 8}} {{if .Inclusive}}incl.{{else}}     {{end}} {{padLeft (amount .TaxableAmount) 16}} {{padLeft (amount .Amount) 16}}
+{{end}}{{end}}
+{{padLeft "Subtotal" 56}} {{padLeft (amount .Subtotal) 24}}
+{{padLeft "Discount" 56}} {{padLeft (amount .Discount) 24}}
+{{padLeft "Shipping" 56}} {{padLeft (amount .Shipping) 24}}
+{{padLeft "Tax" 56}} {{padLeft (amount .Tax) 24}}
+{{padLeft "Total" 56}} {{padLeft (money .Total) 24}}
+`
+
+// BuiltinInvoiceRenderer renders HTML with HTMLTemplate and PDF from the output of TextTemplate.
+// Both are executed with an *Invoice and can use the functions of InvoiceTemplateFuncs.
+type BuiltinInvoiceRenderer struct {
+	HTMLTemplate *htmltemplate.Template
+	TextTemplate *texttemplate.Template
+	MU           sync.RWMutex
+}
+
+func NewBuiltinInvoiceRenderer() *BuiltinInvoiceRenderer {
+	return &BuiltinInvoiceRenderer{
+		HTMLTemplate: htmltemplate.Must(htmltemplate.New("invoice").Funcs(InvoiceTemplateFuncs()).Parse(DefaultInvoiceHTMLTemplate)),
+		TextTemplate: texttemplate.Must(texttemplate.New("invoice").Funcs(InvoiceTemplateFuncs()).Parse(DefaultInvoiceTextTemplate)),
+	}
+}
+
+// InvoiceTemplateFuncs are available to the invoice templates:
+// money and amount format Money with and without the currency, date formats a time as 2006-01-02,
+// percent formats a rate like 0.09 as 9%, cityLine joins the postal code, city and region of a party,
+// pad and padLeft align text in a column, cutting it to the width, and rule draws a line of dashes.
+func InvoiceTemplateFuncs() map[string]any {
+	return map[string]any{
+		"money": func(money Money) string {
+			return money.String()
+		},
+		"amount": func(money Money) string {
+			return money.Decimal()
+		},
+		"date": func(t time.Time) string {
+			return t.Format(time.DateOnly)
+		},
+		"percent": func(rate float64) string {
+			return formatRatePercent(rate) + "%"
+		},
+		"cityLine": func(party InvoiceParty) string {
+			parts := make([]string, 0, 2)
+			if city := strings.TrimSpace(party.PostalCode + " " + party.City); city != "" {
+				parts = append(parts, city)
+			}
+			if party.Region != "" {
+				parts = append(parts, party.Region)
+			}
+			return strings.Join(parts, ", ")
+		},
+		"pad": func(text string, width int) string {
+			return padInvoiceColumn(text, width, false)
+		},
+		"padLeft": func(text string, width int) string {
+			return padInvoiceColumn(text, width, true)
+		},
+		"rule": func(width int) string {
+			return strings.Repeat("-", width)
+		},
+	}
+}
+
+// formatRatePercent formats a rate like 0.09 as 9, rounding away the float noise of multiplying by 100.
+func formatRatePercent(rate float64) string {
+	return strconv.FormatFloat(math.Round(rate*1e6)/1e4, 'f', -1, 64)
+}
+
+func padInvoiceColumn(text string, width int, right bool) string {
+	length := utf8.RuneCountInString(text)
+	if length > width {
+		return string([]rune(text)[:width])
+	}
+	if right {
+		return strings.Repeat(" ", width-length) + text
+	}
+	return text + strings.Repeat(" ", width-length)
+}
+
+// SetHTMLTemplate replaces the HTML template, InvoiceTemplateFuncs are available to it.
+func (renderer *BuiltinInvoiceRenderer) SetHTMLTemplate(text string) error {
+	tmpl, err := htmltemplate.New("invoice").Funcs(InvoiceTemplateFuncs()).Parse(text)
+	if err != nil {
+		return err
+	}
+	renderer.MU.Lock()
+	defer renderer.MU.Unlock()
+	renderer.HTMLTemplate = tmpl
+	return nil
+}
+
+// SetTextTemplate replaces the template of the PDF, InvoiceTemplateFuncs are available to it.
+func (renderer *BuiltinInvoiceRenderer) SetTextTemplate(text string) error {
+	tmpl, err := texttemplate.New("invoice").Funcs(InvoiceTemplateFuncs()).Parse(text)
+	if err != nil {
+		return err
+	}
+	renderer.MU.Lock()
+	defer renderer.MU.Unlock()
+	renderer.TextTemplate = tmpl
+	return nil
+}
+
+func (renderer *BuiltinInvoiceRenderer) RenderInvoice(ctx context.Context, invoice *Invoice, format InvoiceFormat, w io.Writer) error {
+	renderer.MU.RLock()
+	htmlTemplate := renderer.HTMLTemplate
+	textTemplate := renderer.TextTemplate
+	renderer.MU.RUnlock()
+
+	switch format {
+	case InvoiceFormatHTML:
+		return htmlTemplate.Execute(w, invoice)
+	case InvoiceFormatPDF:
+		text := bytes.Buffer{}
+		if err := textTemplate.Execute(&text, invoice); err != nil {
+			return err
+		}
+		return writeTextPDF(w, strings.Split(strings.TrimRight(text.String(), "\n"), "\n"))
+	}
+	return ErrUnsupportedInvoiceFormat
+}
@@ -0,0 +1,172 @@
+package scommerce
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// currencyExponents lists the ISO 4217 currencies which don't have two minor unit digits.
+var currencyExponents = map[string]int32{
+	"BHD": 3, "BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "IQD": 3, "ISK": 0, "JOD": 3,
+	"JPY": 0, "KMF": 0, "KRW": 0, "KWD": 3, "LYD": 3, "OMR": 3, "PYG": 0, "RWF": 0,
+	"TND": 3, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// CurrencyExponent returns the number of minor unit digits of an ISO 4217 currency code.
+func CurrencyExponent(currency string) int32 {
+	if exponent, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// Money is an exact amount in minor units (cents for USD) of a currency.
+// An empty currency is a zero value which adopts the currency of the other operand.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{
+		Amount:   amount,
+		Currency: strings.ToUpper(currency),
+	}
+}
+
+// ParseMoney parses a decimal major unit amount like "12.50" into money of the currency.
+func ParseMoney(amount string, currency string) (Money, error) {
+	exponent := CurrencyExponent(currency)
+	text := strings.TrimSpace(amount)
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimLeft(text, "+-")
+	whole, fraction, _ := strings.Cut(text, ".")
+	if whole == "" && fraction == "" {
+		return Money{}, errors.New("invalid money amount '" + amount + "'")
+	}
+	if int32(len(fraction)) > exponent {
+		return Money{}, errors.New("money amount '" + amount + "' has more than " + strconv.Itoa(int(exponent)) + " fraction digits")
+	}
+	fraction += strings.Repeat("0", int(exponent)-len(fraction))
+	minor, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, errors.New("invalid money amount '" + amount + "'")
+	}
+	if negative {
+		minor = -minor
+	}
+	return NewMoney(minor, currency), nil
+}
+
+func (money Money) Exponent() int32 {
+	return CurrencyExponent(money.Currency)
+}
+
+func (money Money) IsZero() bool {
+	return money.Amount == 0
+}
+
+func (money Money) IsNegative() bool {
+	return money.Amount < 0
+}
+
+func (money Money) IsPositive() bool {
+	return money.Amount > 0
+}
+
+func (money Money) SameCurrency(other Money) bool {
+	return money.Currency == "" || other.Currency == "" || strings.EqualFold(money.Currency, other.Currency)
+}
+
+func (money Money) currencyWith(other Money) (string, error) {
+	if !money.SameCurrency(other) {
+		return "", errors.Join(ErrCurrencyMismatch, errors.New("can't combine "+money.Currency+" with "+other.Currency))
+	}
+	if money.Currency == "" {
+		return other.Currency, nil
+	}
+	return money.Currency, nil
+}
+
+func (money Money) Add(other Money) (Money, error) {
+	currency, err := money.currencyWith(other)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: money.Amount + other.Amount, Currency: currency}, nil
+}
+
+func (money Money) Sub(other Money) (Money, error) {
+	currency, err := money.currencyWith(other)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: money.Amount - other.Amount, Currency: currency}, nil
+}
+
+// Equal reports whether money and other are the same amount of the same currency, whatever the currency casing.
+func (money Money) Equal(other Money) bool {
+	return money.Amount == other.Amount && money.SameCurrency(other)
+}
+
+// Cmp returns -1, 0 or +1 when money is less than, equal to or greater than other.
+func (money Money) Cmp(other Money) (int, error) {
+	if _, err := money.currencyWith(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case money.Amount < other.Amount:
+		return -1, nil
+	case money.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (money Money) Mul(quantity int64) Money {
+	return Money{Amount: money.Amount * quantity, Currency: money.Currency}
+}
+
+// MulRate multiplies money by a rate, rounding half away from zero to the nearest minor unit.
+func (money Money) MulRate(rate float64) Money {
+	return Money{Amount: int64(math.Round(float64(money.Amount) * rate)), Currency: money.Currency}
+}
+
+func (money Money) Neg() Money {
+	return Money{Amount: -money.Amount, Currency: money.Currency}
+}
+
+func (money Money) Abs() Money {
+	if money.Amount < 0 {
+		return money.Neg()
+	}
+	return money
+}
+
+// Decimal formats the amount in major units, "12.50" for 1250 USD.
+func (money Money) Decimal() string {
+	exponent := int(money.Exponent())
+	sign := ""
+	if money.Amount < 0 {
+		sign = "-"
+	}
+	digits := strconv.FormatUint(uint64(money.Abs().Amount), 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+func (money Money) String() string {
+	if money.Currency == "" {
+		return money.Decimal()
+	}
+	return money.Decimal() + " " + money.Currency
+}
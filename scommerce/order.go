@@ -3,6 +3,9 @@ package scommerce
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,6 +13,12 @@ import (
 var _ UserOrderManager[any] = &BuiltinUserOrderManager[any]{}
 var _ UserOrder[any] = &BuiltinUserOrder[any]{}
 
+// DefaultPendingPaymentTimeout is how long an order waits for its payment before Pulse cancels it.
+const DefaultPendingPaymentTimeout = time.Hour
+
+const unpaidOrderCancelReason = "payment not received in time"
+const unpaidOrderBatchSize = 100
+
 type userOrderDatabase[AccountID comparable] interface {
 	DBUserOrder[AccountID]
 	userAddressDatabase[AccountID]
@@ -25,9 +34,11 @@ type userOrderManagerDatabase[AccountID comparable] interface {
 }
 
 type BuiltinUserOrderManager[AccountID comparable] struct {
-	DB                 userOrderManagerDatabase[AccountID]
-	FS                 FileStorage
-	OrderStatusManager OrderStatusManager
+	DB                    userOrderManagerDatabase[AccountID]
+	FS                    FileStorage
+	OrderStatusManager    OrderStatusManager
+	PaymentGateways       PaymentGatewayRegistry[AccountID]
+	PendingPaymentTimeout time.Duration // orders pending payment for longer are cancelled by Pulse
 }
 
 type UserOrderProductItem[AccountID comparable] struct {
@@ -39,11 +50,11 @@ type UserOrderProductItem[AccountID comparable] struct {
 type UserOrderForm[AccountID comparable] struct {
 	ID                uint64                               `json:"id"`
 	UserAccountID     AccountID                            `json:"account_id"`
-	TotalPrice        *float64                             `json:"total_price,omitempty"`
+	TotalPrice        *Money                               `json:"total_price,omitempty"`
 	DeliveryComment   *string                              `json:"delivery_comment,omitempty"`
 	DeliveryDate      *time.Time                           `json:"delivery_date,omitempty"`
 	Date              *time.Time                           `json:"date,omitempty"`
-	Total             *float64                             `json:"total,omitempty"`
+	Total             *Money                               `json:"total,omitempty"`
 	PaymentMethod     *BuiltinUserPaymentMethod[AccountID] `json:"payment_method,omitempty"`
 	ProductItemCount  *uint64                              `json:"product_item_count,omitempty"`
 	ShippingAddress   *BuiltinUserAddress[AccountID]       `json:"shipping_address,omitempty"`
@@ -51,21 +62,28 @@ type UserOrderForm[AccountID comparable] struct {
 	Status            *BuiltinOrderStatus                  `json:"status,omitempty"`
 	UserComment       *string                              `json:"user_comment,omitempty"`
 	IsDeliveriedState *bool                                `json:"is_deliveried,omitempty"`
+	Promotions        *[]PromotionLine                     `json:"promotions,omitempty"`
 }
 
 type BuiltinUserOrder[AccountID comparable] struct {
 	UserOrderForm[AccountID]
-	OrderStatusManager OrderStatusManager           `json:"-"`
-	DB                 userOrderDatabase[AccountID] `json:"-"`
-	FS                 FileStorage                  `json:"-"`
-	MU                 sync.RWMutex                 `json:"-"`
+	OrderStatusManager OrderStatusManager                `json:"-"`
+	PaymentGateways    PaymentGatewayRegistry[AccountID] `json:"-"`
+	DB                 userOrderDatabase[AccountID]      `json:"-"`
+	FS                 FileStorage                       `json:"-"`
+	MU                 sync.RWMutex                      `json:"-"`
 }
 
-func NewBuiltinUserOrderManager[AccountID comparable](db userOrderManagerDatabase[AccountID], osm OrderStatusManager, fs FileStorage) *BuiltinUserOrderManager[AccountID] {
+func NewBuiltinUserOrderManager[AccountID comparable](db userOrderManagerDatabase[AccountID], osm OrderStatusManager, fs FileStorage, paymentGateways PaymentGatewayRegistry[AccountID], pendingPaymentTimeout time.Duration) *BuiltinUserOrderManager[AccountID] {
+	if pendingPaymentTimeout == 0 {
+		pendingPaymentTimeout = DefaultPendingPaymentTimeout
+	}
 	return &BuiltinUserOrderManager[AccountID]{
-		DB:                 db,
-		FS:                 fs,
-		OrderStatusManager: osm,
+		DB:                    db,
+		FS:                    fs,
+		OrderStatusManager:    osm,
+		PaymentGateways:       paymentGateways,
+		PendingPaymentTimeout: pendingPaymentTimeout,
 	}
 }
 
@@ -99,6 +117,7 @@ func (orderManager *BuiltinUserOrderManager[AccountID]) newUserOrder(ctx context
 		DB:                 db,
 		FS:                 orderManager.FS,
 		OrderStatusManager: orderManager.OrderStatusManager,
+		PaymentGateways:    orderManager.PaymentGateways,
 	}
 	if err := order.Init(ctx); err != nil {
 		return nil, err
@@ -139,7 +158,42 @@ func (orderManager *BuiltinUserOrderManager[AccountID]) Init(ctx context.Context
 }
 
 func (orderManager *BuiltinUserOrderManager[AccountID]) Pulse(ctx context.Context) error {
-	return nil
+	return orderManager.CancelUnpaidOrders(ctx)
+}
+
+// CancelUnpaidOrders cancels the orders pending payment for longer than the pending payment timeout, which puts their
+// items back in stock and gives back their discount codes. Orders with a payment in progress are skipped, a negative
+// timeout keeps unpaid orders.
+func (orderManager *BuiltinUserOrderManager[AccountID]) CancelUnpaidOrders(ctx context.Context) error {
+	if orderManager.PendingPaymentTimeout < 0 {
+		return nil
+	}
+	var errRes error = nil
+	orderedBefore := time.Now().Add(-orderManager.PendingPaymentTimeout)
+	ids := make([]DBUserOrderResult[AccountID], 0, unpaidOrderBatchSize)
+	var afterID uint64 = 0
+	for {
+		var err error = nil
+		ids, err = orderManager.DB.GetUnpaidUserOrders(ctx, orderedBefore, afterID, ids[:0], unpaidOrderBatchSize)
+		if err != nil {
+			return joinErr(errRes, err)
+		}
+		for _, res := range ids {
+			// advance before anything can fail, a failing order must not be fetched again
+			afterID = res.ID
+			order, err := orderManager.newUserOrder(ctx, res.ID, res.AID, orderManager.DB, nil)
+			if err != nil {
+				errRes = joinErr(errRes, err)
+				continue
+			}
+			if err := order.Cancel(ctx, unpaidOrderCancelReason); err != nil && !errors.Is(err, ErrPaymentInProgress) {
+				errRes = joinErr(errRes, err)
+			}
+		}
+		if len(ids) < unpaidOrderBatchSize {
+			return errRes
+		}
+	}
 }
 
 func (orderManager *BuiltinUserOrderManager[AccountID]) RemoveAllUserOrders(ctx context.Context) error {
@@ -150,7 +204,7 @@ func (orderManager *BuiltinUserOrderManager[AccountID]) ToBuiltinObject(ctx cont
 	return orderManager, nil
 }
 
-func (order *BuiltinUserOrder[AccountID]) CalculateTotalPrice(ctx context.Context) (float64, error) {
+func (order *BuiltinUserOrder[AccountID]) CalculateTotalPrice(ctx context.Context) (Money, error) {
 	order.MU.RLock()
 	if order.TotalPrice != nil {
 		defer order.MU.RUnlock()
@@ -159,18 +213,18 @@ func (order *BuiltinUserOrder[AccountID]) CalculateTotalPrice(ctx context.Contex
 	order.MU.RUnlock()
 	id, err := order.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := order.UserOrderForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	price, err := order.DB.CalculateUserOrderTotalPrice(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := order.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	order.MU.Lock()
 	defer order.MU.Unlock()
@@ -178,6 +232,71 @@ func (order *BuiltinUserOrder[AccountID]) CalculateTotalPrice(ctx context.Contex
 	return price, nil
 }
 
+// Cancel refunds everything paid for an order which isn't delivered, puts its items back in stock, gives back its
+// discount code and issues a credit note for the refunded amount. The order moves to the cancelled status.
+func (order *BuiltinUserOrder[AccountID]) Cancel(ctx context.Context, reason string) error {
+	statusName, err := order.claimPayments(ctx)
+	if err != nil {
+		return err
+	}
+	err = order.cancel(ctx, statusName, reason)
+	return errors.Join(err, order.releasePayments(ctx))
+}
+
+func (order *BuiltinUserOrder[AccountID]) cancel(ctx context.Context, statusName string, reason string) error {
+	if statusName == OrderStatusCancelled {
+		return ErrOrderCancelled
+	}
+	delivered, err := order.IsDeliveried(ctx)
+	if err != nil {
+		return err
+	}
+	if delivered {
+		return ErrOrderDelivered
+	}
+	if err := order.checkStatusTransition(ctx, OrderStatusCancelled); err != nil {
+		return err
+	}
+	creditNote := &CreditNote[AccountID]{
+		Reason: reason,
+	}
+	if err := order.issueCreditNote(ctx, creditNote, true); err != nil {
+		return err
+	}
+	return order.setStatusName(ctx, OrderStatusCancelled, reason)
+}
+
+// ChangeStatus moves the order to status when the order status manager allows the transition, otherwise it fails with
+// ErrInvalidOrderStatusTransition. The change is recorded in the status history with actor and note.
+func (order *BuiltinUserOrder[AccountID]) ChangeStatus(ctx context.Context, status OrderStatus, actor string, note string) error {
+	sid, err := status.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := order.DB.SetUserOrderStatus(ctx, &form, id, sid, actor, note); err != nil {
+		return err
+	}
+	if err := order.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	stat, err := status.ToBuiltinObject(ctx)
+	if err != nil {
+		return err
+	}
+	order.MU.Lock()
+	defer order.MU.Unlock()
+	order.Status = stat
+	return nil
+}
+
 func (order *BuiltinUserOrder[AccountID]) Close(ctx context.Context) error {
 	return nil
 }
@@ -222,6 +341,70 @@ func (order *BuiltinUserOrder[AccountID]) Deliver(ctx context.Context, date time
 	return nil
 }
 
+// GetAmountDue returns the part of the order total which isn't captured yet.
+func (order *BuiltinUserOrder[AccountID]) GetAmountDue(ctx context.Context) (Money, error) {
+	total, err := order.GetOrderTotal(ctx)
+	if err != nil {
+		return Money{}, err
+	}
+	payments, err := order.GetPayments(ctx, nil)
+	if err != nil {
+		return Money{}, err
+	}
+	due := total
+	for _, payment := range payments {
+		if payment.CapturedAmount.IsZero() {
+			continue
+		}
+		due, err = due.Sub(payment.CapturedAmount)
+		if err != nil {
+			return Money{}, err
+		}
+	}
+	if due.IsNegative() {
+		return NewMoney(0, due.Currency), nil
+	}
+	return due, nil
+}
+
+func (order *BuiltinUserOrder[AccountID]) GetCreditNotes(ctx context.Context, creditNotes []CreditNote[AccountID]) ([]CreditNote[AccountID], error) {
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	creditNotes, err = order.DB.GetUserOrderCreditNotes(ctx, &form, id, creditNotes)
+	if err != nil {
+		return nil, err
+	}
+	if err := order.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	return creditNotes, nil
+}
+
+func (order *BuiltinUserOrder[AccountID]) GetGiftCards(ctx context.Context, giftCards []GiftCard[AccountID]) ([]GiftCard[AccountID], error) {
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	giftCards, err = order.DB.GetUserOrderGiftCards(ctx, &form, id, giftCards)
+	if err != nil {
+		return nil, err
+	}
+	if err := order.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	return giftCards, nil
+}
+
 func (order *BuiltinUserOrder[AccountID]) GetDeliveryComment(ctx context.Context) (string, error) {
 	order.MU.RLock()
 	if order.DeliveryComment != nil {
@@ -309,7 +492,7 @@ func (order *BuiltinUserOrder[AccountID]) GetOrderDate(ctx context.Context) (tim
 	return date, nil
 }
 
-func (order *BuiltinUserOrder[AccountID]) GetOrderTotal(ctx context.Context) (float64, error) {
+func (order *BuiltinUserOrder[AccountID]) GetOrderTotal(ctx context.Context) (Money, error) {
 	order.MU.RLock()
 	if order.Total != nil {
 		defer order.MU.RUnlock()
@@ -318,18 +501,18 @@ func (order *BuiltinUserOrder[AccountID]) GetOrderTotal(ctx context.Context) (fl
 	order.MU.RUnlock()
 	id, err := order.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := order.UserOrderForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	total, err := order.DB.GetUserOrderTotal(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := order.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	order.MU.Lock()
 	defer order.MU.Unlock()
@@ -383,6 +566,25 @@ func (order *BuiltinUserOrder[AccountID]) GetPaymentMethod(ctx context.Context)
 	return method, nil
 }
 
+func (order *BuiltinUserOrder[AccountID]) GetPayments(ctx context.Context, payments []OrderPayment[AccountID]) ([]OrderPayment[AccountID], error) {
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payments, err = order.DB.GetUserOrderPayments(ctx, &form, id, payments)
+	if err != nil {
+		return nil, err
+	}
+	if err := order.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
 func (order *BuiltinUserOrder[AccountID]) GetProductItemCount(ctx context.Context) (uint64, error) {
 	order.MU.RLock()
 	if order.ProductItemCount != nil {
@@ -466,6 +668,35 @@ func (order *BuiltinUserOrder[AccountID]) GetProductItems(ctx context.Context, i
 	return itms, nil
 }
 
+// GetPromotions returns the automatic promotions applied when the order was placed.
+func (order *BuiltinUserOrder[AccountID]) GetPromotions(ctx context.Context) ([]PromotionLine, error) {
+	order.MU.RLock()
+	if order.Promotions != nil {
+		defer order.MU.RUnlock()
+		return *order.Promotions, nil
+	}
+	order.MU.RUnlock()
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	promotions, err := order.DB.GetUserOrderPromotions(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := order.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	order.MU.Lock()
+	defer order.MU.Unlock()
+	order.Promotions = &promotions
+	return promotions, nil
+}
+
 func (order *BuiltinUserOrder[AccountID]) GetShippingAddress(ctx context.Context) (UserAddress[AccountID], error) {
 	order.MU.RLock()
 	if order.ShippingAddress != nil {
@@ -594,6 +825,25 @@ func (order *BuiltinUserOrder[AccountID]) GetStatus(ctx context.Context) (OrderS
 	return status, nil
 }
 
+func (order *BuiltinUserOrder[AccountID]) GetStatusHistory(ctx context.Context, history []OrderStatusChange) ([]OrderStatusChange, error) {
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	history, err = order.DB.GetUserOrderStatusHistory(ctx, &form, id, history)
+	if err != nil {
+		return nil, err
+	}
+	if err := order.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
 func (order *BuiltinUserOrder[AccountID]) GetUserAccountID(ctx context.Context) (AccountID, error) {
 	order.MU.RLock()
 	defer order.MU.RUnlock()
@@ -660,10 +910,535 @@ func (order *BuiltinUserOrder[AccountID]) IsDeliveried(ctx context.Context) (boo
 	return state, nil
 }
 
+// Pay captures the amount due of an order pending payment. The splits are charged first, each up to its amount,
+// and paymentMethod pays the rest through the gateway of its payment type, a nil paymentMethod pays from the wallet.
+// All payments are authorized before any is captured, if one fails the others are voided or refunded.
+// A declined payment returns *PaymentDeclinedError and leaves the order pending payment.
+// The payments of the order are claimed first, a concurrent Pay, Refund or Cancel fails with ErrPaymentInProgress.
+// The order moves to the paid status once nothing is due, then the gift cards it bought are issued.
+func (order *BuiltinUserOrder[AccountID]) Pay(ctx context.Context, paymentMethod UserPaymentMethod[AccountID], splits ...PaymentSplit[AccountID]) error {
+	if order.PaymentGateways == nil {
+		return errors.Join(ErrPaymentGatewayNotFound, errors.New("order has no payment gateways"))
+	}
+	statusName, err := order.claimPayments(ctx)
+	if err != nil {
+		return err
+	}
+	err = order.pay(ctx, statusName, paymentMethod, splits)
+	return errors.Join(err, order.releasePayments(ctx))
+}
+
+func (order *BuiltinUserOrder[AccountID]) pay(ctx context.Context, statusName string, paymentMethod UserPaymentMethod[AccountID], splits []PaymentSplit[AccountID]) error {
+	if statusName == OrderStatusCancelled {
+		return ErrOrderCancelled
+	}
+	if statusName != OrderStatusPendingPayment {
+		return ErrOrderAlreadyPaid
+	}
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	aid, err := order.GetUserAccountID(ctx)
+	if err != nil {
+		return err
+	}
+	due, err := order.GetAmountDue(ctx)
+	if err != nil {
+		return err
+	}
+
+	legs := make([]orderPaymentLeg[AccountID], 0, len(splits)+1)
+	addLeg := func(paymentMethod UserPaymentMethod[AccountID], giftCardCode string, amount Money) error {
+		gateway, pmid, err := order.getPaymentGateway(ctx, paymentMethod, giftCardCode)
+		if err != nil {
+			return err
+		}
+		legs = append(legs, orderPaymentLeg[AccountID]{
+			Gateway: gateway,
+			Payment: &OrderPayment[AccountID]{
+				OrderID:         id,
+				AccountID:       aid,
+				PaymentMethodID: pmid,
+				GiftCardCode:    giftCardCode,
+				Gateway:         gateway.Name(),
+				Amount:          amount,
+				CapturedAmount:  NewMoney(0, amount.Currency),
+				RefundedAmount:  NewMoney(0, amount.Currency),
+				Status:          PaymentStatusPending,
+			},
+		})
+		due, err = due.Sub(amount)
+		return err
+	}
+	for _, split := range splits {
+		if !due.IsPositive() {
+			break
+		}
+		amount := split.Amount
+		cmp, err := amount.Cmp(due)
+		if err != nil {
+			return err
+		}
+		if cmp > 0 {
+			amount = due
+		}
+		if !amount.IsPositive() {
+			continue
+		}
+		if err := addLeg(split.PaymentMethod, split.GiftCardCode, amount); err != nil {
+			return err
+		}
+	}
+	if due.IsPositive() {
+		if err := addLeg(paymentMethod, "", due); err != nil {
+			return err
+		}
+	}
+
+	if err := order.capturePayments(ctx, legs); err != nil {
+		return err
+	}
+	if err := order.setStatusName(ctx, OrderStatusPaid, ""); err != nil {
+		return err
+	}
+	_, err = order.IssueGiftCards(ctx)
+	return err
+}
+
+// claimPayments locks the order and claims its payments, so no other Pay, Refund or Cancel moves money for it
+// until releasePayments. It returns the status the order has under the lock and caches it.
+func (order *BuiltinUserOrder[AccountID]) claimPayments(ctx context.Context) (string, error) {
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return "", err
+	}
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return "", err
+	}
+	statusForm := OrderStatusForm{}
+	sid, err := order.DB.ClaimUserOrderPayments(ctx, &form, id, time.Now().Add(OrderPaymentClaimTimeout), &statusForm)
+	if err != nil {
+		return "", err
+	}
+	if err := order.ApplyFormObject(ctx, &form); err != nil {
+		return "", errors.Join(err, order.releasePayments(ctx))
+	}
+	status := &BuiltinOrderStatus{
+		DB: order.DB,
+		OrderStatusForm: OrderStatusForm{
+			ID: sid,
+		},
+	}
+	if err := status.Init(ctx); err != nil {
+		return "", errors.Join(err, order.releasePayments(ctx))
+	}
+	if err := status.ApplyFormObject(ctx, &statusForm); err != nil {
+		return "", errors.Join(err, order.releasePayments(ctx))
+	}
+	order.MU.Lock()
+	order.Status = status
+	order.IsDeliveriedState = nil
+	order.MU.Unlock()
+	if statusForm.Name == nil {
+		return "", nil
+	}
+	return *statusForm.Name, nil
+}
+
+func (order *BuiltinUserOrder[AccountID]) releasePayments(ctx context.Context) error {
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := order.DB.ReleaseUserOrderPayments(ctx, &form, id); err != nil {
+		return err
+	}
+	return order.ApplyFormObject(ctx, &form)
+}
+
+type orderPaymentLeg[AccountID comparable] struct {
+	Gateway PaymentGateway[AccountID]
+	Payment *OrderPayment[AccountID]
+}
+
+func (order *BuiltinUserOrder[AccountID]) getPaymentGateway(ctx context.Context, paymentMethod UserPaymentMethod[AccountID], giftCardCode string) (PaymentGateway[AccountID], uint64, error) {
+	if giftCardCode != "" {
+		gateway, err := order.PaymentGateways.GetPaymentGateway(ctx, GiftCardPaymentGatewayName)
+		return gateway, 0, err
+	}
+	if paymentMethod == nil {
+		gateway, err := order.PaymentGateways.GetPaymentGateway(ctx, WalletPaymentGatewayName)
+		return gateway, 0, err
+	}
+	pmid, err := paymentMethod.GetID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	paymentType, err := paymentMethod.GetPaymentType(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	typeName, err := paymentType.GetName(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	gateway, err := order.PaymentGateways.GetPaymentGatewayForType(ctx, typeName)
+	if err != nil {
+		return nil, 0, err
+	}
+	return gateway, pmid, nil
+}
+
+// capturePayments records and authorizes every payment and then captures them. When a step fails
+// the legs which already went through are voided or refunded. Every step is saved on the payments.
+func (order *BuiltinUserOrder[AccountID]) capturePayments(ctx context.Context, legs []orderPaymentLeg[AccountID]) error {
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	for i, leg := range legs {
+		form, err := order.UserOrderForm.Clone(ctx)
+		if err != nil {
+			return errors.Join(err, order.rollbackPayments(ctx, legs[:i]))
+		}
+		if _, err := order.DB.NewUserOrderPayment(ctx, &form, id, leg.Payment); err != nil {
+			return errors.Join(err, order.rollbackPayments(ctx, legs[:i]))
+		}
+		if err := order.ApplyFormObject(ctx, &form); err != nil {
+			return errors.Join(err, order.rollbackPayments(ctx, legs[:i]))
+		}
+		transactionID, err := leg.Gateway.Authorize(ctx, leg.Payment)
+		if err != nil {
+			return order.failPayment(ctx, leg.Payment, errors.Join(err, order.rollbackPayments(ctx, legs[:i])))
+		}
+		leg.Payment.TransactionID = transactionID
+		leg.Payment.Status = PaymentStatusAuthorized
+		if err := order.updatePayment(ctx, leg.Payment); err != nil {
+			return errors.Join(err, order.rollbackPayments(ctx, legs[:i+1]))
+		}
+	}
+	for i, leg := range legs {
+		if err := leg.Gateway.Capture(ctx, leg.Payment, leg.Payment.Amount); err != nil {
+			rollbackErr := order.rollbackPayments(ctx, legs[:i])
+			return order.failPayment(ctx, leg.Payment, errors.Join(err, leg.Gateway.Void(ctx, leg.Payment), rollbackErr, order.rollbackPayments(ctx, legs[i+1:])))
+		}
+		leg.Payment.CapturedAmount = leg.Payment.Amount
+		leg.Payment.Status = PaymentStatusCaptured
+		if err := order.updatePayment(ctx, leg.Payment); err != nil {
+			return errors.Join(err, order.rollbackPayments(ctx, legs))
+		}
+	}
+	return nil
+}
+
+// rollbackPayments voids the authorized legs and refunds the captured ones.
+func (order *BuiltinUserOrder[AccountID]) rollbackPayments(ctx context.Context, legs []orderPaymentLeg[AccountID]) error {
+	var err error = nil
+	for _, leg := range legs {
+		switch leg.Payment.Status {
+		case PaymentStatusAuthorized:
+			if voidErr := leg.Gateway.Void(ctx, leg.Payment); voidErr != nil {
+				err = errors.Join(err, voidErr)
+				continue
+			}
+			leg.Payment.Status = PaymentStatusVoided
+		case PaymentStatusCaptured:
+			if refundErr := leg.Gateway.Refund(ctx, leg.Payment, leg.Payment.CapturedAmount); refundErr != nil {
+				err = errors.Join(err, refundErr)
+				continue
+			}
+			leg.Payment.RefundedAmount = leg.Payment.CapturedAmount
+			leg.Payment.Status = PaymentStatusRefunded
+		default:
+			continue
+		}
+		err = errors.Join(err, order.updatePayment(ctx, leg.Payment))
+	}
+	return err
+}
+
+func (order *BuiltinUserOrder[AccountID]) failPayment(ctx context.Context, payment *OrderPayment[AccountID], cause error) error {
+	payment.Status = PaymentStatusFailed
+	payment.FailureReason = strings.TrimPrefix(cause.Error(), ErrPaymentDeclined.Error()+"\n")
+	if err := order.updatePayment(ctx, payment); err != nil {
+		return errors.Join(cause, err)
+	}
+	if errors.Is(cause, ErrPaymentDeclined) {
+		return &PaymentDeclinedError{
+			OrderID:   payment.OrderID,
+			PaymentID: payment.ID,
+			Gateway:   payment.Gateway,
+			Reason:    payment.FailureReason,
+		}
+	}
+	return cause
+}
+
+func (order *BuiltinUserOrder[AccountID]) updatePayment(ctx context.Context, payment *OrderPayment[AccountID]) error {
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := order.DB.UpdateUserOrderPayment(ctx, &form, id, payment); err != nil {
+		return err
+	}
+	return order.ApplyFormObject(ctx, &form)
+}
+
+// IssueGiftCards issues the gift cards bought by the order once nothing is due, Pay calls it.
+// Gift cards which were already issued aren't issued again, so it's safe to retry.
+func (order *BuiltinUserOrder[AccountID]) IssueGiftCards(ctx context.Context) ([]GiftCard[AccountID], error) {
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	giftCards, err := order.DB.IssueUserOrderGiftCards(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := order.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	return giftCards, nil
+}
+
 func (order *BuiltinUserOrder[AccountID]) Pulse(ctx context.Context) error {
 	return nil
 }
 
+// Refund pays amount back through the payments of the order, latest payment first, puts the items back in stock
+// and issues a credit note for them. Refunding everything paid moves the order to the refunded status and gives
+// back its discount code. The payments of the order are claimed first, like Pay. A failure after the credit note
+// was stored returns it along with the error, as some money may have been paid back already.
+func (order *BuiltinUserOrder[AccountID]) Refund(ctx context.Context, items []RefundItem, amount Money, reason string) (*CreditNote[AccountID], error) {
+	if amount.IsNegative() {
+		return nil, errors.New("refund amount is negative")
+	}
+	statusName, err := order.claimPayments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	creditNote, err := order.refund(ctx, statusName, items, amount, reason)
+	if err = errors.Join(err, order.releasePayments(ctx)); err != nil {
+		return creditNote, err
+	}
+	return creditNote, nil
+}
+
+func (order *BuiltinUserOrder[AccountID]) refund(ctx context.Context, statusName string, items []RefundItem, amount Money, reason string) (*CreditNote[AccountID], error) {
+	if statusName == OrderStatusCancelled {
+		return nil, ErrOrderCancelled
+	}
+	// the claim keeps the payments from changing, the database checks amount against them again
+	refundable, err := order.getRefundableAmount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	full := amount.Equal(refundable) && refundable.IsPositive()
+	if full {
+		if err := order.checkStatusTransition(ctx, OrderStatusRefunded); err != nil {
+			return nil, err
+		}
+	}
+	creditNote := &CreditNote[AccountID]{
+		Items:  slices.Clone(items),
+		Amount: amount,
+		Reason: reason,
+	}
+	if err := order.issueCreditNote(ctx, creditNote, false); err != nil {
+		// a dropped credit note means nothing was paid back
+		if creditNote.ID == 0 {
+			return nil, err
+		}
+		return creditNote, err
+	}
+	if full {
+		if err := order.setStatusName(ctx, OrderStatusRefunded, reason); err != nil {
+			return creditNote, err
+		}
+	}
+	return creditNote, nil
+}
+
+// getRefundableAmount returns what was captured for the order and isn't refunded yet.
+func (order *BuiltinUserOrder[AccountID]) getRefundableAmount(ctx context.Context) (Money, error) {
+	total, err := order.GetOrderTotal(ctx)
+	if err != nil {
+		return Money{}, err
+	}
+	payments, err := order.GetPayments(ctx, nil)
+	if err != nil {
+		return Money{}, err
+	}
+	refundable := NewMoney(0, total.Currency)
+	for _, payment := range payments {
+		if payment.CapturedAmount.IsZero() {
+			continue
+		}
+		net, err := payment.CapturedAmount.Sub(payment.RefundedAmount)
+		if err != nil {
+			return Money{}, err
+		}
+		refundable, err = refundable.Add(net)
+		if err != nil {
+			return Money{}, err
+		}
+	}
+	return refundable, nil
+}
+
+// issueCreditNote stores the credit note pending, pays its amount back and only then issues it, which puts its items
+// back in stock and gives back the discount code. A refund which fails before any money moved drops the credit note,
+// one which fails midway issues it for what was paid back and keeps the items.
+func (order *BuiltinUserOrder[AccountID]) issueCreditNote(ctx context.Context, creditNote *CreditNote[AccountID], cancel bool) error {
+	id, err := order.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	aid, err := order.GetUserAccountID(ctx)
+	if err != nil {
+		return err
+	}
+	creditNote.OrderID = id
+	creditNote.AccountID = aid
+	form, err := order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := order.DB.RefundUserOrder(ctx, &form, id, creditNote, cancel); err != nil {
+		return err
+	}
+	if err := order.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	refunded, refundErr := order.refundPayments(ctx, creditNote.Amount)
+	form, err = order.UserOrderForm.Clone(ctx)
+	if err != nil {
+		return errors.Join(refundErr, err)
+	}
+	if err := order.DB.CompleteUserOrderRefund(ctx, &form, id, creditNote, refunded, cancel); err != nil {
+		return errors.Join(refundErr, err)
+	}
+	if refundErr != nil {
+		return refundErr
+	}
+	return order.ApplyFormObject(ctx, &form)
+}
+
+// refundPayments pays amount back through the gateways of the captured payments, latest payment first. It returns
+// what was paid back, also when a gateway fails midway.
+func (order *BuiltinUserOrder[AccountID]) refundPayments(ctx context.Context, amount Money) (Money, error) {
+	refunded := NewMoney(0, amount.Currency)
+	if !amount.IsPositive() {
+		return refunded, nil
+	}
+	if order.PaymentGateways == nil {
+		return refunded, errors.Join(ErrPaymentGatewayNotFound, errors.New("order has no payment gateways"))
+	}
+	payments, err := order.GetPayments(ctx, nil)
+	if err != nil {
+		return refunded, err
+	}
+	for i := len(payments) - 1; i >= 0 && amount.IsPositive(); i-- {
+		payment := &payments[i]
+		refundable, err := payment.CapturedAmount.Sub(payment.RefundedAmount)
+		if err != nil {
+			return refunded, err
+		}
+		if !refundable.IsPositive() {
+			continue
+		}
+		cmp, err := refundable.Cmp(amount)
+		if err != nil {
+			return refunded, err
+		}
+		if cmp > 0 {
+			refundable = amount
+		}
+		gateway, err := order.PaymentGateways.GetPaymentGateway(ctx, payment.Gateway)
+		if err != nil {
+			return refunded, err
+		}
+		if err := gateway.Refund(ctx, payment, refundable); err != nil {
+			return refunded, err
+		}
+		refunded, err = refunded.Add(refundable)
+		if err != nil {
+			return refunded, err
+		}
+		payment.RefundedAmount, err = payment.RefundedAmount.Add(refundable)
+		if err != nil {
+			return refunded, err
+		}
+		if payment.RefundedAmount.Equal(payment.CapturedAmount) {
+			payment.Status = PaymentStatusRefunded
+		}
+		if err := order.updatePayment(ctx, payment); err != nil {
+			return refunded, err
+		}
+		amount, err = amount.Sub(refundable)
+		if err != nil {
+			return refunded, err
+		}
+	}
+	return refunded, nil
+}
+
+// checkStatusTransition fails with ErrInvalidOrderStatusTransition when the order can't move to the status name, it's
+// called before money is moved so a refused transition doesn't leave a half cancelled or refunded order.
+func (order *BuiltinUserOrder[AccountID]) checkStatusTransition(ctx context.Context, name string) error {
+	current, err := order.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	next, err := order.OrderStatusManager.GetOrderStatusByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	allowed, err := order.OrderStatusManager.CanTransitionOrderStatus(ctx, current, next)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		currentName, err := current.GetName(ctx)
+		if err != nil {
+			return err
+		}
+		return errors.Join(ErrInvalidOrderStatusTransition, errors.New(currentName+" -> "+name))
+	}
+	return nil
+}
+
+func (order *BuiltinUserOrder[AccountID]) getStatusName(ctx context.Context) (string, error) {
+	status, err := order.GetStatus(ctx)
+	if err != nil {
+		return "", err
+	}
+	return status.GetName(ctx)
+}
+
+func (order *BuiltinUserOrder[AccountID]) setStatusName(ctx context.Context, name string, note string) error {
+	status, err := order.OrderStatusManager.GetOrderStatusByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	return order.ChangeStatus(ctx, status, "", note)
+}
+
 func (order *BuiltinUserOrder[AccountID]) SetDeliveryComment(ctx context.Context, comment string) error {
 	id, err := order.GetID(ctx)
 	if err != nil {
@@ -727,7 +1502,7 @@ func (order *BuiltinUserOrder[AccountID]) SetOrderDate(ctx context.Context, date
 	return nil
 }
 
-func (order *BuiltinUserOrder[AccountID]) SetOrderTotal(ctx context.Context, price float64) error {
+func (order *BuiltinUserOrder[AccountID]) SetOrderTotal(ctx context.Context, price Money) error {
 	id, err := order.GetID(ctx)
 	if err != nil {
 		return err
@@ -869,32 +1644,7 @@ func (order *BuiltinUserOrder[AccountID]) SetShippingMethod(ctx context.Context,
 }
 
 func (order *BuiltinUserOrder[AccountID]) SetStatus(ctx context.Context, status OrderStatus) error {
-	sid, err := status.GetID(ctx)
-	if err != nil {
-		return err
-	}
-	id, err := order.GetID(ctx)
-	if err != nil {
-		return err
-	}
-	form, err := order.UserOrderForm.Clone(ctx)
-	if err != nil {
-		return err
-	}
-	if err := order.DB.SetUserOrderStatus(ctx, &form, id, sid); err != nil {
-		return err
-	}
-	if err := order.ApplyFormObject(ctx, &form); err != nil {
-		return err
-	}
-	stat, err := status.ToBuiltinObject(ctx)
-	if err != nil {
-		return err
-	}
-	order.MU.Lock()
-	defer order.MU.Unlock()
-	order.Status = stat
-	return nil
+	return order.ChangeStatus(ctx, status, "", "")
 }
 
 func (order *BuiltinUserOrder[AccountID]) SetUserComment(ctx context.Context, comment string) error {
@@ -973,6 +1723,9 @@ func (order *BuiltinUserOrder[AccountID]) ApplyFormObject(ctx context.Context, f
 	if form.UserComment != nil {
 		order.UserComment = form.UserComment
 	}
+	if form.Promotions != nil {
+		order.Promotions = form.Promotions
+	}
 	if form.IsDeliveriedState != nil {
 		order.IsDeliveriedState = form.IsDeliveriedState
 	}
@@ -2,9 +2,36 @@ package scommerce
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"time"
 )
 
+// Order statuses every database provides next to the idle and delivered ones.
+const (
+	OrderStatusPendingPayment = "pending_payment" // ordered, the payment isn't captured yet
+	OrderStatusPaid           = "paid"
+	OrderStatusShipped        = "shipped"
+	OrderStatusCancelled      = "cancelled"
+	OrderStatusRefunded       = "refunded" // everything paid was refunded
+)
+
+var ErrInvalidOrderStatusTransition = errors.New("order status transition isn't allowed")
+
+// OrderStatusChange is an entry of the status history of an order. An empty actor means the status was changed by
+// the library itself, e.g. by checkout, payments or cancellations.
+type OrderStatusChange struct {
+	ID           uint64    `json:"id"`
+	OrderID      uint64    `json:"order_id"`
+	FromStatusID uint64    `json:"from_status_id,omitempty"` // 0 when the order had no status
+	FromStatus   string    `json:"from_status,omitempty"`
+	ToStatusID   uint64    `json:"to_status_id"`
+	ToStatus     string    `json:"to_status"`
+	Actor        string    `json:"actor,omitempty"`
+	Note         string    `json:"note,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
 type orderStatusDatabase interface {
 	DBOrderStatusManager
 	DBOrderStatus
@@ -53,6 +80,30 @@ func (orderStatusManager *BuiltinOrderStatusManager) newBuiltinOrderStatus(ctx c
 	return status, nil
 }
 
+func (orderStatusManager *BuiltinOrderStatusManager) AddOrderStatusTransition(ctx context.Context, from OrderStatus, to OrderStatus) error {
+	fromID, err := from.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	toID, err := to.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	return orderStatusManager.DB.AddOrderStatusTransition(ctx, fromID, toID)
+}
+
+func (orderStatusManager *BuiltinOrderStatusManager) CanTransitionOrderStatus(ctx context.Context, from OrderStatus, to OrderStatus) (bool, error) {
+	fromID, err := from.GetID(ctx)
+	if err != nil {
+		return false, err
+	}
+	toID, err := to.GetID(ctx)
+	if err != nil {
+		return false, err
+	}
+	return orderStatusManager.DB.ExistsOrderStatusTransition(ctx, fromID, toID)
+}
+
 func (orderStatusManager *BuiltinOrderStatusManager) Close(ctx context.Context) error {
 	return nil
 }
@@ -114,6 +165,31 @@ func (orderStatusManager *BuiltinOrderStatusManager) GetOrderStatuses(ctx contex
 	return statuses, nil
 }
 
+func (orderStatusManager *BuiltinOrderStatusManager) GetOrderStatusTransitions(ctx context.Context, from OrderStatus, orderStatuses []OrderStatus) ([]OrderStatus, error) {
+	fromID, err := from.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, 0, 4)
+	statusForms := make([]*OrderStatusForm, 0, cap(ids))
+	ids, statusForms, err = orderStatusManager.DB.GetOrderStatusTransitions(ctx, fromID, ids, statusForms)
+	if err != nil {
+		return nil, err
+	}
+	statuses := orderStatuses
+	if statuses == nil {
+		statuses = make([]OrderStatus, 0, len(ids))
+	}
+	for i := range len(ids) {
+		status, err := orderStatusManager.newBuiltinOrderStatus(ctx, ids[i], orderStatusManager.DB, statusForms[i])
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
 func (orderStatusManager *BuiltinOrderStatusManager) GetOrderStatusWithID(ctx context.Context, sid uint64, fill bool) (OrderStatus, error) {
 	if !fill {
 		return orderStatusManager.newBuiltinOrderStatus(ctx, sid, orderStatusManager.DB, nil)
@@ -155,6 +231,18 @@ func (orderStatusManager *BuiltinOrderStatusManager) RemoveOrderStatus(ctx conte
 	return orderStatusManager.DB.RemoveOrderStatus(ctx, id)
 }
 
+func (orderStatusManager *BuiltinOrderStatusManager) RemoveOrderStatusTransition(ctx context.Context, from OrderStatus, to OrderStatus) error {
+	fromID, err := from.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	toID, err := to.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	return orderStatusManager.DB.RemoveOrderStatusTransition(ctx, fromID, toID)
+}
+
 func (orderStatusManager *BuiltinOrderStatusManager) ToBuiltinObject(ctx context.Context) (*BuiltinOrderStatusManager, error) {
 	return orderStatusManager, nil
 }
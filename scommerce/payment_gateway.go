@@ -0,0 +1,336 @@
+package scommerce
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrPaymentDeclined = errors.New("payment declined")
+var ErrInsufficientFunds = errors.New("insufficient funds")
+var ErrPaymentGatewayNotFound = errors.New("payment gateway not found")
+var ErrOrderAlreadyPaid = errors.New("order is already paid")
+var ErrPaymentInProgress = errors.New("another payment or refund of the order is in progress")
+
+// OrderPaymentClaimTimeout is how long a payment claim keeps other payments and refunds of an order out. A claim
+// left behind by a crashed process can be taken over once it's that old.
+const OrderPaymentClaimTimeout = 15 * time.Minute
+
+var _ PaymentGatewayRegistry[any] = &BuiltinPaymentGatewayRegistry[any]{}
+var _ PaymentGateway[any] = &BuiltinWalletPaymentGateway[any]{}
+var _ PaymentGateway[any] = &FakePaymentGateway[any]{}
+
+// PaymentDeclinedError is returned by UserOrder.Pay and UserShoppingCart.Order when a gateway declines a payment.
+// The other payments of the attempt are rolled back and the order stays pending payment, it can be paid again.
+// It matches ErrPaymentDeclined with errors.Is.
+type PaymentDeclinedError struct {
+	OrderID   uint64 `json:"order_id"`
+	PaymentID uint64 `json:"payment_id"`
+	Gateway   string `json:"gateway"`
+	Reason    string `json:"reason"`
+}
+
+func (err *PaymentDeclinedError) Error() string {
+	return ErrPaymentDeclined.Error() + ": order " + strconv.FormatUint(err.OrderID, 10) + " via " + err.Gateway + ": " + err.Reason
+}
+
+func (err *PaymentDeclinedError) Unwrap() error {
+	return ErrPaymentDeclined
+}
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending    PaymentStatus = "pending"
+	PaymentStatusAuthorized PaymentStatus = "authorized"
+	PaymentStatusCaptured   PaymentStatus = "captured"
+	PaymentStatusVoided     PaymentStatus = "voided"
+	PaymentStatusRefunded   PaymentStatus = "refunded" // the whole captured amount is refunded
+	PaymentStatusFailed     PaymentStatus = "failed"
+)
+
+// OrderPayment is one attempt to pay an order through a gateway.
+type OrderPayment[AccountID comparable] struct {
+	ID              uint64        `json:"id"`
+	OrderID         uint64        `json:"order_id"`
+	AccountID       AccountID     `json:"account_id"`
+	PaymentMethodID uint64        `json:"payment_method_id,omitempty"` // 0 when paid from the wallet without a payment method
+	GiftCardID      uint64        `json:"gift_card_id,omitempty"`      // gift card paying the payment, set by the gift card gateway
+	GiftCardCode    string        `json:"-"`                           // code of the split, only set before the payment is authorized
+	Gateway         string        `json:"gateway"`
+	TransactionID   string        `json:"transaction_id,omitempty"` // id of the authorization at the gateway
+	Amount          Money         `json:"amount"`
+	CapturedAmount  Money         `json:"captured_amount"`
+	RefundedAmount  Money         `json:"refunded_amount"`
+	Status          PaymentStatus `json:"status"`
+	FailureReason   string        `json:"failure_reason,omitempty"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+// PaymentSplit pays part of an order with a payment method, a nil PaymentMethod pays from the wallet.
+// A split with a GiftCardCode pays from the gift card through the gift card gateway and ignores PaymentMethod.
+// Amount is the most the split pays, so the whole wallet or gift card balance can be offered without knowing the total.
+type PaymentSplit[AccountID comparable] struct {
+	PaymentMethod UserPaymentMethod[AccountID] `json:"-"`
+	GiftCardCode  string                       `json:"gift_card_code,omitempty"`
+	Amount        Money                        `json:"amount"`
+}
+
+// PaymentGateway moves the money of order payments. Authorize reserves payment.Amount and returns the id of the
+// authorization, Capture takes the reserved money, Void releases an authorization which isn't captured and Refund pays
+// captured money back. Declines are reported by errors matching ErrPaymentDeclined.
+type PaymentGateway[AccountID comparable] interface {
+	Name() string
+	Authorize(ctx context.Context, payment *OrderPayment[AccountID]) (string, error)
+	Capture(ctx context.Context, payment *OrderPayment[AccountID], amount Money) error
+	Void(ctx context.Context, payment *OrderPayment[AccountID]) error
+	Refund(ctx context.Context, payment *OrderPayment[AccountID], amount Money) error
+}
+
+type PaymentGatewayRegistry[AccountID comparable] interface {
+	GetPaymentGateway(ctx context.Context, name string) (PaymentGateway[AccountID], error)
+	GetPaymentGatewayForType(ctx context.Context, paymentType string) (PaymentGateway[AccountID], error)
+}
+
+// BuiltinPaymentGatewayRegistry selects gateways by the name of the payment type of a payment method,
+// payment types without a gateway use Default.
+type BuiltinPaymentGatewayRegistry[AccountID comparable] struct {
+	Gateways     map[string]PaymentGateway[AccountID]
+	PaymentTypes map[string]string // payment type name to gateway name
+	Default      string
+	MU           sync.RWMutex
+}
+
+// NewBuiltinPaymentGatewayRegistry registers defaultGateway as the default, it may be nil.
+func NewBuiltinPaymentGatewayRegistry[AccountID comparable](defaultGateway PaymentGateway[AccountID]) *BuiltinPaymentGatewayRegistry[AccountID] {
+	registry := &BuiltinPaymentGatewayRegistry[AccountID]{
+		Gateways:     make(map[string]PaymentGateway[AccountID]),
+		PaymentTypes: make(map[string]string),
+	}
+	if defaultGateway != nil {
+		registry.Register(defaultGateway)
+		registry.Default = defaultGateway.Name()
+	}
+	return registry
+}
+
+// Register adds the gateway and routes the payment types to it.
+func (registry *BuiltinPaymentGatewayRegistry[AccountID]) Register(gateway PaymentGateway[AccountID], paymentTypes ...string) {
+	registry.MU.Lock()
+	defer registry.MU.Unlock()
+	name := gateway.Name()
+	registry.Gateways[name] = gateway
+	for _, paymentType := range paymentTypes {
+		registry.PaymentTypes[paymentType] = name
+	}
+}
+
+func (registry *BuiltinPaymentGatewayRegistry[AccountID]) GetPaymentGateway(ctx context.Context, name string) (PaymentGateway[AccountID], error) {
+	registry.MU.RLock()
+	defer registry.MU.RUnlock()
+	gateway, ok := registry.Gateways[name]
+	if !ok {
+		return nil, errors.Join(ErrPaymentGatewayNotFound, errors.New("gateway "+name))
+	}
+	return gateway, nil
+}
+
+func (registry *BuiltinPaymentGatewayRegistry[AccountID]) GetPaymentGatewayForType(ctx context.Context, paymentType string) (PaymentGateway[AccountID], error) {
+	registry.MU.RLock()
+	name, ok := registry.PaymentTypes[paymentType]
+	if !ok {
+		name = registry.Default
+	}
+	registry.MU.RUnlock()
+	if name == "" {
+		return nil, errors.Join(ErrPaymentGatewayNotFound, errors.New("payment type "+paymentType))
+	}
+	return registry.GetPaymentGateway(ctx, name)
+}
+
+const WalletPaymentGatewayName = "wallet"
+
+// BuiltinWalletPaymentGateway pays orders from the wallet of the account. Nothing is held on authorization,
+// Capture withdraws atomically and declines when the wallet doesn't cover the amount.
+type BuiltinWalletPaymentGateway[AccountID comparable] struct {
+	DB DBUserAccount[AccountID]
+}
+
+func NewBuiltinWalletPaymentGateway[AccountID comparable](db DBUserAccount[AccountID]) *BuiltinWalletPaymentGateway[AccountID] {
+	return &BuiltinWalletPaymentGateway[AccountID]{
+		DB: db,
+	}
+}
+
+func (gateway *BuiltinWalletPaymentGateway[AccountID]) Name() string {
+	return WalletPaymentGatewayName
+}
+
+func (gateway *BuiltinWalletPaymentGateway[AccountID]) Authorize(ctx context.Context, payment *OrderPayment[AccountID]) (string, error) {
+	wallet, err := gateway.DB.GetUserAccountWalletCurrency(ctx, nil, payment.AccountID)
+	if err != nil {
+		return "", err
+	}
+	cmp, err := wallet.Cmp(payment.Amount)
+	if err != nil {
+		return "", err
+	}
+	if cmp < 0 {
+		return "", errors.Join(ErrPaymentDeclined, ErrInsufficientFunds)
+	}
+	return "wallet_" + strconv.FormatUint(payment.ID, 10), nil
+}
+
+func (gateway *BuiltinWalletPaymentGateway[AccountID]) Capture(ctx context.Context, payment *OrderPayment[AccountID], amount Money) error {
+	entry := &WalletEntry[AccountID]{
+		Type:          WalletTransactionCheckout,
+		ReferenceType: WalletReferenceOrder,
+		ReferenceID:   strconv.FormatUint(payment.OrderID, 10),
+	}
+	// a retried capture of the same payment must not withdraw twice
+	err := gateway.DB.WithdrawUserAccountWallet(ctx, nil, payment.AccountID, amount, entry, "capture_"+payment.TransactionID)
+	if errors.Is(err, ErrInsufficientFunds) {
+		return errors.Join(ErrPaymentDeclined, err)
+	}
+	return err
+}
+
+func (gateway *BuiltinWalletPaymentGateway[AccountID]) Void(ctx context.Context, payment *OrderPayment[AccountID]) error {
+	return nil
+}
+
+func (gateway *BuiltinWalletPaymentGateway[AccountID]) Refund(ctx context.Context, payment *OrderPayment[AccountID], amount Money) error {
+	entry := &WalletEntry[AccountID]{
+		Type:          WalletTransactionRefund,
+		ReferenceType: WalletReferenceOrder,
+		ReferenceID:   strconv.FormatUint(payment.OrderID, 10),
+	}
+	// the refunded amount so far tells the refunds of a payment apart, a retried refund must not pay back twice
+	idempotencyKey := "refund_" + strconv.FormatUint(payment.ID, 10) + "_" + strconv.FormatInt(payment.RefundedAmount.Amount, 10)
+	return gateway.DB.ChargeUserAccountWallet(ctx, nil, payment.AccountID, amount, entry, idempotencyKey)
+}
+
+const FakePaymentGatewayName = "fake"
+
+var ErrFakePaymentTransactionNotFound = errors.New("fake payment transaction not found")
+
+type FakePaymentTransaction struct {
+	Authorized Money `json:"authorized"`
+	Captured   Money `json:"captured"`
+	Refunded   Money `json:"refunded"`
+	Voided     bool  `json:"voided"`
+}
+
+// FakePaymentGateway is an in-process gateway for tests and development, it keeps its transactions
+// in memory and moves no money. Setting DeclineReason declines every authorization.
+type FakePaymentGateway[AccountID comparable] struct {
+	GatewayName   string // FakePaymentGatewayName if empty
+	DeclineReason string
+	Transactions  map[string]*FakePaymentTransaction
+	LastID        uint64
+	MU            sync.Mutex
+}
+
+func NewFakePaymentGateway[AccountID comparable]() *FakePaymentGateway[AccountID] {
+	return &FakePaymentGateway[AccountID]{
+		Transactions: make(map[string]*FakePaymentTransaction),
+	}
+}
+
+func (gateway *FakePaymentGateway[AccountID]) Name() string {
+	if gateway.GatewayName == "" {
+		return FakePaymentGatewayName
+	}
+	return gateway.GatewayName
+}
+
+func (gateway *FakePaymentGateway[AccountID]) Authorize(ctx context.Context, payment *OrderPayment[AccountID]) (string, error) {
+	gateway.MU.Lock()
+	defer gateway.MU.Unlock()
+	if gateway.DeclineReason != "" {
+		return "", errors.Join(ErrPaymentDeclined, errors.New(gateway.DeclineReason))
+	}
+	if gateway.Transactions == nil {
+		gateway.Transactions = make(map[string]*FakePaymentTransaction)
+	}
+	gateway.LastID++
+	id := "fake_" + strconv.FormatUint(gateway.LastID, 10)
+	gateway.Transactions[id] = &FakePaymentTransaction{
+		Authorized: payment.Amount,
+		Captured:   NewMoney(0, payment.Amount.Currency),
+		Refunded:   NewMoney(0, payment.Amount.Currency),
+	}
+	return id, nil
+}
+
+func (gateway *FakePaymentGateway[AccountID]) transaction(payment *OrderPayment[AccountID]) (*FakePaymentTransaction, error) {
+	transaction, ok := gateway.Transactions[payment.TransactionID]
+	if !ok {
+		return nil, errors.Join(ErrFakePaymentTransactionNotFound, errors.New("transaction "+payment.TransactionID))
+	}
+	return transaction, nil
+}
+
+func (gateway *FakePaymentGateway[AccountID]) Capture(ctx context.Context, payment *OrderPayment[AccountID], amount Money) error {
+	gateway.MU.Lock()
+	defer gateway.MU.Unlock()
+	transaction, err := gateway.transaction(payment)
+	if err != nil {
+		return err
+	}
+	if transaction.Voided {
+		return errors.New("can't capture a voided authorization")
+	}
+	captured, err := transaction.Captured.Add(amount)
+	if err != nil {
+		return err
+	}
+	cmp, err := captured.Cmp(transaction.Authorized)
+	if err != nil {
+		return err
+	}
+	if cmp > 0 {
+		return errors.New("capture exceeds the authorized amount")
+	}
+	transaction.Captured = captured
+	return nil
+}
+
+func (gateway *FakePaymentGateway[AccountID]) Void(ctx context.Context, payment *OrderPayment[AccountID]) error {
+	gateway.MU.Lock()
+	defer gateway.MU.Unlock()
+	transaction, err := gateway.transaction(payment)
+	if err != nil {
+		return err
+	}
+	if !transaction.Captured.IsZero() {
+		return errors.New("can't void a captured authorization")
+	}
+	transaction.Voided = true
+	return nil
+}
+
+func (gateway *FakePaymentGateway[AccountID]) Refund(ctx context.Context, payment *OrderPayment[AccountID], amount Money) error {
+	gateway.MU.Lock()
+	defer gateway.MU.Unlock()
+	transaction, err := gateway.transaction(payment)
+	if err != nil {
+		return err
+	}
+	refunded, err := transaction.Refunded.Add(amount)
+	if err != nil {
+		return err
+	}
+	cmp, err := refunded.Cmp(transaction.Captured)
+	if err != nil {
+		return err
+	}
+	if cmp > 0 {
+		return errors.New("refund exceeds the captured amount")
+	}
+	transaction.Refunded = refunded
+	return nil
+}
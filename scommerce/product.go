@@ -23,6 +23,7 @@ type ProductForm[AccountID comparable] struct {
 	Name             *string                            `json:"name,omitempty"`
 	ProductCategory  *BuiltinProductCategory[AccountID] `json:"product_category,omitempty"`
 	ProductItemCount *uint64                            `json:"product_item_count,omitempty"`
+	Options          *[]ProductOption                   `json:"options,omitempty"`
 }
 
 type BuiltinProduct[AccountID comparable] struct {
@@ -52,7 +53,15 @@ func (product *BuiltinProduct[AccountID]) newProductItem(ctx context.Context, id
 	return item, nil
 }
 
-func (product *BuiltinProduct[AccountID]) AddProductItem(ctx context.Context, sku string, name string, price float64, quantity uint64, images []FileReader, attrs json.RawMessage) (ProductItem[AccountID], error) {
+func (product *BuiltinProduct[AccountID]) AddProductItem(ctx context.Context, sku string, name string, price Money, quantity uint64, images []FileReader, attrs json.RawMessage) (ProductItem[AccountID], error) {
+	return product.addProductItem(ctx, sku, name, price, quantity, images, attrs, nil)
+}
+
+func (product *BuiltinProduct[AccountID]) AddProductItemWithOptions(ctx context.Context, options map[string]string, sku string, name string, price Money, quantity uint64, images []FileReader, attrs json.RawMessage) (ProductItem[AccountID], error) {
+	return product.addProductItem(ctx, sku, name, price, quantity, images, attrs, options)
+}
+
+func (product *BuiltinProduct[AccountID]) addProductItem(ctx context.Context, sku string, name string, price Money, quantity uint64, images []FileReader, attrs json.RawMessage, options map[string]string) (ProductItem[AccountID], error) {
 	var errRes error = nil
 	tokens := make([]string, 0, len(images))
 	imgs := make([]FileReader, 0, len(images))
@@ -76,7 +85,7 @@ func (product *BuiltinProduct[AccountID]) AddProductItem(ctx context.Context, sk
 		return nil, err
 	}
 	itemForm := ProductItemForm[AccountID]{}
-	pid, err := product.DB.AddProductProductItem(ctx, &form, id, sku, name, price, quantity, tokens, attrs, &itemForm, product.FS)
+	pid, err := product.DB.AddProductProductItem(ctx, &form, id, sku, name, price, quantity, tokens, attrs, options, &itemForm, product.FS)
 	if err != nil {
 		return nil, err
 	}
@@ -217,6 +226,54 @@ func (product *BuiltinProduct[AccountID]) GetName(ctx context.Context) (string,
 	return name, nil
 }
 
+func (product *BuiltinProduct[AccountID]) GetOptions(ctx context.Context) ([]ProductOption, error) {
+	product.MU.RLock()
+	if product.Options != nil {
+		defer product.MU.RUnlock()
+		return *product.Options, nil
+	}
+	product.MU.RUnlock()
+	id, err := product.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := product.ProductForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	options, err := product.DB.GetProductOptions(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := product.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	product.MU.Lock()
+	defer product.MU.Unlock()
+	product.Options = &options
+	return options, nil
+}
+
+func (product *BuiltinProduct[AccountID]) FindItemByOptions(ctx context.Context, options map[string]string) (ProductItem[AccountID], error) {
+	id, err := product.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := product.ProductForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	itemForm := ProductItemForm[AccountID]{}
+	itid, err := product.DB.GetProductProductItemByOptions(ctx, &form, id, options, &itemForm, product.FS)
+	if err != nil {
+		return nil, err
+	}
+	if err := product.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	return product.newProductItem(ctx, itid, product.DB, &itemForm)
+}
+
 func (product *BuiltinProduct[AccountID]) GetProductCategory(ctx context.Context) (ProductCategory[AccountID], error) {
 	product.MU.RLock()
 	if product.ProductCategory != nil {
@@ -470,6 +527,30 @@ func (product *BuiltinProduct[AccountID]) SetName(ctx context.Context, name stri
 	return nil
 }
 
+func (product *BuiltinProduct[AccountID]) SetOptions(ctx context.Context, options []ProductOption) error {
+	if err := ValidateProductOptions(options); err != nil {
+		return err
+	}
+	id, err := product.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := product.ProductForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := product.DB.SetProductOptions(ctx, &form, id, options); err != nil {
+		return err
+	}
+	if err := product.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	product.MU.Lock()
+	defer product.MU.Unlock()
+	product.Options = &options
+	return nil
+}
+
 func (product *BuiltinProduct[AccountID]) SetProductCategory(ctx context.Context, category ProductCategory[AccountID]) error {
 	var cid *uint64 = nil
 	if category != nil {
@@ -531,6 +612,9 @@ func (product *BuiltinProduct[AccountID]) ApplyFormObject(ctx context.Context, f
 	if form.ProductItemCount != nil {
 		product.ProductItemCount = form.ProductItemCount
 	}
+	if form.Options != nil {
+		product.Options = form.Options
+	}
 	return nil
 }
 
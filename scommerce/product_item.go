@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"sync"
+	"time"
 )
 
 var _ ProductItem[any] = &BuiltinProductItem[any]{}
@@ -20,11 +21,33 @@ type ProductItemForm[AccountID comparable] struct {
 	ID              uint64                     `json:"id"`
 	Attributes      *json.RawMessage           `json:"attributes,omitempty"`
 	Images          *[]string                  `json:"images,omitempty"`
-	Price           *float64                   `json:"price,omitempty"`
+	Price           *Money                     `json:"price,omitempty"`
 	Product         *BuiltinProduct[AccountID] `json:"product,omitempty"`
 	QuantityInStock *uint64                    `json:"quantity_in_stock,omitempty"`
 	Name            *string                    `json:"name,omitempty"`
 	SKU             *string                    `json:"sku,omitempty"`
+	Weight          *float64                   `json:"weight,omitempty"`
+	Dimensions      *ProductItemDimensions     `json:"dimensions,omitempty"`
+	GiftCard        *ProductItemGiftCard       `json:"gift_card,omitempty"`
+	Options         *map[string]string         `json:"options,omitempty"`
+}
+
+// ProductItemDimensions is the packed size of one unit in centimeters.
+type ProductItemDimensions struct {
+	Length float64 `json:"length"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func (dimensions ProductItemDimensions) Volume() float64 {
+	return dimensions.Length * dimensions.Width * dimensions.Height
+}
+
+// ProductItemGiftCard makes a product item a gift card, every unit of a paid order issues
+// a gift card worth the price the unit was ordered at.
+type ProductItemGiftCard struct {
+	Enabled  bool          `json:"enabled"`
+	Validity time.Duration `json:"validity,omitempty"` // zero never expires
 }
 
 type BuiltinProductItem[AccountID comparable] struct {
@@ -134,7 +157,7 @@ func (item *BuiltinProductItem[AccountID]) GetImages(ctx context.Context) ([]Fil
 	return files, nil
 }
 
-func (item *BuiltinProductItem[AccountID]) GetPrice(ctx context.Context) (float64, error) {
+func (item *BuiltinProductItem[AccountID]) GetPrice(ctx context.Context) (Money, error) {
 	item.MU.RLock()
 	if item.Price != nil {
 		defer item.MU.RUnlock()
@@ -143,18 +166,18 @@ func (item *BuiltinProductItem[AccountID]) GetPrice(ctx context.Context) (float6
 	item.MU.RUnlock()
 	id, err := item.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := item.ProductItemForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	price, err := item.DB.GetProductItemPrice(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := item.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	item.MU.Lock()
 	defer item.MU.Unlock()
@@ -225,6 +248,25 @@ func (item *BuiltinProductItem[AccountID]) GetQuantityInStock(ctx context.Contex
 	return quantity, nil
 }
 
+func (item *BuiltinProductItem[AccountID]) GetReservedQuantity(ctx context.Context) (uint64, error) {
+	id, err := item.GetID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	form, err := item.ProductItemForm.Clone(ctx)
+	if err != nil {
+		return 0, err
+	}
+	reserved, err := item.DB.GetProductItemReservedQuantity(ctx, &form, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := item.ApplyFormObject(ctx, &form); err != nil {
+		return 0, err
+	}
+	return reserved, nil
+}
+
 func (item *BuiltinProductItem[AccountID]) GetName(ctx context.Context) (string, error) {
 	item.MU.RLock()
 	if item.Name != nil {
@@ -281,6 +323,119 @@ func (item *BuiltinProductItem[AccountID]) GetSKU(ctx context.Context) (string,
 	return sku, nil
 }
 
+func (item *BuiltinProductItem[AccountID]) GetWeight(ctx context.Context) (float64, error) {
+	item.MU.RLock()
+	if item.Weight != nil {
+		defer item.MU.RUnlock()
+		return *item.Weight, nil
+	}
+	item.MU.RUnlock()
+	id, err := item.GetID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	form, err := item.ProductItemForm.Clone(ctx)
+	if err != nil {
+		return 0, err
+	}
+	weight, err := item.DB.GetProductItemWeight(ctx, &form, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := item.ApplyFormObject(ctx, &form); err != nil {
+		return 0, err
+	}
+	item.MU.Lock()
+	defer item.MU.Unlock()
+	item.Weight = &weight
+	return weight, nil
+}
+
+func (item *BuiltinProductItem[AccountID]) GetDimensions(ctx context.Context) (ProductItemDimensions, error) {
+	item.MU.RLock()
+	if item.Dimensions != nil {
+		defer item.MU.RUnlock()
+		return *item.Dimensions, nil
+	}
+	item.MU.RUnlock()
+	id, err := item.GetID(ctx)
+	if err != nil {
+		return ProductItemDimensions{}, err
+	}
+	form, err := item.ProductItemForm.Clone(ctx)
+	if err != nil {
+		return ProductItemDimensions{}, err
+	}
+	dimensions, err := item.DB.GetProductItemDimensions(ctx, &form, id)
+	if err != nil {
+		return ProductItemDimensions{}, err
+	}
+	if err := item.ApplyFormObject(ctx, &form); err != nil {
+		return ProductItemDimensions{}, err
+	}
+	item.MU.Lock()
+	defer item.MU.Unlock()
+	item.Dimensions = &dimensions
+	return dimensions, nil
+}
+
+func (item *BuiltinProductItem[AccountID]) GetGiftCard(ctx context.Context) (ProductItemGiftCard, error) {
+	item.MU.RLock()
+	if item.GiftCard != nil {
+		defer item.MU.RUnlock()
+		return *item.GiftCard, nil
+	}
+	item.MU.RUnlock()
+	id, err := item.GetID(ctx)
+	if err != nil {
+		return ProductItemGiftCard{}, err
+	}
+	form, err := item.ProductItemForm.Clone(ctx)
+	if err != nil {
+		return ProductItemGiftCard{}, err
+	}
+	giftCard, err := item.DB.GetProductItemGiftCard(ctx, &form, id)
+	if err != nil {
+		return ProductItemGiftCard{}, err
+	}
+	if err := item.ApplyFormObject(ctx, &form); err != nil {
+		return ProductItemGiftCard{}, err
+	}
+	item.MU.Lock()
+	defer item.MU.Unlock()
+	item.GiftCard = &giftCard
+	return giftCard, nil
+}
+
+// GetOptions returns the value the item picks for every option axis of its product, nil when the item isn't a variant.
+func (item *BuiltinProductItem[AccountID]) GetOptions(ctx context.Context) (map[string]string, error) {
+	item.MU.RLock()
+	if item.Options != nil {
+		defer item.MU.RUnlock()
+		return *item.Options, nil
+	}
+	item.MU.RUnlock()
+	id, err := item.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := item.ProductItemForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	options, err := item.DB.GetProductItemOptions(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := item.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	item.MU.Lock()
+	defer item.MU.Unlock()
+	item.Options = &options
+	return options, nil
+}
+
 func (item *BuiltinProductItem[AccountID]) Init(ctx context.Context) error {
 	return nil
 }
@@ -364,7 +519,7 @@ func (item *BuiltinProductItem[AccountID]) SetImages(ctx context.Context, images
 	return errRes
 }
 
-func (item *BuiltinProductItem[AccountID]) SetPrice(ctx context.Context, price float64) error {
+func (item *BuiltinProductItem[AccountID]) SetPrice(ctx context.Context, price Money) error {
 	id, err := item.GetID(ctx)
 	if err != nil {
 		return err
@@ -415,6 +570,7 @@ func (item *BuiltinProductItem[AccountID]) SetProduct(ctx context.Context, produ
 	item.MU.Lock()
 	defer item.MU.Unlock()
 	item.Product = proc
+	item.Options = nil // moving to another product drops the options
 	return nil
 }
 
@@ -460,6 +616,93 @@ func (item *BuiltinProductItem[AccountID]) SetName(ctx context.Context, name str
 	return nil
 }
 
+func (item *BuiltinProductItem[AccountID]) SetWeight(ctx context.Context, weight float64) error {
+	id, err := item.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := item.ProductItemForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := item.DB.SetProductItemWeight(ctx, &form, id, weight); err != nil {
+		return err
+	}
+	if err := item.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	item.MU.Lock()
+	defer item.MU.Unlock()
+	item.Weight = &weight
+	return nil
+}
+
+func (item *BuiltinProductItem[AccountID]) SetDimensions(ctx context.Context, dimensions ProductItemDimensions) error {
+	id, err := item.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := item.ProductItemForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := item.DB.SetProductItemDimensions(ctx, &form, id, dimensions); err != nil {
+		return err
+	}
+	if err := item.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	item.MU.Lock()
+	defer item.MU.Unlock()
+	item.Dimensions = &dimensions
+	return nil
+}
+
+func (item *BuiltinProductItem[AccountID]) SetGiftCard(ctx context.Context, giftCard ProductItemGiftCard) error {
+	id, err := item.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := item.ProductItemForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := item.DB.SetProductItemGiftCard(ctx, &form, id, giftCard); err != nil {
+		return err
+	}
+	if err := item.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	item.MU.Lock()
+	defer item.MU.Unlock()
+	item.GiftCard = &giftCard
+	return nil
+}
+
+func (item *BuiltinProductItem[AccountID]) SetOptions(ctx context.Context, options map[string]string) error {
+	if len(options) == 0 {
+		options = nil
+	}
+	id, err := item.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := item.ProductItemForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := item.DB.SetProductItemOptions(ctx, &form, id, options); err != nil {
+		return err
+	}
+	if err := item.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	item.MU.Lock()
+	defer item.MU.Unlock()
+	item.Options = &options
+	return nil
+}
+
 func (item *BuiltinProductItem[AccountID]) SetSKU(ctx context.Context, sku string) error {
 	id, err := item.GetID(ctx)
 	if err != nil {
@@ -609,6 +852,18 @@ func (item *BuiltinProductItem[AccountID]) ApplyFormObject(ctx context.Context,
 	if form.SKU != nil {
 		item.SKU = form.SKU
 	}
+	if form.Weight != nil {
+		item.Weight = form.Weight
+	}
+	if form.Dimensions != nil {
+		item.Dimensions = form.Dimensions
+	}
+	if form.GiftCard != nil {
+		item.GiftCard = form.GiftCard
+	}
+	if form.Options != nil {
+		item.Options = form.Options
+	}
 	return nil
 }
 
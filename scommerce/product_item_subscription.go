@@ -2,6 +2,7 @@ package scommerce
 
 import (
 	"context"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -65,34 +66,38 @@ func NewBuiltinProductItemSubscriptionManager[AccountID comparable](db productIt
 	return manager
 }
 
-func (manager *BuiltinProductItemSubscriptionManager[AccountID]) defaultRenewalHandler(ctx context.Context, subscription ProductItemSubscription[AccountID], account UserAccount[AccountID], productItem ProductItem[AccountID]) (bool, float64, error) {
+func (manager *BuiltinProductItemSubscriptionManager[AccountID]) defaultRenewalHandler(ctx context.Context, subscription ProductItemSubscription[AccountID], account UserAccount[AccountID], productItem ProductItem[AccountID]) (bool, Money, error) {
 	price, err := productItem.GetPrice(ctx)
 	if err != nil {
-		return false, 0, err
+		return false, Money{}, err
 	}
 
 	walletBalance, err := account.GetWalletCurrency(ctx)
 	if err != nil {
-		return false, 0, err
+		return false, Money{}, err
 	}
 
-	if walletBalance < price {
-		return false, 0, nil
+	cmp, err := walletBalance.Cmp(price)
+	if err != nil {
+		return false, Money{}, err
+	}
+	if cmp < 0 {
+		return false, Money{}, nil
 	}
 
 	expiresAt, err := subscription.GetExpiresAt(ctx)
 	if err != nil {
-		return false, 0, err
+		return false, Money{}, err
 	}
 
 	duration, err := subscription.GetDuration(ctx)
 	if err != nil {
-		return false, 0, err
+		return false, Money{}, err
 	}
 
 	newExpiresAt := expiresAt.Add(duration)
 	if err := subscription.SetExpiresAt(ctx, newExpiresAt); err != nil {
-		return false, 0, err
+		return false, Money{}, err
 	}
 
 	return true, price, nil
@@ -346,8 +351,13 @@ func (manager *BuiltinProductItemSubscriptionManager[AccountID]) ProcessExpiredS
 			}
 
 			// Deduct the charged amount from user's wallet if amount > 0
-			if amountCharged > 0 {
-				if err := account.ChargeWallet(ctx, -amountCharged); err != nil {
+			if amountCharged.IsPositive() {
+				entry := &WalletEntry[AccountID]{
+					Type:          WalletTransactionSubscriptionRenewal,
+					ReferenceType: WalletReferenceSubscription,
+					ReferenceID:   strconv.FormatUint(ids[idx], 10),
+				}
+				if err := account.ChargeWallet(ctx, amountCharged.Neg(), entry, ""); err != nil {
 					errChan <- err
 					return
 				}
@@ -0,0 +1,72 @@
+package scommerce
+
+import (
+	"errors"
+)
+
+var ErrInvalidProductOptions = errors.New("product options are invalid")
+var ErrProductItemOptionsMismatch = errors.New("product item options don't match the options of the product")
+var ErrDuplicateProductItemOptions = errors.New("another product item of the product has the same options")
+var ErrProductItemNotFound = errors.New("product item not found")
+
+// ProductOption is an axis the items of a product vary along, like size or color, every item of
+// the product with options picks one of the values of every axis.
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"` // in the order storefronts show them
+}
+
+// ValidateProductOptions checks that every axis has a unique non empty name and at least one value,
+// and that the values of an axis are non empty and unique.
+func ValidateProductOptions(options []ProductOption) error {
+	names := make(map[string]struct{}, len(options))
+	for _, option := range options {
+		if option.Name == "" || len(option.Values) == 0 {
+			return ErrInvalidProductOptions
+		}
+		if _, ok := names[option.Name]; ok {
+			return ErrInvalidProductOptions
+		}
+		names[option.Name] = struct{}{}
+
+		values := make(map[string]struct{}, len(option.Values))
+		for _, value := range option.Values {
+			if value == "" {
+				return ErrInvalidProductOptions
+			}
+			if _, ok := values[value]; ok {
+				return ErrInvalidProductOptions
+			}
+			values[value] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// MatchProductOptions reports whether the options of a product item pick an allowed value for every axis
+// of the product and name nothing else. Items without options aren't variants and always match.
+func MatchProductOptions(axes []ProductOption, options map[string]string) bool {
+	if len(options) == 0 {
+		return true
+	}
+	if len(options) != len(axes) {
+		return false
+	}
+	for _, axis := range axes {
+		value, ok := options[axis.Name]
+		if !ok {
+			return false
+		}
+		allowed := false
+		for _, v := range axis.Values {
+			if v == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
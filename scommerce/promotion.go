@@ -0,0 +1,217 @@
+package scommerce
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+)
+
+var _ PromotionCalculator = &BuiltinPromotionCalculator{}
+
+type PromotionType string
+
+const (
+	PromotionTypeBuyXGetY       PromotionType = "buy_x_get_y"     // every BuyQuantity + GetQuantity units, the GetQuantity cheapest are free
+	PromotionTypeBundlePrice    PromotionType = "bundle_price"    // every BundleQuantity units cost BundlePrice
+	PromotionTypeTieredQuantity PromotionType = "tiered_quantity" // the tier reached by the number of units sets the percentage off
+)
+
+// PromotionTier applies from MinQuantity matching units.
+type PromotionTier struct {
+	MinQuantity int64   `json:"min_quantity"`
+	Percentage  float64 `json:"percentage"` // 10 for 10% off
+}
+
+// Promotion is applied automatically to the cart lines matching all of its non-empty scopes.
+type Promotion struct {
+	Name           string          `json:"name"`
+	Type           PromotionType   `json:"type"`
+	ProductItemIDs []uint64        `json:"product_item_ids,omitempty"`
+	CategoryIDs    []uint64        `json:"category_ids,omitempty"` // sub categories are included
+	BuyQuantity    int64           `json:"buy_quantity,omitempty"`
+	GetQuantity    int64           `json:"get_quantity,omitempty"`
+	BundleQuantity int64           `json:"bundle_quantity,omitempty"`
+	BundlePrice    Money           `json:"bundle_price"`
+	Tiers          []PromotionTier `json:"tiers,omitempty"`
+}
+
+type PromotionRequest struct {
+	Items []TaxableItem `json:"items"`
+}
+
+// PromotionLine is a promotion applied to the cart, it is stored with the order and spread over the factor lines.
+type PromotionLine struct {
+	Promotion      string        `json:"promotion"`
+	Type           PromotionType `json:"type"`
+	ProductItemIDs []uint64      `json:"product_item_ids"` // product items of the units the promotion used
+	Quantity       int64         `json:"quantity"`         // units the promotion used
+	Amount         Money         `json:"amount"`           // taken off the subtotal
+}
+
+type PromotionResult struct {
+	Lines []PromotionLine `json:"lines"`
+	Total Money           `json:"total"`
+}
+
+type PromotionCalculator interface {
+	CalculatePromotions(ctx context.Context, request *PromotionRequest) (*PromotionResult, error)
+}
+
+// BuiltinPromotionCalculator applies its promotions in order, a unit used by a promotion isn't used by the following ones.
+// Promotions take the most expensive units first.
+type BuiltinPromotionCalculator struct {
+	Promotions []Promotion
+	MU         sync.RWMutex
+}
+
+func NewBuiltinPromotionCalculator(promotions []Promotion) *BuiltinPromotionCalculator {
+	return &BuiltinPromotionCalculator{
+		Promotions: slices.Clone(promotions),
+	}
+}
+
+func (calculator *BuiltinPromotionCalculator) AddPromotion(promotion Promotion) {
+	calculator.MU.Lock()
+	defer calculator.MU.Unlock()
+	calculator.Promotions = append(calculator.Promotions, promotion)
+}
+
+func (calculator *BuiltinPromotionCalculator) SetPromotions(promotions []Promotion) {
+	calculator.MU.Lock()
+	defer calculator.MU.Unlock()
+	calculator.Promotions = slices.Clone(promotions)
+}
+
+type promotionUnit struct {
+	item  *TaxableItem
+	price Money
+	used  bool
+}
+
+func (calculator *BuiltinPromotionCalculator) CalculatePromotions(ctx context.Context, request *PromotionRequest) (*PromotionResult, error) {
+	calculator.MU.RLock()
+	defer calculator.MU.RUnlock()
+	result := &PromotionResult{
+		Lines: make([]PromotionLine, 0),
+	}
+
+	units := make([]promotionUnit, 0)
+	for i := range request.Items {
+		item := &request.Items[i]
+		for range item.Quantity {
+			units = append(units, promotionUnit{item: item, price: item.UnitPrice})
+		}
+	}
+	slices.SortStableFunc(units, func(a promotionUnit, b promotionUnit) int {
+		return cmp.Compare(b.price.Amount, a.price.Amount)
+	})
+
+	for i := range calculator.Promotions {
+		promotion := &calculator.Promotions[i]
+		pool := make([]*promotionUnit, 0)
+		for j := range units {
+			if !units[j].used && promotionMatches(promotion, units[j].item) {
+				pool = append(pool, &units[j])
+			}
+		}
+		used, amount, err := applyPromotion(promotion, pool)
+		if err != nil {
+			return nil, err
+		}
+		if len(used) == 0 || !amount.IsPositive() {
+			continue
+		}
+
+		line := PromotionLine{
+			Promotion:      promotion.Name,
+			Type:           promotion.Type,
+			ProductItemIDs: make([]uint64, 0),
+			Quantity:       int64(len(used)),
+			Amount:         amount,
+		}
+		for _, unit := range used {
+			unit.used = true
+			if !slices.Contains(line.ProductItemIDs, unit.item.ProductItemID) {
+				line.ProductItemIDs = append(line.ProductItemIDs, unit.item.ProductItemID)
+			}
+		}
+		slices.Sort(line.ProductItemIDs)
+		result.Lines = append(result.Lines, line)
+		total, err := result.Total.Add(amount)
+		if err != nil {
+			return nil, err
+		}
+		result.Total = total
+	}
+	return result, nil
+}
+
+func promotionMatches(promotion *Promotion, item *TaxableItem) bool {
+	if len(promotion.ProductItemIDs) != 0 && !slices.Contains(promotion.ProductItemIDs, item.ProductItemID) {
+		return false
+	}
+	if len(promotion.CategoryIDs) != 0 && !slices.ContainsFunc(item.CategoryIDs, func(id uint64) bool {
+		return slices.Contains(promotion.CategoryIDs, id)
+	}) {
+		return false
+	}
+	return true
+}
+
+// applyPromotion picks the units of the pool the promotion uses and the amount it takes off, the pool is sorted by price descending.
+func applyPromotion(promotion *Promotion, pool []*promotionUnit) ([]*promotionUnit, Money, error) {
+	switch promotion.Type {
+	case PromotionTypeBuyXGetY:
+		group := promotion.BuyQuantity + promotion.GetQuantity
+		if promotion.BuyQuantity <= 0 || promotion.GetQuantity <= 0 {
+			return nil, Money{}, nil
+		}
+		groups := int64(len(pool)) / group
+		used := pool[:groups*group]
+		amount, err := sumUnits(used[int64(len(used))-groups*promotion.GetQuantity:])
+		return used, amount, err
+
+	case PromotionTypeBundlePrice:
+		if promotion.BundleQuantity <= 0 {
+			return nil, Money{}, nil
+		}
+		groups := int64(len(pool)) / promotion.BundleQuantity
+		used := pool[:groups*promotion.BundleQuantity]
+		price, err := sumUnits(used)
+		if err != nil {
+			return nil, Money{}, err
+		}
+		amount, err := price.Sub(promotion.BundlePrice.Mul(groups))
+		return used, amount, err
+
+	case PromotionTypeTieredQuantity:
+		var tier *PromotionTier = nil
+		for i := range promotion.Tiers {
+			if promotion.Tiers[i].MinQuantity <= int64(len(pool)) && (tier == nil || promotion.Tiers[i].MinQuantity > tier.MinQuantity) {
+				tier = &promotion.Tiers[i]
+			}
+		}
+		if tier == nil {
+			return nil, Money{}, nil
+		}
+		price, err := sumUnits(pool)
+		if err != nil {
+			return nil, Money{}, err
+		}
+		return pool, price.MulRate(tier.Percentage / 100), nil
+	}
+	return nil, Money{}, nil
+}
+
+func sumUnits(units []*promotionUnit) (Money, error) {
+	sum := Money{}
+	for _, unit := range units {
+		total, err := sum.Add(unit.price)
+		if err != nil {
+			return Money{}, err
+		}
+		sum = total
+	}
+	return sum, nil
+}
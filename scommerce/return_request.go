@@ -0,0 +1,689 @@
+package scommerce
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Return request statuses, a request moves requested -> approved -> received -> refunding -> refunded or requested -> rejected.
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"  // the items arrived and were inspected
+	ReturnStatusRefunding = "refunding" // the refund is being paid back, a refund which paid nothing back moves back to received
+	ReturnStatusRefunded  = "refunded"
+)
+
+var ErrOrderNotDelivered = errors.New("order isn't delivered, cancel it instead")
+var ErrReturnExceedsQuantity = errors.New("return exceeds the delivered quantity")
+var ErrReturnRequestStatus = errors.New("return request isn't in the expected status")
+
+type ReturnItem struct {
+	ProductItemID uint64 `json:"product_item_id"`
+	Quantity      uint64 `json:"quantity"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+var _ ReturnRequestManager[any] = &BuiltinReturnRequestManager[any]{}
+var _ ReturnRequest[any] = &BuiltinReturnRequest[any]{}
+
+type returnRequestDatabase[AccountID comparable] interface {
+	DBReturnRequest[AccountID]
+}
+
+type returnRequestManagerDatabase[AccountID comparable] interface {
+	DBReturnRequestManager[AccountID]
+	returnRequestDatabase[AccountID]
+}
+
+type BuiltinReturnRequestManager[AccountID comparable] struct {
+	DB           returnRequestManagerDatabase[AccountID]
+	OrderManager UserOrderManager[AccountID]
+}
+
+type ReturnRequestForm[AccountID comparable] struct {
+	ID            uint64        `json:"id"`
+	UserAccountID AccountID     `json:"account_id"`
+	OrderID       *uint64       `json:"order_id,omitempty"`
+	Items         *[]ReturnItem `json:"items,omitempty"`
+	ReceivedItems *[]ReturnItem `json:"received_items,omitempty"`
+	Status        *string       `json:"status,omitempty"`
+	Comment       *string       `json:"comment,omitempty"`
+	Resolution    *string       `json:"resolution,omitempty"`
+	CreditNoteID  *uint64       `json:"credit_note_id,omitempty"`
+	CreatedAt     *time.Time    `json:"created_at,omitempty"`
+}
+
+type BuiltinReturnRequest[AccountID comparable] struct {
+	ReturnRequestForm[AccountID]
+	OrderManager UserOrderManager[AccountID]      `json:"-"`
+	DB           returnRequestDatabase[AccountID] `json:"-"`
+	MU           sync.RWMutex                     `json:"-"`
+}
+
+func NewBuiltinReturnRequestManager[AccountID comparable](db returnRequestManagerDatabase[AccountID], orderManager UserOrderManager[AccountID]) *BuiltinReturnRequestManager[AccountID] {
+	return &BuiltinReturnRequestManager[AccountID]{
+		DB:           db,
+		OrderManager: orderManager,
+	}
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) newReturnRequest(ctx context.Context, rid uint64, aid AccountID, db returnRequestDatabase[AccountID], form *ReturnRequestForm[AccountID]) (*BuiltinReturnRequest[AccountID], error) {
+	request := &BuiltinReturnRequest[AccountID]{
+		ReturnRequestForm: ReturnRequestForm[AccountID]{
+			ID:            rid,
+			UserAccountID: aid,
+		},
+		OrderManager: returnManager.OrderManager,
+		DB:           db,
+	}
+	if err := request.Init(ctx); err != nil {
+		return nil, err
+	}
+	if form != nil {
+		if err := request.ApplyFormObject(ctx, form); err != nil {
+			return nil, err
+		}
+	}
+	return request, nil
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) newReturnRequests(ctx context.Context, requests []ReturnRequest[AccountID], ids []DBReturnRequestResult[AccountID], forms []*ReturnRequestForm[AccountID]) ([]ReturnRequest[AccountID], error) {
+	reqs := requests
+	if reqs == nil {
+		reqs = make([]ReturnRequest[AccountID], 0, len(ids))
+	}
+	for i := range len(ids) {
+		request, err := returnManager.newReturnRequest(ctx, ids[i].ID, ids[i].AID, returnManager.DB, forms[i])
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, request)
+	}
+	return reqs, nil
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) Close(ctx context.Context) error {
+	return nil
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) GetOrderReturnRequests(ctx context.Context, order UserOrder[AccountID], requests []ReturnRequest[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]ReturnRequest[AccountID], error) {
+	var err error = nil
+	oid, err := order.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]DBReturnRequestResult[AccountID], 0, GetSafeLimit(limit))
+	forms := make([]*ReturnRequestForm[AccountID], 0, cap(ids))
+	ids, forms, err = returnManager.DB.GetOrderReturnRequests(ctx, oid, ids, forms, skip, limit, queueOrder)
+	if err != nil {
+		return nil, err
+	}
+	return returnManager.newReturnRequests(ctx, requests, ids, forms)
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) GetReturnRequestCount(ctx context.Context) (uint64, error) {
+	return returnManager.DB.GetReturnRequestCount(ctx)
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) GetReturnRequests(ctx context.Context, requests []ReturnRequest[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]ReturnRequest[AccountID], error) {
+	var err error = nil
+	ids := make([]DBReturnRequestResult[AccountID], 0, GetSafeLimit(limit))
+	forms := make([]*ReturnRequestForm[AccountID], 0, cap(ids))
+	ids, forms, err = returnManager.DB.GetReturnRequests(ctx, ids, forms, skip, limit, queueOrder)
+	if err != nil {
+		return nil, err
+	}
+	return returnManager.newReturnRequests(ctx, requests, ids, forms)
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) GetReturnRequestsWithStatus(ctx context.Context, status string, requests []ReturnRequest[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]ReturnRequest[AccountID], error) {
+	var err error = nil
+	ids := make([]DBReturnRequestResult[AccountID], 0, GetSafeLimit(limit))
+	forms := make([]*ReturnRequestForm[AccountID], 0, cap(ids))
+	ids, forms, err = returnManager.DB.GetReturnRequestsWithStatus(ctx, status, ids, forms, skip, limit, queueOrder)
+	if err != nil {
+		return nil, err
+	}
+	return returnManager.newReturnRequests(ctx, requests, ids, forms)
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) GetReturnRequestWithID(ctx context.Context, rid uint64, fill bool) (ReturnRequest[AccountID], error) {
+	if !fill {
+		var zeroAccountID AccountID
+		return returnManager.newReturnRequest(ctx, rid, zeroAccountID, returnManager.DB, nil)
+	}
+	form := ReturnRequestForm[AccountID]{}
+	err := returnManager.DB.FillReturnRequestWithID(ctx, rid, &form)
+	if err != nil {
+		return nil, err
+	}
+	return returnManager.newReturnRequest(ctx, rid, form.UserAccountID, returnManager.DB, &form)
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) Init(ctx context.Context) error {
+	return returnManager.DB.InitReturnRequestManager(ctx)
+}
+
+// NewReturnRequest opens a return for items of a delivered order. The quantities can't exceed what was delivered
+// minus what was already refunded or is being returned.
+func (returnManager *BuiltinReturnRequestManager[AccountID]) NewReturnRequest(ctx context.Context, order UserOrder[AccountID], items []ReturnItem, comment string) (ReturnRequest[AccountID], error) {
+	if len(items) == 0 {
+		return nil, errors.New("return request has no items")
+	}
+	delivered, err := order.IsDeliveried(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !delivered {
+		return nil, ErrOrderNotDelivered
+	}
+	oid, err := order.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	aid, err := order.GetUserAccountID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items = slices.Clone(items)
+	status := ReturnStatusRequested
+	form := ReturnRequestForm[AccountID]{
+		OrderID: &oid,
+		Items:   &items,
+		Status:  &status,
+		Comment: &comment,
+	}
+	id, err := returnManager.DB.NewReturnRequest(ctx, aid, oid, items, comment, &form)
+	if err != nil {
+		return nil, err
+	}
+	return returnManager.newReturnRequest(ctx, id, aid, returnManager.DB, &form)
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) Pulse(ctx context.Context) error {
+	return nil
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) RemoveAllReturnRequests(ctx context.Context) error {
+	return returnManager.DB.RemoveAllReturnRequests(ctx)
+}
+
+func (returnManager *BuiltinReturnRequestManager[AccountID]) ToBuiltinObject(ctx context.Context) (*BuiltinReturnRequestManager[AccountID], error) {
+	return returnManager, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) Approve(ctx context.Context, note string) error {
+	return request.moveStatus(ctx, ReturnStatusRequested, ReturnStatusApproved, note)
+}
+
+func (request *BuiltinReturnRequest[AccountID]) Close(ctx context.Context) error {
+	return nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) GetComment(ctx context.Context) (string, error) {
+	request.MU.RLock()
+	if request.Comment != nil {
+		defer request.MU.RUnlock()
+		return *request.Comment, nil
+	}
+	request.MU.RUnlock()
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return "", err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return "", err
+	}
+	comment, err := request.DB.GetReturnRequestComment(ctx, &form, id)
+	if err != nil {
+		return "", err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return "", err
+	}
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.Comment = &comment
+	return comment, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) GetCreatedAt(ctx context.Context) (time.Time, error) {
+	request.MU.RLock()
+	if request.CreatedAt != nil {
+		defer request.MU.RUnlock()
+		return *request.CreatedAt, nil
+	}
+	request.MU.RUnlock()
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	createdAt, err := request.DB.GetReturnRequestCreatedAt(ctx, &form, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return time.Time{}, err
+	}
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.CreatedAt = &createdAt
+	return createdAt, nil
+}
+
+// GetCreditNoteID returns the credit note issued when the return was refunded, 0 before that.
+func (request *BuiltinReturnRequest[AccountID]) GetCreditNoteID(ctx context.Context) (uint64, error) {
+	request.MU.RLock()
+	if request.CreditNoteID != nil {
+		defer request.MU.RUnlock()
+		return *request.CreditNoteID, nil
+	}
+	request.MU.RUnlock()
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return 0, err
+	}
+	creditNoteID, err := request.DB.GetReturnRequestCreditNoteID(ctx, &form, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return 0, err
+	}
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.CreditNoteID = &creditNoteID
+	return creditNoteID, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) GetID(ctx context.Context) (uint64, error) {
+	request.MU.RLock()
+	defer request.MU.RUnlock()
+	return request.ID, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) GetItems(ctx context.Context) ([]ReturnItem, error) {
+	request.MU.RLock()
+	if request.Items != nil {
+		defer request.MU.RUnlock()
+		return *request.Items, nil
+	}
+	request.MU.RUnlock()
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := request.DB.GetReturnRequestItems(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.Items = &items
+	return items, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) GetOrder(ctx context.Context) (UserOrder[AccountID], error) {
+	request.MU.RLock()
+	if request.OrderID != nil {
+		defer request.MU.RUnlock()
+		return request.OrderManager.GetOrderWithID(ctx, *request.OrderID, false)
+	}
+	request.MU.RUnlock()
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	oid, err := request.DB.GetReturnRequestOrderID(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	request.MU.Lock()
+	request.OrderID = &oid
+	request.MU.Unlock()
+	return request.OrderManager.GetOrderWithID(ctx, oid, false)
+}
+
+// GetReceivedItems returns the items accepted when the return was inspected, nil before that.
+func (request *BuiltinReturnRequest[AccountID]) GetReceivedItems(ctx context.Context) ([]ReturnItem, error) {
+	request.MU.RLock()
+	if request.ReceivedItems != nil {
+		defer request.MU.RUnlock()
+		return *request.ReceivedItems, nil
+	}
+	request.MU.RUnlock()
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := request.DB.GetReturnRequestReceivedItems(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	if items == nil {
+		return nil, nil
+	}
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.ReceivedItems = &items
+	return items, nil
+}
+
+// GetResolution returns the note of the last admin decision on the request.
+func (request *BuiltinReturnRequest[AccountID]) GetResolution(ctx context.Context) (string, error) {
+	request.MU.RLock()
+	if request.Resolution != nil {
+		defer request.MU.RUnlock()
+		return *request.Resolution, nil
+	}
+	request.MU.RUnlock()
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return "", err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return "", err
+	}
+	resolution, err := request.DB.GetReturnRequestResolution(ctx, &form, id)
+	if err != nil {
+		return "", err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return "", err
+	}
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.Resolution = &resolution
+	return resolution, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) GetStatus(ctx context.Context) (string, error) {
+	request.MU.RLock()
+	if request.Status != nil {
+		defer request.MU.RUnlock()
+		return *request.Status, nil
+	}
+	request.MU.RUnlock()
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return "", err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return "", err
+	}
+	status, err := request.DB.GetReturnRequestStatus(ctx, &form, id)
+	if err != nil {
+		return "", err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return "", err
+	}
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.Status = &status
+	return status, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) GetUserAccountID(ctx context.Context) (AccountID, error) {
+	request.MU.RLock()
+	defer request.MU.RUnlock()
+	return request.UserAccountID, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) Init(ctx context.Context) error {
+	return nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) Pulse(ctx context.Context) error {
+	return nil
+}
+
+// Receive records the inspection of an approved return. items are the accepted quantities, at most the requested
+// ones; nil accepts everything requested. Only accepted items are put back in stock by Refund.
+func (request *BuiltinReturnRequest[AccountID]) Receive(ctx context.Context, items []ReturnItem, note string) error {
+	if items == nil {
+		requested, err := request.GetItems(ctx)
+		if err != nil {
+			return err
+		}
+		items = requested
+	}
+	accepted := make([]ReturnItem, 0, len(items))
+	for _, item := range items {
+		if item.Quantity > 0 {
+			accepted = append(accepted, item)
+		}
+	}
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := request.DB.ReceiveReturnRequest(ctx, &form, id, accepted, note); err != nil {
+		return err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	status := ReturnStatusReceived
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.ReceivedItems = &accepted
+	request.Status = &status
+	request.Resolution = &note
+	return nil
+}
+
+// Refund refunds amount through the order of a received return, restocks the accepted items and issues a credit
+// note for them. The request is claimed by moving it to refunding first, so it's refunded once.
+func (request *BuiltinReturnRequest[AccountID]) Refund(ctx context.Context, amount Money) (*CreditNote[AccountID], error) {
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	creditNote, err := request.refundOrder(ctx, id, amount)
+	if err != nil {
+		return creditNote, err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return creditNote, err
+	}
+	if err := request.DB.SetReturnRequestRefunded(ctx, &form, id, creditNote.ID); err != nil {
+		return creditNote, err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return creditNote, err
+	}
+	status := ReturnStatusRefunded
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.Status = &status
+	request.CreditNoteID = &creditNote.ID
+	return creditNote, nil
+}
+
+// refundOrder refunds the received items through the order and links the request to the credit note. A request left
+// refunding with a credit note was paid back by an earlier call, its credit note is returned instead of refunding
+// again. Only a refund which paid nothing back moves the request back to received.
+func (request *BuiltinReturnRequest[AccountID]) refundOrder(ctx context.Context, id uint64, amount Money) (*CreditNote[AccountID], error) {
+	order, err := request.GetOrder(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status, err := request.DB.GetReturnRequestStatus(ctx, nil, id)
+	if err != nil {
+		return nil, err
+	}
+	creditNoteID, err := request.DB.GetReturnRequestCreditNoteID(ctx, nil, id)
+	if err != nil {
+		return nil, err
+	}
+	if status == ReturnStatusRefunding && creditNoteID != 0 {
+		creditNotes, err := order.GetCreditNotes(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i := range creditNotes {
+			if creditNotes[i].ID == creditNoteID {
+				return &creditNotes[i], nil
+			}
+		}
+		return nil, errors.New("credit note " + strconv.FormatUint(creditNoteID, 10) + " of the return request isn't issued")
+	}
+	received, err := request.GetReceivedItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]RefundItem, 0, len(received))
+	for _, item := range received {
+		items = append(items, RefundItem{ProductItemID: item.ProductItemID, Quantity: item.Quantity})
+	}
+	resolution, err := request.GetResolution(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := request.moveStatus(ctx, ReturnStatusReceived, ReturnStatusRefunding, resolution); err != nil {
+		return nil, err
+	}
+	creditNote, err := order.Refund(ctx, items, amount, resolution)
+	if creditNote == nil {
+		return nil, errors.Join(err, request.moveStatus(ctx, ReturnStatusRefunding, ReturnStatusReceived, resolution))
+	}
+	form, formErr := request.ReturnRequestForm.Clone(ctx)
+	if formErr != nil {
+		return creditNote, errors.Join(err, formErr)
+	}
+	if linkErr := request.DB.SetReturnRequestCreditNote(ctx, &form, id, creditNote.ID); linkErr != nil {
+		return creditNote, errors.Join(err, linkErr)
+	}
+	if err != nil {
+		return creditNote, err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return creditNote, err
+	}
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.CreditNoteID = &creditNote.ID
+	return creditNote, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) Reject(ctx context.Context, reason string) error {
+	return request.moveStatus(ctx, ReturnStatusRequested, ReturnStatusRejected, reason)
+}
+
+func (request *BuiltinReturnRequest[AccountID]) moveStatus(ctx context.Context, from string, to string, resolution string) error {
+	id, err := request.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := request.ReturnRequestForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := request.DB.UpdateReturnRequestStatus(ctx, &form, id, from, to, resolution); err != nil {
+		return err
+	}
+	if err := request.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	request.Status = &to
+	request.Resolution = &resolution
+	return nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) ToBuiltinObject(ctx context.Context) (*BuiltinReturnRequest[AccountID], error) {
+	return request, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) ToFormObject(ctx context.Context) (*ReturnRequestForm[AccountID], error) {
+	request.MU.RLock()
+	defer request.MU.RUnlock()
+	return &request.ReturnRequestForm, nil
+}
+
+func (request *BuiltinReturnRequest[AccountID]) ApplyFormObject(ctx context.Context, form *ReturnRequestForm[AccountID]) error {
+	request.MU.Lock()
+	defer request.MU.Unlock()
+	if form.ID != 0 {
+		request.ID = form.ID
+	}
+	var zeroAccountID AccountID
+	if form.UserAccountID != zeroAccountID {
+		request.UserAccountID = form.UserAccountID
+	}
+	if form.OrderID != nil {
+		request.OrderID = form.OrderID
+	}
+	if form.Items != nil {
+		request.Items = form.Items
+	}
+	if form.ReceivedItems != nil {
+		request.ReceivedItems = form.ReceivedItems
+	}
+	if form.Status != nil {
+		request.Status = form.Status
+	}
+	if form.Comment != nil {
+		request.Comment = form.Comment
+	}
+	if form.Resolution != nil {
+		request.Resolution = form.Resolution
+	}
+	if form.CreditNoteID != nil {
+		request.CreditNoteID = form.CreditNoteID
+	}
+	if form.CreatedAt != nil {
+		request.CreatedAt = form.CreatedAt
+	}
+	return nil
+}
+
+func (form *ReturnRequestForm[AccountID]) Clone(ctx context.Context) (ReturnRequestForm[AccountID], error) {
+	var cloned ReturnRequestForm[AccountID] = *form
+	return cloned, nil
+}
@@ -0,0 +1,562 @@
+package scommerce
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrShipmentExceedsQuantity = errors.New("shipment exceeds the ordered quantity")
+var ErrOrderNotShippable = errors.New("order isn't paid or shipping")
+
+type ShipmentItem struct {
+	ProductItemID uint64 `json:"product_item_id"`
+	Quantity      uint64 `json:"quantity"`
+}
+
+var _ ShipmentManager[any] = &BuiltinShipmentManager[any]{}
+var _ Shipment[any] = &BuiltinShipment[any]{}
+
+type shipmentDatabase interface {
+	DBShipment
+}
+
+type shipmentManagerDatabase interface {
+	DBShipmentManager
+	shipmentDatabase
+}
+
+type BuiltinShipmentManager[AccountID comparable] struct {
+	DB           shipmentManagerDatabase
+	OrderManager UserOrderManager[AccountID]
+}
+
+type ShipmentForm struct {
+	ID             uint64          `json:"id"`
+	OrderID        *uint64         `json:"order_id,omitempty"`
+	Carrier        *string         `json:"carrier,omitempty"`
+	TrackingNumber *string         `json:"tracking_number,omitempty"`
+	Items          *[]ShipmentItem `json:"items,omitempty"`
+	ShippedAt      *time.Time      `json:"shipped_at,omitempty"`   // zero until the shipment leaves
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"` // zero until the shipment arrives
+}
+
+type BuiltinShipment[AccountID comparable] struct {
+	ShipmentForm
+	OrderManager UserOrderManager[AccountID] `json:"-"`
+	DB           shipmentDatabase            `json:"-"`
+	MU           sync.RWMutex                `json:"-"`
+}
+
+func NewBuiltinShipmentManager[AccountID comparable](db shipmentManagerDatabase, orderManager UserOrderManager[AccountID]) *BuiltinShipmentManager[AccountID] {
+	return &BuiltinShipmentManager[AccountID]{
+		DB:           db,
+		OrderManager: orderManager,
+	}
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) newShipment(ctx context.Context, shid uint64, db shipmentDatabase, form *ShipmentForm) (*BuiltinShipment[AccountID], error) {
+	shipment := &BuiltinShipment[AccountID]{
+		ShipmentForm: ShipmentForm{
+			ID: shid,
+		},
+		OrderManager: shipmentManager.OrderManager,
+		DB:           db,
+	}
+	if err := shipment.Init(ctx); err != nil {
+		return nil, err
+	}
+	if form != nil {
+		if err := shipment.ApplyFormObject(ctx, form); err != nil {
+			return nil, err
+		}
+	}
+	return shipment, nil
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) newShipments(ctx context.Context, shipments []Shipment[AccountID], ids []uint64, forms []*ShipmentForm) ([]Shipment[AccountID], error) {
+	shps := shipments
+	if shps == nil {
+		shps = make([]Shipment[AccountID], 0, len(ids))
+	}
+	for i := range len(ids) {
+		shipment, err := shipmentManager.newShipment(ctx, ids[i], shipmentManager.DB, forms[i])
+		if err != nil {
+			return nil, err
+		}
+		shps = append(shps, shipment)
+	}
+	return shps, nil
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) Close(ctx context.Context) error {
+	return nil
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) GetOrderByTrackingNumber(ctx context.Context, trackingNumber string) (UserOrder[AccountID], error) {
+	shipment, err := shipmentManager.GetShipmentByTrackingNumber(ctx, trackingNumber)
+	if err != nil {
+		return nil, err
+	}
+	return shipment.GetOrder(ctx)
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) GetOrderShipments(ctx context.Context, order UserOrder[AccountID], shipments []Shipment[AccountID]) ([]Shipment[AccountID], error) {
+	oid, err := order.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, 0, 4)
+	forms := make([]*ShipmentForm, 0, cap(ids))
+	ids, forms, err = shipmentManager.DB.GetOrderShipments(ctx, oid, ids, forms)
+	if err != nil {
+		return nil, err
+	}
+	return shipmentManager.newShipments(ctx, shipments, ids, forms)
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) GetShipmentByTrackingNumber(ctx context.Context, trackingNumber string) (Shipment[AccountID], error) {
+	form := ShipmentForm{}
+	id, err := shipmentManager.DB.GetShipmentByTrackingNumber(ctx, trackingNumber, &form)
+	if err != nil {
+		return nil, err
+	}
+	return shipmentManager.newShipment(ctx, id, shipmentManager.DB, &form)
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) GetShipmentCount(ctx context.Context) (uint64, error) {
+	return shipmentManager.DB.GetShipmentCount(ctx)
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) GetShipments(ctx context.Context, shipments []Shipment[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]Shipment[AccountID], error) {
+	var err error = nil
+	ids := make([]uint64, 0, GetSafeLimit(limit))
+	forms := make([]*ShipmentForm, 0, cap(ids))
+	ids, forms, err = shipmentManager.DB.GetShipments(ctx, ids, forms, skip, limit, queueOrder)
+	if err != nil {
+		return nil, err
+	}
+	return shipmentManager.newShipments(ctx, shipments, ids, forms)
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) GetShipmentWithID(ctx context.Context, shid uint64, fill bool) (Shipment[AccountID], error) {
+	if !fill {
+		return shipmentManager.newShipment(ctx, shid, shipmentManager.DB, nil)
+	}
+	form := ShipmentForm{}
+	err := shipmentManager.DB.FillShipmentWithID(ctx, shid, &form)
+	if err != nil {
+		return nil, err
+	}
+	return shipmentManager.newShipment(ctx, shid, shipmentManager.DB, &form)
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) Init(ctx context.Context) error {
+	return shipmentManager.DB.InitShipmentManager(ctx)
+}
+
+// NewShipment puts items of an order in a box. The order must be paid or already shipping other boxes, and the
+// quantities can't exceed what was ordered minus what the other shipments of the order hold.
+func (shipmentManager *BuiltinShipmentManager[AccountID]) NewShipment(ctx context.Context, order UserOrder[AccountID], carrier string, trackingNumber string, items []ShipmentItem) (Shipment[AccountID], error) {
+	if len(items) == 0 {
+		return nil, errors.New("shipment has no items")
+	}
+	oid, err := order.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items = slices.Clone(items)
+	var notYet time.Time
+	form := ShipmentForm{
+		OrderID:        &oid,
+		Carrier:        &carrier,
+		TrackingNumber: &trackingNumber,
+		Items:          &items,
+		ShippedAt:      &notYet,
+		DeliveredAt:    &notYet,
+	}
+	id, err := shipmentManager.DB.NewShipment(ctx, oid, carrier, trackingNumber, items, &form)
+	if err != nil {
+		return nil, err
+	}
+	return shipmentManager.newShipment(ctx, id, shipmentManager.DB, &form)
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) Pulse(ctx context.Context) error {
+	return nil
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) RemoveAllShipments(ctx context.Context) error {
+	return shipmentManager.DB.RemoveAllShipments(ctx)
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) RemoveShipment(ctx context.Context, shipment Shipment[AccountID]) error {
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	return shipmentManager.DB.RemoveShipment(ctx, id)
+}
+
+func (shipmentManager *BuiltinShipmentManager[AccountID]) ToBuiltinObject(ctx context.Context) (*BuiltinShipmentManager[AccountID], error) {
+	return shipmentManager, nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) Close(ctx context.Context) error {
+	return nil
+}
+
+// Deliver records the arrival of the shipment. Once every ordered item arrived the order is delivered in the same
+// transaction.
+func (shipment *BuiltinShipment[AccountID]) Deliver(ctx context.Context, at time.Time) error {
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	trackingNumber, err := shipment.GetTrackingNumber(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := shipment.ShipmentForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := shipment.DB.DeliverShipment(ctx, &form, id, at, "last shipment "+trackingNumber+" delivered"); err != nil {
+		return err
+	}
+	if err := shipment.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	shipment.MU.Lock()
+	defer shipment.MU.Unlock()
+	shipment.DeliveredAt = &at
+	if shipment.ShippedAt != nil && shipment.ShippedAt.IsZero() {
+		shipment.ShippedAt = &at
+	}
+	return nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) GetCarrier(ctx context.Context) (string, error) {
+	shipment.MU.RLock()
+	if shipment.Carrier != nil {
+		defer shipment.MU.RUnlock()
+		return *shipment.Carrier, nil
+	}
+	shipment.MU.RUnlock()
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return "", err
+	}
+	form, err := shipment.ShipmentForm.Clone(ctx)
+	if err != nil {
+		return "", err
+	}
+	carrier, err := shipment.DB.GetShipmentCarrier(ctx, &form, id)
+	if err != nil {
+		return "", err
+	}
+	if err := shipment.ApplyFormObject(ctx, &form); err != nil {
+		return "", err
+	}
+	shipment.MU.Lock()
+	defer shipment.MU.Unlock()
+	shipment.Carrier = &carrier
+	return carrier, nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) GetDeliveredAt(ctx context.Context) (time.Time, error) {
+	shipment.MU.RLock()
+	if shipment.DeliveredAt != nil {
+		defer shipment.MU.RUnlock()
+		return *shipment.DeliveredAt, nil
+	}
+	shipment.MU.RUnlock()
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	form, err := shipment.ShipmentForm.Clone(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	deliveredAt, err := shipment.DB.GetShipmentDeliveredAt(ctx, &form, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := shipment.ApplyFormObject(ctx, &form); err != nil {
+		return time.Time{}, err
+	}
+	shipment.MU.Lock()
+	defer shipment.MU.Unlock()
+	shipment.DeliveredAt = &deliveredAt
+	return deliveredAt, nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) GetID(ctx context.Context) (uint64, error) {
+	shipment.MU.RLock()
+	defer shipment.MU.RUnlock()
+	return shipment.ID, nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) GetItems(ctx context.Context) ([]ShipmentItem, error) {
+	shipment.MU.RLock()
+	if shipment.Items != nil {
+		defer shipment.MU.RUnlock()
+		return *shipment.Items, nil
+	}
+	shipment.MU.RUnlock()
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := shipment.ShipmentForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := shipment.DB.GetShipmentItems(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := shipment.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	shipment.MU.Lock()
+	defer shipment.MU.Unlock()
+	shipment.Items = &items
+	return items, nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) GetOrder(ctx context.Context) (UserOrder[AccountID], error) {
+	shipment.MU.RLock()
+	if shipment.OrderID != nil {
+		defer shipment.MU.RUnlock()
+		return shipment.OrderManager.GetOrderWithID(ctx, *shipment.OrderID, false)
+	}
+	shipment.MU.RUnlock()
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := shipment.ShipmentForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	oid, err := shipment.DB.GetShipmentOrderID(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := shipment.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	shipment.MU.Lock()
+	shipment.OrderID = &oid
+	shipment.MU.Unlock()
+	return shipment.OrderManager.GetOrderWithID(ctx, oid, false)
+}
+
+func (shipment *BuiltinShipment[AccountID]) GetShippedAt(ctx context.Context) (time.Time, error) {
+	shipment.MU.RLock()
+	if shipment.ShippedAt != nil {
+		defer shipment.MU.RUnlock()
+		return *shipment.ShippedAt, nil
+	}
+	shipment.MU.RUnlock()
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	form, err := shipment.ShipmentForm.Clone(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	shippedAt, err := shipment.DB.GetShipmentShippedAt(ctx, &form, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := shipment.ApplyFormObject(ctx, &form); err != nil {
+		return time.Time{}, err
+	}
+	shipment.MU.Lock()
+	defer shipment.MU.Unlock()
+	shipment.ShippedAt = &shippedAt
+	return shippedAt, nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) GetTrackingNumber(ctx context.Context) (string, error) {
+	shipment.MU.RLock()
+	if shipment.TrackingNumber != nil {
+		defer shipment.MU.RUnlock()
+		return *shipment.TrackingNumber, nil
+	}
+	shipment.MU.RUnlock()
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return "", err
+	}
+	form, err := shipment.ShipmentForm.Clone(ctx)
+	if err != nil {
+		return "", err
+	}
+	trackingNumber, err := shipment.DB.GetShipmentTrackingNumber(ctx, &form, id)
+	if err != nil {
+		return "", err
+	}
+	if err := shipment.ApplyFormObject(ctx, &form); err != nil {
+		return "", err
+	}
+	shipment.MU.Lock()
+	defer shipment.MU.Unlock()
+	shipment.TrackingNumber = &trackingNumber
+	return trackingNumber, nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) Init(ctx context.Context) error {
+	return nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) IsDeliveried(ctx context.Context) (bool, error) {
+	deliveredAt, err := shipment.GetDeliveredAt(ctx)
+	if err != nil {
+		return false, err
+	}
+	return !deliveredAt.IsZero(), nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) Pulse(ctx context.Context) error {
+	return nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) SetCarrier(ctx context.Context, carrier string) error {
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := shipment.ShipmentForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := shipment.DB.SetShipmentCarrier(ctx, &form, id, carrier); err != nil {
+		return err
+	}
+	if err := shipment.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	shipment.MU.Lock()
+	defer shipment.MU.Unlock()
+	shipment.Carrier = &carrier
+	return nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) SetTrackingNumber(ctx context.Context, trackingNumber string) error {
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := shipment.ShipmentForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := shipment.DB.SetShipmentTrackingNumber(ctx, &form, id, trackingNumber); err != nil {
+		return err
+	}
+	if err := shipment.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	shipment.MU.Lock()
+	defer shipment.MU.Unlock()
+	shipment.TrackingNumber = &trackingNumber
+	return nil
+}
+
+// Ship records the departure of the shipment, the first shipment moves the order to the shipped status. It fails
+// with ErrInvalidOrderStatusTransition when the order can't be shipped.
+func (shipment *BuiltinShipment[AccountID]) Ship(ctx context.Context, at time.Time) error {
+	order, err := shipment.GetOrder(ctx)
+	if err != nil {
+		return err
+	}
+	builtinOrder, err := order.ToBuiltinObject(ctx)
+	if err != nil {
+		return err
+	}
+	statusName, err := builtinOrder.getStatusName(ctx)
+	if err != nil {
+		return err
+	}
+	// an earlier box already shipped the order
+	firstBox := statusName != OrderStatusShipped
+	if firstBox {
+		if err := builtinOrder.checkStatusTransition(ctx, OrderStatusShipped); err != nil {
+			return err
+		}
+	}
+	id, err := shipment.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := shipment.ShipmentForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := shipment.DB.ShipShipment(ctx, &form, id, at); err != nil {
+		return err
+	}
+	if err := shipment.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	shipment.MU.Lock()
+	shipment.ShippedAt = &at
+	shipment.MU.Unlock()
+	if !firstBox {
+		return nil
+	}
+	trackingNumber, err := shipment.GetTrackingNumber(ctx)
+	if err != nil {
+		return err
+	}
+	return builtinOrder.setStatusName(ctx, OrderStatusShipped, "shipment "+trackingNumber+" shipped")
+}
+
+func (shipment *BuiltinShipment[AccountID]) ToBuiltinObject(ctx context.Context) (*BuiltinShipment[AccountID], error) {
+	return shipment, nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) ToFormObject(ctx context.Context) (*ShipmentForm, error) {
+	shipment.MU.RLock()
+	defer shipment.MU.RUnlock()
+	return &shipment.ShipmentForm, nil
+}
+
+func (shipment *BuiltinShipment[AccountID]) ApplyFormObject(ctx context.Context, form *ShipmentForm) error {
+	shipment.MU.Lock()
+	defer shipment.MU.Unlock()
+	if form.ID != 0 {
+		shipment.ID = form.ID
+	}
+	if form.OrderID != nil {
+		shipment.OrderID = form.OrderID
+	}
+	if form.Carrier != nil {
+		shipment.Carrier = form.Carrier
+	}
+	if form.TrackingNumber != nil {
+		shipment.TrackingNumber = form.TrackingNumber
+	}
+	if form.Items != nil {
+		shipment.Items = form.Items
+	}
+	if form.ShippedAt != nil {
+		shipment.ShippedAt = form.ShippedAt
+	}
+	if form.DeliveredAt != nil {
+		shipment.DeliveredAt = form.DeliveredAt
+	}
+	return nil
+}
+
+func (form *ShipmentForm) Clone(ctx context.Context) (ShipmentForm, error) {
+	var cloned ShipmentForm = *form
+	return cloned, nil
+}
@@ -18,9 +18,9 @@ type BuiltinShippingMethodManager struct {
 }
 
 type ShippingMethodForm struct {
-	ID    uint64   `json:"id"`
-	Name  *string  `json:"name,omitempty"`
-	Price *float64 `json:"price,omitempty"`
+	ID    uint64  `json:"id"`
+	Name  *string `json:"name,omitempty"`
+	Price *Money  `json:"price,omitempty"`
 }
 
 type BuiltinShippingMethod struct {
@@ -112,7 +112,7 @@ func (shippingMethodManager *BuiltinShippingMethodManager) Init(ctx context.Cont
 	return shippingMethodManager.DB.InitShippingMethodManager(ctx)
 }
 
-func (shippingMethodManager *BuiltinShippingMethodManager) NewShippingMethod(ctx context.Context, name string, price float64) (ShippingMethod, error) {
+func (shippingMethodManager *BuiltinShippingMethodManager) NewShippingMethod(ctx context.Context, name string, price Money) (ShippingMethod, error) {
 	shippingForm := ShippingMethodForm{}
 	id, err := shippingMethodManager.DB.NewShippingMethod(ctx, name, price, &shippingForm)
 	if err != nil {
@@ -208,7 +208,7 @@ func (shippingMethod *BuiltinShippingMethod) SetName(ctx context.Context, name s
 	return nil
 }
 
-func (shippingMethod *BuiltinShippingMethod) GetPrice(ctx context.Context) (float64, error) {
+func (shippingMethod *BuiltinShippingMethod) GetPrice(ctx context.Context) (Money, error) {
 	shippingMethod.MU.RLock()
 	if shippingMethod.Price != nil {
 		defer shippingMethod.MU.RUnlock()
@@ -217,18 +217,18 @@ func (shippingMethod *BuiltinShippingMethod) GetPrice(ctx context.Context) (floa
 	shippingMethod.MU.RUnlock()
 	id, err := shippingMethod.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := shippingMethod.ShippingMethodForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	price, err := shippingMethod.DB.GetShippingMethodPrice(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := shippingMethod.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	shippingMethod.MU.Lock()
 	defer shippingMethod.MU.Unlock()
@@ -236,7 +236,7 @@ func (shippingMethod *BuiltinShippingMethod) GetPrice(ctx context.Context) (floa
 	return price, nil
 }
 
-func (shippingMethod *BuiltinShippingMethod) SetPrice(ctx context.Context, price float64) error {
+func (shippingMethod *BuiltinShippingMethod) SetPrice(ctx context.Context, price Money) error {
 	id, err := shippingMethod.GetID(ctx)
 	if err != nil {
 		return err
@@ -0,0 +1,216 @@
+package scommerce
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var _ ShippingRateCalculator = &BuiltinShippingRateCalculator{}
+
+var ErrNoShippingRate = errors.New("no shipping rate fits the parcel")
+
+type ShippableItem struct {
+	ProductItemID uint64                `json:"product_item_id"`
+	UnitPrice     Money                 `json:"unit_price"`
+	Quantity      int64                 `json:"quantity"`
+	Weight        float64               `json:"weight"` // kilograms of one unit
+	Dimensions    ProductItemDimensions `json:"dimensions"`
+}
+
+type ShippingRateRequest struct {
+	Items            []ShippableItem `json:"items"`
+	ShippingMethodID uint64          `json:"shipping_method_id"`
+	BasePrice        Money           `json:"base_price"` // flat price of the shipping method
+	CountryID        uint64          `json:"country_id"` // 0 if the address is unknown
+	Region           string          `json:"region"`
+}
+
+// Subtotal is the price of the items before discounts and taxes.
+func (request *ShippingRateRequest) Subtotal() (Money, error) {
+	subtotal := Money{}
+	for _, item := range request.Items {
+		total, err := subtotal.Add(item.UnitPrice.Mul(item.Quantity))
+		if err != nil {
+			return Money{}, err
+		}
+		subtotal = total
+	}
+	return subtotal, nil
+}
+
+// Weight is the total weight of the parcel in kilograms.
+func (request *ShippingRateRequest) Weight() float64 {
+	weight := 0.0
+	for _, item := range request.Items {
+		weight += item.Weight * float64(item.Quantity)
+	}
+	return weight
+}
+
+// Volume is the total volume of the parcel in cubic centimeters.
+func (request *ShippingRateRequest) Volume() float64 {
+	volume := 0.0
+	for _, item := range request.Items {
+		volume += item.Dimensions.Volume() * float64(item.Quantity)
+	}
+	return volume
+}
+
+type ShippingRateCalculator interface {
+	CalculateShippingRate(ctx context.Context, request *ShippingRateRequest) (Money, error)
+}
+
+// ShippingZone groups destinations sharing their shipping rates.
+type ShippingZone struct {
+	Name       string   `json:"name"`
+	CountryIDs []uint64 `json:"country_ids"`
+	Regions    []string `json:"regions,omitempty"` // empty matches every region of the countries
+}
+
+// ShippingRateTier prices parcels up to its limits, a zero limit is unbounded.
+type ShippingRateTier struct {
+	MaxWeight float64 `json:"max_weight,omitempty"` // kilograms
+	MaxVolume float64 `json:"max_volume,omitempty"` // cubic centimeters
+	Price     Money   `json:"price"`
+}
+
+// ShippingRateRule applies to the parcels matching all of its non-zero scopes.
+// Only the most specific matching rule is applied, and its first tier fitting the parcel sets the price.
+type ShippingRateRule struct {
+	Zone              string             `json:"zone,omitempty"`
+	ShippingMethodID  uint64             `json:"shipping_method_id,omitempty"`
+	Tiers             []ShippingRateTier `json:"tiers"`
+	FreeShippingAbove Money              `json:"free_shipping_above"` // subtotal from which shipping is free, zero disables it
+}
+
+// BuiltinShippingRateCalculator charges the flat price of the shipping method when no rule matches.
+type BuiltinShippingRateCalculator struct {
+	Zones []ShippingZone
+	Rules []ShippingRateRule
+	MU    sync.RWMutex
+}
+
+func NewBuiltinShippingRateCalculator(zones []ShippingZone, rules []ShippingRateRule) *BuiltinShippingRateCalculator {
+	return &BuiltinShippingRateCalculator{
+		Zones: slices.Clone(zones),
+		Rules: slices.Clone(rules),
+	}
+}
+
+func (calculator *BuiltinShippingRateCalculator) AddZone(zone ShippingZone) {
+	calculator.MU.Lock()
+	defer calculator.MU.Unlock()
+	calculator.Zones = append(calculator.Zones, zone)
+}
+
+func (calculator *BuiltinShippingRateCalculator) SetZones(zones []ShippingZone) {
+	calculator.MU.Lock()
+	defer calculator.MU.Unlock()
+	calculator.Zones = slices.Clone(zones)
+}
+
+func (calculator *BuiltinShippingRateCalculator) AddRule(rule ShippingRateRule) {
+	calculator.MU.Lock()
+	defer calculator.MU.Unlock()
+	calculator.Rules = append(calculator.Rules, rule)
+}
+
+func (calculator *BuiltinShippingRateCalculator) SetRules(rules []ShippingRateRule) {
+	calculator.MU.Lock()
+	defer calculator.MU.Unlock()
+	calculator.Rules = slices.Clone(rules)
+}
+
+func (calculator *BuiltinShippingRateCalculator) CalculateShippingRate(ctx context.Context, request *ShippingRateRequest) (Money, error) {
+	calculator.MU.RLock()
+	defer calculator.MU.RUnlock()
+	rule := calculator.matchRule(request)
+	if rule == nil {
+		return request.BasePrice, nil
+	}
+	if !rule.FreeShippingAbove.IsZero() {
+		subtotal, err := request.Subtotal()
+		if err != nil {
+			return Money{}, err
+		}
+		cmp, err := subtotal.Cmp(rule.FreeShippingAbove)
+		if err != nil {
+			return Money{}, err
+		}
+		if cmp >= 0 {
+			return Money{Currency: request.BasePrice.Currency}, nil
+		}
+	}
+	weight := request.Weight()
+	volume := request.Volume()
+	for _, tier := range rule.Tiers {
+		if tier.MaxWeight != 0 && weight > tier.MaxWeight {
+			continue
+		}
+		if tier.MaxVolume != 0 && volume > tier.MaxVolume {
+			continue
+		}
+		return tier.Price, nil
+	}
+	return Money{}, ErrNoShippingRate
+}
+
+func (calculator *BuiltinShippingRateCalculator) matchRule(request *ShippingRateRequest) *ShippingRateRule {
+	var best *ShippingRateRule = nil
+	bestScore := -1
+	for i := range calculator.Rules {
+		rule := &calculator.Rules[i]
+		score, ok := calculator.ruleSpecificity(rule, request)
+		if !ok || score <= bestScore {
+			continue
+		}
+		best = rule
+		bestScore = score
+	}
+	return best
+}
+
+// ruleSpecificity scores how narrowly a rule targets the parcel, a shipping method beats a region and a region beats a country.
+func (calculator *BuiltinShippingRateCalculator) ruleSpecificity(rule *ShippingRateRule, request *ShippingRateRequest) (int, bool) {
+	score := 0
+	if rule.ShippingMethodID != 0 {
+		if rule.ShippingMethodID != request.ShippingMethodID {
+			return 0, false
+		}
+		score += 4
+	}
+	if rule.Zone != "" {
+		zoneScore := -1
+		for _, zone := range calculator.Zones {
+			if zone.Name != rule.Zone {
+				continue
+			}
+			if s, ok := zoneSpecificity(&zone, request); ok && s > zoneScore {
+				zoneScore = s
+			}
+		}
+		if zoneScore < 0 {
+			return 0, false
+		}
+		score += zoneScore
+	}
+	return score, true
+}
+
+func zoneSpecificity(zone *ShippingZone, request *ShippingRateRequest) (int, bool) {
+	if !slices.Contains(zone.CountryIDs, request.CountryID) {
+		return 0, false
+	}
+	if len(zone.Regions) == 0 {
+		return 1, true
+	}
+	for _, region := range zone.Regions {
+		if strings.EqualFold(region, request.Region) {
+			return 2, true
+		}
+	}
+	return 0, false
+}
@@ -3,9 +3,49 @@ package scommerce
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+var ErrInsufficientStock = errors.New("insufficient stock")
+var ErrShoppingCartNotGuest = errors.New("shopping cart belongs to an account")
+var ErrShoppingCartChanged = errors.New("shopping cart changed while it was ordered")
+
+type InsufficientStockItem struct {
+	ProductItemID uint64 `json:"product_item_id"`
+	Requested     int64  `json:"requested"`
+	Available     int64  `json:"available"`
+}
+
+// InsufficientStockError is returned by UserShoppingCart.Order when one or more
+// cart items request more units than the product item has in stock.
+// It matches ErrInsufficientStock with errors.Is.
+type InsufficientStockError struct {
+	Items []InsufficientStockItem `json:"items"`
+}
+
+func (err *InsufficientStockError) Error() string {
+	parts := make([]string, 0, len(err.Items))
+	for _, item := range err.Items {
+		parts = append(parts, "product item "+strconv.FormatUint(item.ProductItemID, 10)+" (requested "+strconv.FormatInt(item.Requested, 10)+", available "+strconv.FormatInt(item.Available, 10)+")")
+	}
+	return ErrInsufficientStock.Error() + ": " + strings.Join(parts, ", ")
+}
+
+func (err *InsufficientStockError) Unwrap() error {
+	return ErrInsufficientStock
+}
+
+// DefaultAbandonedCartThreshold is how long a cart is inactive before it counts as abandoned.
+const DefaultAbandonedCartThreshold = 24 * time.Hour
+
+// DefaultShoppingCartRetention is how long an inactive cart is kept before Pulse removes it.
+const DefaultShoppingCartRetention = 90 * 24 * time.Hour
+
 var _ UserShoppingCartManager[any] = &BuiltinUserShoppingCartManager[any]{}
 var _ UserShoppingCart[any] = &BuiltinUserShoppingCart[any]{}
 
@@ -19,12 +59,30 @@ type userShoppingCartDatabase[AccountID comparable] interface {
 	DBUserShoppingCartItem[AccountID]
 	userOrderDatabase[AccountID]
 	productItemDatabase[AccountID]
+	// the discount a code takes off is known before checkout, so the taxes apply to the discounted prices
+	PreviewUserDiscount(ctx context.Context, code string, sid uint64, shippingMethod uint64, shippingCost *Money) (UserDiscountPreview, error)
+}
+
+// OrderPricing is what UserShoppingCart.Order priced the cart at before the checkout transaction, which rejects
+// the order with ErrShoppingCartChanged when its lines or its discount no longer match the cart.
+type OrderPricing struct {
+	Items      []TaxableItem    // the cart lines in order, Discount is their share of the promotions and the discount
+	Promotion  Money            // taken off the items by the promotions, at most their subtotal
+	Discount   Money            // taken off the items by the discount code, after the promotions
+	Tax        *TaxResult       // computed on the items less their discounts, nil when no tax applies
+	Promotions *PromotionResult // nil when no promotion applies
 }
 
 type BuiltinUserShoppingCartManager[AccountID comparable] struct {
-	DB                 userShoppingCartManagerDatabase[AccountID]
-	FS                 FileStorage
-	OrderStatusManager OrderStatusManager
+	DB                     userShoppingCartManagerDatabase[AccountID]
+	FS                     FileStorage
+	OrderStatusManager     OrderStatusManager
+	TaxCalculator          TaxCalculator
+	ShippingRateCalculator ShippingRateCalculator
+	PromotionCalculator    PromotionCalculator
+	PaymentGateways        PaymentGatewayRegistry[AccountID]
+	AbandonedCartThreshold time.Duration
+	Retention              time.Duration // carts inactive for longer are removed by Pulse
 }
 
 type UserShoppingCartForm[AccountID comparable] struct {
@@ -32,22 +90,38 @@ type UserShoppingCartForm[AccountID comparable] struct {
 	UserAccountID         AccountID `json:"account_id"`
 	SessionText           *string   `json:"session_text,omitempty"`
 	ShoppingCartItemCount *uint64   `json:"shopping_cart_item_count,omitempty"`
-	Dept                  *float64  `json:"dept,omitempty"`
+	Dept                  *Money    `json:"dept,omitempty"`
 }
 
 type BuiltinUserShoppingCart[AccountID comparable] struct {
 	UserShoppingCartForm[AccountID]
-	DB                 userShoppingCartDatabase[AccountID] `json:"-"`
-	FS                 FileStorage                         `json:"-"`
-	OrderStatusManager OrderStatusManager                  `json:"-"`
-	MU                 sync.RWMutex                        `json:"-"`
+	DB                     userShoppingCartDatabase[AccountID] `json:"-"`
+	FS                     FileStorage                         `json:"-"`
+	OrderStatusManager     OrderStatusManager                  `json:"-"`
+	TaxCalculator          TaxCalculator                       `json:"-"`
+	ShippingRateCalculator ShippingRateCalculator              `json:"-"`
+	PromotionCalculator    PromotionCalculator                 `json:"-"`
+	PaymentGateways        PaymentGatewayRegistry[AccountID]   `json:"-"`
+	MU                     sync.RWMutex                        `json:"-"`
 }
 
-func NewBuiltinUserShoppingCartManager[AccountID comparable](db userShoppingCartManagerDatabase[AccountID], fs FileStorage, osm OrderStatusManager) *BuiltinUserShoppingCartManager[AccountID] {
+func NewBuiltinUserShoppingCartManager[AccountID comparable](db userShoppingCartManagerDatabase[AccountID], fs FileStorage, osm OrderStatusManager, taxCalculator TaxCalculator, shippingRateCalculator ShippingRateCalculator, promotionCalculator PromotionCalculator, paymentGateways PaymentGatewayRegistry[AccountID], abandonedCartThreshold time.Duration, retention time.Duration) *BuiltinUserShoppingCartManager[AccountID] {
+	if abandonedCartThreshold == 0 {
+		abandonedCartThreshold = DefaultAbandonedCartThreshold
+	}
+	if retention == 0 {
+		retention = DefaultShoppingCartRetention
+	}
 	return &BuiltinUserShoppingCartManager[AccountID]{
-		DB:                 db,
-		FS:                 fs,
-		OrderStatusManager: osm,
+		AbandonedCartThreshold: abandonedCartThreshold,
+		Retention:              retention,
+		DB:                     db,
+		FS:                     fs,
+		OrderStatusManager:     osm,
+		TaxCalculator:          taxCalculator,
+		ShippingRateCalculator: shippingRateCalculator,
+		PromotionCalculator:    promotionCalculator,
+		PaymentGateways:        paymentGateways,
 	}
 }
 
@@ -57,9 +131,13 @@ func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) Close(ctx
 
 func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) newShoppingCart(ctx context.Context, id uint64, aid *AccountID, db userShoppingCartDatabase[AccountID], form *UserShoppingCartForm[AccountID]) (*BuiltinUserShoppingCart[AccountID], error) {
 	cart := &BuiltinUserShoppingCart[AccountID]{
-		DB:                 db,
-		FS:                 shoppingCartManager.FS,
-		OrderStatusManager: shoppingCartManager.OrderStatusManager,
+		DB:                     db,
+		FS:                     shoppingCartManager.FS,
+		OrderStatusManager:     shoppingCartManager.OrderStatusManager,
+		TaxCalculator:          shoppingCartManager.TaxCalculator,
+		ShippingRateCalculator: shoppingCartManager.ShippingRateCalculator,
+		PromotionCalculator:    shoppingCartManager.PromotionCalculator,
+		PaymentGateways:        shoppingCartManager.PaymentGateways,
 		UserShoppingCartForm: UserShoppingCartForm[AccountID]{
 			ID: id,
 		},
@@ -80,9 +158,13 @@ func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) newShoppin
 
 func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) newShoppingCartItem(ctx context.Context, id uint64, aid AccountID, db userShoppingCartManagerDatabase[AccountID], form *UserShoppingCartItemForm[AccountID]) (*BuiltinUserShoppingCartItem[AccountID], error) {
 	item := &BuiltinUserShoppingCartItem[AccountID]{
-		DB:                 db,
-		FS:                 shoppingCartManager.FS,
-		OrderStatusManager: shoppingCartManager.OrderStatusManager,
+		DB:                     db,
+		FS:                     shoppingCartManager.FS,
+		OrderStatusManager:     shoppingCartManager.OrderStatusManager,
+		TaxCalculator:          shoppingCartManager.TaxCalculator,
+		ShippingRateCalculator: shoppingCartManager.ShippingRateCalculator,
+		PromotionCalculator:    shoppingCartManager.PromotionCalculator,
+		PaymentGateways:        shoppingCartManager.PaymentGateways,
 		UserShoppingCartItemForm: UserShoppingCartItemForm[AccountID]{
 			ID:            id,
 			UserAccountID: aid,
@@ -99,6 +181,16 @@ func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) newShoppin
 	return item, nil
 }
 
+// NewGuestShoppingCart creates a cart without an account, it's ordered after MergeInto moves it to an account.
+func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) NewGuestShoppingCart(ctx context.Context, sessionText string) (UserShoppingCart[AccountID], error) {
+	cartForm := UserShoppingCartForm[AccountID]{}
+	cid, err := shoppingCartManager.DB.NewGuestShoppingCart(ctx, sessionText, &cartForm)
+	if err != nil {
+		return nil, err
+	}
+	return shoppingCartManager.newShoppingCart(ctx, cid, nil, shoppingCartManager.DB, &cartForm)
+}
+
 func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) GetShoppingCartBySessionText(ctx context.Context, sessionText string) (UserShoppingCart[AccountID], error) {
 	cartForm := UserShoppingCartForm[AccountID]{}
 	cid, err := shoppingCartManager.DB.GetShoppingCartBySessionText(ctx, sessionText, &cartForm)
@@ -168,7 +260,49 @@ func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) Init(ctx c
 }
 
 func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) Pulse(ctx context.Context) error {
-	return nil
+	var err error = nil
+	err = joinErr(err, shoppingCartManager.ReleaseExpiredStockReservations(ctx))
+	err = joinErr(err, shoppingCartManager.RemoveInactiveShoppingCarts(ctx))
+	return err
+}
+
+func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) GetAbandonedShoppingCarts(ctx context.Context, carts []UserShoppingCart[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserShoppingCart[AccountID], error) {
+	var err error = nil
+	ids := make([]DBUserUserShoppingCartResult[AccountID], 0, GetSafeLimit(limit))
+	cartForms := make([]*UserShoppingCartForm[AccountID], 0, cap(ids))
+	inactiveSince := time.Now().Add(-shoppingCartManager.AbandonedCartThreshold)
+	ids, cartForms, err = shoppingCartManager.DB.GetAbandonedShoppingCarts(ctx, inactiveSince, ids, cartForms, skip, limit, queueOrder)
+	if err != nil {
+		return nil, err
+	}
+	cts := carts
+	if cts == nil {
+		cts = make([]UserShoppingCart[AccountID], 0, len(ids))
+	}
+	for i := range len(ids) {
+		cart, err := shoppingCartManager.newShoppingCart(ctx, ids[i].ID, &ids[i].AID, shoppingCartManager.DB, cartForms[i])
+		if err != nil {
+			return nil, err
+		}
+		cts = append(cts, cart)
+	}
+	return cts, nil
+}
+
+func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) GetAbandonedShoppingCartCount(ctx context.Context) (uint64, error) {
+	return shoppingCartManager.DB.GetAbandonedShoppingCartCount(ctx, time.Now().Add(-shoppingCartManager.AbandonedCartThreshold))
+}
+
+// RemoveInactiveShoppingCarts removes the carts inactive for longer than the retention, a negative retention keeps them.
+func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) RemoveInactiveShoppingCarts(ctx context.Context) error {
+	if shoppingCartManager.Retention < 0 {
+		return nil
+	}
+	return shoppingCartManager.DB.RemoveInactiveShoppingCarts(ctx, time.Now().Add(-shoppingCartManager.Retention))
+}
+
+func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) ReleaseExpiredStockReservations(ctx context.Context) error {
+	return shoppingCartManager.DB.RemoveExpiredStockReservations(ctx, time.Now())
 }
 
 func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) RemoveAllShoppingCarts(ctx context.Context) error {
@@ -179,35 +313,54 @@ func (shoppingCartManager *BuiltinUserShoppingCartManager[AccountID]) ToBuiltinO
 	return shoppingCartManager, nil
 }
 
-func (shoppingCart *BuiltinUserShoppingCart[AccountID]) CalculateDept(ctx context.Context, shippingMethod ShippingMethod) (float64, error) {
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) CalculateDept(ctx context.Context, shippingMethod ShippingMethod, address UserAddress[AccountID]) (Money, error) {
+	dept, err := shoppingCart.calculateDept(ctx, shippingMethod, address)
+	if err != nil {
+		return Money{}, err
+	}
+	// priced like the order, the promotions take off at most the subtotal
+	pricing, err := shoppingCart.priceOrder(ctx, shippingMethod, address, nil, "")
+	if err != nil {
+		return Money{}, err
+	}
+	dept, err = dept.Sub(pricing.Promotion)
+	if err != nil {
+		return Money{}, err
+	}
+	if address == nil || pricing.Tax == nil {
+		return dept, nil
+	}
+	return dept.Add(pricing.Tax.ExclusiveTotal)
+}
+
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) calculateDept(ctx context.Context, shippingMethod ShippingMethod, address UserAddress[AccountID]) (Money, error) {
 	var sid uint64 = 0
 	if shippingMethod != nil {
 		tsid, err := shippingMethod.GetID(ctx)
 		if err != nil {
-			return 0, err
+			return Money{}, err
 		}
 		sid = tsid
 	}
-	shoppingCart.MU.RLock()
-	if shoppingCart.Dept != nil {
-		defer shoppingCart.MU.RUnlock()
-		return *shoppingCart.Dept, nil
+	// the debt depends on the shipping method and the address, so it's computed every time and Dept keeps the last one
+	shippingCost, err := shoppingCart.shippingCost(ctx, shippingMethod, address)
+	if err != nil {
+		return Money{}, err
 	}
-	shoppingCart.MU.RUnlock()
 	id, err := shoppingCart.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
-	dept, err := shoppingCart.DB.CalculateUserShoppingCartDept(ctx, &form, id, sid)
+	dept, err := shoppingCart.DB.CalculateUserShoppingCartDept(ctx, &form, id, sid, shippingCost)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := shoppingCart.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	shoppingCart.MU.Lock()
 	defer shoppingCart.MU.Unlock()
@@ -215,6 +368,225 @@ func (shoppingCart *BuiltinUserShoppingCart[AccountID]) CalculateDept(ctx contex
 	return dept, nil
 }
 
+// shippingCost is nil when the price of the shipping method is charged as is.
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) shippingCost(ctx context.Context, shippingMethod ShippingMethod, address UserAddress[AccountID]) (*Money, error) {
+	if shoppingCart.ShippingRateCalculator == nil || shippingMethod == nil {
+		return nil, nil
+	}
+	cost, err := shoppingCart.CalculateShippingRate(ctx, shippingMethod, address)
+	if err != nil {
+		return nil, err
+	}
+	return &cost, nil
+}
+
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) CalculateShippingRate(ctx context.Context, shippingMethod ShippingMethod, address UserAddress[AccountID]) (Money, error) {
+	if shippingMethod == nil {
+		return Money{}, nil
+	}
+	price, err := shippingMethod.GetPrice(ctx)
+	if err != nil {
+		return Money{}, err
+	}
+	if shoppingCart.ShippingRateCalculator == nil {
+		return price, nil
+	}
+	sid, err := shippingMethod.GetID(ctx)
+	if err != nil {
+		return Money{}, err
+	}
+	request := ShippingRateRequest{
+		ShippingMethodID: sid,
+		BasePrice:        price,
+	}
+	request.CountryID, request.Region, err = addressDestination(ctx, address)
+	if err != nil {
+		return Money{}, err
+	}
+	id, err := shoppingCart.GetID(ctx)
+	if err != nil {
+		return Money{}, err
+	}
+	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
+	if err != nil {
+		return Money{}, err
+	}
+	items, err := shoppingCart.DB.GetUserShoppingCartShippableItems(ctx, &form, id)
+	if err != nil {
+		return Money{}, err
+	}
+	if err := shoppingCart.ApplyFormObject(ctx, &form); err != nil {
+		return Money{}, err
+	}
+	request.Items = items
+	return shoppingCart.ShippingRateCalculator.CalculateShippingRate(ctx, &request)
+}
+
+// CalculateTax computes the taxes of the cart lines less their share of the promotions.
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) CalculateTax(ctx context.Context, shippingMethod ShippingMethod, address UserAddress[AccountID]) (*TaxResult, error) {
+	if shoppingCart.TaxCalculator == nil {
+		return &TaxResult{Lines: []TaxLine{}}, nil
+	}
+	pricing, err := shoppingCart.priceOrder(ctx, shippingMethod, address, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return pricing.Tax, nil
+}
+
+// priceOrder reads the cart lines once and prices them like the checkout: the promotions come first, the discount code
+// takes off at most what they leave, both are spread over the lines in proportion to their subtotals like the factor
+// lines and the taxes apply to what is left.
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) priceOrder(ctx context.Context, shippingMethod ShippingMethod, address UserAddress[AccountID], shippingCost *Money, discountCode string) (*OrderPricing, error) {
+	id, err := shoppingCart.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var smid uint64 = 0
+	if shippingMethod != nil {
+		smid, err = shippingMethod.GetID(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := shoppingCart.DB.GetUserShoppingCartTaxableItems(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := shoppingCart.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	pricing := &OrderPricing{
+		Items: items,
+	}
+
+	subtotal := Money{}
+	for _, item := range items {
+		subtotal, err = subtotal.Add(item.UnitPrice.Mul(item.Quantity))
+		if err != nil {
+			return nil, err
+		}
+	}
+	promotion := NewMoney(0, subtotal.Currency)
+	if shoppingCart.PromotionCalculator != nil {
+		pricing.Promotions, err = shoppingCart.PromotionCalculator.CalculatePromotions(ctx, &PromotionRequest{Items: items})
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range pricing.Promotions.Lines {
+			promotion, err = promotion.Add(line.Amount)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	promotion, err = minMoney(promotion, subtotal)
+	if err != nil {
+		return nil, err
+	}
+	pricing.Promotion = promotion
+	left, err := subtotal.Sub(promotion)
+	if err != nil {
+		return nil, err
+	}
+	pricing.Discount = NewMoney(0, subtotal.Currency)
+	if discountCode != "" {
+		preview, err := shoppingCart.DB.PreviewUserDiscount(ctx, discountCode, id, smid, shippingCost)
+		if err != nil {
+			return nil, err
+		}
+		if !preview.Applicable {
+			return nil, &DiscountNotApplicableError{Reason: preview.Reason}
+		}
+		pricing.Discount, err = minMoney(preview.Discount, left)
+		if err != nil {
+			return nil, err
+		}
+	}
+	discount, err := promotion.Add(pricing.Discount)
+	if err != nil {
+		return nil, err
+	}
+	spreadDiscount(items, subtotal, discount)
+
+	if shoppingCart.TaxCalculator != nil {
+		request := TaxRequest{
+			Items:            items,
+			ShippingMethodID: smid,
+		}
+		request.CountryID, request.Region, err = addressDestination(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		pricing.Tax, err = shoppingCart.TaxCalculator.CalculateTax(ctx, &request)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pricing, nil
+}
+
+// spreadDiscount sets the Discount of the items to their share of discount in proportion to their subtotals, rounding
+// down the running total so the shares add up to discount, the way the checkout spreads it over the factor lines.
+func spreadDiscount(items []TaxableItem, subtotal Money, discount Money) {
+	if !subtotal.IsPositive() || discount.IsNegative() {
+		return
+	}
+	total := uint64(discount.Amount)
+	whole := uint64(subtotal.Amount)
+	var running uint64 = 0
+	for i := range items {
+		line := items[i].UnitPrice.Mul(items[i].Quantity)
+		before := running
+		running += uint64(line.Amount)
+		items[i].Discount = NewMoney(int64(mulDiv(total, running, whole)-mulDiv(total, before, whole)), discount.Currency)
+	}
+}
+
+// mulDiv returns a * b / c rounded down without overflowing, a * b / c must fit in an uint64.
+func mulDiv(a uint64, b uint64, c uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	quotient, _ := bits.Div64(hi, lo, c)
+	return quotient
+}
+
+func minMoney(a Money, b Money) (Money, error) {
+	cmp, err := a.Cmp(b)
+	if err != nil {
+		return Money{}, err
+	}
+	if cmp > 0 {
+		return b, nil
+	}
+	return a, nil
+}
+
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) CalculatePromotions(ctx context.Context) (*PromotionResult, error) {
+	if shoppingCart.PromotionCalculator == nil {
+		return &PromotionResult{Lines: []PromotionLine{}}, nil
+	}
+	id, err := shoppingCart.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := shoppingCart.DB.GetUserShoppingCartTaxableItems(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := shoppingCart.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	return shoppingCart.PromotionCalculator.CalculatePromotions(ctx, &PromotionRequest{Items: items})
+}
+
 func (shoppingCart *BuiltinUserShoppingCart[AccountID]) Close(ctx context.Context) error {
 	return nil
 }
@@ -287,9 +659,13 @@ func (shoppingCart *BuiltinUserShoppingCart[AccountID]) newShoppingCartItem(ctx
 		return nil, err
 	}
 	item := &BuiltinUserShoppingCartItem[AccountID]{
-		DB:                 db,
-		FS:                 shoppingCart.FS,
-		OrderStatusManager: shoppingCart.OrderStatusManager,
+		DB:                     db,
+		FS:                     shoppingCart.FS,
+		OrderStatusManager:     shoppingCart.OrderStatusManager,
+		TaxCalculator:          shoppingCart.TaxCalculator,
+		ShippingRateCalculator: shoppingCart.ShippingRateCalculator,
+		PromotionCalculator:    shoppingCart.PromotionCalculator,
+		PaymentGateways:        shoppingCart.PaymentGateways,
 		UserShoppingCartItemForm: UserShoppingCartItemForm[AccountID]{
 			ID:            id,
 			UserAccountID: aid,
@@ -389,6 +765,7 @@ func (shoppingCart *BuiltinUserShoppingCart[AccountID]) newOrder(ctx context.Con
 		DB:                 db,
 		FS:                 shoppingCart.FS,
 		OrderStatusManager: shoppingCart.OrderStatusManager,
+		PaymentGateways:    shoppingCart.PaymentGateways,
 		UserOrderForm: UserOrderForm[AccountID]{
 			ID:            id,
 			UserAccountID: aid,
@@ -405,7 +782,7 @@ func (shoppingCart *BuiltinUserShoppingCart[AccountID]) newOrder(ctx context.Con
 	return order, nil
 }
 
-func (shoppingCart *BuiltinUserShoppingCart[AccountID]) Order(ctx context.Context, paymentMethod UserPaymentMethod[AccountID], address UserAddress[AccountID], shippingMethod ShippingMethod, userComment string, discountCode string) (UserOrder[AccountID], error) {
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) Order(ctx context.Context, paymentMethod UserPaymentMethod[AccountID], address UserAddress[AccountID], shippingMethod ShippingMethod, userComment string, discountCode string, idempotencyKey string, splits ...PaymentSplit[AccountID]) (UserOrder[AccountID], error) {
 	pid, err := paymentMethod.GetID(ctx)
 	if err != nil {
 		return nil, err
@@ -422,12 +799,20 @@ func (shoppingCart *BuiltinUserShoppingCart[AccountID]) Order(ctx context.Contex
 	if err != nil {
 		return nil, err
 	}
+	shippingCost, err := shoppingCart.shippingCost(ctx, shippingMethod, address)
+	if err != nil {
+		return nil, err
+	}
+	pricing, err := shoppingCart.priceOrder(ctx, shippingMethod, address, shippingCost, discountCode)
+	if err != nil {
+		return nil, err
+	}
 	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
 	if err != nil {
 		return nil, err
 	}
 	orderForm := UserOrderForm[AccountID]{}
-	oid, err := shoppingCart.DB.OrderUserShoppingCart(ctx, &form, id, pid, aid, sid, userComment, discountCode, &orderForm)
+	oid, err := shoppingCart.DB.OrderUserShoppingCart(ctx, &form, id, pid, aid, sid, shippingCost, userComment, discountCode, pricing, idempotencyKey, &orderForm)
 	if err != nil {
 		return nil, err
 	}
@@ -435,13 +820,138 @@ func (shoppingCart *BuiltinUserShoppingCart[AccountID]) Order(ctx context.Contex
 	if err != nil {
 		return nil, err
 	}
+	// a replayed order may already be paid, a declined one stays pending payment and is returned with the error
+	if err := order.Pay(ctx, paymentMethod, splits...); err != nil && !errors.Is(err, ErrOrderAlreadyPaid) {
+		return order, err
+	}
 	return order, nil
 }
 
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) MergeInto(ctx context.Context, account UserAccount[AccountID]) (UserShoppingCart[AccountID], error) {
+	aid, err := account.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := shoppingCart.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cartForm := UserShoppingCartForm[AccountID]{}
+	cid, err := shoppingCart.DB.MergeUserShoppingCartInto(ctx, &form, id, aid, &cartForm)
+	if err != nil {
+		return nil, err
+	}
+	if cid == id {
+		if err := shoppingCart.ApplyFormObject(ctx, &cartForm); err != nil {
+			return nil, err
+		}
+		shoppingCart.MU.Lock()
+		shoppingCart.UserAccountID = aid
+		shoppingCart.MU.Unlock()
+		return shoppingCart, nil
+	}
+	cart := &BuiltinUserShoppingCart[AccountID]{
+		DB:                     shoppingCart.DB,
+		FS:                     shoppingCart.FS,
+		OrderStatusManager:     shoppingCart.OrderStatusManager,
+		TaxCalculator:          shoppingCart.TaxCalculator,
+		ShippingRateCalculator: shoppingCart.ShippingRateCalculator,
+		PromotionCalculator:    shoppingCart.PromotionCalculator,
+		PaymentGateways:        shoppingCart.PaymentGateways,
+		UserShoppingCartForm: UserShoppingCartForm[AccountID]{
+			ID:            cid,
+			UserAccountID: aid,
+		},
+	}
+	if err := cart.Init(ctx); err != nil {
+		return nil, err
+	}
+	if err := cart.ApplyFormObject(ctx, &cartForm); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
 func (shoppingCart *BuiltinUserShoppingCart[AccountID]) Pulse(ctx context.Context) error {
 	return nil
 }
 
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) ReserveStock(ctx context.Context, ttl time.Duration) (time.Time, error) {
+	id, err := shoppingCart.GetID(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiresAt := time.Now().Add(ttl)
+	if err := shoppingCart.DB.ReserveUserShoppingCartStock(ctx, &form, id, expiresAt); err != nil {
+		return time.Time{}, err
+	}
+	if err := shoppingCart.ApplyFormObject(ctx, &form); err != nil {
+		return time.Time{}, err
+	}
+	return expiresAt, nil
+}
+
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) ReleaseStock(ctx context.Context) error {
+	id, err := shoppingCart.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := shoppingCart.DB.ReleaseUserShoppingCartStock(ctx, &form, id); err != nil {
+		return err
+	}
+	return shoppingCart.ApplyFormObject(ctx, &form)
+}
+
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) GetLastActivityAt(ctx context.Context) (time.Time, error) {
+	id, err := shoppingCart.GetID(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	lastActivityAt, err := shoppingCart.DB.GetUserShoppingCartLastActivityAt(ctx, &form, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := shoppingCart.ApplyFormObject(ctx, &form); err != nil {
+		return time.Time{}, err
+	}
+	return lastActivityAt, nil
+}
+
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) GetStockReservationExpiresAt(ctx context.Context) (time.Time, error) {
+	id, err := shoppingCart.GetID(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiresAt, err := shoppingCart.DB.GetUserShoppingCartStockReservationExpiresAt(ctx, &form, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := shoppingCart.ApplyFormObject(ctx, &form); err != nil {
+		return time.Time{}, err
+	}
+	return expiresAt, nil
+}
+
 func (shoppingCart *BuiltinUserShoppingCart[AccountID]) RemoveAllShoppingCartItems(ctx context.Context) error {
 	id, err := shoppingCart.GetID(ctx)
 	if err != nil {
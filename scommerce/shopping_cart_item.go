@@ -17,7 +17,7 @@ type userShoppingCartItemDatabase[AccountID comparable] interface {
 type UserShoppingCartItemForm[AccountID comparable] struct {
 	ID            uint64                              `json:"id"`
 	UserAccountID AccountID                           `json:"account_id"`
-	Dept          *float64                            `json:"dept,omitempty"`
+	Dept          *Money                              `json:"dept,omitempty"`
 	ProductItem   *BuiltinProductItem[AccountID]      `json:"product_item,omitempty"`
 	Quantity      *int64                              `json:"quantity,omitempty"`
 	ShoppingCart  *BuiltinUserShoppingCart[AccountID] `json:"shopping_cart,omitempty"`
@@ -26,10 +26,14 @@ type UserShoppingCartItemForm[AccountID comparable] struct {
 
 type BuiltinUserShoppingCartItem[AccountID comparable] struct {
 	UserShoppingCartItemForm[AccountID]
-	DB                 userShoppingCartItemDatabase[AccountID] `json:"-"`
-	FS                 FileStorage                             `json:"-"`
-	OrderStatusManager OrderStatusManager                      `json:"-"`
-	MU                 sync.RWMutex                            `json:"-"`
+	DB                     userShoppingCartItemDatabase[AccountID] `json:"-"`
+	FS                     FileStorage                             `json:"-"`
+	OrderStatusManager     OrderStatusManager                      `json:"-"`
+	TaxCalculator          TaxCalculator                           `json:"-"`
+	ShippingRateCalculator ShippingRateCalculator                  `json:"-"`
+	PromotionCalculator    PromotionCalculator                     `json:"-"`
+	PaymentGateways        PaymentGatewayRegistry[AccountID]       `json:"-"`
+	MU                     sync.RWMutex                            `json:"-"`
 }
 
 func (item *BuiltinUserShoppingCartItem[AccountID]) AddQuantity(ctx context.Context, delta int64) error {
@@ -53,7 +57,7 @@ func (item *BuiltinUserShoppingCartItem[AccountID]) AddQuantity(ctx context.Cont
 	return nil
 }
 
-func (item *BuiltinUserShoppingCartItem[AccountID]) CalculateDept(ctx context.Context) (float64, error) {
+func (item *BuiltinUserShoppingCartItem[AccountID]) CalculateDept(ctx context.Context) (Money, error) {
 	item.MU.RLock()
 	if item.Dept != nil {
 		defer item.MU.RUnlock()
@@ -62,18 +66,18 @@ func (item *BuiltinUserShoppingCartItem[AccountID]) CalculateDept(ctx context.Co
 	item.MU.RUnlock()
 	id, err := item.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := item.UserShoppingCartItemForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	dept, err := item.DB.CalculateUserShoppingCartItemDept(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := item.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	item.MU.Lock()
 	defer item.MU.Unlock()
@@ -180,9 +184,13 @@ func (item *BuiltinUserShoppingCartItem[AccountID]) newShoppingCart(ctx context.
 		return nil, err
 	}
 	cart := &BuiltinUserShoppingCart[AccountID]{
-		DB:                 db,
-		FS:                 item.FS,
-		OrderStatusManager: item.OrderStatusManager,
+		DB:                     db,
+		FS:                     item.FS,
+		OrderStatusManager:     item.OrderStatusManager,
+		TaxCalculator:          item.TaxCalculator,
+		ShippingRateCalculator: item.ShippingRateCalculator,
+		PromotionCalculator:    item.PromotionCalculator,
+		PaymentGateways:        item.PaymentGateways,
 		UserShoppingCartForm: UserShoppingCartForm[AccountID]{
 			ID:            id,
 			UserAccountID: aid,
@@ -342,6 +350,18 @@ func (item *BuiltinUserShoppingCartItem[AccountID]) ApplyFormObject(ctx context.
 		item.Quantity = form.Quantity
 	}
 	if form.ShoppingCart != nil {
+		if form.ShoppingCart.TaxCalculator == nil {
+			form.ShoppingCart.TaxCalculator = item.TaxCalculator
+		}
+		if form.ShoppingCart.ShippingRateCalculator == nil {
+			form.ShoppingCart.ShippingRateCalculator = item.ShippingRateCalculator
+		}
+		if form.ShoppingCart.PromotionCalculator == nil {
+			form.ShoppingCart.PromotionCalculator = item.PromotionCalculator
+		}
+		if form.ShoppingCart.PaymentGateways == nil {
+			form.ShoppingCart.PaymentGateways = item.PaymentGateways
+		}
 		item.ShoppingCart = form.ShoppingCart
 	}
 	if form.Attributes != nil {
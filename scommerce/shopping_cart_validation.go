@@ -0,0 +1,142 @@
+package scommerce
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrProductItemRemoved = errors.New("product item was removed")
+
+type ShoppingCartIssueKind string
+
+const (
+	ShoppingCartIssuePriceChanged       ShoppingCartIssueKind = "price_changed"
+	ShoppingCartIssueOutOfStock         ShoppingCartIssueKind = "out_of_stock"
+	ShoppingCartIssueQuantityReduced    ShoppingCartIssueKind = "quantity_reduced"
+	ShoppingCartIssueProductItemRemoved ShoppingCartIssueKind = "product_item_removed"
+)
+
+type ShoppingCartIssue struct {
+	Kind               ShoppingCartIssueKind `json:"kind"`
+	ShoppingCartItemID uint64                `json:"shopping_cart_item_id"`
+	ProductItemID      uint64                `json:"product_item_id"`    // 0 when the product item was removed
+	OldPrice           Money                 `json:"old_price"`          // price when the item was added, for price_changed
+	NewPrice           Money                 `json:"new_price"`          // current price, for price_changed
+	RequestedQuantity  int64                 `json:"requested_quantity"` // quantity in the cart
+	AvailableQuantity  int64                 `json:"available_quantity"` // quantity which can be ordered
+	Fixed              bool                  `json:"fixed"`              // the cart was changed to resolve the issue
+}
+
+type ShoppingCartValidation struct {
+	Issues []ShoppingCartIssue `json:"issues"`
+}
+
+// IsValid reports whether the cart can be ordered as the user saw it.
+func (validation *ShoppingCartValidation) IsValid() bool {
+	return len(validation.Issues) == 0
+}
+
+// Validate compares the cart with the current prices and stock.
+// With fix, removed and out of stock lines are deleted, quantities are reduced to the stock and new prices are accepted.
+func (shoppingCart *BuiltinUserShoppingCart[AccountID]) Validate(ctx context.Context, fix bool) (*ShoppingCartValidation, error) {
+	id, err := shoppingCart.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := shoppingCart.UserShoppingCartForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := shoppingCart.DB.GetUserShoppingCartValidationItems(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := shoppingCart.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+
+	validation := &ShoppingCartValidation{
+		Issues: make([]ShoppingCartIssue, 0),
+	}
+	available := make(map[uint64]int64, len(items))
+	for _, item := range items {
+		if _, ok := available[item.ProductItemID]; !ok {
+			available[item.ProductItemID] = max(item.Available, 0)
+		}
+	}
+	priceChanged := false
+	for _, item := range items {
+		issue := ShoppingCartIssue{
+			ShoppingCartItemID: item.ShoppingCartItemID,
+			ProductItemID:      item.ProductItemID,
+			RequestedQuantity:  item.Quantity,
+		}
+		if item.ProductItemID == 0 {
+			issue.Kind = ShoppingCartIssueProductItemRemoved
+			if fix {
+				if err := shoppingCart.DB.RemoveUserShoppingCartShoppingCartItem(ctx, &form, id, item.ShoppingCartItemID); err != nil {
+					return nil, err
+				}
+				issue.Fixed = true
+			}
+			validation.Issues = append(validation.Issues, issue)
+			continue
+		}
+
+		// lines sharing a product item take the stock in the order they were added
+		issue.AvailableQuantity = min(item.Quantity, available[item.ProductItemID])
+		available[item.ProductItemID] -= issue.AvailableQuantity
+		if issue.AvailableQuantity < item.Quantity {
+			if issue.AvailableQuantity == 0 {
+				issue.Kind = ShoppingCartIssueOutOfStock
+				if fix {
+					if err := shoppingCart.DB.RemoveUserShoppingCartShoppingCartItem(ctx, &form, id, item.ShoppingCartItemID); err != nil {
+						return nil, err
+					}
+					issue.Fixed = true
+				}
+				validation.Issues = append(validation.Issues, issue)
+				continue
+			}
+			issue.Kind = ShoppingCartIssueQuantityReduced
+			if fix {
+				if err := shoppingCart.DB.SetUserShoppingCartItemQuantity(ctx, nil, item.ShoppingCartItemID, issue.AvailableQuantity); err != nil {
+					return nil, err
+				}
+				issue.Fixed = true
+			}
+			validation.Issues = append(validation.Issues, issue)
+		}
+
+		if item.AddedPrice != nil && item.AddedPrice.Amount != item.Price.Amount {
+			validation.Issues = append(validation.Issues, ShoppingCartIssue{
+				Kind:               ShoppingCartIssuePriceChanged,
+				ShoppingCartItemID: item.ShoppingCartItemID,
+				ProductItemID:      item.ProductItemID,
+				OldPrice:           *item.AddedPrice,
+				NewPrice:           item.Price,
+				RequestedQuantity:  item.Quantity,
+				AvailableQuantity:  issue.AvailableQuantity,
+				Fixed:              fix,
+			})
+			priceChanged = true
+		}
+	}
+
+	if fix && len(validation.Issues) != 0 {
+		if priceChanged {
+			if err := shoppingCart.DB.AcceptUserShoppingCartPrices(ctx, &form, id); err != nil {
+				return nil, err
+			}
+		}
+		if err := shoppingCart.ApplyFormObject(ctx, &form); err != nil {
+			return nil, err
+		}
+		shoppingCart.MU.Lock()
+		shoppingCart.Dept = nil
+		shoppingCart.ShoppingCartItemCount = nil
+		shoppingCart.MU.Unlock()
+	}
+
+	return validation, nil
+}
@@ -0,0 +1,170 @@
+package scommerce
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var _ TaxCalculator = &BuiltinTaxCalculator{}
+
+type TaxableItem struct {
+	ProductItemID uint64   `json:"product_item_id"`
+	CategoryIDs   []uint64 `json:"category_ids"` // category of the product first, followed by its parents
+	UnitPrice     Money    `json:"unit_price"`
+	Quantity      int64    `json:"quantity"`
+	Discount      Money    `json:"discount"` // share of the promotions and the discount code, taxes apply to what is left
+}
+
+type TaxRequest struct {
+	Items            []TaxableItem `json:"items"`
+	CountryID        uint64        `json:"country_id"` // 0 if the address is unknown
+	Region           string        `json:"region"`
+	ShippingMethodID uint64        `json:"shipping_method_id"`
+}
+
+type TaxLine struct {
+	ProductItemID uint64  `json:"product_item_id"`
+	Name          string  `json:"name"`
+	Rate          float64 `json:"rate"`
+	Inclusive     bool    `json:"inclusive"`
+	TaxableAmount Money   `json:"taxable_amount"`
+	Amount        Money   `json:"amount"`
+}
+
+type TaxResult struct {
+	Lines          []TaxLine `json:"lines"`
+	Total          Money     `json:"total"`
+	ExclusiveTotal Money     `json:"exclusive_total"` // part of Total which is added on top of the prices
+}
+
+type TaxCalculator interface {
+	CalculateTax(ctx context.Context, request *TaxRequest) (*TaxResult, error)
+}
+
+// TaxRate applies to the items matching all of its non-zero scopes.
+// Rates sharing a name don't stack, only the most specific one is applied.
+type TaxRate struct {
+	Name       string  `json:"name"`
+	Rate       float64 `json:"rate"` // 0.09 for 9%
+	Inclusive  bool    `json:"inclusive"`
+	CountryID  uint64  `json:"country_id,omitempty"`
+	Region     string  `json:"region,omitempty"`
+	CategoryID uint64  `json:"category_id,omitempty"` // sub categories inherit the rate
+}
+
+type BuiltinTaxCalculator struct {
+	Rates []TaxRate
+	MU    sync.RWMutex
+}
+
+func NewBuiltinTaxCalculator(rates []TaxRate) *BuiltinTaxCalculator {
+	return &BuiltinTaxCalculator{
+		Rates: slices.Clone(rates),
+	}
+}
+
+func (calculator *BuiltinTaxCalculator) AddRate(rate TaxRate) {
+	calculator.MU.Lock()
+	defer calculator.MU.Unlock()
+	calculator.Rates = append(calculator.Rates, rate)
+}
+
+func (calculator *BuiltinTaxCalculator) SetRates(rates []TaxRate) {
+	calculator.MU.Lock()
+	defer calculator.MU.Unlock()
+	calculator.Rates = slices.Clone(rates)
+}
+
+func (calculator *BuiltinTaxCalculator) CalculateTax(ctx context.Context, request *TaxRequest) (*TaxResult, error) {
+	calculator.MU.RLock()
+	defer calculator.MU.RUnlock()
+	result := &TaxResult{
+		Lines: make([]TaxLine, 0, len(request.Items)),
+	}
+	for _, item := range request.Items {
+		rates := calculator.matchRates(request, &item)
+		amount, err := item.UnitPrice.Mul(item.Quantity).Sub(item.Discount)
+		if err != nil {
+			return nil, err
+		}
+		inclusiveRate := 0.0
+		for _, rate := range rates {
+			if rate.Inclusive {
+				inclusiveRate += rate.Rate
+			}
+		}
+		net := amount.MulRate(1 / (1 + inclusiveRate))
+		for _, rate := range rates {
+			tax := net.MulRate(rate.Rate)
+			result.Lines = append(result.Lines, TaxLine{
+				ProductItemID: item.ProductItemID,
+				Name:          rate.Name,
+				Rate:          rate.Rate,
+				Inclusive:     rate.Inclusive,
+				TaxableAmount: net,
+				Amount:        tax,
+			})
+			total, err := result.Total.Add(tax)
+			if err != nil {
+				return nil, err
+			}
+			result.Total = total
+			if !rate.Inclusive {
+				exclusiveTotal, err := result.ExclusiveTotal.Add(tax)
+				if err != nil {
+					return nil, err
+				}
+				result.ExclusiveTotal = exclusiveTotal
+			}
+		}
+	}
+	return result, nil
+}
+
+func (calculator *BuiltinTaxCalculator) matchRates(request *TaxRequest, item *TaxableItem) []TaxRate {
+	best := make(map[string]int, len(calculator.Rates))
+	rates := make([]TaxRate, 0, len(calculator.Rates))
+	for _, rate := range calculator.Rates {
+		score, ok := rateSpecificity(&rate, request, item)
+		if !ok {
+			continue
+		}
+		if i, exists := best[rate.Name]; exists {
+			if prevScore, _ := rateSpecificity(&rates[i], request, item); prevScore >= score {
+				continue
+			}
+			rates[i] = rate
+			continue
+		}
+		best[rate.Name] = len(rates)
+		rates = append(rates, rate)
+	}
+	return rates
+}
+
+// rateSpecificity scores how narrowly a rate targets the item, a closer category beats a region and a region beats a country.
+func rateSpecificity(rate *TaxRate, request *TaxRequest, item *TaxableItem) (int, bool) {
+	score := 0
+	if rate.CountryID != 0 {
+		if rate.CountryID != request.CountryID {
+			return 0, false
+		}
+		score += 1
+	}
+	if rate.Region != "" {
+		if !strings.EqualFold(rate.Region, request.Region) {
+			return 0, false
+		}
+		score += 2
+	}
+	if rate.CategoryID != 0 {
+		depth := slices.Index(item.CategoryIDs, rate.CategoryID)
+		if depth < 0 {
+			return 0, false
+		}
+		score += 4 * (len(item.CategoryIDs) - depth)
+	}
+	return score, true
+}
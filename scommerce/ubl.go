@@ -0,0 +1,597 @@
+package scommerce
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrIncompleteUBLDocument = errors.New("ubl document misses required elements")
+var ErrCreditNoteFactorMismatch = errors.New("credit note was issued for another factor")
+
+const (
+	ublInvoiceNamespace    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublCreditNoteNamespace = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	ublCACNamespace        = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublCBCNamespace        = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+
+	ublInvoiceTypeCode    = "380" // commercial invoice, UNCL1001
+	ublCreditNoteTypeCode = "381" // credit note, UNCL1001
+	ublUnitCode           = "C62" // one, UN/ECE recommendation 20
+	ublTaxScheme          = "VAT"
+)
+
+// The UBL elements are declared in the order the schema requires them, encoding/xml keeps the field order.
+
+type ublDocument struct {
+	XMLName                 xml.Name
+	Namespace               string               `xml:"xmlns,attr"`
+	CACNamespace            string               `xml:"xmlns:cac,attr"`
+	CBCNamespace            string               `xml:"xmlns:cbc,attr"`
+	UBLVersionID            string               `xml:"cbc:UBLVersionID"`
+	ID                      string               `xml:"cbc:ID"`
+	IssueDate               string               `xml:"cbc:IssueDate"`
+	InvoiceTypeCode         string               `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode      string               `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	Note                    string               `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode    string               `xml:"cbc:DocumentCurrencyCode"`
+	OrderReference          *ublIdentification   `xml:"cac:OrderReference"`
+	BillingReference        *ublBillingReference `xml:"cac:BillingReference"`
+	AccountingSupplierParty ublPartyRole         `xml:"cac:AccountingSupplierParty"`
+	AccountingCustomerParty ublPartyRole         `xml:"cac:AccountingCustomerParty"`
+	AllowanceCharges        []ublAllowanceCharge `xml:"cac:AllowanceCharge"`
+	TaxTotal                ublTaxTotal          `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal      ublMonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines            []ublLine            `xml:"cac:InvoiceLine"`
+	CreditNoteLines         []ublLine            `xml:"cac:CreditNoteLine"`
+}
+
+type ublAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type ublQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublIdentification struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublBillingReference struct {
+	InvoiceDocumentReference ublDocumentReference `xml:"cac:InvoiceDocumentReference"`
+}
+
+type ublDocumentReference struct {
+	ID        string `xml:"cbc:ID"`
+	IssueDate string `xml:"cbc:IssueDate,omitempty"`
+}
+
+type ublPartyRole struct {
+	Party ublParty `xml:"cac:Party"`
+}
+
+type ublParty struct {
+	PartyName        *ublName           `xml:"cac:PartyName"`
+	PostalAddress    *ublAddress        `xml:"cac:PostalAddress"`
+	PartyTaxScheme   *ublPartyTaxScheme `xml:"cac:PartyTaxScheme"`
+	PartyLegalEntity ublLegalEntity     `xml:"cac:PartyLegalEntity"`
+	Contact          *ublContact        `xml:"cac:Contact"`
+}
+
+type ublName struct {
+	Name string `xml:"cbc:Name"`
+}
+
+type ublAddress struct {
+	StreetName           string           `xml:"cbc:StreetName,omitempty"`
+	AdditionalStreetName string           `xml:"cbc:AdditionalStreetName,omitempty"`
+	CityName             string           `xml:"cbc:CityName,omitempty"`
+	PostalZone           string           `xml:"cbc:PostalZone,omitempty"`
+	CountrySubentity     string           `xml:"cbc:CountrySubentity,omitempty"`
+	AddressLines         []ublAddressLine `xml:"cac:AddressLine"`
+	Country              *ublCountry      `xml:"cac:Country"`
+}
+
+type ublAddressLine struct {
+	Line string `xml:"cbc:Line"`
+}
+
+type ublCountry struct {
+	IdentificationCode string `xml:"cbc:IdentificationCode,omitempty"`
+	Name               string `xml:"cbc:Name,omitempty"`
+}
+
+type ublPartyTaxScheme struct {
+	CompanyID string            `xml:"cbc:CompanyID"`
+	TaxScheme ublIdentification `xml:"cac:TaxScheme"`
+}
+
+type ublLegalEntity struct {
+	RegistrationName string `xml:"cbc:RegistrationName"`
+}
+
+type ublContact struct {
+	Telephone      string `xml:"cbc:Telephone,omitempty"`
+	ElectronicMail string `xml:"cbc:ElectronicMail,omitempty"`
+}
+
+type ublAllowanceCharge struct {
+	ChargeIndicator       bool            `xml:"cbc:ChargeIndicator"`
+	AllowanceChargeReason string          `xml:"cbc:AllowanceChargeReason"`
+	Amount                ublAmount       `xml:"cbc:Amount"`
+	TaxCategory           *ublTaxCategory `xml:"cac:TaxCategory"` // document level ones are untaxed and zero rated
+}
+
+type ublTaxTotal struct {
+	TaxAmount    ublAmount        `xml:"cbc:TaxAmount"`
+	TaxSubtotals []ublTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type ublTaxSubtotal struct {
+	TaxableAmount ublAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     ublAmount      `xml:"cbc:TaxAmount"`
+	TaxCategory   ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublTaxCategory struct {
+	ID        string            `xml:"cbc:ID"`
+	Name      string            `xml:"cbc:Name,omitempty"`
+	Percent   string            `xml:"cbc:Percent"`
+	TaxScheme ublIdentification `xml:"cac:TaxScheme"`
+}
+
+type ublMonetaryTotal struct {
+	LineExtensionAmount  ublAmount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount   ublAmount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount   ublAmount  `xml:"cbc:TaxInclusiveAmount"`
+	AllowanceTotalAmount *ublAmount `xml:"cbc:AllowanceTotalAmount"`
+	ChargeTotalAmount    *ublAmount `xml:"cbc:ChargeTotalAmount"`
+	PayableAmount        ublAmount  `xml:"cbc:PayableAmount"`
+}
+
+type ublLine struct {
+	ID                  string               `xml:"cbc:ID"`
+	InvoicedQuantity    *ublQuantity         `xml:"cbc:InvoicedQuantity"`
+	CreditedQuantity    *ublQuantity         `xml:"cbc:CreditedQuantity"`
+	LineExtensionAmount ublAmount            `xml:"cbc:LineExtensionAmount"`
+	AllowanceCharges    []ublAllowanceCharge `xml:"cac:AllowanceCharge"`
+	Item                ublItem              `xml:"cac:Item"`
+	Price               ublPrice             `xml:"cac:Price"`
+}
+
+type ublItem struct {
+	Name                      string             `xml:"cbc:Name"`
+	SellersItemIdentification *ublIdentification `xml:"cac:SellersItemIdentification"`
+	ClassifiedTaxCategories   []ublTaxCategory   `xml:"cac:ClassifiedTaxCategory"`
+}
+
+type ublPrice struct {
+	PriceAmount  ublAmount    `xml:"cbc:PriceAmount"`
+	BaseQuantity *ublQuantity `xml:"cbc:BaseQuantity"`
+}
+
+// WriteUBLInvoice writes the invoice as a UBL 2.1 Invoice. Lines are priced without their taxes,
+// their discounts are line allowances and the shipping is a zero rated document level charge, its discount an allowance.
+func WriteUBLInvoice(w io.Writer, invoice *Invoice) error {
+	currency := invoice.Total.Currency
+	if err := checkUBLCurrency(invoice, currency); err != nil {
+		return err
+	}
+
+	document := newUBLDocument(ublInvoiceNamespace, "Invoice", invoice)
+	document.ID = invoice.Number.String()
+	document.IssueDate = invoice.IssuedAt.Format(time.DateOnly)
+	document.InvoiceTypeCode = ublInvoiceTypeCode
+
+	var lineExtension, linesDiscount, linesTax int64
+	for i, line := range invoice.Lines {
+		net := line.Total.Amount - line.Tax.Amount
+		invoiceLine := ublLine{
+			ID:                  strconv.Itoa(i + 1),
+			InvoicedQuantity:    newUBLQuantity(line.Quantity),
+			LineExtensionAmount: newUBLAmount(net, currency),
+			Item:                newUBLItem(line.Name, line.SKU, ublLineTaxCategories(invoice.TaxLines, line.ProductItemID)),
+			Price:               newUBLPrice(net+line.Discount.Amount, line.Quantity, currency),
+		}
+		if !line.Discount.IsZero() {
+			invoiceLine.AllowanceCharges = []ublAllowanceCharge{newUBLAllowanceCharge(false, "Discount", line.Discount.Amount, currency)}
+		}
+		document.InvoiceLines = append(document.InvoiceLines, invoiceLine)
+		lineExtension += net
+		linesDiscount += line.Discount.Amount
+		linesTax += line.Tax.Amount
+	}
+
+	// the tax which isn't on the lines is the tax of the shipping
+	shipping := invoice.Shipping.Amount - (invoice.Tax.Amount - linesTax)
+	shippingDiscount := invoice.Discount.Amount - linesDiscount
+	if shipping != 0 {
+		document.AllowanceCharges = append(document.AllowanceCharges, newUBLDocumentAllowanceCharge(true, "Shipping", shipping, currency))
+		amount := newUBLAmount(shipping, currency)
+		document.LegalMonetaryTotal.ChargeTotalAmount = &amount
+	}
+	if shippingDiscount != 0 {
+		document.AllowanceCharges = append(document.AllowanceCharges, newUBLDocumentAllowanceCharge(false, "Shipping discount", shippingDiscount, currency))
+		amount := newUBLAmount(shippingDiscount, currency)
+		document.LegalMonetaryTotal.AllowanceTotalAmount = &amount
+	}
+
+	taxExclusive := lineExtension + shipping - shippingDiscount
+	document.TaxTotal = newUBLTaxTotal(invoice.Taxes, invoice.Tax.Amount, taxExclusive, currency)
+	document.LegalMonetaryTotal.LineExtensionAmount = newUBLAmount(lineExtension, currency)
+	document.LegalMonetaryTotal.TaxExclusiveAmount = newUBLAmount(taxExclusive, currency)
+	document.LegalMonetaryTotal.TaxInclusiveAmount = newUBLAmount(taxExclusive+invoice.Tax.Amount, currency)
+	document.LegalMonetaryTotal.PayableAmount = newUBLAmount(invoice.Total.Amount, currency)
+
+	return writeUBLDocument(w, document, document.InvoiceLines)
+}
+
+// WriteUBLCreditNote writes a credit note of the invoice as a UBL 2.1 CreditNote referencing the invoice.
+// Its tax is the invoice's tax in the proportion of the credited amount to the invoice total. Refunded items
+// are credited at their share of the invoice lines, what the amount credits beyond or short of them is a
+// document level charge or allowance. A credit note without items has a single line for the whole amount.
+func WriteUBLCreditNote[AccountID comparable](w io.Writer, invoice *Invoice, creditNote *CreditNote[AccountID]) error {
+	currency := invoice.Total.Currency
+	if err := checkUBLCurrency(invoice, currency); err != nil {
+		return err
+	}
+	if creditNote.Amount.Currency != "" && creditNote.Amount.Currency != currency {
+		return ErrCurrencyMismatch
+	}
+	if creditNote.FactorID != 0 && creditNote.FactorID != invoice.FactorID {
+		return ErrCreditNoteFactorMismatch
+	}
+
+	document := newUBLDocument(ublCreditNoteNamespace, "CreditNote", invoice)
+	document.ID = "CN-" + strconv.FormatUint(creditNote.ID, 10)
+	document.IssueDate = creditNote.CreatedAt.Format(time.DateOnly)
+	document.CreditNoteTypeCode = ublCreditNoteTypeCode
+	document.Note = creditNote.Reason
+	document.BillingReference = &ublBillingReference{
+		InvoiceDocumentReference: ublDocumentReference{
+			ID:        invoice.Number.String(),
+			IssueDate: invoice.IssuedAt.Format(time.DateOnly),
+		},
+	}
+
+	// the taxes are prorated in integers and spread over the tax groups, so they add up to the tax of the credit note
+	taxableAmounts := make([]int64, 0, len(invoice.Taxes))
+	taxAmounts := make([]int64, 0, len(invoice.Taxes))
+	for _, invoiceTax := range invoice.Taxes {
+		taxableAmounts = append(taxableAmounts, invoiceTax.TaxableAmount.Amount)
+		taxAmounts = append(taxAmounts, invoiceTax.Amount.Amount)
+	}
+	taxableAmounts = ProrateAmounts(taxableAmounts, creditNote.Amount.Amount, invoice.Total.Amount)
+	taxAmounts = ProrateAmounts(taxAmounts, creditNote.Amount.Amount, invoice.Total.Amount)
+	taxes := make([]InvoiceTax, 0, len(invoice.Taxes))
+	var tax int64
+	for i, invoiceTax := range invoice.Taxes {
+		invoiceTax.TaxableAmount = NewMoney(taxableAmounts[i], currency)
+		invoiceTax.Amount = NewMoney(taxAmounts[i], currency)
+		taxes = append(taxes, invoiceTax)
+		tax += taxAmounts[i]
+	}
+	taxExclusive := creditNote.Amount.Amount - tax
+
+	var lineExtension int64
+	for _, item := range creditNote.Items {
+		for _, line := range invoice.Lines {
+			if line.ProductItemID != item.ProductItemID || line.Quantity <= 0 {
+				continue
+			}
+			quantity := int64(item.Quantity)
+			net := mulDivAmount(line.Total.Amount-line.Tax.Amount, quantity, line.Quantity)
+			document.CreditNoteLines = append(document.CreditNoteLines, ublLine{
+				ID:                  strconv.Itoa(len(document.CreditNoteLines) + 1),
+				CreditedQuantity:    newUBLQuantity(quantity),
+				LineExtensionAmount: newUBLAmount(net, currency),
+				Item:                newUBLItem(line.Name, line.SKU, ublLineTaxCategories(invoice.TaxLines, line.ProductItemID)),
+				Price:               newUBLPrice(net, quantity, currency),
+			})
+			lineExtension += net
+			break
+		}
+	}
+	if len(document.CreditNoteLines) == 0 {
+		categories := make([]ublTaxCategory, 0, len(invoice.Taxes))
+		for _, invoiceTax := range invoice.Taxes {
+			categories = append(categories, newUBLTaxCategory(invoiceTax.Name, invoiceTax.Rate))
+		}
+		document.CreditNoteLines = append(document.CreditNoteLines, ublLine{
+			ID:                  "1",
+			CreditedQuantity:    newUBLQuantity(1),
+			LineExtensionAmount: newUBLAmount(taxExclusive, currency),
+			Item:                newUBLItem("Refund of invoice "+invoice.Number.String(), "", categories),
+			Price:               newUBLPrice(taxExclusive, 1, currency),
+		})
+		lineExtension = taxExclusive
+	}
+
+	if adjustment := taxExclusive - lineExtension; adjustment > 0 {
+		document.AllowanceCharges = append(document.AllowanceCharges, newUBLDocumentAllowanceCharge(true, "Refund adjustment", adjustment, currency))
+		amount := newUBLAmount(adjustment, currency)
+		document.LegalMonetaryTotal.ChargeTotalAmount = &amount
+	} else if adjustment < 0 {
+		document.AllowanceCharges = append(document.AllowanceCharges, newUBLDocumentAllowanceCharge(false, "Refund adjustment", -adjustment, currency))
+		amount := newUBLAmount(-adjustment, currency)
+		document.LegalMonetaryTotal.AllowanceTotalAmount = &amount
+	}
+
+	document.TaxTotal = newUBLTaxTotal(taxes, tax, taxExclusive, currency)
+	document.LegalMonetaryTotal.LineExtensionAmount = newUBLAmount(lineExtension, currency)
+	document.LegalMonetaryTotal.TaxExclusiveAmount = newUBLAmount(taxExclusive, currency)
+	document.LegalMonetaryTotal.TaxInclusiveAmount = newUBLAmount(creditNote.Amount.Amount, currency)
+	document.LegalMonetaryTotal.PayableAmount = newUBLAmount(creditNote.Amount.Amount, currency)
+
+	return writeUBLDocument(w, document, document.CreditNoteLines)
+}
+
+func newUBLDocument(namespace string, name string, invoice *Invoice) *ublDocument {
+	document := &ublDocument{
+		XMLName:                 xml.Name{Local: name},
+		Namespace:               namespace,
+		CACNamespace:            ublCACNamespace,
+		CBCNamespace:            ublCBCNamespace,
+		UBLVersionID:            "2.1",
+		DocumentCurrencyCode:    invoice.Total.Currency,
+		AccountingSupplierParty: ublPartyRole{Party: newUBLParty(invoice.Seller)},
+		AccountingCustomerParty: ublPartyRole{Party: newUBLParty(invoice.Buyer)},
+	}
+	if invoice.OrderID != 0 {
+		document.OrderReference = &ublIdentification{ID: strconv.FormatUint(invoice.OrderID, 10)}
+	}
+	return document
+}
+
+// checkUBLCurrency makes sure every amount of the invoice is in the currency of its total, zero amounts may have none.
+func checkUBLCurrency(invoice *Invoice, currency string) error {
+	amounts := []Money{invoice.Subtotal, invoice.Discount, invoice.Shipping, invoice.Tax}
+	for _, line := range invoice.Lines {
+		amounts = append(amounts, line.UnitPrice, line.Discount, line.Tax, line.Total)
+	}
+	for _, tax := range invoice.Taxes {
+		amounts = append(amounts, tax.TaxableAmount, tax.Amount)
+	}
+	for _, amount := range amounts {
+		if amount.Currency != "" && amount.Currency != currency {
+			return ErrCurrencyMismatch
+		}
+	}
+	return nil
+}
+
+func writeUBLDocument(w io.Writer, document *ublDocument, lines []ublLine) error {
+	missing := make([]string, 0)
+	if document.ID == "" {
+		missing = append(missing, "cbc:ID")
+	}
+	if document.DocumentCurrencyCode == "" {
+		missing = append(missing, "cbc:DocumentCurrencyCode")
+	}
+	if document.AccountingSupplierParty.Party.PartyLegalEntity.RegistrationName == "" {
+		missing = append(missing, "cac:AccountingSupplierParty/cac:Party/cac:PartyLegalEntity/cbc:RegistrationName")
+	}
+	if document.AccountingCustomerParty.Party.PartyLegalEntity.RegistrationName == "" {
+		missing = append(missing, "cac:AccountingCustomerParty/cac:Party/cac:PartyLegalEntity/cbc:RegistrationName")
+	}
+	if len(lines) == 0 {
+		missing = append(missing, "cac:"+document.XMLName.Local+"Line")
+	}
+	for _, line := range lines {
+		if line.Item.Name == "" {
+			missing = append(missing, "cac:"+document.XMLName.Local+"Line["+line.ID+"]/cac:Item/cbc:Name")
+		}
+	}
+	if len(missing) != 0 {
+		return errors.Join(ErrIncompleteUBLDocument, errors.New("missing "+strings.Join(missing, ", ")))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func newUBLAmount(amount int64, currency string) ublAmount {
+	return ublAmount{
+		CurrencyID: currency,
+		Value:      NewMoney(amount, currency).Decimal(),
+	}
+}
+
+func newUBLQuantity(quantity int64) *ublQuantity {
+	return &ublQuantity{
+		UnitCode: ublUnitCode,
+		Value:    strconv.FormatInt(quantity, 10),
+	}
+}
+
+// newUBLPrice prices a unit when the amount divides by the quantity, otherwise the amount is the price of the quantity.
+func newUBLPrice(amount int64, quantity int64, currency string) ublPrice {
+	if quantity <= 1 || amount%quantity == 0 {
+		return ublPrice{PriceAmount: newUBLAmount(amount/max(quantity, 1), currency)}
+	}
+	return ublPrice{
+		PriceAmount:  newUBLAmount(amount, currency),
+		BaseQuantity: newUBLQuantity(quantity),
+	}
+}
+
+func newUBLAllowanceCharge(charge bool, reason string, amount int64, currency string) ublAllowanceCharge {
+	return ublAllowanceCharge{
+		ChargeIndicator:       charge,
+		AllowanceChargeReason: reason,
+		Amount:                newUBLAmount(amount, currency),
+	}
+}
+
+// newUBLDocumentAllowanceCharge is zero rated, the taxes of the invoice are all on its lines.
+func newUBLDocumentAllowanceCharge(charge bool, reason string, amount int64, currency string) ublAllowanceCharge {
+	allowanceCharge := newUBLAllowanceCharge(charge, reason, amount, currency)
+	category := newUBLTaxCategory("", 0)
+	allowanceCharge.TaxCategory = &category
+	return allowanceCharge
+}
+
+func newUBLItem(name string, sku string, categories []ublTaxCategory) ublItem {
+	item := ublItem{
+		Name:                    name,
+		ClassifiedTaxCategories: categories,
+	}
+	if sku != "" {
+		item.SellersItemIdentification = &ublIdentification{ID: sku}
+	}
+	return item
+}
+
+// newUBLTaxCategory is standard rated (S) for positive rates, zero rated (Z) otherwise.
+func newUBLTaxCategory(name string, rate float64) ublTaxCategory {
+	id := "Z"
+	if rate > 0 {
+		id = "S"
+	}
+	return ublTaxCategory{
+		ID:        id,
+		Name:      name,
+		Percent:   formatRatePercent(rate),
+		TaxScheme: ublIdentification{ID: ublTaxScheme},
+	}
+}
+
+func ublLineTaxCategories(taxLines []TaxLine, productItemID uint64) []ublTaxCategory {
+	categories := make([]ublTaxCategory, 0, 1)
+	for _, line := range taxLines {
+		if line.ProductItemID == productItemID {
+			categories = append(categories, newUBLTaxCategory(line.Name, line.Rate))
+		}
+	}
+	if len(categories) == 0 {
+		categories = append(categories, newUBLTaxCategory("", 0))
+	}
+	return categories
+}
+
+// newUBLTaxTotal breaks the tax down by the taxes of the invoice. What they don't tax of the tax exclusive amount, like
+// the shipping, is a zero rated subtotal, so the taxable amounts add up to it. An untaxed document has only that one.
+func newUBLTaxTotal(taxes []InvoiceTax, tax int64, taxExclusive int64, currency string) ublTaxTotal {
+	total := ublTaxTotal{TaxAmount: newUBLAmount(tax, currency)}
+	untaxed := taxExclusive
+	for _, invoiceTax := range taxes {
+		total.TaxSubtotals = append(total.TaxSubtotals, ublTaxSubtotal{
+			TaxableAmount: newUBLAmount(invoiceTax.TaxableAmount.Amount, currency),
+			TaxAmount:     newUBLAmount(invoiceTax.Amount.Amount, currency),
+			TaxCategory:   newUBLTaxCategory(invoiceTax.Name, invoiceTax.Rate),
+		})
+		untaxed -= invoiceTax.TaxableAmount.Amount
+	}
+	if untaxed > 0 || len(total.TaxSubtotals) == 0 {
+		total.TaxSubtotals = append(total.TaxSubtotals, ublTaxSubtotal{
+			TaxableAmount: newUBLAmount(untaxed, currency),
+			TaxAmount:     newUBLAmount(0, currency),
+			TaxCategory:   newUBLTaxCategory("", 0),
+		})
+	}
+	return total
+}
+
+// ProrateAmounts takes numerator / denominator of the amounts in minor units, the total is rounded toward zero and spread
+// over the amounts in proportion to them, rounding the running total down so the shares add up to it like the discounts
+// of the cart lines. The amounts must have the same sign.
+func ProrateAmounts(amounts []int64, numerator int64, denominator int64) []int64 {
+	var total int64
+	for _, amount := range amounts {
+		total += amount
+	}
+	shares := make([]int64, len(amounts))
+	if total == 0 || denominator == 0 {
+		return shares
+	}
+	prorated := mulDivAmount(total, numerator, denominator)
+	var running int64
+	for i, amount := range amounts {
+		before := running
+		running += amount
+		shares[i] = mulDivAmount(prorated, running, total) - mulDivAmount(prorated, before, total)
+	}
+	return shares
+}
+
+// mulDivAmount returns a * b / c rounded toward zero without overflowing, the result must fit in an int64.
+func mulDivAmount(a int64, b int64, c int64) int64 {
+	if c == 0 {
+		return 0
+	}
+	negative := (a < 0) != (b < 0) != (c < 0)
+	result := int64(mulDiv(absAmount(a), absAmount(b), absAmount(c)))
+	if negative {
+		return -result
+	}
+	return result
+}
+
+func absAmount(amount int64) uint64 {
+	if amount < 0 {
+		return uint64(-amount)
+	}
+	return uint64(amount)
+}
+
+func newUBLParty(party InvoiceParty) ublParty {
+	result := ublParty{
+		PartyLegalEntity: ublLegalEntity{RegistrationName: party.Name},
+	}
+	if party.Name != "" {
+		result.PartyName = &ublName{Name: party.Name}
+	}
+
+	address := ublAddress{
+		CityName:         party.City,
+		PostalZone:       party.PostalCode,
+		CountrySubentity: party.Region,
+	}
+	for i, line := range party.AddressLines {
+		switch i {
+		case 0:
+			address.StreetName = line
+		case 1:
+			address.AdditionalStreetName = line
+		default:
+			address.AddressLines = append(address.AddressLines, ublAddressLine{Line: line})
+		}
+	}
+	if party.CountryCode != "" || party.Country != "" {
+		address.Country = &ublCountry{
+			IdentificationCode: strings.ToUpper(party.CountryCode),
+			Name:               party.Country,
+		}
+	}
+	if address.StreetName != "" || address.CityName != "" || address.PostalZone != "" || address.CountrySubentity != "" || address.Country != nil {
+		result.PostalAddress = &address
+	}
+
+	if party.TaxID != "" {
+		result.PartyTaxScheme = &ublPartyTaxScheme{
+			CompanyID: party.TaxID,
+			TaxScheme: ublIdentification{ID: ublTaxScheme},
+		}
+	}
+	if party.Phone != "" || party.Email != "" {
+		result.Contact = &ublContact{
+			Telephone:      party.Phone,
+			ElectronicMail: party.Email,
+		}
+	}
+	return result
+}
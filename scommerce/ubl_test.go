@@ -0,0 +1,304 @@
+package scommerce
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var ublPrefixes = map[string]string{
+	ublCACNamespace: "cac",
+	ublCBCNamespace: "cbc",
+}
+
+// newTestInvoice has a discounted line, a line without discount, a discounted shipping and one tax.
+func newTestInvoice() *Invoice {
+	usd := func(amount int64) Money { return NewMoney(amount, "USD") }
+	return &Invoice{
+		FactorID: 12,
+		Number:   InvoiceNumber{Year: 2025, Sequence: 42},
+		IssuedAt: time.Date(2025, time.March, 14, 10, 30, 0, 0, time.UTC),
+		OrderID:  7,
+		Seller: InvoiceParty{
+			Name:         "Example Store Ltd",
+			TaxID:        "GB123456789",
+			AddressLines: []string{"1 Market Street"},
+			City:         "London",
+			PostalCode:   "EC1A 1BB",
+			Country:      "United Kingdom",
+			CountryCode:  "gb",
+		},
+		Buyer: InvoiceParty{
+			Name:         "Jane Doe",
+			Email:        "jane@example.com",
+			AddressLines: []string{"22 Baker Street", "Flat 3"},
+			City:         "London",
+			PostalCode:   "NW1 6XE",
+			Country:      "United Kingdom",
+			CountryCode:  "GB",
+		},
+		Lines: []FactorLine{
+			{ProductItemID: 1, SKU: "TSHIRT-M-RED", Name: "T-Shirt M Red", UnitPrice: usd(1000), Quantity: 2, Discount: usd(200), Tax: usd(180), Total: usd(1980)},
+			{ProductItemID: 2, SKU: "MUG-WHITE", Name: "Mug White", UnitPrice: usd(500), Quantity: 1, Discount: usd(0), Tax: usd(50), Total: usd(550)},
+		},
+		Taxes: []InvoiceTax{
+			{Name: "VAT", Rate: 0.1, TaxableAmount: usd(2300), Amount: usd(230)},
+		},
+		TaxLines: []TaxLine{
+			{ProductItemID: 1, Name: "VAT", Rate: 0.1, TaxableAmount: usd(1800), Amount: usd(180)},
+			{ProductItemID: 2, Name: "VAT", Rate: 0.1, TaxableAmount: usd(500), Amount: usd(50)},
+		},
+		Subtotal: usd(2500),
+		Discount: usd(300),
+		Shipping: usd(400),
+		Tax:      usd(230),
+		Total:    usd(2830),
+	}
+}
+
+func newTestCreditNote() *CreditNote[uint64] {
+	return &CreditNote[uint64]{
+		ID:        3,
+		OrderID:   7,
+		FactorID:  12,
+		AccountID: 5,
+		Items:     []RefundItem{{ProductItemID: 1, Quantity: 1}},
+		Amount:    NewMoney(990, "USD"),
+		Reason:    "Returned one t-shirt",
+		CreatedAt: time.Date(2025, time.March, 20, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWriteUBLInvoice(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteUBLInvoice(&buf, newTestInvoice()); err != nil {
+		t.Fatal(err)
+	}
+	checkUBLGolden(t, "ubl_invoice.golden.xml", buf.Bytes())
+	checkUBLRequiredElements(t, buf.Bytes(), "Invoice", "cac:InvoiceLine", "cbc:InvoicedQuantity")
+	checkUBLTypeCode(t, buf.Bytes(), "cbc:InvoiceTypeCode", ublInvoiceTypeCode)
+	checkUBLTaxableAmounts(t, buf.Bytes())
+}
+
+func TestWriteUBLCreditNote(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteUBLCreditNote(&buf, newTestInvoice(), newTestCreditNote()); err != nil {
+		t.Fatal(err)
+	}
+	checkUBLGolden(t, "ubl_credit_note.golden.xml", buf.Bytes())
+	checkUBLRequiredElements(t, buf.Bytes(), "CreditNote", "cac:CreditNoteLine", "cbc:CreditedQuantity")
+	checkUBLTypeCode(t, buf.Bytes(), "cbc:CreditNoteTypeCode", ublCreditNoteTypeCode)
+	checkUBLTaxableAmounts(t, buf.Bytes())
+}
+
+func TestWriteUBLIncompleteDocument(t *testing.T) {
+	invoice := newTestInvoice()
+	invoice.Seller.Name = ""
+	invoice.Lines = nil
+
+	var buf bytes.Buffer
+	err := WriteUBLInvoice(&buf, invoice)
+	if !errors.Is(err, ErrIncompleteUBLDocument) {
+		t.Fatalf("got %v, want %v", err, ErrIncompleteUBLDocument)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("an incomplete document must not be written")
+	}
+
+	creditNote := newTestCreditNote()
+	creditNote.FactorID = 13
+	if err := WriteUBLCreditNote(&buf, newTestInvoice(), creditNote); !errors.Is(err, ErrCreditNoteFactorMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrCreditNoteFactorMismatch)
+	}
+}
+
+func checkUBLGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file, run go test -update to rewrite it\ngot:\n%s", name, got)
+	}
+}
+
+// checkUBLRequiredElements checks the elements UBL 2.1 requires on the document and on every line.
+func checkUBLRequiredElements(t *testing.T, data []byte, root string, line string, quantity string) {
+	t.Helper()
+	document := parseUBLElement(t, data)
+	if document.name != root {
+		t.Fatalf("root is %s, want %s", document.name, root)
+	}
+	for _, name := range []string{
+		"cbc:UBLVersionID",
+		"cbc:ID",
+		"cbc:IssueDate",
+		"cbc:DocumentCurrencyCode",
+		"cac:AccountingSupplierParty",
+		"cac:AccountingCustomerParty",
+		"cac:TaxTotal",
+		"cac:LegalMonetaryTotal",
+		line,
+	} {
+		if document.child(name) == nil {
+			t.Errorf("%s misses %s", root, name)
+		}
+	}
+	for _, party := range []string{"cac:AccountingSupplierParty", "cac:AccountingCustomerParty"} {
+		if document.path(party, "cac:Party", "cac:PartyLegalEntity", "cbc:RegistrationName") == nil {
+			t.Errorf("%s misses its registration name", party)
+		}
+	}
+	if document.path("cac:TaxTotal", "cbc:TaxAmount") == nil || document.path("cac:TaxTotal", "cac:TaxSubtotal", "cac:TaxCategory", "cbc:Percent") == nil {
+		t.Error("cac:TaxTotal misses its tax amount or breakdown")
+	}
+	for _, name := range []string{"cbc:LineExtensionAmount", "cbc:TaxExclusiveAmount", "cbc:TaxInclusiveAmount", "cbc:PayableAmount"} {
+		if document.path("cac:LegalMonetaryTotal", name) == nil {
+			t.Errorf("cac:LegalMonetaryTotal misses %s", name)
+		}
+	}
+
+	lines := 0
+	for _, element := range document.children {
+		if element.name != line {
+			continue
+		}
+		lines++
+		for _, name := range []string{"cbc:ID", quantity, "cbc:LineExtensionAmount", "cac:Item", "cac:Price"} {
+			if element.child(name) == nil {
+				t.Errorf("%s %d misses %s", line, lines, name)
+			}
+		}
+		if element.path("cac:Item", "cbc:Name") == nil || element.path("cac:Price", "cbc:PriceAmount") == nil {
+			t.Errorf("%s %d misses its item name or price amount", line, lines)
+		}
+	}
+	if lines == 0 {
+		t.Errorf("%s has no %s", root, line)
+	}
+}
+
+func checkUBLTypeCode(t *testing.T, data []byte, name string, want string) {
+	t.Helper()
+	element := parseUBLElement(t, data).child(name)
+	if element == nil {
+		t.Fatalf("document misses %s", name)
+	}
+	if element.text != want {
+		t.Errorf("%s is %q, want %q", name, element.text, want)
+	}
+}
+
+// checkUBLTaxableAmounts checks that the tax subtotals break down the tax exclusive amount and the tax amount.
+func checkUBLTaxableAmounts(t *testing.T, data []byte) {
+	t.Helper()
+	document := parseUBLElement(t, data)
+	var taxable, tax int64
+	for _, subtotal := range document.child("cac:TaxTotal").children {
+		if subtotal.name != "cac:TaxSubtotal" {
+			continue
+		}
+		taxable += parseUBLTestAmount(t, subtotal.child("cbc:TaxableAmount"))
+		tax += parseUBLTestAmount(t, subtotal.child("cbc:TaxAmount"))
+	}
+	if want := parseUBLTestAmount(t, document.path("cac:LegalMonetaryTotal", "cbc:TaxExclusiveAmount")); taxable != want {
+		t.Errorf("taxable amounts add up to %d, want the tax exclusive amount %d", taxable, want)
+	}
+	if want := parseUBLTestAmount(t, document.path("cac:TaxTotal", "cbc:TaxAmount")); tax != want {
+		t.Errorf("tax subtotals add up to %d, want the tax amount %d", tax, want)
+	}
+}
+
+func parseUBLTestAmount(t *testing.T, element *ublTestElement) int64 {
+	t.Helper()
+	if element == nil {
+		t.Fatal("amount is missing")
+	}
+	amount, err := ParseMoney(element.text, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amount.Amount
+}
+
+type ublTestElement struct {
+	name     string
+	text     string
+	children []*ublTestElement
+}
+
+func (element *ublTestElement) child(name string) *ublTestElement {
+	for _, child := range element.children {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+func (element *ublTestElement) path(names ...string) *ublTestElement {
+	for _, name := range names {
+		if element = element.child(name); element == nil {
+			return nil
+		}
+	}
+	return element
+}
+
+// parseUBLElement reads the element tree with the cac and cbc prefixes put back on the names and the text of the elements.
+func parseUBLElement(t *testing.T, data []byte) *ublTestElement {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root *ublTestElement
+	stack := make([]*ublTestElement, 0)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			name := token.Name.Local
+			if prefix, ok := ublPrefixes[token.Name.Space]; ok {
+				name = prefix + ":" + name
+			}
+			element := &ublTestElement{name: name}
+			if len(stack) == 0 {
+				root = element
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, element)
+			}
+			stack = append(stack, element)
+		case xml.CharData:
+			if len(stack) != 0 {
+				stack[len(stack)-1].text += strings.TrimSpace(string(token))
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if root == nil {
+		t.Fatal("document has no root element")
+	}
+	return root
+}
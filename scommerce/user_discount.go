@@ -11,6 +11,8 @@ import (
 )
 
 var ErrExceededMaxRetries = errors.New("exceeded maximum retry attempts")
+var ErrInvalidUserDiscountType = errors.New("invalid user discount type")
+var ErrInvalidUserDiscountPercentage = errors.New("user discount percentage must be between 0 and 100")
 
 var _ UserDiscountManager[any] = &BuiltinUserDiscountManager[any]{}
 var _ UserDiscount[any] = &BuiltinUserDiscount[any]{}
@@ -32,12 +34,19 @@ type BuiltinUserDiscountManager[AccountID comparable] struct {
 }
 
 type UserDiscountForm[AccountID comparable] struct {
-	ID            uint64       `json:"id"`
-	UserAccountID AccountID    `json:"account_id"`
-	Code          *string      `json:"code,omitempty"`
-	Value         *float64     `json:"value,omitempty"`
-	ValidCount    *int64       `json:"valid_count,omitempty"`
-	UsedBy        *[]AccountID `json:"used_by,omitempty"`
+	ID             uint64             `json:"id"`
+	UserAccountID  AccountID          `json:"account_id"`
+	Code           *string            `json:"code,omitempty"`
+	Value          *Money             `json:"value,omitempty"`
+	ValidCount     *int64             `json:"valid_count,omitempty"`
+	UsedBy         *[]AccountID       `json:"used_by,omitempty"`
+	Type           *UserDiscountType  `json:"type,omitempty"`
+	Percentage     *float64           `json:"percentage,omitempty"`
+	MaxValue       *Money             `json:"max_value,omitempty"`        // zero leaves the discount uncapped
+	MinOrderAmount *Money             `json:"min_order_amount,omitempty"` // subtotal the cart must reach
+	StartsAt       *time.Time         `json:"starts_at,omitempty"`        // zero when the code is valid from its creation
+	EndsAt         *time.Time         `json:"ends_at,omitempty"`          // zero when the code never expires
+	Scope          *UserDiscountScope `json:"scope,omitempty"`
 }
 
 type BuiltinUserDiscount[AccountID comparable] struct {
@@ -155,7 +164,7 @@ func (discountManager *BuiltinUserDiscountManager[AccountID]) Init(ctx context.C
 	return discountManager.DB.InitUserDiscountManager(ctx)
 }
 
-func (discountManager *BuiltinUserDiscountManager[AccountID]) NewUserDiscount(ctx context.Context, ownerAccount UserAccount[AccountID], value float64, validCount int64) (UserDiscount[AccountID], error) {
+func (discountManager *BuiltinUserDiscountManager[AccountID]) NewUserDiscount(ctx context.Context, ownerAccount UserAccount[AccountID], value Money, validCount int64) (UserDiscount[AccountID], error) {
 	aid, err := ownerAccount.GetID(ctx)
 	if err != nil {
 		return nil, err
@@ -251,12 +260,208 @@ func (discount *BuiltinUserDiscount[AccountID]) GetCode(ctx context.Context) (st
 	return code, nil
 }
 
+func (discount *BuiltinUserDiscount[AccountID]) GetEndsAt(ctx context.Context) (time.Time, error) {
+	discount.MU.RLock()
+	if discount.EndsAt != nil {
+		defer discount.MU.RUnlock()
+		return *discount.EndsAt, nil
+	}
+	discount.MU.RUnlock()
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	endsAt, err := discount.DB.GetUserDiscountEndsAt(ctx, &form, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return time.Time{}, err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.EndsAt = &endsAt
+	return endsAt, nil
+}
+
 func (discount *BuiltinUserDiscount[AccountID]) GetID(ctx context.Context) (uint64, error) {
 	discount.MU.RLock()
 	defer discount.MU.RUnlock()
 	return discount.ID, nil
 }
 
+func (discount *BuiltinUserDiscount[AccountID]) GetMaxValue(ctx context.Context) (Money, error) {
+	discount.MU.RLock()
+	if discount.MaxValue != nil {
+		defer discount.MU.RUnlock()
+		return *discount.MaxValue, nil
+	}
+	discount.MU.RUnlock()
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return Money{}, err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return Money{}, err
+	}
+	maxValue, err := discount.DB.GetUserDiscountMaxValue(ctx, &form, id)
+	if err != nil {
+		return Money{}, err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return Money{}, err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.MaxValue = &maxValue
+	return maxValue, nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) GetMinOrderAmount(ctx context.Context) (Money, error) {
+	discount.MU.RLock()
+	if discount.MinOrderAmount != nil {
+		defer discount.MU.RUnlock()
+		return *discount.MinOrderAmount, nil
+	}
+	discount.MU.RUnlock()
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return Money{}, err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return Money{}, err
+	}
+	minOrderAmount, err := discount.DB.GetUserDiscountMinOrderAmount(ctx, &form, id)
+	if err != nil {
+		return Money{}, err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return Money{}, err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.MinOrderAmount = &minOrderAmount
+	return minOrderAmount, nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) GetPercentage(ctx context.Context) (float64, error) {
+	discount.MU.RLock()
+	if discount.Percentage != nil {
+		defer discount.MU.RUnlock()
+		return *discount.Percentage, nil
+	}
+	discount.MU.RUnlock()
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return 0, err
+	}
+	percentage, err := discount.DB.GetUserDiscountPercentage(ctx, &form, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return 0, err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.Percentage = &percentage
+	return percentage, nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) GetScope(ctx context.Context) (UserDiscountScope, error) {
+	discount.MU.RLock()
+	if discount.Scope != nil {
+		defer discount.MU.RUnlock()
+		return *discount.Scope, nil
+	}
+	discount.MU.RUnlock()
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return UserDiscountScope{}, err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return UserDiscountScope{}, err
+	}
+	scope, err := discount.DB.GetUserDiscountScope(ctx, &form, id)
+	if err != nil {
+		return UserDiscountScope{}, err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return UserDiscountScope{}, err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.Scope = &scope
+	return scope, nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) GetStartsAt(ctx context.Context) (time.Time, error) {
+	discount.MU.RLock()
+	if discount.StartsAt != nil {
+		defer discount.MU.RUnlock()
+		return *discount.StartsAt, nil
+	}
+	discount.MU.RUnlock()
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	startsAt, err := discount.DB.GetUserDiscountStartsAt(ctx, &form, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return time.Time{}, err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.StartsAt = &startsAt
+	return startsAt, nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) GetType(ctx context.Context) (UserDiscountType, error) {
+	discount.MU.RLock()
+	if discount.Type != nil {
+		defer discount.MU.RUnlock()
+		return *discount.Type, nil
+	}
+	discount.MU.RUnlock()
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return "", err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return "", err
+	}
+	discountType, err := discount.DB.GetUserDiscountType(ctx, &form, id)
+	if err != nil {
+		return "", err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return "", err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.Type = &discountType
+	return discountType, nil
+}
+
 func (discount *BuiltinUserDiscount[AccountID]) GetUserAccountID(ctx context.Context) (AccountID, error) {
 	discount.MU.RLock()
 	defer discount.MU.RUnlock()
@@ -319,7 +524,7 @@ func (discount *BuiltinUserDiscount[AccountID]) GetValidCount(ctx context.Contex
 	return validCount, nil
 }
 
-func (discount *BuiltinUserDiscount[AccountID]) GetValue(ctx context.Context) (float64, error) {
+func (discount *BuiltinUserDiscount[AccountID]) GetValue(ctx context.Context) (Money, error) {
 	discount.MU.RLock()
 	if discount.Value != nil {
 		defer discount.MU.RUnlock()
@@ -328,18 +533,18 @@ func (discount *BuiltinUserDiscount[AccountID]) GetValue(ctx context.Context) (f
 	discount.MU.RUnlock()
 	id, err := discount.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := discount.UserDiscountForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	value, err := discount.DB.GetUserDiscountValue(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := discount.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	discount.MU.Lock()
 	defer discount.MU.Unlock()
@@ -424,6 +629,159 @@ func (discount *BuiltinUserDiscount[AccountID]) SetCode(ctx context.Context, cod
 	return nil
 }
 
+func (discount *BuiltinUserDiscount[AccountID]) SetEndsAt(ctx context.Context, endsAt time.Time) error {
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := discount.DB.SetUserDiscountEndsAt(ctx, &form, id, endsAt); err != nil {
+		return err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.EndsAt = &endsAt
+	return nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) SetMaxValue(ctx context.Context, maxValue Money) error {
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := discount.DB.SetUserDiscountMaxValue(ctx, &form, id, maxValue); err != nil {
+		return err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.MaxValue = &maxValue
+	return nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) SetMinOrderAmount(ctx context.Context, minOrderAmount Money) error {
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := discount.DB.SetUserDiscountMinOrderAmount(ctx, &form, id, minOrderAmount); err != nil {
+		return err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.MinOrderAmount = &minOrderAmount
+	return nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) SetPercentage(ctx context.Context, percentage float64) error {
+	if percentage < 0 || percentage > 100 {
+		return ErrInvalidUserDiscountPercentage
+	}
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := discount.DB.SetUserDiscountPercentage(ctx, &form, id, percentage); err != nil {
+		return err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.Percentage = &percentage
+	return nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) SetScope(ctx context.Context, scope UserDiscountScope) error {
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := discount.DB.SetUserDiscountScope(ctx, &form, id, scope); err != nil {
+		return err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.Scope = &scope
+	return nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) SetStartsAt(ctx context.Context, startsAt time.Time) error {
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := discount.DB.SetUserDiscountStartsAt(ctx, &form, id, startsAt); err != nil {
+		return err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.StartsAt = &startsAt
+	return nil
+}
+
+func (discount *BuiltinUserDiscount[AccountID]) SetType(ctx context.Context, discountType UserDiscountType) error {
+	if !discountType.IsValid() {
+		return ErrInvalidUserDiscountType
+	}
+	id, err := discount.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := discount.UserDiscountForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := discount.DB.SetUserDiscountType(ctx, &form, id, discountType); err != nil {
+		return err
+	}
+	if err := discount.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	discount.MU.Lock()
+	defer discount.MU.Unlock()
+	discount.Type = &discountType
+	return nil
+}
+
 func (discount *BuiltinUserDiscount[AccountID]) SetValidCount(ctx context.Context, validCount int64) error {
 	id, err := discount.GetID(ctx)
 	if err != nil {
@@ -445,7 +803,7 @@ func (discount *BuiltinUserDiscount[AccountID]) SetValidCount(ctx context.Contex
 	return nil
 }
 
-func (discount *BuiltinUserDiscount[AccountID]) SetValue(ctx context.Context, value float64) error {
+func (discount *BuiltinUserDiscount[AccountID]) SetValue(ctx context.Context, value Money) error {
 	id, err := discount.GetID(ctx)
 	if err != nil {
 		return err
@@ -498,6 +856,27 @@ func (discount *BuiltinUserDiscount[AccountID]) ApplyFormObject(ctx context.Cont
 	if form.UsedBy != nil {
 		discount.UsedBy = form.UsedBy
 	}
+	if form.Type != nil {
+		discount.Type = form.Type
+	}
+	if form.Percentage != nil {
+		discount.Percentage = form.Percentage
+	}
+	if form.MaxValue != nil {
+		discount.MaxValue = form.MaxValue
+	}
+	if form.MinOrderAmount != nil {
+		discount.MinOrderAmount = form.MinOrderAmount
+	}
+	if form.StartsAt != nil {
+		discount.StartsAt = form.StartsAt
+	}
+	if form.EndsAt != nil {
+		discount.EndsAt = form.EndsAt
+	}
+	if form.Scope != nil {
+		discount.Scope = form.Scope
+	}
 	return nil
 }
 
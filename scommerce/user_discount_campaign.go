@@ -0,0 +1,266 @@
+package scommerce
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/MobinYengejehi/scommerce/scommerce/otp"
+)
+
+var ErrInvalidUserDiscountCampaignCodeCount = errors.New("discount campaign needs at least one code")
+var ErrUserDiscountCampaignCodeSpace = errors.New("discount campaign needs more codes than the code length allows")
+
+// userDiscountCampaignBatchSize is the number of codes generated and stored at once.
+const userDiscountCampaignBatchSize = 1000
+
+// userDiscountCampaignMaxCollisions is how many generated codes in a row may repeat earlier ones of the batch
+// before generateCodes gives up, the code space is nearly used up by then.
+const userDiscountCampaignMaxCollisions = 1000
+
+// UserDiscountRules are shared by every code of a campaign, see the matching fields of UserDiscountForm.
+type UserDiscountRules struct {
+	Type           UserDiscountType  `json:"type"`
+	Value          Money             `json:"value"`
+	Percentage     float64           `json:"percentage"`
+	MaxValue       Money             `json:"max_value"`
+	MinOrderAmount Money             `json:"min_order_amount"`
+	StartsAt       time.Time         `json:"starts_at"`
+	EndsAt         time.Time         `json:"ends_at"`
+	Scope          UserDiscountScope `json:"scope"`
+	ValidCount     int64             `json:"valid_count"` // uses of each code
+}
+
+// UserDiscountCampaign groups discount codes generated together, its codes are
+// removed with it.
+type UserDiscountCampaign[AccountID comparable] struct {
+	ID         uint64            `json:"id"`
+	AccountID  AccountID         `json:"account_id"` // owner of the codes
+	Name       string            `json:"name"`
+	CodePrefix string            `json:"code_prefix,omitempty"`
+	Rules      UserDiscountRules `json:"rules"`
+	CodeCount  uint64            `json:"code_count"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// UserDiscountCampaignReport counts the orders placed with the codes of a campaign.
+type UserDiscountCampaignReport struct {
+	CampaignID        uint64  `json:"campaign_id"`
+	CodeCount         uint64  `json:"code_count"`
+	RedeemedCodeCount uint64  `json:"redeemed_code_count"` // codes used by at least one order
+	RedemptionCount   uint64  `json:"redemption_count"`    // orders placed with a code of the campaign
+	RedemptionRate    float64 `json:"redemption_rate"`     // RedeemedCodeCount / CodeCount
+}
+
+func (rules *UserDiscountRules) validate() error {
+	if !rules.Type.IsValid() {
+		return ErrInvalidUserDiscountType
+	}
+	if rules.Percentage < 0 || rules.Percentage > 100 {
+		return ErrInvalidUserDiscountPercentage
+	}
+	return nil
+}
+
+func (discountManager *BuiltinUserDiscountManager[AccountID]) generateCodes(prefix string, count int64) ([]string, error) {
+	discountManager.MU.Lock()
+	defer discountManager.MU.Unlock()
+
+	codes := make([]string, 0, count)
+	seen := make(map[string]struct{}, count)
+	collisions := 0
+	for int64(len(codes)) < count {
+		code := prefix + string(otp.GenerateRandomBytes(discountManager.CodeLength, otp.TokenKeys, discountManager.RandSrc))
+		if _, ok := seen[code]; ok {
+			collisions++
+			if collisions >= userDiscountCampaignMaxCollisions {
+				return nil, ErrExceededMaxRetries
+			}
+			continue
+		}
+		collisions = 0
+		seen[code] = struct{}{}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// codeSpaceHolds reports whether there are at least count different codes of the code length.
+func (discountManager *BuiltinUserDiscountManager[AccountID]) codeSpaceHolds(count int64) bool {
+	var space int64 = 1
+	for i := int32(0); i < discountManager.CodeLength && space < count; i++ {
+		space *= int64(len(otp.TokenKeys))
+	}
+	return space >= count
+}
+
+// NewUserDiscountCampaign generates count unique codes sharing the rules, each code is prefix followed by CodeLength random characters.
+// Codes colliding with existing ones are generated again, the campaign is removed if it can't be filled.
+// A count above the number of codes of CodeLength characters fails with ErrUserDiscountCampaignCodeSpace.
+func (discountManager *BuiltinUserDiscountManager[AccountID]) NewUserDiscountCampaign(ctx context.Context, ownerAccount UserAccount[AccountID], name string, prefix string, count int64, rules UserDiscountRules) (*UserDiscountCampaign[AccountID], error) {
+	const maxTry = 1000
+
+	if count <= 0 {
+		return nil, ErrInvalidUserDiscountCampaignCodeCount
+	}
+	if !discountManager.codeSpaceHolds(count) {
+		return nil, ErrUserDiscountCampaignCodeSpace
+	}
+	if err := rules.validate(); err != nil {
+		return nil, err
+	}
+	aid, err := ownerAccount.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	campaign := &UserDiscountCampaign[AccountID]{
+		AccountID:  aid,
+		Name:       name,
+		CodePrefix: prefix,
+		Rules:      rules,
+	}
+	cid, err := discountManager.DB.NewUserDiscountCampaign(ctx, aid, campaign)
+	if err != nil {
+		return nil, err
+	}
+
+	var inserted int64 = 0
+	for try := 0; inserted < count; try++ {
+		if try >= maxTry {
+			err = ErrExceededMaxRetries
+			break
+		}
+		var codes []string
+		codes, err = discountManager.generateCodes(prefix, min(count-inserted, userDiscountCampaignBatchSize))
+		if err != nil {
+			break
+		}
+		var n int64
+		n, err = discountManager.DB.AddUserDiscountCampaignCodes(ctx, cid, codes)
+		if err != nil {
+			break
+		}
+		inserted += n
+	}
+	if err != nil {
+		return nil, errors.Join(err, discountManager.DB.RemoveUserDiscountCampaign(ctx, cid))
+	}
+
+	campaign.CodeCount = uint64(inserted)
+	return campaign, nil
+}
+
+func (discountManager *BuiltinUserDiscountManager[AccountID]) GetUserDiscountCampaignWithID(ctx context.Context, cid uint64) (*UserDiscountCampaign[AccountID], error) {
+	campaign := &UserDiscountCampaign[AccountID]{}
+	if err := discountManager.DB.GetUserDiscountCampaign(ctx, cid, campaign); err != nil {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+func (discountManager *BuiltinUserDiscountManager[AccountID]) GetUserDiscountCampaigns(ctx context.Context, campaigns []UserDiscountCampaign[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserDiscountCampaign[AccountID], error) {
+	return discountManager.DB.GetUserDiscountCampaigns(ctx, campaigns, skip, limit, queueOrder)
+}
+
+func (discountManager *BuiltinUserDiscountManager[AccountID]) GetUserDiscountCampaignDiscounts(ctx context.Context, cid uint64, discounts []UserDiscount[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserDiscount[AccountID], error) {
+	var err error = nil
+	ids := make([]uint64, 0, GetSafeLimit(limit))
+	discountForms := make([]*UserDiscountForm[AccountID], 0, cap(ids))
+	ids, discountForms, err = discountManager.DB.GetUserDiscountCampaignDiscounts(ctx, cid, ids, discountForms, skip, limit, queueOrder)
+	if err != nil {
+		return nil, err
+	}
+	discs := discounts
+	if discs == nil {
+		discs = make([]UserDiscount[AccountID], 0, len(ids))
+	}
+	for i := range len(ids) {
+		discount, err := discountManager.newUserDiscount(ctx, ids[i], discountForms[i].UserAccountID, discountManager.DB, discountForms[i])
+		if err != nil {
+			return nil, err
+		}
+		discs = append(discs, discount)
+	}
+	return discs, nil
+}
+
+// ExportUserDiscountCampaignCSV writes a header and one row per code of the campaign.
+// Amounts are in major units and times in RFC 3339, empty when unset.
+func (discountManager *BuiltinUserDiscountManager[AccountID]) ExportUserDiscountCampaignCSV(ctx context.Context, cid uint64, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"code", "type", "value", "percentage", "max_value", "min_order_amount", "starts_at", "ends_at", "valid_count"})
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint64, 0, userDiscountCampaignBatchSize)
+	forms := make([]*UserDiscountForm[AccountID], 0, userDiscountCampaignBatchSize)
+	for skip := int64(0); ; skip += userDiscountCampaignBatchSize {
+		ids, forms, err = discountManager.DB.GetUserDiscountCampaignDiscounts(ctx, cid, ids[:0], forms[:0], skip, userDiscountCampaignBatchSize, QueueOrderAscending)
+		if err != nil {
+			return err
+		}
+		for _, form := range forms {
+			if err := writer.Write(userDiscountCSVRecord(form)); err != nil {
+				return err
+			}
+		}
+		if len(ids) < userDiscountCampaignBatchSize {
+			break
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func userDiscountCSVRecord[AccountID comparable](form *UserDiscountForm[AccountID]) []string {
+	record := make([]string, 9)
+	if form.Code != nil {
+		record[0] = *form.Code
+	}
+	if form.Type != nil {
+		record[1] = string(*form.Type)
+	}
+	if form.Value != nil {
+		record[2] = form.Value.Decimal()
+	}
+	if form.Percentage != nil {
+		record[3] = strconv.FormatFloat(*form.Percentage, 'f', -1, 64)
+	}
+	if form.MaxValue != nil {
+		record[4] = form.MaxValue.Decimal()
+	}
+	if form.MinOrderAmount != nil {
+		record[5] = form.MinOrderAmount.Decimal()
+	}
+	if form.StartsAt != nil && !form.StartsAt.IsZero() {
+		record[6] = form.StartsAt.Format(time.RFC3339)
+	}
+	if form.EndsAt != nil && !form.EndsAt.IsZero() {
+		record[7] = form.EndsAt.Format(time.RFC3339)
+	}
+	if form.ValidCount != nil {
+		record[8] = strconv.FormatInt(*form.ValidCount, 10)
+	}
+	return record
+}
+
+func (discountManager *BuiltinUserDiscountManager[AccountID]) GetUserDiscountCampaignReport(ctx context.Context, cid uint64) (*UserDiscountCampaignReport, error) {
+	report, err := discountManager.DB.GetUserDiscountCampaignReport(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+	if report.CodeCount != 0 {
+		report.RedemptionRate = float64(report.RedeemedCodeCount) / float64(report.CodeCount)
+	}
+	return &report, nil
+}
+
+func (discountManager *BuiltinUserDiscountManager[AccountID]) RemoveUserDiscountCampaign(ctx context.Context, cid uint64) error {
+	return discountManager.DB.RemoveUserDiscountCampaign(ctx, cid)
+}
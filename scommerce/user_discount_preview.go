@@ -0,0 +1,137 @@
+package scommerce
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrDiscountNotApplicable = errors.New("discount code does not apply to the shopping cart")
+
+type UserDiscountType string
+
+const (
+	UserDiscountTypeFixed        UserDiscountType = "fixed"         // Value is taken off the eligible subtotal
+	UserDiscountTypePercentage   UserDiscountType = "percentage"    // Percentage of the eligible subtotal is taken off
+	UserDiscountTypeFreeShipping UserDiscountType = "free_shipping" // the shipping cost is taken off
+)
+
+func (discountType UserDiscountType) IsValid() bool {
+	switch discountType {
+	case UserDiscountTypeFixed, UserDiscountTypePercentage, UserDiscountTypeFreeShipping:
+		return true
+	}
+	return false
+}
+
+// UserDiscountScope limits a discount to some items and shipping methods, an empty list doesn't limit it.
+type UserDiscountScope struct {
+	ProductIDs        []uint64 `json:"product_ids,omitempty"`
+	CategoryIDs       []uint64 `json:"category_ids,omitempty"` // subcategories are included
+	ShippingMethodIDs []uint64 `json:"shipping_method_ids,omitempty"`
+}
+
+type UserDiscountReason string
+
+const (
+	UserDiscountReasonNotFound                  UserDiscountReason = "not_found"
+	UserDiscountReasonExhausted                 UserDiscountReason = "exhausted"
+	UserDiscountReasonAlreadyUsed               UserDiscountReason = "already_used"
+	UserDiscountReasonNotStarted                UserDiscountReason = "not_started"
+	UserDiscountReasonExpired                   UserDiscountReason = "expired"
+	UserDiscountReasonBelowMinOrderAmount       UserDiscountReason = "below_min_order_amount"
+	UserDiscountReasonNoEligibleItems           UserDiscountReason = "no_eligible_items"
+	UserDiscountReasonShippingMethodNotEligible UserDiscountReason = "shipping_method_not_eligible"
+)
+
+// DiscountNotApplicableError is returned by UserShoppingCart.Order when the
+// discount code can't be redeemed on the cart.
+// It matches ErrDiscountNotApplicable with errors.Is.
+type DiscountNotApplicableError struct {
+	Reason UserDiscountReason `json:"reason"`
+}
+
+func (err *DiscountNotApplicableError) Error() string {
+	return ErrDiscountNotApplicable.Error() + ": " + string(err.Reason)
+}
+
+func (err *DiscountNotApplicableError) Unwrap() error {
+	return ErrDiscountNotApplicable
+}
+
+// UserDiscountPreview explains what a discount code would take off a shopping cart.
+// The amounts are zero when the code doesn't apply.
+type UserDiscountPreview struct {
+	DiscountID       uint64             `json:"discount_id"` // 0 when the code doesn't exist
+	Code             string             `json:"code"`
+	Type             UserDiscountType   `json:"type"`
+	Applicable       bool               `json:"applicable"`
+	Reason           UserDiscountReason `json:"reason,omitempty"` // why the code doesn't apply
+	Subtotal         Money              `json:"subtotal"`
+	EligibleSubtotal Money              `json:"eligible_subtotal"` // subtotal of the items in the scope of the discount
+	MinOrderAmount   Money              `json:"min_order_amount"`
+	Promotions       Money              `json:"promotions"`        // taken off the items before the code
+	Discount         Money              `json:"discount"`          // taken off the items
+	ShippingDiscount Money              `json:"shipping_discount"` // taken off the shipping cost
+}
+
+// Total is everything the code takes off the order.
+func (preview *UserDiscountPreview) Total() (Money, error) {
+	return preview.Discount.Add(preview.ShippingDiscount)
+}
+
+// PreviewDiscount evaluates the code against the cart with the same rules as UserShoppingCart.Order, without redeeming it.
+// shippingMethod may be nil, then codes limited to shipping methods don't apply and free shipping takes nothing off.
+// address is optional like for CalculateShippingRate. The promotions of the cart come first, the code takes off at most
+// what they leave.
+func (discountManager *BuiltinUserDiscountManager[AccountID]) PreviewDiscount(ctx context.Context, cart UserShoppingCart[AccountID], code string, shippingMethod ShippingMethod, address UserAddress[AccountID]) (*UserDiscountPreview, error) {
+	builtinCart, err := cart.ToBuiltinObject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sid, err := builtinCart.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var smid uint64 = 0
+	if shippingMethod != nil {
+		smid, err = shippingMethod.GetID(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	shippingCost, err := builtinCart.shippingCost(ctx, shippingMethod, address)
+	if err != nil {
+		return nil, err
+	}
+	preview, err := discountManager.DB.PreviewUserDiscount(ctx, code, sid, smid, shippingCost)
+	if err != nil {
+		return nil, err
+	}
+	promotions, err := builtinCart.CalculatePromotions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	preview.Promotions = NewMoney(0, preview.Subtotal.Currency)
+	if promotions.Total.IsPositive() {
+		preview.Promotions = promotions.Total
+	}
+	cmp, err := preview.Promotions.Cmp(preview.Subtotal)
+	if err != nil {
+		return nil, err
+	}
+	if cmp > 0 {
+		preview.Promotions = preview.Subtotal
+	}
+	left, err := preview.Subtotal.Sub(preview.Promotions)
+	if err != nil {
+		return nil, err
+	}
+	cmp, err = preview.Discount.Cmp(left)
+	if err != nil {
+		return nil, err
+	}
+	if cmp > 0 {
+		preview.Discount = left
+	}
+	return &preview, nil
+}
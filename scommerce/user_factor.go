@@ -1,9 +1,15 @@
 package scommerce
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 var _ UserFactorManager[any] = &BuiltinUserFactorManager[any]{}
@@ -19,27 +25,68 @@ type userFactorManagerDatabase[AccountID comparable] interface {
 }
 
 type BuiltinUserFactorManager[AccountID comparable] struct {
-	DB userFactorManagerDatabase[AccountID]
+	DB              userFactorManagerDatabase[AccountID]
+	FS              FileStorage
+	InvoiceRenderer InvoiceRenderer
+	InvoiceSeller   InvoiceParty
+}
+
+// FactorLine is an ordered product item as it was invoiced.
+type FactorLine struct {
+	ProductItemID uint64          `json:"product_item_id"`
+	SKU           string          `json:"sku"`
+	Name          string          `json:"name"`
+	UnitPrice     Money           `json:"unit_price"`
+	Quantity      int64           `json:"quantity"`
+	Attributes    json.RawMessage `json:"attributes,omitempty"`
+	Discount      Money           `json:"discount"` // share of the promotions and the discount code
+	Tax           Money           `json:"tax"`      // inclusive and exclusive taxes of the line
+	Total         Money           `json:"total"`    // UnitPrice * Quantity - Discount + exclusive taxes
+}
+
+// InvoiceNumber numbers the factors issued in a year from 1 without gaps.
+type InvoiceNumber struct {
+	Year     int    `json:"year"`
+	Sequence uint64 `json:"sequence"`
+}
+
+// String formats the number like "2025-000042".
+func (number InvoiceNumber) String() string {
+	sequence := strconv.FormatUint(number.Sequence, 10)
+	if len(sequence) < 6 {
+		sequence = strings.Repeat("0", 6-len(sequence)) + sequence
+	}
+	return strconv.Itoa(number.Year) + "-" + sequence
 }
 
 type UserFactorForm[AccountID comparable] struct {
-	ID            uint64           `json:"id"`
-	UserAccountID AccountID        `json:"account_id"`
-	Products      *json.RawMessage `json:"products,omitempty"`
-	Discount      *float64         `json:"discount,omitempty"`
-	Tax           *float64         `json:"tax,omitempty"`
-	AmountPaid    *float64         `json:"amount_paid,omitempty"`
+	ID            uint64         `json:"id"`
+	UserAccountID AccountID      `json:"account_id"`
+	OrderID       *uint64        `json:"order_id,omitempty"`
+	InvoiceNumber *InvoiceNumber `json:"invoice_number,omitempty"`
+	IssuedAt      *time.Time     `json:"issued_at,omitempty"`
+	Lines         *[]FactorLine  `json:"lines,omitempty"`
+	Discount      *Money         `json:"discount,omitempty"`
+	Tax           *Money         `json:"tax,omitempty"`
+	TaxLines      *[]TaxLine     `json:"tax_lines,omitempty"`
+	AmountPaid    *Money         `json:"amount_paid,omitempty"`
 }
 
 type BuiltinUserFactor[AccountID comparable] struct {
 	UserFactorForm[AccountID]
-	DB userFactorDatabase[AccountID] `json:"-"`
-	MU sync.RWMutex                  `json:"-"`
+	DB              userFactorDatabase[AccountID] `json:"-"`
+	FS              FileStorage                   `json:"-"`
+	InvoiceRenderer InvoiceRenderer               `json:"-"` // nil renders with a BuiltinInvoiceRenderer
+	InvoiceSeller   InvoiceParty                  `json:"-"`
+	MU              sync.RWMutex                  `json:"-"`
 }
 
-func NewBuiltinUserFactorManager[AccountID comparable](db userFactorManagerDatabase[AccountID]) *BuiltinUserFactorManager[AccountID] {
+func NewBuiltinUserFactorManager[AccountID comparable](db userFactorManagerDatabase[AccountID], fs FileStorage, invoiceRenderer InvoiceRenderer, invoiceSeller InvoiceParty) *BuiltinUserFactorManager[AccountID] {
 	return &BuiltinUserFactorManager[AccountID]{
-		DB: db,
+		DB:              db,
+		FS:              fs,
+		InvoiceRenderer: invoiceRenderer,
+		InvoiceSeller:   invoiceSeller,
 	}
 }
 
@@ -49,7 +96,10 @@ func (factorManager *BuiltinUserFactorManager[AccountID]) newUserFactor(ctx cont
 			ID:            fid,
 			UserAccountID: aid,
 		},
-		DB: db,
+		DB:              db,
+		FS:              factorManager.FS,
+		InvoiceRenderer: factorManager.InvoiceRenderer,
+		InvoiceSeller:   factorManager.InvoiceSeller,
 	}
 	if err := factor.Init(ctx); err != nil {
 		return nil, err
@@ -87,6 +137,14 @@ func (factorManager *BuiltinUserFactorManager[AccountID]) GetFactorWithID(ctx co
 	return factorManager.newUserFactor(ctx, fid, factorForm.UserAccountID, factorManager.DB, &factorForm)
 }
 
+func (factorManager *BuiltinUserFactorManager[AccountID]) GetFactorWithInvoiceNumber(ctx context.Context, number InvoiceNumber, fill bool) (UserFactor[AccountID], error) {
+	fid, err := factorManager.DB.GetUserFactorIDWithInvoiceNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return factorManager.GetFactorWithID(ctx, fid, fill)
+}
+
 func (factorManager *BuiltinUserFactorManager[AccountID]) GetUserFactors(ctx context.Context, account UserAccount[AccountID], factors []UserFactor[AccountID], skip int64, limit int64, queueOrder QueueOrder) ([]UserFactor[AccountID], error) {
 	var err error = nil
 	aid, err := account.GetID(ctx)
@@ -145,11 +203,96 @@ func (factor *BuiltinUserFactor[AccountID]) GetUserAccountID(ctx context.Context
 	return factor.UserAccountID, nil
 }
 
-func (factor *BuiltinUserFactor[AccountID]) GetProducts(ctx context.Context) (json.RawMessage, error) {
+// GetOrderID returns the order the factor was issued for, 0 when the order was removed.
+func (factor *BuiltinUserFactor[AccountID]) GetOrderID(ctx context.Context) (uint64, error) {
 	factor.MU.RLock()
-	if factor.Products != nil {
+	if factor.OrderID != nil {
 		defer factor.MU.RUnlock()
-		return *factor.Products, nil
+		return *factor.OrderID, nil
+	}
+	factor.MU.RUnlock()
+	id, err := factor.GetID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	form, err := factor.UserFactorForm.Clone(ctx)
+	if err != nil {
+		return 0, err
+	}
+	oid, err := factor.DB.GetUserFactorOrderID(ctx, &form, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := factor.ApplyFormObject(ctx, &form); err != nil {
+		return 0, err
+	}
+	factor.MU.Lock()
+	defer factor.MU.Unlock()
+	factor.OrderID = &oid
+	return oid, nil
+}
+
+func (factor *BuiltinUserFactor[AccountID]) GetInvoiceNumber(ctx context.Context) (InvoiceNumber, error) {
+	factor.MU.RLock()
+	if factor.InvoiceNumber != nil {
+		defer factor.MU.RUnlock()
+		return *factor.InvoiceNumber, nil
+	}
+	factor.MU.RUnlock()
+	id, err := factor.GetID(ctx)
+	if err != nil {
+		return InvoiceNumber{}, err
+	}
+	form, err := factor.UserFactorForm.Clone(ctx)
+	if err != nil {
+		return InvoiceNumber{}, err
+	}
+	number, err := factor.DB.GetUserFactorInvoiceNumber(ctx, &form, id)
+	if err != nil {
+		return InvoiceNumber{}, err
+	}
+	if err := factor.ApplyFormObject(ctx, &form); err != nil {
+		return InvoiceNumber{}, err
+	}
+	factor.MU.Lock()
+	defer factor.MU.Unlock()
+	factor.InvoiceNumber = &number
+	return number, nil
+}
+
+func (factor *BuiltinUserFactor[AccountID]) GetIssuedAt(ctx context.Context) (time.Time, error) {
+	factor.MU.RLock()
+	if factor.IssuedAt != nil {
+		defer factor.MU.RUnlock()
+		return *factor.IssuedAt, nil
+	}
+	factor.MU.RUnlock()
+	id, err := factor.GetID(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	form, err := factor.UserFactorForm.Clone(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	issuedAt, err := factor.DB.GetUserFactorIssuedAt(ctx, &form, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := factor.ApplyFormObject(ctx, &form); err != nil {
+		return time.Time{}, err
+	}
+	factor.MU.Lock()
+	defer factor.MU.Unlock()
+	factor.IssuedAt = &issuedAt
+	return issuedAt, nil
+}
+
+func (factor *BuiltinUserFactor[AccountID]) GetLines(ctx context.Context) ([]FactorLine, error) {
+	factor.MU.RLock()
+	if factor.Lines != nil {
+		defer factor.MU.RUnlock()
+		return *factor.Lines, nil
 	}
 	factor.MU.RUnlock()
 	id, err := factor.GetID(ctx)
@@ -160,7 +303,7 @@ func (factor *BuiltinUserFactor[AccountID]) GetProducts(ctx context.Context) (js
 	if err != nil {
 		return nil, err
 	}
-	products, err := factor.DB.GetUserFactorProducts(ctx, &form, id)
+	lines, err := factor.DB.GetUserFactorLines(ctx, &form, id)
 	if err != nil {
 		return nil, err
 	}
@@ -169,11 +312,11 @@ func (factor *BuiltinUserFactor[AccountID]) GetProducts(ctx context.Context) (js
 	}
 	factor.MU.Lock()
 	defer factor.MU.Unlock()
-	factor.Products = &products
-	return products, nil
+	factor.Lines = &lines
+	return lines, nil
 }
 
-func (factor *BuiltinUserFactor[AccountID]) SetProducts(ctx context.Context, products json.RawMessage) error {
+func (factor *BuiltinUserFactor[AccountID]) SetLines(ctx context.Context, lines []FactorLine) error {
 	id, err := factor.GetID(ctx)
 	if err != nil {
 		return err
@@ -182,7 +325,7 @@ func (factor *BuiltinUserFactor[AccountID]) SetProducts(ctx context.Context, pro
 	if err != nil {
 		return err
 	}
-	if err := factor.DB.SetUserFactorProducts(ctx, &form, id, products); err != nil {
+	if err := factor.DB.SetUserFactorLines(ctx, &form, id, lines); err != nil {
 		return err
 	}
 	if err := factor.ApplyFormObject(ctx, &form); err != nil {
@@ -190,11 +333,11 @@ func (factor *BuiltinUserFactor[AccountID]) SetProducts(ctx context.Context, pro
 	}
 	factor.MU.Lock()
 	defer factor.MU.Unlock()
-	factor.Products = &products
+	factor.Lines = &lines
 	return nil
 }
 
-func (factor *BuiltinUserFactor[AccountID]) GetDiscount(ctx context.Context) (float64, error) {
+func (factor *BuiltinUserFactor[AccountID]) GetDiscount(ctx context.Context) (Money, error) {
 	factor.MU.RLock()
 	if factor.Discount != nil {
 		defer factor.MU.RUnlock()
@@ -203,18 +346,18 @@ func (factor *BuiltinUserFactor[AccountID]) GetDiscount(ctx context.Context) (fl
 	factor.MU.RUnlock()
 	id, err := factor.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := factor.UserFactorForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	discount, err := factor.DB.GetUserFactorDiscount(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := factor.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	factor.MU.Lock()
 	defer factor.MU.Unlock()
@@ -222,7 +365,7 @@ func (factor *BuiltinUserFactor[AccountID]) GetDiscount(ctx context.Context) (fl
 	return discount, nil
 }
 
-func (factor *BuiltinUserFactor[AccountID]) SetDiscount(ctx context.Context, discount float64) error {
+func (factor *BuiltinUserFactor[AccountID]) SetDiscount(ctx context.Context, discount Money) error {
 	id, err := factor.GetID(ctx)
 	if err != nil {
 		return err
@@ -243,7 +386,7 @@ func (factor *BuiltinUserFactor[AccountID]) SetDiscount(ctx context.Context, dis
 	return nil
 }
 
-func (factor *BuiltinUserFactor[AccountID]) GetTax(ctx context.Context) (float64, error) {
+func (factor *BuiltinUserFactor[AccountID]) GetTax(ctx context.Context) (Money, error) {
 	factor.MU.RLock()
 	if factor.Tax != nil {
 		defer factor.MU.RUnlock()
@@ -252,18 +395,18 @@ func (factor *BuiltinUserFactor[AccountID]) GetTax(ctx context.Context) (float64
 	factor.MU.RUnlock()
 	id, err := factor.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := factor.UserFactorForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	tax, err := factor.DB.GetUserFactorTax(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := factor.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	factor.MU.Lock()
 	defer factor.MU.Unlock()
@@ -271,7 +414,7 @@ func (factor *BuiltinUserFactor[AccountID]) GetTax(ctx context.Context) (float64
 	return tax, nil
 }
 
-func (factor *BuiltinUserFactor[AccountID]) SetTax(ctx context.Context, tax float64) error {
+func (factor *BuiltinUserFactor[AccountID]) SetTax(ctx context.Context, tax Money) error {
 	id, err := factor.GetID(ctx)
 	if err != nil {
 		return err
@@ -292,7 +435,56 @@ func (factor *BuiltinUserFactor[AccountID]) SetTax(ctx context.Context, tax floa
 	return nil
 }
 
-func (factor *BuiltinUserFactor[AccountID]) GetAmountPaid(ctx context.Context) (float64, error) {
+func (factor *BuiltinUserFactor[AccountID]) GetTaxLines(ctx context.Context) ([]TaxLine, error) {
+	factor.MU.RLock()
+	if factor.TaxLines != nil {
+		defer factor.MU.RUnlock()
+		return *factor.TaxLines, nil
+	}
+	factor.MU.RUnlock()
+	id, err := factor.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := factor.UserFactorForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := factor.DB.GetUserFactorTaxLines(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := factor.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	factor.MU.Lock()
+	defer factor.MU.Unlock()
+	factor.TaxLines = &lines
+	return lines, nil
+}
+
+func (factor *BuiltinUserFactor[AccountID]) SetTaxLines(ctx context.Context, lines []TaxLine) error {
+	id, err := factor.GetID(ctx)
+	if err != nil {
+		return err
+	}
+	form, err := factor.UserFactorForm.Clone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := factor.DB.SetUserFactorTaxLines(ctx, &form, id, lines); err != nil {
+		return err
+	}
+	if err := factor.ApplyFormObject(ctx, &form); err != nil {
+		return err
+	}
+	factor.MU.Lock()
+	defer factor.MU.Unlock()
+	factor.TaxLines = &lines
+	return nil
+}
+
+func (factor *BuiltinUserFactor[AccountID]) GetAmountPaid(ctx context.Context) (Money, error) {
 	factor.MU.RLock()
 	if factor.AmountPaid != nil {
 		defer factor.MU.RUnlock()
@@ -301,18 +493,18 @@ func (factor *BuiltinUserFactor[AccountID]) GetAmountPaid(ctx context.Context) (
 	factor.MU.RUnlock()
 	id, err := factor.GetID(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	form, err := factor.UserFactorForm.Clone(ctx)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	amountPaid, err := factor.DB.GetUserFactorAmountPaid(ctx, &form, id)
 	if err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	if err := factor.ApplyFormObject(ctx, &form); err != nil {
-		return 0, err
+		return Money{}, err
 	}
 	factor.MU.Lock()
 	defer factor.MU.Unlock()
@@ -320,7 +512,7 @@ func (factor *BuiltinUserFactor[AccountID]) GetAmountPaid(ctx context.Context) (
 	return amountPaid, nil
 }
 
-func (factor *BuiltinUserFactor[AccountID]) SetAmountPaid(ctx context.Context, amountPaid float64) error {
+func (factor *BuiltinUserFactor[AccountID]) SetAmountPaid(ctx context.Context, amountPaid Money) error {
 	id, err := factor.GetID(ctx)
 	if err != nil {
 		return err
@@ -341,6 +533,221 @@ func (factor *BuiltinUserFactor[AccountID]) SetAmountPaid(ctx context.Context, a
 	return nil
 }
 
+// GetCreditNotes returns the credit notes which reverse the factor.
+func (factor *BuiltinUserFactor[AccountID]) GetCreditNotes(ctx context.Context) ([]CreditNote[AccountID], error) {
+	id, err := factor.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := factor.UserFactorForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	creditNotes, err := factor.DB.GetUserFactorCreditNotes(ctx, &form, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := factor.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	return creditNotes, nil
+}
+
+// GetPayments returns the captured payment legs of the order the factor was issued for.
+func (factor *BuiltinUserFactor[AccountID]) GetPayments(ctx context.Context) ([]OrderPayment[AccountID], error) {
+	id, err := factor.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := factor.UserFactorForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := factor.DB.GetUserFactorPayments(ctx, &form, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := factor.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// GetInvoice collects what the invoice of the factor shows, the buyer is the account with the shipping address of the order.
+func (factor *BuiltinUserFactor[AccountID]) GetInvoice(ctx context.Context) (*Invoice, error) {
+	id, err := factor.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	number, err := factor.GetInvoiceNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	issuedAt, err := factor.GetIssuedAt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orderID, err := factor.GetOrderID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := factor.GetLines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	taxLines, err := factor.GetTaxLines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	discount, err := factor.GetDiscount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tax, err := factor.GetTax(ctx)
+	if err != nil {
+		return nil, err
+	}
+	total, err := factor.GetAmountPaid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form, err := factor.UserFactorForm.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buyer, err := factor.DB.GetUserFactorBuyer(ctx, &form, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := factor.ApplyFormObject(ctx, &form); err != nil {
+		return nil, err
+	}
+	taxes, err := newInvoiceTaxes(taxLines)
+	if err != nil {
+		return nil, err
+	}
+
+	// the shipping is what the lines don't account for, before its discount
+	var subtotal, linesDiscount, linesTotal Money
+	for _, line := range lines {
+		if subtotal, err = subtotal.Add(line.UnitPrice.Mul(line.Quantity)); err != nil {
+			return nil, err
+		}
+		if linesDiscount, err = linesDiscount.Add(line.Discount); err != nil {
+			return nil, err
+		}
+		if linesTotal, err = linesTotal.Add(line.Total); err != nil {
+			return nil, err
+		}
+	}
+	shippingDiscount, err := discount.Sub(linesDiscount)
+	if err != nil {
+		return nil, err
+	}
+	shipping, err := total.Sub(linesTotal)
+	if err != nil {
+		return nil, err
+	}
+	if shipping, err = shipping.Add(shippingDiscount); err != nil {
+		return nil, err
+	}
+
+	factor.MU.RLock()
+	seller := factor.InvoiceSeller
+	factor.MU.RUnlock()
+
+	return &Invoice{
+		FactorID: id,
+		Number:   number,
+		IssuedAt: issuedAt,
+		OrderID:  orderID,
+		Seller:   seller,
+		Buyer:    buyer,
+		Lines:    lines,
+		Taxes:    taxes,
+		TaxLines: taxLines,
+		Subtotal: subtotal,
+		Discount: discount,
+		Shipping: shipping,
+		Tax:      tax,
+		Total:    total,
+	}, nil
+}
+
+// ExportUBLInvoice writes the invoice of the factor as a UBL 2.1 Invoice.
+func (factor *BuiltinUserFactor[AccountID]) ExportUBLInvoice(ctx context.Context, w io.Writer) error {
+	invoice, err := factor.GetInvoice(ctx)
+	if err != nil {
+		return err
+	}
+	return WriteUBLInvoice(w, invoice)
+}
+
+// ExportUBLCreditNote writes a credit note issued against the factor as a UBL 2.1 CreditNote.
+func (factor *BuiltinUserFactor[AccountID]) ExportUBLCreditNote(ctx context.Context, creditNote *CreditNote[AccountID], w io.Writer) error {
+	invoice, err := factor.GetInvoice(ctx)
+	if err != nil {
+		return err
+	}
+	return WriteUBLCreditNote(w, invoice, creditNote)
+}
+
+// GetInvoiceDocument opens the invoice document of the factor in the file storage, rendering it the first time.
+func (factor *BuiltinUserFactor[AccountID]) GetInvoiceDocument(ctx context.Context, format InvoiceFormat) (FileReadCloser, error) {
+	number, err := factor.GetInvoiceNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token := invoiceDocumentToken(number, format)
+	exists, err := factor.FS.Exists(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return factor.RenderInvoiceDocument(ctx, format)
+	}
+	return factor.FS.Open(ctx, token)
+}
+
+// RenderInvoiceDocument renders the invoice document again, replacing the stored one, and opens it.
+func (factor *BuiltinUserFactor[AccountID]) RenderInvoiceDocument(ctx context.Context, format InvoiceFormat) (FileReadCloser, error) {
+	invoice, err := factor.GetInvoice(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	factor.MU.RLock()
+	renderer := factor.InvoiceRenderer
+	factor.MU.RUnlock()
+	if renderer == nil {
+		renderer = NewBuiltinInvoiceRenderer()
+	}
+
+	// render before touching the stored document so a failure keeps it
+	document := bytes.Buffer{}
+	if err := renderer.RenderInvoice(ctx, invoice, format, &document); err != nil {
+		return nil, err
+	}
+
+	// write next to the stored document and swap it in, so a failed write keeps the old one
+	token := invoiceDocumentToken(invoice.Number, format)
+	tempToken := token + ".tmp"
+	file, err := factor.FS.Create(ctx, tempToken)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := document.WriteTo(file); err != nil {
+		return nil, errors.Join(err, file.Close(), factor.FS.Delete(ctx, tempToken))
+	}
+	if err := file.Close(); err != nil {
+		return nil, errors.Join(err, factor.FS.Delete(ctx, tempToken))
+	}
+	if err := factor.FS.Rename(ctx, tempToken, token); err != nil {
+		return nil, errors.Join(err, factor.FS.Delete(ctx, tempToken))
+	}
+	return factor.FS.Open(ctx, token)
+}
+
 func (factor *BuiltinUserFactor[AccountID]) Init(ctx context.Context) error {
 	return nil
 }
@@ -369,8 +776,17 @@ func (factor *BuiltinUserFactor[AccountID]) ApplyFormObject(ctx context.Context,
 	if form.UserAccountID != zeroAccountID {
 		factor.UserAccountID = form.UserAccountID
 	}
-	if form.Products != nil {
-		factor.Products = form.Products
+	if form.OrderID != nil {
+		factor.OrderID = form.OrderID
+	}
+	if form.InvoiceNumber != nil {
+		factor.InvoiceNumber = form.InvoiceNumber
+	}
+	if form.IssuedAt != nil {
+		factor.IssuedAt = form.IssuedAt
+	}
+	if form.Lines != nil {
+		factor.Lines = form.Lines
 	}
 	if form.Discount != nil {
 		factor.Discount = form.Discount
@@ -378,6 +794,9 @@ func (factor *BuiltinUserFactor[AccountID]) ApplyFormObject(ctx context.Context,
 	if form.Tax != nil {
 		factor.Tax = form.Tax
 	}
+	if form.TaxLines != nil {
+		factor.TaxLines = form.TaxLines
+	}
 	if form.AmountPaid != nil {
 		factor.AmountPaid = form.AmountPaid
 	}
@@ -0,0 +1,91 @@
+package scommerce
+
+import (
+	"time"
+)
+
+type WalletTransactionType string
+
+const (
+	WalletTransactionOpeningBalance      WalletTransactionType = "opening_balance" // wallet balance which existed before the ledger
+	WalletTransactionCharge              WalletTransactionType = "charge"
+	WalletTransactionFine                WalletTransactionType = "fine"
+	WalletTransactionAdjustment          WalletTransactionType = "adjustment" // SetWalletCurrency and SetPenalty
+	WalletTransactionTransfer            WalletTransactionType = "transfer"
+	WalletTransactionCheckout            WalletTransactionType = "checkout"
+	WalletTransactionSubscriptionRenewal WalletTransactionType = "subscription_renewal"
+	WalletTransactionRefund              WalletTransactionType = "refund" // money of an order paid back to the wallet
+)
+
+// Ledgers on the other side of a wallet transaction. Every journal sums to zero across its ledgers.
+const (
+	WalletLedgerWallet      = "wallet"
+	WalletLedgerExternal    = "external"
+	WalletLedgerPenalties   = "penalties"
+	WalletLedgerAdjustments = "adjustments"
+	WalletLedgerSales       = "sales"
+)
+
+// Counterparty returns the ledger which balances a wallet transaction of the type.
+func (transactionType WalletTransactionType) Counterparty() string {
+	switch transactionType {
+	case WalletTransactionFine:
+		return WalletLedgerPenalties
+	case WalletTransactionAdjustment, WalletTransactionOpeningBalance:
+		return WalletLedgerAdjustments
+	case WalletTransactionTransfer:
+		return WalletLedgerWallet
+	case WalletTransactionCheckout, WalletTransactionSubscriptionRenewal, WalletTransactionRefund:
+		return WalletLedgerSales
+	}
+	return WalletLedgerExternal
+}
+
+const (
+	WalletReferenceOrder        = "order"
+	WalletReferenceSubscription = "subscription"
+	WalletReferenceFactor       = "factor"
+)
+
+// WalletEntry describes why a wallet is mutated, pass it to ChargeWallet, Fine, SetPenalty, SetWalletCurrency
+// or TransferCurrency. A nil entry records the operation without reference, actor or description.
+type WalletEntry[AccountID comparable] struct {
+	Type          WalletTransactionType `json:"type,omitempty"` // overrides the type of the operation when not empty
+	ReferenceType string                `json:"reference_type,omitempty"`
+	ReferenceID   string                `json:"reference_id,omitempty"`
+	ActorID       *AccountID            `json:"actor_id,omitempty"`
+	Description   string                `json:"description,omitempty"`
+}
+
+// WalletTransaction is the wallet side of an append-only journal, Amount is signed.
+type WalletTransaction[AccountID comparable] struct {
+	ID             uint64                `json:"id"`
+	JournalID      uint64                `json:"journal_id"`
+	AccountID      AccountID             `json:"account_id"`
+	Type           WalletTransactionType `json:"type"`
+	Amount         Money                 `json:"amount"`
+	BalanceAfter   Money                 `json:"balance_after"`
+	Counterparty   string                `json:"counterparty"` // ledger of the other side, WalletLedgerWallet for transfers
+	CounterpartyID *AccountID            `json:"counterparty_id,omitempty"`
+	ReferenceType  string                `json:"reference_type,omitempty"`
+	ReferenceID    string                `json:"reference_id,omitempty"`
+	ActorID        *AccountID            `json:"actor_id,omitempty"`
+	Description    string                `json:"description,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+}
+
+type WalletDiscrepancy[AccountID comparable] struct {
+	AccountID     AccountID `json:"account_id"`
+	Balance       Money     `json:"balance"`        // stored wallet
+	LedgerBalance Money     `json:"ledger_balance"` // sum of the wallet transactions
+}
+
+type WalletReconciliation[AccountID comparable] struct {
+	CheckedAt          time.Time                      `json:"checked_at"`
+	Discrepancies      []WalletDiscrepancy[AccountID] `json:"discrepancies"`
+	UnbalancedJournals []uint64                       `json:"unbalanced_journals"` // journals which don't sum to zero
+}
+
+func (reconciliation *WalletReconciliation[AccountID]) IsBalanced() bool {
+	return len(reconciliation.Discrepancies) == 0 && len(reconciliation.UnbalancedJournals) == 0
+}